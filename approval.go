@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// apiTimeout ограничивает время запроса к серверу API (план, ход запуска).
+const apiTimeout = 10 * time.Second
+
+// Действия над файлами: так они описываются в плане пробного запуска
+// (подробность причины dry_run), и по ним утверждённый план сверяется
+// при выполнении. Перемещение по ярусам — pendingTier и каталог яруса.
+const (
+	pendingDelete          = "удаление"
+	pendingTier            = "перемещение в "
+	pendingCompress        = "сжатие"
+	pendingDeleteDir       = "удаление каталога"
+	pendingQuotaDelete     = "удаление по квоте подкаталога"
+	pendingDeleteLink      = "удаление ссылки"
+	pendingPurge           = "окончательное удаление"
+	pendingPurgeQuarantine = "удаление из карантина"
+)
+
+// approved сообщает, можно ли выполнить действие action над файлом path:
+// без утверждённого плана можно всё, с планом — только то, что в нём есть.
+func (o processOptions) approved(path, action string) bool {
+	return o.Approved == nil || o.Approved[path] == action
+}
+
+// pendingPlan — план, ожидающий утверждения (serve с scan_only).
+// Идентификатор меняется вместе с содержимым плана, поэтому утверждается
+// именно тот план, который видел оператор.
+type pendingPlan struct {
+	ID string `json:"id"`
+	PlanRecord
+}
+
+// newPendingPlan строит ожидающий план и его идентификатор: хеш
+// конфигурации и списка файлов с действиями.
+func newPendingPlan(plan PlanRecord) *pendingPlan {
+	var files []string
+	for _, f := range plan.Folders {
+		for _, p := range f.Files {
+			files = append(files, p.Path+"\x00"+p.Action)
+		}
+	}
+	slices.Sort(files)
+	return &pendingPlan{ID: sha256Hex([]byte(plan.ConfigHash + "\x00" + strings.Join(files, "\n")))[:16], PlanRecord: plan}
+}
+
+// approvedFiles возвращает действия плана по путям файлов.
+func (p *pendingPlan) approvedFiles() map[string]string {
+	files := make(map[string]string)
+	for _, f := range p.Folders {
+		for _, pf := range f.Files {
+			files[pf.Path] = pf.Action
+		}
+	}
+	return files
+}
+
+// validateScanOnly проверяет параметры режима scan_only: план строится по
+// списку оставленных файлов, которого нет в режиме экономии памяти.
+func validateScanOnly(cfg Config) error {
+	switch {
+	case !cfg.API.ScanOnly:
+		return nil
+	case cfg.API.ScanInterval <= 0:
+		return errors.New("интервал сканирования (--api-scan-interval) должен быть больше нуля")
+	case cfg.API.FullScanInterval < 0:
+		return errors.New("интервал полного сканирования (--api-full-scan-interval) не может быть отрицательным")
+	case cfg.LowMemory:
+		return errors.New("scan_only нельзя сочетать с --low-memory: в этом режиме не собирается список файлов плана")
+	}
+	return nil
+}
+
+// folderFingerprint возвращает отпечаток папки — время изменения и размер
+// каталога: они меняются, когда в папке появляются, исчезают или
+// переименовываются файлы. Папки, правила которых затрагивают подкаталоги,
+// отпечатка не имеют и пересканируются всегда.
+func folderFingerprint(folder string, rule folderRule) (string, bool) {
+	if rule.Recursive || rule.Unit == unitDir || rule.SubdirQuotaSize > 0 || rule.SubdirQuotaFiles > 0 {
+		return "", false
+	}
+	info, err := os.Stat(folder)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size()), true
+}
+
+// scanLoop поддерживает план в режиме scan_only: каждые scan_interval
+// пересканирует папки, изменившиеся с прошлого сканирования, а каждые
+// full_scan_interval — все папки, чтобы в план попадали и файлы, которые
+// просто состарились.
+func (s *apiServer) scanLoop() {
+	ticker := time.NewTicker(s.cfg.API.ScanInterval)
+	defer ticker.Stop()
+	var lastFull time.Time
+	for {
+		full := time.Since(lastFull) >= s.cfg.API.FullScanInterval
+		if full {
+			lastFull = time.Now()
+		}
+		s.scan(full)
+		select {
+		case <-ticker.C:
+		case <-s.rescan:
+		}
+	}
+}
+
+// scan пробно обрабатывает изменившиеся папки (все при full) и обновляет
+// ожидающий план. Сканирование не пересекается с запусками по запросам API.
+func (s *apiServer) scan(full bool) {
+	s.run.Lock()
+	defer s.run.Unlock()
+	only := make(map[string]bool)
+	prints := make(map[string]string)
+	for _, spec := range s.cfg.Folders {
+		fp, ok := folderFingerprint(spec.Path, s.cfg.folderRule(spec))
+		if _, scanned := s.scanned[spec.Path]; full || !ok || !scanned || fp != s.prints[spec.Path] {
+			only[spec.Path] = true
+		}
+		if ok {
+			prints[spec.Path] = fp
+		}
+	}
+	if len(only) == 0 {
+		return
+	}
+	cfg := s.cfg
+	cfg.DryRun, cfg.scan, cfg.only = true, true, only
+	// Сканирования идут постоянно, поэтому в журнал попадают только
+	// предупреждения и ошибки.
+	cfg.Show, cfg.LogLevel, cfg.Verbose, cfg.EventsFile = "", "warn", false, ""
+	summary, err := performRun(cfg)
+	if err != nil {
+		log.Printf("[%s] Ошибка сканирования для плана: %v\n", errorCode(err, CodeConfig), err)
+		return
+	}
+	for _, res := range summary.Folders {
+		s.scanned[res.Folder] = res
+		if res.Err == nil {
+			s.prints[res.Folder] = prints[res.Folder]
+		} else {
+			delete(s.prints, res.Folder)
+		}
+	}
+	merged := RunSummary{Start: summary.Start, Instance: summary.Instance, RunID: summary.RunID, DryRun: true}
+	for _, spec := range sortedFolderSpecs(s.cfg.Folders) {
+		if res, ok := s.scanned[spec.Path]; ok {
+			merged.Folders = append(merged.Folders, res)
+		}
+	}
+	plan := newPendingPlan(newPlanRecord(s.cfg, merged))
+	s.mu.Lock()
+	changed := s.plan == nil || s.plan.ID != plan.ID
+	s.plan = plan
+	s.mu.Unlock()
+	if changed {
+		planned := 0
+		for _, f := range plan.Folders {
+			planned += len(f.Files)
+		}
+		log.Printf("План %s ожидает утверждения: к обработке %d файлов (папок просканировано: %d)\n", plan.ID, planned, len(summary.Folders))
+	}
+}
+
+// pendingPlan возвращает ожидающий утверждения план или nil, если первое
+// сканирование ещё не завершено.
+func (s *apiServer) pendingPlan() *pendingPlan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.plan
+}
+
+// approve выполняет ожидающий план с идентификатором id: удаляются только
+// файлы плана и только если они по-прежнему подходят под правила. Вызывается
+// под s.run. После выполнения все папки сканируются заново.
+func (s *apiServer) approve(rec *apiAuditRecord, id string) (RunSummary, error) {
+	plan := s.pendingPlan()
+	if plan == nil {
+		return RunSummary{}, withCode(CodeNoPlan, errors.New("план ещё не построен: идёт первое сканирование"))
+	}
+	rec.Plan = id
+	if plan.ID != id {
+		return RunSummary{}, withCode(CodePlanStale, fmt.Errorf("план %s устарел, ожидает утверждения план %s", id, plan.ID))
+	}
+	log.Printf("Выполнение плана %s, утверждённого %s (%s)\n", id, rec.Caller, rec.Remote)
+	cfg := s.cfg
+	// Утверждение плана и есть подтверждение очистки новых папок.
+	cfg.approved, cfg.FirstRunConfirm = plan.approvedFiles(), true
+	summary, err := performRun(cfg)
+	s.mu.Lock()
+	s.plan = nil
+	s.mu.Unlock()
+	clear(s.scanned)
+	clear(s.prints)
+	select {
+	case s.rescan <- struct{}{}:
+	default:
+	}
+	return summary, err
+}
+
+// apiBaseURL возвращает адрес сервера API; адрес без хоста (":8443")
+// запрашивается на localhost.
+func apiBaseURL(opts APIOptions) string {
+	addr := opts.Listen
+	if host, port, err := net.SplitHostPort(addr); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	scheme := "http"
+	if opts.TLSCert != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + addr
+}
+
+// apiClient возвращает HTTP-клиент для запроса к серверу API: сертификат
+// сервера из той же конфигурации считается доверенным вместе с системными,
+// чтобы approve и status работали с самоподписанным сертификатом.
+func apiClient(opts APIOptions) (*http.Client, error) {
+	client := &http.Client{Timeout: apiTimeout}
+	if opts.TLSCert == "" {
+		return client, nil
+	}
+	pem, err := os.ReadFile(opts.TLSCert)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pool.AppendCertsFromPEM(pem)
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	return client, nil
+}
+
+// runApprove реализует подкоманду approve: выводит план, ожидающий
+// утверждения у cleanup serve с scan_only, а с --plan-id утверждает его.
+func runApprove(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("approve", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup approve --api-listen :8443 [--api-token TOKEN] [--plan-id ID] [flags] [config.yml]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cfg.API.Listen == "" {
+		fmt.Fprintln(os.Stderr, "не задан адрес API (--api-listen)")
+		return 1
+	}
+	client, err := apiClient(cfg.API)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка чтения сертификата сервера: %v\n", err)
+		return 1
+	}
+	method, path, body := http.MethodGet, "/api/v1/plan", []byte(nil)
+	if opts.planID != "" {
+		// Выполнение плана длится столько же, сколько запуск очистки.
+		client.Timeout = 0
+		method, path = http.MethodPost, "/api/v1/plan/approve"
+		body, _ = json.Marshal(map[string]string{"id": opts.planID})
+	}
+	req, err := http.NewRequest(method, apiBaseURL(cfg.API)+path, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cfg.API.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.API.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка запроса к API: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		fmt.Fprintf(os.Stderr, "API ответило %s: %s\n", resp.Status, strings.TrimSpace(string(data)))
+		return 1
+	}
+	if opts.planID != "" {
+		var rec RunRecord
+		if err := json.NewDecoder(resp.Body).Decode(&rec); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка разбора ответа API: %v\n", err)
+			return 1
+		}
+		fmt.Printf("План %s выполнен: просмотрено %d файлов, удалено %d (%s)\n", opts.planID, rec.Total, rec.Deleted, formatBytes(rec.Freed))
+		return 0
+	}
+	var plan pendingPlan
+	if err := json.NewDecoder(resp.Body).Decode(&plan); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка разбора ответа API: %v\n", err)
+		return 1
+	}
+	writePendingPlan(os.Stdout, plan)
+	return 0
+}
+
+// writePendingPlan выводит ожидающий план для человека: папки, файлы
+// с действиями и команду утверждения.
+func writePendingPlan(w io.Writer, plan pendingPlan) {
+	fmt.Fprintf(w, "План %s (%s, сканирование %s)\n", plan.ID, plan.Host, plan.Start.Local().Format(time.RFC3339))
+	planned := 0
+	for _, f := range plan.Folders {
+		if f.Error != "" {
+			fmt.Fprintf(w, "%s: ошибка: %s\n", f.Folder, f.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%s: к обработке %d из %d файлов (%s)\n", f.Folder, f.Planned, f.Total, formatBytes(f.PlannedFreed))
+		for _, pf := range f.Files {
+			fmt.Fprintf(w, "  %s: %s\n", pf.Action, pf.Path)
+		}
+		planned += len(f.Files)
+	}
+	if planned == 0 {
+		fmt.Fprintln(w, "Файлов к обработке нет")
+		return
+	}
+	fmt.Fprintf(w, "Утвердить: cleanup approve --plan-id %s\n", plan.ID)
+}
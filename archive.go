@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// archiveDisposal собирает файлы папки в архив tar.gz за день в каталоге
+// архива. Архив пишется в каталог промежуточных файлов запуска и переносится
+// в каталог архива после того, как записан целиком и сброшен на диск (fsync);
+// только затем файлы удаляются из папки. Так при аварийном завершении файлы
+// остаются на месте, а недописанный архив удаляется при следующем запуске.
+// Потоки удаления пишут в архив по очереди.
+type archiveDisposal struct {
+	folder, dir string
+	work        *workDir
+
+	mu      sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	pending []archivedFile // записаны в архив, удаляются в finish
+	err     error          // после ошибки записи архив не дописывается
+}
+
+// archivedFile — файл, записанный в архив, его размер в папке и исходные
+// метаданные для манифеста архива.
+type archivedFile struct {
+	path string
+	size int64
+	meta fileMeta
+}
+
+func (a *archiveDisposal) dispose(path string) (string, error) {
+	if err := protection.check(path); err != nil {
+		return "", err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return "", fmt.Errorf("архив не дописывается после ошибки: %v", a.err)
+	}
+	if a.file == nil {
+		f, err := a.work.create(a.dir, "archive-*.tar.gz.partial")
+		if os.IsNotExist(err) {
+			if err = os.MkdirAll(a.dir, 0755); err == nil {
+				f, err = a.work.create(a.dir, "archive-*.tar.gz.partial")
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		a.file = f
+		a.gz = gzip.NewWriter(f)
+		a.tw = tar.NewWriter(a.gz)
+	}
+	meta, err := readMeta(path)
+	if err != nil {
+		return "", err
+	}
+	size, err := a.append(path, meta)
+	if err != nil {
+		a.err = err
+		return "", err
+	}
+	a.pending = append(a.pending, archivedFile{path: path, size: size, meta: meta})
+	return "", nil
+}
+
+// append дописывает файл в архив и возвращает его размер. Заголовок в
+// формате PAX сохраняет владельца, права, время доступа и изменения
+// и расширенные атрибуты файла.
+func (a *archiveDisposal) append(path string, meta fileMeta) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return 0, err
+	}
+	hdr.Name = filepath.ToSlash(folderRelative(a.folder, path))
+	hdr.Format, hdr.AccessTime = tar.FormatPAX, meta.ATime
+	for name, value := range meta.XAttrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords["SCHILY.xattr."+name] = string(value)
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return 0, err
+	}
+	_, err = io.CopyN(a.tw, src, hdr.Size)
+	return hdr.Size, err
+}
+
+func (*archiveDisposal) failure() (ErrorCode, string) {
+	return CodeArchiveFailed, "Ошибка архивирования файла "
+}
+
+// record ничего не учитывает: файлы учитываются в finish, после переноса
+// архива в каталог архива.
+func (*archiveDisposal) record(*FolderResult, string, string, int64) {}
+
+// finish дописывает конец архива, переносит его в каталог архива под именем
+// <дата>.tar.gz (если папка уже очищалась сегодня — <дата>-2.tar.gz и так
+// далее) и удаляет из папки записанные в архив файлы; их размер учитывается
+// в освобождённом месте папки (сам архив занимает место в каталоге архива).
+// При ошибке архив удаляется, а файлы остаются на месте.
+func (a *archiveDisposal) finish(res *FolderResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return
+	}
+	partial := a.file.Name()
+	defer os.Remove(partial)
+	err := a.tw.Close()
+	if err2 := a.gz.Close(); err == nil {
+		err = err2
+	}
+	if err2 := a.file.Sync(); err == nil {
+		err = err2
+	}
+	if err2 := a.file.Close(); err == nil {
+		err = err2
+	}
+	var target string
+	if err == nil {
+		target, err = a.commit(partial, time.Now())
+	}
+	if err != nil {
+		res.fileError(a.dir, CodeArchiveFailed, fmt.Sprintf("Ошибка записи архива в %s (файлы оставлены в папке: %d)", a.dir, len(a.pending)), err)
+		return
+	}
+	for _, f := range a.pending {
+		if err := removeFile(f.path); err != nil {
+			res.fileError(f.path, CodeDeleteFailed, "Ошибка удаления файла "+f.path, err)
+			continue
+		}
+		f.meta.Time, f.meta.Target, f.meta.Member = time.Now(), target, filepath.ToSlash(folderRelative(a.folder, f.path))
+		if err := appendManifest(a.dir, f.meta); err != nil {
+			events.emitCode(EventError, CodeManifestWrite, res.Folder, f.path, "Ошибка записи манифеста %s: %v", filepath.Join(a.dir, manifestName), err)
+		}
+		events.emit(EventAction, res.Folder, f.path, "Файл %s перенесён в архив %s", f.path, target)
+		affected.add(res.Folder, f.path, "archived", target, f.size)
+		res.Archived++
+		res.Freed += f.size
+	}
+}
+
+// commit переносит записанный архив в каталог архива под свободным именем.
+func (a *archiveDisposal) commit(partial string, now time.Time) (string, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return "", err
+	}
+	date := now.Format("2006-01-02")
+	for n := 1; ; n++ {
+		name := date + ".tar.gz"
+		if n > 1 {
+			name = fmt.Sprintf("%s-%d.tar.gz", date, n)
+		}
+		target := filepath.Join(a.dir, name)
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		return target, moveFile(partial, target)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsTimeout ограничивает время ожидания ответов AWS API и сервиса метаданных.
+const awsTimeout = 15 * time.Second
+
+// imdsEndpoint — адрес сервиса метаданных экземпляра EC2.
+const imdsEndpoint = "http://169.254.169.254"
+
+// awsCredentials содержит ключи доступа AWS.
+type awsCredentials struct {
+	AccessKey string
+	SecretKey string
+	Token     string
+}
+
+// loadAWSCredentials берёт ключи из стандартных переменных окружения,
+// а при их отсутствии — из роли экземпляра EC2 через IMDSv2.
+func loadAWSCredentials() (awsCredentials, error) {
+	creds := awsCredentials{
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Token:     os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKey != "" && creds.SecretKey != "" {
+		return creds, nil
+	}
+	return loadIMDSCredentials()
+}
+
+// imdsGet выполняет GET-запрос к сервису метаданных с токеном IMDSv2.
+func imdsGet(client *http.Client, token, path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, imdsEndpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервис метаданных ответил %s на %s", resp.Status, path)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// loadIMDSCredentials получает временные ключи роли экземпляра EC2.
+func loadIMDSCredentials() (awsCredentials, error) {
+	client := &http.Client{Timeout: 2 * time.Second}
+	req, err := http.NewRequest(http.MethodPut, imdsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, errors.New("ключи AWS не заданы в окружении, а сервис метаданных EC2 недоступен")
+	}
+	tokenBytes, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	token := string(tokenBytes)
+
+	role, err := imdsGet(client, token, "/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	roleName := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if roleName == "" {
+		return awsCredentials{}, errors.New("экземпляру EC2 не назначена роль IAM")
+	}
+	data, err := imdsGet(client, token, "/latest/meta-data/iam/security-credentials/"+roleName)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var doc struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return awsCredentials{}, fmt.Errorf("неверный ответ сервиса метаданных: %w", err)
+	}
+	return awsCredentials{AccessKey: doc.AccessKeyId, SecretKey: doc.SecretAccessKey, Token: doc.Token}, nil
+}
+
+// awsRegion возвращает регион из переменных окружения AWS.
+func awsRegion() string {
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		return r
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// hmacSHA256 вычисляет HMAC-SHA256.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sha256Hex возвращает SHA-256 в шестнадцатеричном виде.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signAWSRequest подписывает запрос по схеме AWS Signature Version 4.
+// Подписываются заголовок Host и все заголовки, уже установленные в запросе.
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	signAWSRequestHash(req, sha256Hex(body), creds, region, service, now)
+}
+
+// signAWSRequestHash подписывает запрос с заранее вычисленным SHA-256 тела,
+// чтобы большие файлы не приходилось читать в память целиком.
+func signAWSRequestHash(req *http.Request, payloadHash string, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := now.UTC().Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	canonicalRequest, signedHeaders := awsCanonicalRequest(req, payloadHash)
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := awsStringToSign(canonicalRequest, amzDate, scope)
+	signature := awsSignature(creds.SecretKey, day, region, service, stringToSign)
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// awsCanonicalRequest возвращает каноническую форму запроса SigV4 и список
+// подписываемых заголовков: Host и все заголовки, установленные в запросе,
+// кроме самой подписи (Authorization) — запрос можно подписать повторно.
+func awsCanonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		if name = strings.ToLower(name); name != "authorization" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := awsEscapePath(req.URL.Path)
+	if path == "" {
+		path = "/"
+	}
+	return strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+// awsStringToSign возвращает строку для подписи SigV4 с областью scope.
+func awsStringToSign(canonicalRequest, amzDate, scope string) string {
+	return "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+}
+
+// awsSignature подписывает строку stringToSign ключом, выведенным из
+// секретного ключа для дня, региона и сервиса.
+func awsSignature(secret, day, region, service, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalQuery формирует отсортированную строку параметров запроса для подписи.
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape кодирует строку по правилам RFC 3986, которых требует SigV4.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsEscapePath кодирует путь по сегментам между «/» функцией awsEscape:
+// SigV4 подписывает путь, в котором закодированы все символы, кроме
+// незарезервированных и «/», а S3 принимает «+» в пути как пробел. Тот же
+// путь передаётся в запросе, иначе подпись не совпадёт.
+func awsEscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = awsEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// doAWSRequest подписывает и выполняет запрос к AWS API, возвращая тело ответа.
+func doAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string) ([]byte, error) {
+	signAWSRequest(req, body, creds, region, service, time.Now())
+	client := &http.Client{Timeout: awsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return data, fmt.Errorf("%s ответил %s: %s", service, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseBackfill разбирает сроки постепенной очистки из строки папки,
+// например "365,180" или "365d,180d".
+func parseBackfill(s string) ([]int, error) {
+	var steps []int
+	for _, part := range strings.Split(s, ",") {
+		days, err := parseRetentionDays(part)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, days)
+	}
+	return steps, nil
+}
+
+// validateBackfill проверяет, что сроки backfill убывают: каждый следующий
+// запуск удаляет файлы, оставленные предыдущим, а не наоборот.
+func validateBackfill(steps []int) error {
+	for i, days := range steps {
+		if days <= 0 {
+			return fmt.Errorf("backfill: срок %d должен быть положительным", days)
+		}
+		if i > 0 && days >= steps[i-1] {
+			return fmt.Errorf("backfill: сроки должны убывать, %d после %d", days, steps[i-1])
+		}
+	}
+	return nil
+}
+
+// backfillStep возвращает номер шага постепенной очистки для очередного
+// запуска папки или -1, если сроки backfill не действуют: они заданы не
+// для папки, все шаги пройдены или папка очищалась до того, как для неё
+// задали backfill (её файлы уже удалены по обычному сроку).
+func backfillStep(rule folderRule, st folderState, known bool) int {
+	if st.BackfillStep >= len(rule.Backfill) || known && st.BackfillStep == 0 {
+		return -1
+	}
+	return st.BackfillStep
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// CanaryCheck — ожидания для папки-канарейки: она обрабатывается первой,
+// и остальные папки очищаются, только если её результат укладывается
+// в ожидания. Удобно для поэтапного выката конфигурации на парк хостов.
+// В строке папки задаётся параметрами canary и canary_*, в объекте папки —
+// объектом или просто canary: true (проверяется только отсутствие ошибок).
+type CanaryCheck struct {
+	MinDeleted *int      `yaml:"min_deleted"` // не меньше стольких удалений
+	MaxDeleted *int      `yaml:"max_deleted"` // не больше стольких удалений
+	MaxFreed   *ByteSize `yaml:"max_freed"`   // не больше такого объёма
+
+	enabled bool
+}
+
+// UnmarshalYAML принимает canary: true|false или объект с ожиданиями.
+func (c *CanaryCheck) UnmarshalYAML(unmarshal func(any) error) error {
+	var on bool
+	if err := unmarshal(&on); err == nil {
+		*c = CanaryCheck{enabled: on}
+		return nil
+	}
+	type plain CanaryCheck
+	var check plain
+	if err := unmarshal(&check); err != nil {
+		return err
+	}
+	*c = CanaryCheck(check)
+	c.enabled = true
+	if c.MinDeleted != nil && c.MaxDeleted != nil && *c.MinDeleted > *c.MaxDeleted {
+		return fmt.Errorf("canary: min_deleted больше max_deleted")
+	}
+	return nil
+}
+
+// isCanary сообщает, является ли папка канарейкой.
+func (spec FolderSpec) isCanary() bool {
+	return spec.Canary != nil && spec.Canary.enabled
+}
+
+// canaryCheck возвращает ожидания папки-канарейки и помечает папку
+// канарейкой, если она ещё не помечена (параметры canary_* в строке папки).
+func (spec *FolderSpec) canaryCheck() *CanaryCheck {
+	if spec.Canary == nil {
+		spec.Canary = &CanaryCheck{enabled: true}
+	}
+	return spec.Canary
+}
+
+// verify проверяет результат папки-канарейки. В пробном запуске
+// сравниваются файлы, которые были бы удалены.
+func (c CanaryCheck) verify(res FolderResult) error {
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.Errors > 0 {
+		return fmt.Errorf("ошибок при обработке файлов: %d", res.Errors)
+	}
+	deleted, freed := res.Deleted+res.Planned, res.Freed+res.PlannedFreed
+	if c.MinDeleted != nil && deleted < *c.MinDeleted {
+		return fmt.Errorf("удалено файлов %d, ожидалось не меньше %d", deleted, *c.MinDeleted)
+	}
+	if c.MaxDeleted != nil && deleted > *c.MaxDeleted {
+		return fmt.Errorf("удалено файлов %d, ожидалось не больше %d", deleted, *c.MaxDeleted)
+	}
+	if c.MaxFreed != nil && freed > int64(*c.MaxFreed) {
+		return fmt.Errorf("освобождено %s, ожидалось не больше %s", formatBytes(freed), formatBytes(int64(*c.MaxFreed)))
+	}
+	return nil
+}
+
+// canariesFirst переставляет папки-канарейки в начало списка,
+// сохраняя порядок внутри групп.
+func canariesFirst(specs []FolderSpec) []FolderSpec {
+	slices.SortStableFunc(specs, func(a, b FolderSpec) int {
+		switch {
+		case a.isCanary() == b.isCanary():
+			return 0
+		case a.isCanary():
+			return -1
+		default:
+			return 1
+		}
+	})
+	return specs
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cloudWatchBatch — сколько метрик отправляется одним вызовом PutMetricData.
+const cloudWatchBatch = 20
+
+// Ограничения PutLogEvents: событий и байт в одном вызове (к размеру
+// каждого события добавляется cloudWatchEventOverhead байт).
+const (
+	cloudWatchLogBatchCount = 10000
+	cloudWatchLogBatchBytes = 1 << 20
+	cloudWatchEventOverhead = 26
+)
+
+// cloudWatchMaxEvents — сколько событий запуска отправляется в CloudWatch
+// Logs; остальные только подсчитываются, чтобы очистка огромной папки не
+// держала в памяти и не отправляла миллионы событий.
+const cloudWatchMaxEvents = 10000
+
+// CloudWatchOptions описывает параметры отправки данных в AWS CloudWatch.
+type CloudWatchOptions struct {
+	Namespace  string `yaml:"namespace"`
+	Region     string `yaml:"region"`
+	Dimensions string `yaml:"dimensions"` // "Имя=Значение,Имя2=Значение2"
+	LogGroup   string `yaml:"log_group"`
+	LogStream  string `yaml:"log_stream"`
+}
+
+// cloudWatchDimension — измерение метрики CloudWatch.
+type cloudWatchDimension struct {
+	Name  string
+	Value string
+}
+
+// cloudWatchDatum — одно значение метрики CloudWatch.
+type cloudWatchDatum struct {
+	Name       string
+	Value      float64
+	Unit       string
+	Dimensions []cloudWatchDimension
+}
+
+// parseDimensions разбирает строку вида "Имя=Значение,Имя2=Значение2".
+func parseDimensions(s string) ([]cloudWatchDimension, error) {
+	var dims []cloudWatchDimension
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("неверное измерение CloudWatch %q, ожидается Имя=Значение", part)
+		}
+		dims = append(dims, cloudWatchDimension{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	return dims, nil
+}
+
+// publishCloudWatch отправляет метрики запуска в CloudWatch и, если задана
+// группа журналов, запись о запуске в CloudWatch Logs.
+func publishCloudWatch(opts CloudWatchOptions, summary RunSummary) error {
+	region := opts.Region
+	if region == "" {
+		region = awsRegion()
+	}
+	if region == "" {
+		return errors.New("не задан регион AWS (--cloudwatch-region или AWS_REGION)")
+	}
+	dims, err := parseDimensions(opts.Dimensions)
+	if err != nil {
+		return err
+	}
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return err
+	}
+
+	if opts.Namespace != "" {
+		if err := putMetricData(creds, region, opts.Namespace, cloudWatchData(summary, dims)); err != nil {
+			return fmt.Errorf("PutMetricData: %w", err)
+		}
+	}
+	if opts.LogGroup != "" {
+		if err := putRunLogEvent(creds, region, opts, summary); err != nil {
+			return fmt.Errorf("CloudWatch Logs: %w", err)
+		}
+	}
+	return nil
+}
+
+// cloudWatchData строит набор метрик запуска: общие и по каждой папке.
+func cloudWatchData(summary RunSummary, dims []cloudWatchDimension) []cloudWatchDatum {
+	failed := summary.FailedFolders()
+	data := []cloudWatchDatum{
+		{Name: "FilesFound", Value: float64(summary.Total), Unit: "Count", Dimensions: dims},
+		{Name: "FilesDeleted", Value: float64(summary.Deleted), Unit: "Count", Dimensions: dims},
+		{Name: "BytesFreed", Value: float64(summary.Freed), Unit: "Bytes", Dimensions: dims},
+		{Name: "FoldersFailed", Value: float64(failed), Unit: "Count", Dimensions: dims},
+		{Name: "RunDuration", Value: summary.Duration.Seconds(), Unit: "Seconds", Dimensions: dims},
+	}
+	if rec := resourceRecord(summary); rec != nil {
+		data = append(data,
+			cloudWatchDatum{Name: "CPUTime", Value: rec.UserCPUSeconds + rec.SystemCPUSeconds, Unit: "Seconds", Dimensions: dims},
+			cloudWatchDatum{Name: "MaxRSS", Value: float64(rec.MaxRSS), Unit: "Bytes", Dimensions: dims},
+			cloudWatchDatum{Name: "IOReadBytes", Value: float64(rec.ReadBytes), Unit: "Bytes", Dimensions: dims},
+			cloudWatchDatum{Name: "IOWriteBytes", Value: float64(rec.WriteBytes), Unit: "Bytes", Dimensions: dims},
+			cloudWatchDatum{Name: "Syscalls", Value: float64(rec.Syscalls), Unit: "Count", Dimensions: dims},
+			cloudWatchDatum{Name: "FilesPerSecond", Value: rec.FilesPerSecond, Unit: "Count/Second", Dimensions: dims},
+		)
+	}
+	for _, f := range summary.Folders {
+		folderDims := append(append([]cloudWatchDimension{}, dims...), cloudWatchDimension{Name: "Folder", Value: f.Folder})
+		data = append(data,
+			cloudWatchDatum{Name: "FilesFound", Value: float64(f.Total), Unit: "Count", Dimensions: folderDims},
+			cloudWatchDatum{Name: "FilesDeleted", Value: float64(f.Deleted), Unit: "Count", Dimensions: folderDims},
+			cloudWatchDatum{Name: "BytesFreed", Value: float64(f.Freed), Unit: "Bytes", Dimensions: folderDims},
+		)
+	}
+	return data
+}
+
+// putMetricData вызывает CloudWatch PutMetricData через Query API пачками по cloudWatchBatch.
+func putMetricData(creds awsCredentials, region, namespace string, data []cloudWatchDatum) error {
+	endpoint := "https://monitoring." + region + ".amazonaws.com/"
+	for start := 0; start < len(data); start += cloudWatchBatch {
+		end := min(start+cloudWatchBatch, len(data))
+		form := url.Values{}
+		form.Set("Action", "PutMetricData")
+		form.Set("Version", "2010-08-01")
+		form.Set("Namespace", namespace)
+		for i, d := range data[start:end] {
+			prefix := "MetricData.member." + strconv.Itoa(i+1) + "."
+			form.Set(prefix+"MetricName", d.Name)
+			form.Set(prefix+"Value", strconv.FormatFloat(d.Value, 'f', -1, 64))
+			form.Set(prefix+"Unit", d.Unit)
+			for j, dim := range d.Dimensions {
+				dimPrefix := prefix + "Dimensions.member." + strconv.Itoa(j+1) + "."
+				form.Set(dimPrefix+"Name", dim.Name)
+				form.Set(dimPrefix+"Value", dim.Value)
+			}
+		}
+		body := []byte(form.Encode())
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		if _, err := doAWSRequest(req, body, creds, region, "monitoring"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callCloudWatchLogs вызывает действие JSON API CloudWatch Logs.
+func callCloudWatchLogs(creds awsCredentials, region, action string, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://logs."+region+".amazonaws.com/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	return doAWSRequest(req, body, creds, region, "logs")
+}
+
+// cloudWatchLogEvent — событие журнала CloudWatch Logs.
+type cloudWatchLogEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// cloudWatchLogBatches делит события журнала на пачки для PutLogEvents
+// в пределах cloudWatchLogBatchCount событий и cloudWatchLogBatchBytes байт.
+func cloudWatchLogBatches(list []cloudWatchLogEvent) [][]cloudWatchLogEvent {
+	var batches [][]cloudWatchLogEvent
+	start, size := 0, 0
+	for i, ev := range list {
+		n := len(ev.Message) + cloudWatchEventOverhead
+		if i > start && (i-start == cloudWatchLogBatchCount || size+n > cloudWatchLogBatchBytes) {
+			batches = append(batches, list[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(list) {
+		batches = append(batches, list[start:])
+	}
+	return batches
+}
+
+// putRunLogEvent записывает в CloudWatch Logs события запуска, выводимые
+// в журнал (в том же JSON, что и файл событий), и итоги запуска последним
+// JSON-событием. Поток журнала создаётся при необходимости; по умолчанию он
+// называется по имени хоста.
+func putRunLogEvent(creds awsCredentials, region string, opts CloudWatchOptions, summary RunSummary) error {
+	stream := opts.LogStream
+	if stream == "" {
+		stream, _ = os.Hostname()
+	}
+	resp, err := callCloudWatchLogs(creds, region, "CreateLogStream", map[string]string{
+		"logGroupName":  opts.LogGroup,
+		"logStreamName": stream,
+	})
+	if err != nil && !bytes.Contains(resp, []byte("ResourceAlreadyExistsException")) {
+		return err
+	}
+
+	captured, dropped := events.takeCaptured()
+	list := make([]cloudWatchLogEvent, 0, len(captured)+1)
+	for _, ev := range captured {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		list = append(list, cloudWatchLogEvent{Timestamp: ev.Time.UnixMilli(), Message: string(data)})
+	}
+	if dropped > 0 {
+		events.emit(EventWarning, "", "", "В CloudWatch Logs не отправлено событий запуска: %d (отправляются первые %d)", dropped, cloudWatchMaxEvents)
+	}
+	// CloudWatch Logs ограничивает размер события 256 КБ, поэтому список
+	// оставленных файлов не передаётся, только количество по причинам.
+	message, err := json.Marshal(newRunRecord(summary, false))
+	if err != nil {
+		return err
+	}
+	list = append(list, cloudWatchLogEvent{Timestamp: time.Now().UnixMilli(), Message: string(message)})
+	for _, batch := range cloudWatchLogBatches(list) {
+		if _, err := callCloudWatchLogs(creds, region, "PutLogEvents", map[string]any{
+			"logGroupName":  opts.LogGroup,
+			"logStreamName": stream,
+			"logEvents":     batch,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
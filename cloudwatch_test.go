@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCloudWatchLogBatches(t *testing.T) {
+	small := make([]cloudWatchLogEvent, cloudWatchLogBatchCount+1)
+	big := []cloudWatchLogEvent{
+		{Message: strings.Repeat("x", cloudWatchLogBatchBytes/2)},
+		{Message: strings.Repeat("x", cloudWatchLogBatchBytes/2)},
+		{Message: "итоги"},
+	}
+	tests := []struct {
+		name  string
+		list  []cloudWatchLogEvent
+		sizes []int
+	}{
+		{"пусто", nil, nil},
+		{"одна пачка", small[:3], []int{3}},
+		{"предел числа событий", small, []int{cloudWatchLogBatchCount, 1}},
+		{"предел размера", big, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := cloudWatchLogBatches(tt.list)
+			if len(batches) != len(tt.sizes) {
+				t.Fatalf("пачек %d, want %d", len(batches), len(tt.sizes))
+			}
+			for i, b := range batches {
+				if len(b) != tt.sizes[i] {
+					t.Errorf("пачка %d: событий %d, want %d", i, len(b), tt.sizes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEventCapture(t *testing.T) {
+	sink := &eventSink{show: defaultShow()}
+	sink.capture(2)
+	sink.emit(EventSkip, "/a", "/a/f", "оставлен")
+	for range 3 {
+		sink.emit(EventAction, "/a", "/a/f", "удалён")
+	}
+	list, dropped := sink.takeCaptured()
+	if len(list) != 2 || dropped != 1 {
+		t.Errorf("накоплено %d, не поместилось %d, want 2 и 1: skip не выводится в журнал", len(list), dropped)
+	}
+}
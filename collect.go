@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// collectTimeout ограничивает время отправки записи о запуске на сервер сбора.
+const collectTimeout = 10 * time.Second
+
+// collectMaxBody ограничивает размер принимаемой записи о запуске.
+const collectMaxBody = 8 << 20
+
+// collectCompactEvery — как часто сервер сбора удаляет из хранилища записи
+// старше collect.retain.
+const collectCompactEvery = 24 * time.Hour
+
+// CollectOptions описывает отправку записей о запусках на сервер сбора
+// (агент) и хранение принятых записей (сервер cleanup collect).
+type CollectOptions struct {
+	URL    string        `yaml:"url"`    // адрес сервера сбора для агента
+	Token  string        `yaml:"token"`  // bearer-токен агента
+	Store  string        `yaml:"store"`  // файл записей сервера (JSON Lines)
+	Stale  time.Duration `yaml:"stale"`  // через сколько без запусков хост считается пропавшим
+	Plans  string        `yaml:"plans"`  // каталог планов пробных запусков сервера
+	Retain time.Duration `yaml:"retain"` // сколько хранить принятые записи (0 — бессрочно)
+}
+
+// sendReport отправляет запись о запуске на сервер сбора.
+func sendReport(opts CollectOptions, rec RunRecord) error {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(opts.URL, "/")+"/api/v1/reports", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	client := &http.Client{Timeout: collectTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("сервер сбора ответил %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// hostStatus — последнее известное состояние экземпляра cleanup на хосте.
+type hostStatus struct {
+	Host     string    `json:"host"`
+	Instance string    `json:"instance"`
+	LastRun  time.Time `json:"last_run"`
+	Status   string    `json:"status"` // ok, error или stale
+	Deleted  int       `json:"deleted"`
+	Freed    int64     `json:"freed_bytes"`
+	Errors   []string  `json:"errors,omitempty"`
+	Missing  []string  `json:"missing,omitempty"`
+	// ErrorCodes — сколько ошибок папок и файлов с каждым кодом
+	// в последнем запуске.
+	ErrorCodes map[ErrorCode]int `json:"error_codes,omitempty"`
+}
+
+// collectServer хранит принятые записи о запусках и последнее состояние
+// каждого хоста и экземпляра.
+type collectServer struct {
+	cfg Config
+
+	mu        sync.Mutex
+	latest    map[string]RunRecord // по хосту и экземпляру
+	compacted time.Time            // когда хранилище последний раз сжималось
+}
+
+// newCollectServer создаёт сервер, сжимает хранилище и загружает последние
+// записи из него.
+func newCollectServer(cfg Config) (*collectServer, error) {
+	s := &collectServer{cfg: cfg, latest: make(map[string]RunRecord)}
+	if err := s.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	records, err := readHistory(cfg.Collect.Store)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		s.remember(rec)
+	}
+	return s, nil
+}
+
+// compact удаляет из хранилища записи старше collect.retain. Последняя
+// запись каждого хоста и экземпляра остаётся независимо от возраста, иначе
+// пропавший хост исчез бы со страницы состояния, а не был отмечен stale.
+// Остальные строки переписываются без изменений, повреждённые отбрасываются.
+// Без хранения (retain 0) и без устаревших записей файл не переписывается.
+// Вызывается под s.mu или до запуска сервера.
+func (s *collectServer) compact(now time.Time) error {
+	s.compacted = now
+	if s.cfg.Collect.Retain <= 0 {
+		return nil
+	}
+	data, err := os.ReadFile(s.cfg.Collect.Store)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		line  []byte
+		key   string
+		start time.Time
+	}
+	var entries []entry
+	newest := make(map[string]time.Time)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var rec struct {
+			Host     string    `json:"host"`
+			Instance string    `json:"instance"`
+			Start    time.Time `json:"start"`
+		}
+		if json.Unmarshal(sc.Bytes(), &rec) != nil {
+			continue
+		}
+		key := rec.Host + "\x00" + rec.Instance
+		entries = append(entries, entry{line: slices.Clone(sc.Bytes()), key: key, start: rec.Start})
+		if rec.Start.After(newest[key]) {
+			newest[key] = rec.Start
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	cutoff := now.Add(-s.cfg.Collect.Retain)
+	var buf bytes.Buffer
+	dropped := 0
+	for _, e := range entries {
+		if e.start.Before(cutoff) && e.start.Before(newest[e.key]) {
+			dropped++
+			continue
+		}
+		buf.Write(e.line)
+		buf.WriteByte('\n')
+	}
+	if dropped == 0 && buf.Len() == len(data) {
+		return nil
+	}
+	if err := writeFileAtomic(s.cfg.Collect.Store, buf.Bytes()); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		log.Printf("Из %s удалено записей старше %s: %d\n", s.cfg.Collect.Store, s.cfg.Collect.Retain, dropped)
+	}
+	return nil
+}
+
+// remember обновляет последнее состояние по записи о запуске.
+func (s *collectServer) remember(rec RunRecord) {
+	key := rec.Host + "\x00" + rec.Instance
+	if prev, ok := s.latest[key]; !ok || rec.Start.After(prev.Start) {
+		s.latest[key] = rec
+	}
+}
+
+// statuses возвращает состояние всех хостов, упорядоченное по имени.
+func (s *collectServer) statuses(now time.Time) []hostStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []hostStatus
+	for _, rec := range s.latest {
+		st := hostStatus{Host: rec.Host, Instance: rec.Instance, LastRun: rec.Start, Status: "ok",
+			Deleted: rec.Deleted, Freed: rec.Freed, Missing: rec.Missing}
+		codes := make(map[ErrorCode]int)
+		for _, f := range rec.Folders {
+			if f.Error != "" {
+				st.Errors = append(st.Errors, f.Folder+": "+f.Error)
+				codes[f.ErrorCode]++
+			}
+			for code, n := range f.ErrorCodes {
+				codes[code] += n
+			}
+		}
+		if len(rec.Missing) > 0 {
+			codes[CodeFolderMissing] += len(rec.Missing)
+		}
+		if len(codes) > 0 {
+			st.ErrorCodes = codes
+		}
+		switch {
+		case s.cfg.Collect.Stale > 0 && now.Sub(rec.Start) > s.cfg.Collect.Stale:
+			st.Status = "stale"
+		case len(st.Errors) > 0 || len(st.Missing) > 0:
+			st.Status = "error"
+		}
+		out = append(out, st)
+	}
+	slices.SortFunc(out, func(a, b hostStatus) int {
+		if c := strings.Compare(a.Host, b.Host); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Instance, b.Instance)
+	})
+	return out
+}
+
+// dashboardTemplate — страница со сводным состоянием парка.
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"time":  func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html lang="ru"><head><meta charset="utf-8"><title>cleanup</title>
+<style>body{font-family:sans-serif}td,th{padding:2px 8px;text-align:left}.error{color:#b00}.stale{color:#a60}</style>
+</head><body>
+<h1>cleanup: состояние хостов</h1>
+<table>
+<tr><th>Хост</th><th>Экземпляр</th><th>Последний запуск</th><th>Состояние</th><th>Удалено</th><th>Освобождено</th><th>Проблемы</th></tr>
+{{range .}}<tr class="{{.Status}}"><td>{{.Host}}</td><td>{{.Instance}}</td><td>{{time .LastRun}}</td><td>{{.Status}}</td><td>{{.Deleted}}</td><td>{{bytes .Freed}}</td><td>{{range .Errors}}{{.}}<br>{{end}}{{range .Missing}}не найдена {{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// collectHandler возвращает обработчик сервера сбора:
+// POST /api/v1/reports — приём записи о запуске, POST и GET /api/v1/plans —
+// приём и выдача планов пробных запусков, GET /api/v1/hosts — состояние
+// хостов в JSON, GET / — страница состояния.
+func collectHandler(s *collectServer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	auth := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := apiCaller(s.cfg.API, r); !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, apiError{Error: "требуется аутентификация", Code: CodeUnauthorized})
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("POST /api/v1/reports", auth(func(w http.ResponseWriter, r *http.Request) {
+		var rec RunRecord
+		if err := json.NewDecoder(io.LimitReader(r.Body, collectMaxBody)).Decode(&rec); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "неверная запись о запуске: " + err.Error(), Code: CodeBadRequest})
+			return
+		}
+		if rec.Host == "" || rec.Start.IsZero() {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "в записи о запуске нет host или start", Code: CodeBadRequest})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := appendHistory(s.cfg.Collect.Store, rec); err != nil {
+			log.Printf("Ошибка записи в %s: %v\n", s.cfg.Collect.Store, err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "ошибка сохранения записи", Code: CodeStoreFailed})
+			return
+		}
+		s.remember(rec)
+		if now := time.Now(); now.Sub(s.compacted) >= collectCompactEvery {
+			if err := s.compact(now); err != nil {
+				log.Printf("Ошибка сжатия %s: %v\n", s.cfg.Collect.Store, err)
+			}
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	}))
+	mux.HandleFunc("POST /api/v1/plans", auth(func(w http.ResponseWriter, r *http.Request) {
+		var plan PlanRecord
+		if err := json.NewDecoder(io.LimitReader(r.Body, collectMaxBody)).Decode(&plan); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "неверный план: " + err.Error(), Code: CodeBadRequest})
+			return
+		}
+		if plan.Host == "" || plan.Start.IsZero() {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "в плане нет host или start", Code: CodeBadRequest})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := savePlan(s.cfg.Collect.Plans, plan); err != nil {
+			log.Printf("Ошибка записи плана в %s: %v\n", s.cfg.Collect.Plans, err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "ошибка сохранения плана", Code: CodeStoreFailed})
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	}))
+	mux.HandleFunc("GET /api/v1/plans", auth(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		plans, err := readPlans([]string{s.cfg.Collect.Plans})
+		s.mu.Unlock()
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Ошибка чтения планов из %s: %v\n", s.cfg.Collect.Plans, err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "ошибка чтения планов", Code: CodeStoreFailed})
+			return
+		}
+		writeJSON(w, http.StatusOK, latestPlans(plans))
+	}))
+	mux.HandleFunc("GET /api/v1/hosts", auth(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.statuses(time.Now()))
+	}))
+	mux.HandleFunc("GET /{$}", auth(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, s.statuses(time.Now())); err != nil {
+			log.Printf("Ошибка формирования страницы: %v\n", err)
+		}
+	}))
+	return mux
+}
+
+// runCollect реализует подкоманду collect: сервер, принимающий записи
+// о запусках от агентов (--collect-url) и показывающий состояние всех хостов.
+// Записи хранятся в формате истории запусков, поэтому к хранилищу применимы
+// подкоманды digest и forecast.
+func runCollect(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("collect", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup collect --api-listen :8443 --api-token TOKEN [--collect-store reports.jsonl] [flags]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := validateAPIOptions(cfg.API); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if cfg.Collect.Store == "" {
+		dir, err := stateDir()
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		cfg.Collect.Store = filepath.Join(dir, "reports.jsonl")
+	}
+	if cfg.Collect.Plans == "" {
+		cfg.Collect.Plans = filepath.Join(filepath.Dir(cfg.Collect.Store), "plans")
+	}
+	s, err := newCollectServer(cfg)
+	if err != nil {
+		log.Printf("Ошибка чтения %s: %v\n", cfg.Collect.Store, err)
+		return 1
+	}
+	srv := &http.Server{
+		Addr:              cfg.API.Listen,
+		Handler:           collectHandler(s),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.Default(),
+	}
+	if cfg.API.TLSCert != "" {
+		if srv.TLSConfig, err = apiTLSConfig(cfg.API); err != nil {
+			log.Printf("Ошибка настройки TLS: %v\n", err)
+			return 1
+		}
+		log.Printf("Сервер сбора ожидает записи на https://%s (хранилище %s)\n", cfg.API.Listen, cfg.Collect.Store)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Сервер сбора ожидает записи на http://%s (хранилище %s)\n", cfg.API.Listen, cfg.Collect.Store)
+		err = srv.ListenAndServe()
+	}
+	log.Printf("Ошибка сервера сбора: %v\n", err)
+	return 1
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectCompact(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "reports.jsonl")
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	records := []RunRecord{
+		{Host: "web-1", Start: now.AddDate(0, 0, -100)},
+		{Host: "web-1", Start: now.AddDate(0, 0, -1)},
+		// Хост давно не присылал записей: последняя остаётся для stale.
+		{Host: "web-2", Start: now.AddDate(0, 0, -200)},
+		{Host: "web-2", Start: now.AddDate(0, 0, -120)},
+	}
+	for _, rec := range records {
+		if err := appendHistory(store, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := defaultConfig()
+	cfg.Collect.Store = store
+	s := &collectServer{cfg: cfg, latest: make(map[string]RunRecord)}
+	if err := s.compact(now); err != nil {
+		t.Fatal(err)
+	}
+	left, err := readHistory(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 2 || !left[0].Start.Equal(records[1].Start) || !left[1].Start.Equal(records[3].Start) {
+		t.Errorf("в хранилище остались %v, want последние записи web-1 и web-2", left)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressedSuffix — расширение файлов, сжатых на месте (compress_days).
+const compressedSuffix = ".gz"
+
+// compressed сообщает, сжат ли уже файл name. У сжатого на месте файла
+// время создания — момент сжатия, поэтому его возраст отсчитывается только
+// от времени изменения, сохранённого от исходного файла.
+func (r folderRule) compressed(name string) bool {
+	return r.CompressDays > 0 && strings.HasSuffix(strings.ToLower(name), compressedSuffix)
+}
+
+// compressFile сжимает файл на месте, как logrotate: рядом создаётся
+// <имя>.gz с тем же временем изменения, а исходный файл удаляется только
+// после того, как сжатый файл записан и сброшен на диск. Сжатый файл
+// пишется в каталог промежуточных файлов work и затем переносится на место.
+// Возвращает путь и размер сжатого файла.
+func compressFile(file string, work *workDir) (string, int64, error) {
+	if err := protection.check(file); err != nil {
+		return "", 0, err
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	target := file + compressedSuffix
+	if _, err := os.Lstat(target); err == nil {
+		return "", 0, fmt.Errorf("%s уже существует", target)
+	}
+	dst, err := work.create(filepath.Dir(file), ".cleanup-*.gz.partial")
+	if err != nil {
+		return "", 0, err
+	}
+	partial := dst.Name()
+	gz := gzip.NewWriter(dst)
+	gz.Name, gz.ModTime = info.Name(), info.ModTime()
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(partial, info.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(partial, info.ModTime(), info.ModTime())
+	}
+	var size int64
+	if err == nil {
+		var out os.FileInfo
+		if out, err = os.Stat(partial); err == nil {
+			size = out.Size()
+		}
+	}
+	if err == nil {
+		err = moveFile(partial, target)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return "", 0, err
+	}
+	src.Close()
+	return target, size, removeFile(file)
+}
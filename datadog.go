@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// datadogTimeout ограничивает время ожидания Datadog API.
+const datadogTimeout = 10 * time.Second
+
+// DatadogOptions описывает параметры отправки данных в Datadog.
+// Используется либо HTTP API (API или APIKey), либо локальный агент DogStatsD (StatsD), либо оба.
+type DatadogOptions struct {
+	API    bool   `yaml:"api"` // отправлять в API; ключ берётся из api_key или DD_API_KEY
+	APIKey string `yaml:"api_key"`
+	Site   string `yaml:"site"`
+	StatsD string `yaml:"statsd"` // адрес агента, например 127.0.0.1:8125
+	Tags   string `yaml:"tags"`   // теги через запятую, например env:prod,team:ops
+}
+
+// datadogMetric — одна метрика для отправки в Datadog.
+type datadogMetric struct {
+	Name  string
+	Value float64
+	Tags  []string
+}
+
+// datadogTags разбирает список тегов через запятую.
+func datadogTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// datadogMetrics строит набор метрик запуска: общие и по каждой папке.
+// Значения по папкам — отдельные метрики cleanup.folder.*, чтобы сумма по
+// метрике (sum:cleanup.files_deleted{*}) не удваивала итог запуска.
+func datadogMetrics(summary RunSummary, tags []string) []datadogMetric {
+	failed := summary.FailedFolders()
+	metrics := []datadogMetric{
+		{Name: "cleanup.files_found", Value: float64(summary.Total), Tags: tags},
+		{Name: "cleanup.files_deleted", Value: float64(summary.Deleted), Tags: tags},
+		{Name: "cleanup.bytes_freed", Value: float64(summary.Freed), Tags: tags},
+		{Name: "cleanup.folders_failed", Value: float64(failed), Tags: tags},
+		{Name: "cleanup.run_duration_seconds", Value: summary.Duration.Seconds(), Tags: tags},
+	}
+	if rec := resourceRecord(summary); rec != nil {
+		metrics = append(metrics,
+			datadogMetric{Name: "cleanup.cpu_seconds", Value: rec.UserCPUSeconds + rec.SystemCPUSeconds, Tags: tags},
+			datadogMetric{Name: "cleanup.max_rss_bytes", Value: float64(rec.MaxRSS), Tags: tags},
+			datadogMetric{Name: "cleanup.io_read_bytes", Value: float64(rec.ReadBytes), Tags: tags},
+			datadogMetric{Name: "cleanup.io_write_bytes", Value: float64(rec.WriteBytes), Tags: tags},
+			datadogMetric{Name: "cleanup.syscalls", Value: float64(rec.Syscalls), Tags: tags},
+			datadogMetric{Name: "cleanup.files_per_second", Value: rec.FilesPerSecond, Tags: tags},
+		)
+	}
+	for _, f := range summary.Folders {
+		folderTags := append(append([]string{}, tags...), "folder:"+f.Folder)
+		metrics = append(metrics,
+			datadogMetric{Name: "cleanup.folder.files_found", Value: float64(f.Total), Tags: folderTags},
+			datadogMetric{Name: "cleanup.folder.files_deleted", Value: float64(f.Deleted), Tags: folderTags},
+			datadogMetric{Name: "cleanup.folder.bytes_freed", Value: float64(f.Freed), Tags: folderTags},
+		)
+	}
+	return metrics
+}
+
+// datadogEvent формирует заголовок, текст и тип события о запуске.
+func datadogEvent(summary RunSummary) (title, text, alertType string) {
+	title = "cleanup: удалено файлов " + fmt.Sprint(summary.Deleted)
+	alertType = "info"
+	var b strings.Builder
+	fmt.Fprintf(&b, "Файлов обнаружено: %d, удалено: %d, освобождено: %s, длительность: %s\n",
+		summary.Total, summary.Deleted, formatBytes(summary.Freed), summary.Duration.Round(time.Millisecond))
+	for _, f := range summary.Folders {
+		if f.Err != nil {
+			alertType = "error"
+			fmt.Fprintf(&b, "%s: ошибка: %v\n", f.Folder, f.Err)
+		} else {
+			fmt.Fprintf(&b, "%s: обнаружено %d, удалено %d, освобождено %s\n", f.Folder, f.Total, f.Deleted, formatBytes(f.Freed))
+		}
+	}
+	if alertType == "error" {
+		title = "cleanup: ошибки при обработке папок"
+	}
+	return title, b.String(), alertType
+}
+
+// publishDatadog отправляет метрики и событие о запуске в Datadog.
+func publishDatadog(opts DatadogOptions, summary RunSummary) error {
+	tags := datadogTags(opts.Tags)
+	var errs []string
+	if opts.StatsD != "" {
+		if err := sendDogStatsD(opts.StatsD, summary, tags); err != nil {
+			errs = append(errs, "DogStatsD: "+err.Error())
+		}
+	}
+	if opts.API || opts.APIKey != "" {
+		if opts.APIKey == "" {
+			errs = append(errs, "API: не задан ключ (--datadog-api-key или DD_API_KEY)")
+		} else if err := sendDatadogAPI(opts, summary, tags); err != nil {
+			errs = append(errs, "API: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sendDogStatsD отправляет метрики и событие агенту Datadog по UDP.
+func sendDogStatsD(addr string, summary RunSummary, tags []string) error {
+	conn, err := net.DialTimeout("udp", addr, datadogTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, m := range datadogMetrics(summary, tags) {
+		line := fmt.Sprintf("%s:%g|g", m.Name, m.Value)
+		if len(m.Tags) > 0 {
+			line += "|#" + strings.Join(m.Tags, ",")
+		}
+		if _, err := conn.Write([]byte(line)); err != nil {
+			return err
+		}
+	}
+	title, text, alertType := datadogEvent(summary)
+	text = strings.ReplaceAll(text, "\n", "\\n")
+	event := fmt.Sprintf("_e{%d,%d}:%s|%s|t:%s", len(title), len(text), title, text, alertType)
+	if len(tags) > 0 {
+		event += "|#" + strings.Join(tags, ",")
+	}
+	_, err = conn.Write([]byte(event))
+	return err
+}
+
+// postDatadog отправляет JSON в Datadog HTTP API.
+func postDatadog(opts DatadogOptions, path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	site := opts.Site
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://api."+site+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", opts.APIKey)
+	client := &http.Client{Timeout: datadogTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Datadog ответил %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// sendDatadogAPI отправляет метрики и событие через Datadog HTTP API.
+func sendDatadogAPI(opts DatadogOptions, summary RunSummary, tags []string) error {
+	host, _ := os.Hostname()
+	now := time.Now().Unix()
+	var series []map[string]any
+	for _, m := range datadogMetrics(summary, tags) {
+		series = append(series, map[string]any{
+			"metric": m.Name,
+			"type":   "gauge",
+			"points": [][]float64{{float64(now), m.Value}},
+			"host":   host,
+			"tags":   m.Tags,
+		})
+	}
+	if err := postDatadog(opts, "/api/v1/series", map[string]any{"series": series}); err != nil {
+		return err
+	}
+	title, text, alertType := datadogEvent(summary)
+	return postDatadog(opts, "/api/v1/events", map[string]any{
+		"title":            title,
+		"text":             text,
+		"alert_type":       alertType,
+		"host":             host,
+		"tags":             tags,
+		"source_type_name": "cleanup",
+	})
+}
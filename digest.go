@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// digestTimeout ограничивает время ожидания ответа на отправку сводки.
+const digestTimeout = 10 * time.Second
+
+// DigestOptions описывает параметры сводки по истории запусков.
+type DigestOptions struct {
+	Period  string `yaml:"period"`  // day или week
+	Webhook string `yaml:"webhook"` // URL для отправки сводки (JSON с полем text)
+}
+
+// digestPeriod возвращает длительность периода сводки.
+func digestPeriod(period string) (time.Duration, error) {
+	switch period {
+	case "day":
+		return 24 * time.Hour, nil
+	case "week":
+		return 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("неизвестный период сводки %q (допустимы day, week)", period)
+}
+
+// digestRow — итоги запусков одного экземпляра на одном хосте за период.
+type digestRow struct {
+	Host, Instance string
+	Runs           int
+	FailedRuns     int // запусков, в которых хотя бы одна папка завершилась ошибкой
+	Deleted        int
+	Freed          int64
+	Permission     int
+	Missing        []string
+	LastRun        time.Time
+}
+
+// buildDigest собирает итоги записей истории, начатых в [from, to),
+// по хостам и экземплярам.
+func buildDigest(records []RunRecord, from, to time.Time) []digestRow {
+	rows := make(map[string]*digestRow)
+	for _, rec := range records {
+		if rec.Start.Before(from) || !rec.Start.Before(to) {
+			continue
+		}
+		key := rec.Host + "\x00" + rec.Instance
+		row := rows[key]
+		if row == nil {
+			row = &digestRow{Host: rec.Host, Instance: rec.Instance}
+			rows[key] = row
+		}
+		row.Runs++
+		row.Deleted += rec.Deleted
+		row.Freed += rec.Freed
+		failed := false
+		for _, f := range rec.Folders {
+			row.Permission += f.PermissionDenied
+			if f.Error != "" {
+				failed = true
+			}
+		}
+		if failed {
+			row.FailedRuns++
+		}
+		for _, folder := range rec.Missing {
+			if !slices.Contains(row.Missing, folder) {
+				row.Missing = append(row.Missing, folder)
+			}
+		}
+		if rec.Start.After(row.LastRun) {
+			row.LastRun = rec.Start
+		}
+	}
+	var out []digestRow
+	for _, row := range rows {
+		out = append(out, *row)
+	}
+	slices.SortFunc(out, func(a, b digestRow) int {
+		if c := strings.Compare(a.Host, b.Host); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Instance, b.Instance)
+	})
+	return out
+}
+
+// formatDigest формирует текст сводки.
+func formatDigest(rows []digestRow, from, to time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cleanup: сводка за %s — %s\n", from.Format("2006-01-02 15:04"), to.Format("2006-01-02 15:04"))
+	if len(rows) == 0 {
+		fmt.Fprintln(&b, "Запусков за период нет")
+		return b.String()
+	}
+	var runs, failed, deleted int
+	var freed int64
+	for _, row := range rows {
+		runs += row.Runs
+		failed += row.FailedRuns
+		deleted += row.Deleted
+		freed += row.Freed
+		fmt.Fprintf(&b, "%s/%s: запусков %d (с ошибками %d), удалено %d, освобождено %s, последний запуск %s\n",
+			row.Host, row.Instance, row.Runs, row.FailedRuns, row.Deleted, formatBytes(row.Freed), row.LastRun.Format("2006-01-02 15:04"))
+		if row.Permission > 0 {
+			fmt.Fprintf(&b, "  отказано в доступе к файлам: %d\n", row.Permission)
+		}
+		if len(row.Missing) > 0 {
+			fmt.Fprintf(&b, "  не найдены папки: %s\n", strings.Join(row.Missing, ", "))
+		}
+	}
+	fmt.Fprintf(&b, "Итого: хостов и экземпляров %d, запусков %d (с ошибками %d), удалено %d, освобождено %s\n",
+		len(rows), runs, failed, deleted, formatBytes(freed))
+	return b.String()
+}
+
+// postDigest отправляет сводку на webhook в виде JSON {"text": ...},
+// который принимают Slack, Mattermost и аналогичные системы.
+func postDigest(url, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: digestTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook ответил %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// runDigest реализует подкоманду digest: одна сводка за день или неделю по
+// всем хостам и экземплярам, пишущим в общую историю запусков.
+func runDigest(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("digest", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup digest [--digest-period day|week] [--digest-webhook URL] [--history-file history.jsonl] [flags]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	period, err := digestPeriod(cfg.Digest.Period)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	historyFile, err := cfg.historyPath()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	records, err := readHistory(historyFile)
+	if err != nil {
+		log.Printf("Ошибка чтения истории %s: %v\n", historyFile, err)
+		return 1
+	}
+
+	to := time.Now()
+	from := to.Add(-period)
+	text := formatDigest(buildDigest(records, from, to), from, to)
+	fmt.Print(text)
+	if cfg.Digest.Webhook != "" {
+		if err := postDigest(cfg.Digest.Webhook, text); err != nil {
+			log.Printf("Ошибка отправки сводки: %v\n", err)
+			return 1
+		}
+		log.Print("Сводка отправлена")
+	}
+	return 0
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Единицы очистки папки (unit).
+const (
+	unitFile = "file" // отдельные файлы папки
+	unitDir  = "dir"  // подкаталоги первого уровня целиком
+)
+
+// validateUnit проверяет единицу очистки unit.
+func validateUnit(unit string) error {
+	if unit != unitFile && unit != unitDir {
+		return fmt.Errorf("unit=%q: допустимы file, dir", unit)
+	}
+	return nil
+}
+
+// validateDirUnit проверяет, что при unit=dir не заданы перенос и проверка
+// файлов: каталоги удаляются целиком (os.RemoveAll), и карантин, архив,
+// move_to, мягкое удаление, verify и tier_to к ним не применяются.
+func validateDirUnit(rule folderRule) error {
+	if rule.Unit != unitDir {
+		return nil
+	}
+	switch {
+	case rule.Action != "" && rule.Action != actionDelete:
+		return fmt.Errorf("action=%s нельзя сочетать с unit: dir: каталоги удаляются целиком", rule.Action)
+	case rule.SoftDelete > 0:
+		return fmt.Errorf("soft_delete нельзя сочетать с unit: dir: каталоги удаляются целиком")
+	case rule.Verify != nil:
+		return fmt.Errorf("verify нельзя сочетать с unit: dir: каталоги удаляются целиком")
+	case rule.TierTo != "":
+		return fmt.Errorf("tier_to нельзя сочетать с unit: dir: каталоги удаляются целиком")
+	}
+	return nil
+}
+
+// dirUnit — подкаталог первого уровня, очищаемый как целое.
+type dirUnit struct {
+	name   string
+	path   string
+	newest time.Time // самое позднее время файла в дереве
+	size   int64
+	files  int
+	held   string // пояснение, если файл дерева удерживается
+	reason SkipReason
+}
+
+// scanDirUnit обходит дерево подкаталога: возраст каталога — время самого
+// свежего файла в нём (у пустого каталога — время изменения самого каталога),
+// поэтому каталог, в который ещё пишут, не удаляется. Каталог удерживается
+// целиком, если хотя бы один его файл не был бы удалён и при очистке по
+// файлам: подходит под exclude или filters, вне ограничений размера или
+// принадлежит другому владельцу.
+func scanDirUnit(folder string, entry os.DirEntry, rule folderRule, opts processOptions) (dirUnit, error) {
+	u := dirUnit{name: entry.Name(), path: filepath.Join(folder, entry.Name())}
+	now := time.Now()
+	err := filepath.WalkDir(u.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		t, err := statTimes(path)
+		if err != nil {
+			return err
+		}
+		if ft := rule.fileTime(stampsOf(t), d.Name()); ft.After(u.newest) {
+			u.newest = ft
+		}
+		info, err := d.Info()
+		if err == nil {
+			u.size += info.Size()
+		}
+		u.files++
+		if u.held != "" {
+			return nil
+		}
+		if rule.excluded(d.Name()) {
+			u.held, u.reason = path, SkipExcluded
+			return nil
+		}
+		if rel, err := filepath.Rel(folder, path); err == nil {
+			if hit := rule.filtered(rel, false); hit != "" {
+				u.held, u.reason = path+": "+hit, SkipIgnored
+				return nil
+			}
+		}
+		if info != nil {
+			if detail := rule.sizeSkip(info.Size()); detail != "" {
+				u.held, u.reason = path+": "+detail, SkipSize
+				return nil
+			}
+			if detail := rule.ownerSkip(fileOwner(info)); detail != "" {
+				u.held, u.reason = path+": "+detail, SkipOwner
+				return nil
+			}
+		}
+		if rule.HonorRetain {
+			held, detail, err := fileHold(path, now)
+			if err != nil {
+				return err
+			}
+			if held {
+				u.held, u.reason = path+" "+detail, SkipRetained
+			}
+		}
+		if users := opts.Mapped.of(path); users != "" {
+			u.held, u.reason = path+": "+users, SkipMapped
+		}
+		return nil
+	})
+	if err != nil {
+		return u, err
+	}
+	if u.files == 0 {
+		info, err := entry.Info()
+		if err != nil {
+			return u, err
+		}
+		u.newest = info.ModTime()
+	}
+	return u, nil
+}
+
+// processDirUnits очищает папку с unit: dir — подкаталоги первого уровня,
+// самый свежий файл которых старше дня отсечки, удаляются целиком. Файлы
+// самой папки не затрагиваются. Счётчики результата считают каталоги.
+func processDirUnits(res *FolderResult, folder string, rule folderRule, opts processOptions) error {
+	entries, err := readDir(folder)
+	if err != nil {
+		return err
+	}
+	anchors := newRetentionAnchors(rule)
+	keepNewest := newestFiles{n: rule.Keep}
+	var units []dirUnit
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(folder, entry.Name())
+		if slices.ContainsFunc(opts.Nested, func(rel string) bool { return rel == entry.Name() || isSubpath(entry.Name(), rel) }) {
+			events.emit(EventDecision, folder, path, "Каталог %s содержит отдельную папку конфигурации и не удаляется целиком", path)
+			continue
+		}
+		res.Total++
+		progress.scanned.Add(1)
+		if !rule.included(entry.Name()) {
+			res.Skipped++
+			res.keep(path, SkipNotIncluded, "")
+			continue
+		}
+		if rule.excluded(entry.Name()) {
+			res.Skipped++
+			res.keep(path, SkipExcluded, "")
+			continue
+		}
+		if hit := rule.filtered(entry.Name(), true); hit != "" {
+			res.Skipped++
+			res.keep(path, SkipIgnored, hit)
+			continue
+		}
+		u, err := scanDirUnit(folder, entry, rule, opts)
+		if err != nil {
+			res.fileError(path, CodeFolderRead, "Ошибка обхода каталога "+path, err)
+			continue
+		}
+		anchors.add(u.name, u.newest)
+		keepNewest.add(u.name, u.newest)
+		units = append(units, u)
+	}
+	keepNames := keepNewest.names()
+	cutoffOf := func(u dirUnit) time.Time {
+		return anchors.of(u.name).AddDate(0, 0, -rule.daysFor(u.name))
+	}
+	events.emit(EventDecision, folder, "", "Папка: %s, очистка подкаталогов целиком, каталогов: %d", folder, len(units))
+
+	// Удаляем, начиная с самых старых каталогов: так max_delete и
+	// ограничение времени оставляют самые свежие.
+	slices.SortStableFunc(units, func(a, b dirUnit) int { return a.newest.Compare(b.newest) })
+	n := 0
+	for _, u := range units {
+		if !keepNames[u.name] && u.held == "" && u.newest.Before(cutoffOf(u)) {
+			n++
+		}
+	}
+	if percent := 100 * float64(n) / float64(len(units)); rule.MaxDeletePercent > 0 && len(units) > 0 && percent > rule.MaxDeletePercent {
+		return withCode(CodeDeleteLimit, fmt.Errorf("к удалению %d из %d каталогов (%.0f%%), больше max_delete_percent=%g%%: папка не очищалась, проверьте срок хранения",
+			n, len(units), percent, rule.MaxDeletePercent))
+	}
+	if rule.MaxDelete > 0 && n > rule.MaxDelete {
+		if rule.MaxDeleteMode != maxDeleteTruncate {
+			return withCode(CodeDeleteLimit, fmt.Errorf("к удалению %d каталогов, больше max_delete=%d: папка не очищалась, проверьте срок хранения", n, rule.MaxDelete))
+		}
+		events.emitCode(EventError, CodeDeleteLimit, folder, "", "Папка %s: к удалению %d каталогов, больше max_delete=%d: будут удалены только %d самых старых",
+			folder, n, rule.MaxDelete, rule.MaxDelete)
+		res.Truncated = n - rule.MaxDelete
+	}
+
+	progress.setPhase(phaseProcess)
+	budget := &deleteBudget{limit: rule.MaxDelete, run: opts.RunBudget}
+	for _, u := range units {
+		progress.processed.Add(1)
+		cutoff := cutoffOf(u)
+		switch {
+		case res.StoppedAt != "" || opts.expired():
+			if res.StoppedAt == "" {
+				res.StoppedAt = u.path
+				events.emit(EventWarning, folder, u.path, "Время запуска исчерпано, обработка остановлена на каталоге %s", u.path)
+			}
+			res.Skipped++
+			res.keep(u.path, SkipBudget, "")
+		case keepNames[u.name]:
+			res.Skipped++
+			res.keep(u.path, SkipKeepNewest, fmt.Sprintf("keep=%d", rule.Keep))
+		case !u.newest.Before(cutoff):
+			res.Skipped++
+			res.keep(u.path, SkipNotOldEnough, fmt.Sprintf("самый свежий файл %s, отсечка %s", u.newest.Format(time.RFC3339), cutoff.Format(time.RFC3339)))
+		case u.held != "":
+			res.Skipped++
+			res.keep(u.path, u.reason, u.held)
+		case !opts.approved(u.path, pendingDeleteDir):
+			res.Skipped++
+			res.keep(u.path, SkipNotApproved, pendingDeleteDir)
+		default:
+			if limit := budget.take(); limit != "" {
+				res.Skipped++
+				res.keep(u.path, SkipMaxDelete, limit)
+				continue
+			}
+			if opts.DryRun {
+				if err := protection.checkTree(u.path); err != nil {
+					budget.give()
+					res.fileError(u.path, CodeDeleteFailed, "", err)
+					continue
+				}
+				events.emit(EventDecision, folder, u.path, "Будет удалён каталог: %s (возраст %s, файлов %d, размер %s)",
+					u.path, formatAge(time.Since(u.newest)), u.files, formatBytes(u.size))
+				res.Planned++
+				res.PlannedFreed += u.size
+				res.Skipped++
+				res.keep(u.path, SkipDryRun, pendingDeleteDir)
+				continue
+			}
+			if err := removeTree(u.path); err != nil {
+				budget.give()
+				res.fileError(u.path, CodeDeleteFailed, "Ошибка удаления каталога "+u.path, err)
+				continue
+			}
+			events.emit(EventAction, folder, u.path, "Удалён каталог: %s (файлов %d, %s)", u.path, u.files, formatBytes(u.size))
+			affected.add(folder, u.path, "deleted", "", u.size)
+			res.Deleted++
+			res.Freed += u.size
+			progress.deleted.Add(1)
+			progress.freed.Add(u.size)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultDiscoverMarker — файл, по которому папка находится автоматически.
+const defaultDiscoverMarker = ".cleanup.yml"
+
+// DiscoverOptions описывает корень, под которым папки для очистки находятся
+// по файлу-маркеру: так сотни временных каталогов проектов регистрируются
+// сами, а не перечисляются в общей конфигурации.
+type DiscoverOptions struct {
+	Root     string `yaml:"root"`
+	Marker   string `yaml:"marker"`    // по умолчанию .cleanup.yml
+	MaxDepth int    `yaml:"max_depth"` // глубина поиска от root, 0 — без ограничения
+	// FollowReparsePoints разрешает искать в символических ссылках
+	// и соединениях (junction) на каталоги.
+	FollowReparsePoints bool `yaml:"follow_reparse_points"`
+}
+
+// discoverFolders находит под корнями каталоги с файлом-маркером. Маркер
+// может быть пустым или содержать настройки папки в YAML (days, include,
+// keep...), которые перекрывают defaults; сам маркер никогда не удаляется.
+// Папка с ошибочным маркером пропускается с предупреждением, папка, уже
+// перечисленная в listed, — молча: её настройки задаёт общая конфигурация.
+// Предупреждения возвращаются отдельно: конфигурация загружается до того,
+// как настроен вывод событий запуска.
+func discoverFolders(roots []DiscoverOptions, listed []FolderSpec) ([]FolderSpec, []string) {
+	seen := make(map[string]bool, len(listed))
+	for _, spec := range listed {
+		seen[filepath.Clean(spec.Path)] = true
+	}
+	var specs []FolderSpec
+	var warnings []string
+	for _, root := range roots {
+		marker := root.Marker
+		if marker == "" {
+			marker = defaultDiscoverMarker
+		}
+		base := strings.Count(filepath.Clean(root.Root), string(filepath.Separator))
+		err := walkTree(root.Root, root.FollowReparsePoints, nil, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("Ошибка поиска папок в %s: %v", path, err))
+				return nil
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if root.MaxDepth > 0 && strings.Count(filepath.Clean(path), string(filepath.Separator))-base >= root.MaxDepth {
+				return filepath.SkipDir
+			}
+			spec, ok, err := readDiscoverMarker(path, marker)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("Папка %s пропущена: ошибка в %s: %v", path, marker, err))
+			} else if ok && !seen[filepath.Clean(path)] {
+				seen[filepath.Clean(path)] = true
+				specs = append(specs, spec)
+			}
+			return nil
+		})
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("Ошибка поиска папок в %s: %v", root.Root, err))
+		}
+	}
+	return specs, warnings
+}
+
+// discoverMarker — настройки, которые допускаются в маркере. Маркер может
+// положить любой, у кого есть запись в каталоге под корнем поиска, поэтому
+// он задаёт только срок хранения и отбор файлов, но не команды (verify),
+// каталоги назначения и другие настройки общей конфигурации.
+type discoverMarker struct {
+	Days    *int     `yaml:"days"`
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	Keep    *int     `yaml:"keep"`
+}
+
+// readDiscoverMarker читает маркер в каталоге dir, если он есть. Ключи,
+// кроме days, include, exclude и keep, — ошибка маркера.
+func readDiscoverMarker(dir, marker string) (FolderSpec, bool, error) {
+	path := filepath.Join(dir, marker)
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return FolderSpec{}, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FolderSpec{}, false, err
+	}
+	spec := FolderSpec{Path: dir}
+	if len(bytes.TrimSpace(data)) > 0 {
+		var m discoverMarker
+		if err := yaml.UnmarshalStrict(data, &m); err != nil {
+			return FolderSpec{}, false, fmt.Errorf("%v (в маркере допустимы только days, include, exclude и keep)", err)
+		}
+		spec.Days, spec.Include, spec.Exclude, spec.Keep = m.Days, m.Include, m.Exclude, m.Keep
+	}
+	if err := spec.normalize(); err != nil {
+		return FolderSpec{}, false, err
+	}
+	spec.Exclude = append(spec.Exclude, foldName(marker))
+	return spec, true, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadDiscoverMarker(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // "-" — маркера нет
+		ok      bool
+		wantErr bool
+		days    int // -1 — срок не задан
+		include []string
+		exclude []string
+	}{
+		{name: "нет маркера", content: "-"},
+		{name: "пустой маркер", content: "", ok: true, days: -1, exclude: []string{".cleanup"}},
+		{name: "только пробелы", content: "\n  \n", ok: true, days: -1, exclude: []string{".cleanup"}},
+		{name: "срок", content: "days: 7\n", ok: true, days: 7, exclude: []string{".cleanup"}},
+		{
+			name:    "шаблоны",
+			content: "days: 30\ninclude: ['*.log']\nexclude: ['keep-*']\n",
+			ok:      true, days: 30, include: []string{"*.log"}, exclude: []string{"keep-*", ".cleanup"},
+		},
+		{name: "недопустимый ключ", content: "days: 7\naction: move\n", wantErr: true},
+		{name: "неверный YAML", content: "days: [\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.content != "-" {
+				if err := os.WriteFile(filepath.Join(dir, ".cleanup"), []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			spec, ok, err := readDiscoverMarker(dir, ".cleanup")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась ошибка: %v", err, tt.wantErr)
+			}
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if spec.Path != dir {
+				t.Errorf("Path = %q, want %q", spec.Path, dir)
+			}
+			if days := -1; spec.Days != nil {
+				days = *spec.Days
+				if days != tt.days {
+					t.Errorf("Days = %d, want %d", days, tt.days)
+				}
+			} else if tt.days != -1 {
+				t.Errorf("Days не задан, want %d", tt.days)
+			}
+			if !slices.Equal(spec.Include, tt.include) {
+				t.Errorf("Include = %q, want %q", spec.Include, tt.include)
+			}
+			if !slices.Equal(spec.Exclude, tt.exclude) {
+				t.Errorf("Exclude = %q, want %q", spec.Exclude, tt.exclude)
+			}
+		})
+	}
+}
+
+func TestReadDiscoverMarkerNotRegular(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".cleanup"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := readDiscoverMarker(dir, ".cleanup"); ok || err != nil {
+		t.Errorf("каталог с именем маркера: ok = %v, err = %v", ok, err)
+	}
+}
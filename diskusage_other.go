@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// diskUsage не поддерживается на этой платформе.
+func diskUsage(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("объём файловой системы не определяется на этой платформе")
+}
@@ -0,0 +1,16 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// diskUsage возвращает общий и доступный объём тома папки.
+func diskUsage(path string) (total, free uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var avail, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &avail, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return total, avail, nil
+}
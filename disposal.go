@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Действия над файлами, срок хранения которых истёк.
+const (
+	actionDelete     = "delete"     // удалить сразу (или мягко, если задан soft_delete)
+	actionQuarantine = "quarantine" // переместить в карантин и удалить по истечении quarantine_ttl
+	actionArchive    = "archive"    // дописать в архив tar.gz и удалить
+	actionMove       = "move"       // переместить в move_to для ручного просмотра
+)
+
+// validateActionName проверяет только имя действия: каталоги действий
+// могут быть заданы в defaults.
+func validateActionName(action string) error {
+	switch action {
+	case "", actionDelete, actionQuarantine, actionArchive, actionMove:
+		return nil
+	}
+	return fmt.Errorf("неизвестное действие action %q (допустимы delete, quarantine, archive, move)", action)
+}
+
+// validateAction проверяет действие папки и его параметры.
+func validateAction(rule folderRule) error {
+	switch {
+	case rule.Action == actionQuarantine && rule.QuarantineDir == "":
+		return fmt.Errorf("action=quarantine: не задан quarantine_dir")
+	case rule.Action == actionArchive && rule.ArchiveDir == "":
+		return fmt.Errorf("action=archive: не задан archive_dir")
+	case rule.Action == actionMove && rule.MoveTo == "":
+		return fmt.Errorf("action=move: не задан move_to")
+	}
+	return validateActionName(rule.Action)
+}
+
+// disposal — шаг processFolder, убирающий файл с истёкшим сроком хранения:
+// удаление, мягкое удаление, перемещение в карантин, в архив или в каталог.
+type disposal interface {
+	// dispose убирает файл и возвращает, куда он перемещён (пусто — удалён).
+	dispose(path string) (string, error)
+	// failure — код и начало сообщения об ошибке dispose.
+	failure() (ErrorCode, string)
+	// record учитывает убранный файл в итогах папки.
+	record(res *FolderResult, path, target string, size int64)
+	// finish вызывается после обработки папки.
+	finish(res *FolderResult)
+}
+
+// newDisposal выбирает шаг удаления по правилам папки; промежуточные файлы
+// создаются в work.
+func newDisposal(folder string, rule folderRule, work *workDir) disposal {
+	switch {
+	case rule.Action == actionQuarantine:
+		return quarantineDisposal{folder: folder, dir: mirrorPath(rule.QuarantineDir, folder)}
+	case rule.Action == actionArchive:
+		return &archiveDisposal{folder: folder, dir: mirrorPath(rule.ArchiveDir, folder), work: work}
+	case rule.Action == actionMove:
+		return moveDisposal{folder: folder, dir: rule.MoveTo}
+	case rule.SoftDelete > 0:
+		return softDisposal{}
+	default:
+		return removeDisposal{}
+	}
+}
+
+// removeDisposal удаляет файл сразу.
+type removeDisposal struct{}
+
+func (removeDisposal) dispose(path string) (string, error) { return "", removeFile(path) }
+func (removeDisposal) failure() (ErrorCode, string) {
+	return CodeDeleteFailed, "Ошибка удаления файла "
+}
+func (removeDisposal) record(res *FolderResult, path, _ string, size int64) {
+	events.emit(EventAction, res.Folder, path, "Удалён файл: %s", path)
+	affected.add(res.Folder, path, "deleted", "", size)
+	res.Deleted++
+	res.Freed += size
+}
+
+func (removeDisposal) finish(*FolderResult) {}
+
+// softDisposal переименовывает файл в надгробие (soft_delete).
+type softDisposal struct{}
+
+func (softDisposal) dispose(path string) (string, error) { return softDelete(path, time.Now()) }
+func (softDisposal) failure() (ErrorCode, string) {
+	return CodeMoveFailed, "Ошибка переименования файла "
+}
+func (softDisposal) record(res *FolderResult, path, target string, size int64) {
+	events.emit(EventAction, res.Folder, path, "Файл %s мягко удалён: переименован в %s", path, filepath.Base(target))
+	affected.add(res.Folder, path, "soft_deleted", target, size)
+	res.SoftDeleted++
+}
+
+func (softDisposal) finish(*FolderResult) {}
+
+// quarantineDisposal перемещает файл в каталог карантина папки под именем
+// надгробия, по которому потом определяется, когда файл попал в карантин.
+// Исходные путь и метаданные файла записываются в манифест карантина.
+type quarantineDisposal struct {
+	folder, dir string
+}
+
+func (q quarantineDisposal) dispose(path string) (string, error) {
+	rel := folderRelative(q.folder, path)
+	target := filepath.Join(q.dir, filepath.Dir(rel), tombstoneName(filepath.Base(rel), time.Now()))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	return target, relocate(q.folder, path, target, q.dir)
+}
+
+func (quarantineDisposal) failure() (ErrorCode, string) {
+	return CodeMoveFailed, "Ошибка перемещения в карантин файла "
+}
+
+func (quarantineDisposal) record(res *FolderResult, path, target string, size int64) {
+	events.emit(EventAction, res.Folder, path, "Файл %s перемещён в карантин: %s", path, target)
+	affected.add(res.Folder, path, "quarantined", target, size)
+	res.Quarantined++
+}
+
+func (quarantineDisposal) finish(*FolderResult) {}
+
+// moveDisposal перемещает файл с тем же путём относительно папки в каталог move_to,
+// например чтобы просмотреть файлы вручную перед удалением. Между
+// файловыми системами файл копируется и затем удаляется. Исходные путь
+// и метаданные файла записываются в манифест move_to.
+type moveDisposal struct {
+	folder, dir string
+}
+
+func (m moveDisposal) dispose(path string) (string, error) {
+	base := filepath.Join(m.dir, folderRelative(m.folder, path))
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return "", err
+	}
+	// Занятое имя в move_to — файл, перенесённый раньше, или чужой файл:
+	// он не перезаписывается, а файл переносится под именем с номером.
+	for n := 1; ; n++ {
+		target := numberedName(base, n)
+		if err := relocate(m.folder, path, target, m.dir); !errors.Is(err, fs.ErrExist) {
+			return target, err
+		}
+	}
+}
+
+func (moveDisposal) failure() (ErrorCode, string) {
+	return CodeMoveFailed, "Ошибка перемещения файла "
+}
+
+func (moveDisposal) record(res *FolderResult, path, target string, size int64) {
+	events.emit(EventAction, res.Folder, path, "Файл %s перемещён в %s", path, target)
+	affected.add(res.Folder, path, "moved", target, size)
+	res.Moved++
+}
+
+func (moveDisposal) finish(*FolderResult) {}
+
+// folderRelative возвращает путь файла относительно папки: файлы подкаталогов
+// (recursive) сохраняют его в каталоге карантина, move_to и архиве, и
+// одноимённые файлы разных подкаталогов не перезаписывают друг друга.
+func folderRelative(folder, path string) string {
+	rel, err := filepath.Rel(folder, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return filepath.Base(path)
+	}
+	return rel
+}
+
+// mirrorPath возвращает каталог карантина или архива для папки: путь папки
+// повторяется внутри dir, например /trash/var/log/app для /var/log/app,
+// поэтому у нескольких папок может быть общий карантин или архив.
+func mirrorPath(dir, folder string) string {
+	abs, err := filepath.Abs(folder)
+	if err != nil {
+		abs = folder
+	}
+	vol := filepath.VolumeName(abs)
+	rel := strings.TrimLeft(abs[len(vol):], `\/`)
+	return filepath.Join(dir, strings.Trim(vol, `\/:`), rel)
+}
+
+// purgeQuarantine окончательно удаляет файлы карантина папки,
+// пролежавшие там дольше ttl.
+func purgeQuarantine(res *FolderResult, dir string, ttl time.Duration, opts processOptions) {
+	now := time.Now()
+	purged := 0
+	walkTree(dir, false, nil, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if !os.IsNotExist(err) {
+				res.fileError(path, CodeFolderRead, "Ошибка чтения "+path, err)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		at, ok := tombstoneTime(d.Name())
+		if !ok || now.Sub(at) < ttl {
+			return nil
+		}
+		var size int64
+		if info, err := d.Info(); err == nil {
+			size = info.Size()
+		}
+		if !opts.approved(path, pendingPurgeQuarantine) {
+			res.Skipped++
+			res.keep(path, SkipNotApproved, pendingPurgeQuarantine)
+			return nil
+		}
+		if opts.DryRun {
+			events.emit(EventDecision, res.Folder, path, "Будет удалён файл карантина: %s", path)
+			res.Planned++
+			res.PlannedFreed += size
+			res.keep(path, SkipDryRun, pendingPurgeQuarantine)
+			return nil
+		}
+		if err := removeFile(path); err != nil {
+			res.fileError(path, CodeDeleteFailed, "Ошибка удаления файла "+path, err)
+			return nil
+		}
+		purged++
+		events.emit(EventAction, res.Folder, path, "Удалён файл карантина: %s (в карантине с %s)", path, at.Local().Format(time.RFC3339))
+		res.Deleted++
+		res.Freed += size
+		return nil
+	})
+	if purged > 0 {
+		if err := pruneManifest(dir); err != nil {
+			events.emitCode(EventError, CodeManifestWrite, res.Folder, dir, "Ошибка обновления манифеста карантина %s: %v", dir, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// oldTree создаёт в dir одноимённые старые файлы двух подкаталогов и свежий
+// файл, который не удаляется.
+func oldTree(t *testing.T, dir string) {
+	t.Helper()
+	past := time.Now().AddDate(0, 0, -100)
+	for _, name := range []string{"a/x.log", "b/x.log", "new.log"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "new.log" {
+			if err := os.Chtimes(path, past, past); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// runFolder очищает папку dir с параметрами params, подтверждая первый запуск.
+func runFolder(t *testing.T, dir, params string) {
+	t.Helper()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	args := []string{"--first-run-confirm", "30", dir + "?recursive=true&time_fields=mtime&" + params}
+	if code := runCleanup(args); code != exitOK {
+		t.Fatalf("runCleanup() = %d, want %d", code, exitOK)
+	}
+}
+
+func TestDisposalKeepsRelativePath(t *testing.T) {
+	t.Run("move_to", func(t *testing.T) {
+		dir, to := t.TempDir(), t.TempDir()
+		oldTree(t, dir)
+		runFolder(t, dir, "action=move&move_to="+to)
+		for _, name := range []string{"a/x.log", "b/x.log"} {
+			data, err := os.ReadFile(filepath.Join(to, filepath.FromSlash(name)))
+			if err != nil || string(data) != name {
+				t.Errorf("%s в move_to: %q, %v", name, data, err)
+			}
+		}
+	})
+	t.Run("quarantine", func(t *testing.T) {
+		dir, trash := t.TempDir(), t.TempDir()
+		oldTree(t, dir)
+		runFolder(t, dir, "action=quarantine&quarantine_dir="+trash)
+		for _, sub := range []string{"a", "b"} {
+			matches, _ := filepath.Glob(filepath.Join(mirrorPath(trash, dir), sub, "x.log"+tombstoneMarker+"*"))
+			if len(matches) != 1 {
+				t.Errorf("в карантине %s: %v, want один файл", sub, matches)
+			}
+		}
+	})
+	t.Run("archive", func(t *testing.T) {
+		dir, cold := t.TempDir(), t.TempDir()
+		oldTree(t, dir)
+		runFolder(t, dir, "action=archive&archive_dir="+cold)
+		archives, _ := filepath.Glob(filepath.Join(mirrorPath(cold, dir), "*.tar.gz"))
+		if len(archives) != 1 {
+			t.Fatalf("архивы: %v, want один", archives)
+		}
+		f, err := os.Open(archives[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, hdr.Name)
+		}
+		slices.Sort(names)
+		if want := []string{"a/x.log", "b/x.log"}; !slices.Equal(names, want) {
+			t.Errorf("файлы архива: %v, want %v", names, want)
+		}
+	})
+}
+
+func TestMoveDisposalNumberedName(t *testing.T) {
+	dir, to := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(to, "a.log"), []byte("раньше"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range []string{"первый", "второй"} {
+		path := filepath.Join(dir, "a.log")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		target, err := moveDisposal{folder: dir, dir: to}.dispose(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(to, fmt.Sprintf("a-%d.log", i+2)); target != want {
+			t.Errorf("dispose() = %s, want %s", target, want)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(to, "a.log")); string(data) != "раньше" {
+		t.Errorf("файл в move_to перезаписан: %q", data)
+	}
+}
+
+func TestCopyFileKeepsExistingTarget(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	for _, path := range []string{src, dst} {
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := copyFile(src, dst); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("copyFile() = %v, want ошибку: файл существует", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != dst {
+		t.Errorf("чужой файл удалён или изменён после ошибки копирования: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// embeddedConfigName — название встроенной конфигурации в сообщениях.
+const embeddedConfigName = "встроенная конфигурация"
+
+// runConfigEmbedded выводит встроенную конфигурацию, чтобы на месте её можно
+// было взять за основу собственного файла.
+func runConfigEmbedded(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: cleanup config embedded")
+		return 1
+	}
+	if len(embeddedConfig) == 0 {
+		fmt.Fprintln(os.Stderr, "Встроенной конфигурации нет: cleanup собран без тега embedconfig")
+		return 1
+	}
+	os.Stdout.Write(embeddedConfig)
+	return 0
+}
@@ -0,0 +1,12 @@
+//go:build embedconfig
+
+package main
+
+import _ "embed"
+
+// embeddedConfig — конфигурация по умолчанию, встроенная при сборке с тегом
+// embedconfig из файла embedded.yml, чтобы образы устройств поставлялись
+// одним исполняемым файлом без отдельной конфигурации.
+//
+//go:embed embedded.yml
+var embeddedConfig []byte
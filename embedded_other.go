@@ -0,0 +1,7 @@
+//go:build !embedconfig
+
+package main
+
+// embeddedConfig пуст: сборка без тега embedconfig не содержит встроенной
+// конфигурации.
+var embeddedConfig []byte
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultEnvPrefix — префикс переменных окружения по умолчанию.
+const defaultEnvPrefix = "CLEANUP_"
+
+// envFlagName возвращает имя переменной окружения для флага:
+// префикс и имя флага в верхнем регистре с заменой «-» на «_»
+// (например, --push-gateway → CLEANUP_PUSH_GATEWAY).
+func envFlagName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvFlags задаёт значения флагов, не указанных в командной строке,
+// из переменных окружения с префиксом. Флаги из skip не читаются из окружения.
+func applyEnvFlags(fs *flag.FlagSet, prefix string, skip ...string) error {
+	if prefix == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range skip {
+		set[name] = true
+	}
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		name := envFlagName(prefix, f.Name)
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("неверное значение переменной окружения %s: %v", name, e)
+			}
+		}
+	})
+	return err
+}
+
+// defaultEnvFile — файл переменных окружения, читаемый из рабочего каталога.
+const defaultEnvFile = ".env"
+
+// loadEnvFile читает файл в формате .env (строки КЛЮЧ=значение, комментарии #,
+// необязательный префикс export, значения в одинарных или двойных кавычках)
+// и задаёт переменные, ещё не установленные в окружении процесса.
+// Отсутствие файла по умолчанию не считается ошибкой, в отличие от явно указанного.
+func loadEnvFile(path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil
+		}
+		return fmt.Errorf("ошибка чтения файла окружения %s: %v", path, err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: ожидается строка вида КЛЮЧ=значение", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			quote := value[0]
+			value = value[1 : len(value)-1]
+			if quote == '"' {
+				value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+			}
+		} else if idx := strings.Index(value, " #"); idx >= 0 {
+			value = strings.TrimSpace(value[:idx])
+		}
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
+
+// setupEnv загружает файл окружения и применяет переменные с префиксом
+// к флагам, не заданным в командной строке.
+func setupEnv(fs *flag.FlagSet, envFile, prefix string) error {
+	explicit := envFile != ""
+	if !explicit {
+		envFile = defaultEnvFile
+	}
+	if err := loadEnvFile(envFile, explicit); err != nil {
+		return err
+	}
+	return applyEnvFlags(fs, prefix, "help", "env-prefix", "env-file")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// ErrorCode — стабильный машиночитаемый код ошибки. Коды не переводятся
+// и не меняются между версиями: по ним автоматика различает виды сбоев,
+// не разбирая текст сообщений.
+type ErrorCode string
+
+// Ошибки конфигурации и запуска.
+const (
+	CodeConfig         ErrorCode = "E_CONFIG"          // неверная конфигурация, очистка не выполнялась
+	CodeCanaryFailed   ErrorCode = "E_CANARY_FAILED"   // проверка папки-канарейки не пройдена
+	CodeRequiredFailed ErrorCode = "E_REQUIRED_FAILED" // обязательная папка не обработана
+	CodeSnapshotFailed ErrorCode = "E_SNAPSHOT_FAILED" // не создана или не удалена теневая копия (vss)
+	CodeQueueFailed    ErrorCode = "E_QUEUE_FAILED"    // сообщения об убранных файлах не опубликованы
+	CodeNotifyFailed   ErrorCode = "E_NOTIFY_FAILED"   // итоги не отправлены в канал или Grafana
+	CodeStateWrite     ErrorCode = "E_STATE_WRITE"     // не записано состояние папок
+	CodeReportWrite    ErrorCode = "E_REPORT_WRITE"    // ошибка журнала, событий, истории или отчётов
+)
+
+// Ошибки папок.
+const (
+	CodeFolderMissing ErrorCode = "E_FOLDER_MISSING" // папка не найдена или не является директорией
+	CodeFolderDenied  ErrorCode = "E_FOLDER_DENIED"  // отказано в доступе к папке
+	CodeFolderRead    ErrorCode = "E_FOLDER_READ"    // ошибка чтения папки или её подкаталога
+	CodeIgnoreRead    ErrorCode = "E_IGNORE_READ"    // ошибка чтения .cleanupignore
+	CodeMappedCheck   ErrorCode = "E_MAPPED_CHECK"   // не проверены файлы процессов (protect_mapped)
+	CodeDeleteLimit   ErrorCode = "E_DELETE_LIMIT"   // превышены max_delete, max_delete_total или max_delete_percent
+	CodeDiskUsage     ErrorCode = "E_DISK_USAGE"     // не определено свободное место
+)
+
+// Ошибки отдельных файлов.
+const (
+	CodeStatFailed     ErrorCode = "E_STAT_FAILED"     // не получено время файла
+	CodeFileMissing    ErrorCode = "E_FILE_MISSING"    // файл исчез во время обработки
+	CodeRetentionRead  ErrorCode = "E_RETENTION_READ"  // не прочитана дата хранения (honor_retain)
+	CodeTouchFailed    ErrorCode = "E_TOUCH_FAILED"    // не сброшено время файла из будущего
+	CodeVerifyFailed   ErrorCode = "E_VERIFY_FAILED"   // проверка перед удалением не выполнена
+	CodeDeleteFailed   ErrorCode = "E_DELETE_FAILED"   // файл или каталог не удалён
+	CodeDeleteDenied   ErrorCode = "E_DELETE_DENIED"   // отказано в доступе при удалении
+	CodeMoveFailed     ErrorCode = "E_MOVE_FAILED"     // файл не перемещён или не переименован
+	CodeArchiveFailed  ErrorCode = "E_ARCHIVE_FAILED"  // файл не записан в архив
+	CodeCompressFailed ErrorCode = "E_COMPRESS_FAILED" // файл не сжат
+	CodeAccessDenied   ErrorCode = "E_ACCESS_DENIED"   // отказано в доступе при других операциях
+	CodeManifestWrite  ErrorCode = "E_MANIFEST_WRITE"  // не записан манифест перенесённых файлов
+)
+
+// Ошибки запросов к API.
+const (
+	CodeUnauthorized ErrorCode = "E_UNAUTHORIZED" // требуется аутентификация
+	CodeRateLimited  ErrorCode = "E_RATE_LIMITED" // слишком частые запросы
+	CodeQueueFull    ErrorCode = "E_QUEUE_FULL"   // очередь запусков заполнена
+	CodeBadRequest   ErrorCode = "E_BAD_REQUEST"  // неверное тело запроса
+	CodeStoreFailed  ErrorCode = "E_STORE_FAILED" // ошибка хранилища сервера сбора
+	// Режим scan_only.
+	CodeApprovalRequired ErrorCode = "E_APPROVAL_REQUIRED" // удаление только по утверждённому плану
+	CodeNoPlan           ErrorCode = "E_NO_PLAN"           // плана, ожидающего утверждения, нет
+	CodePlanStale        ErrorCode = "E_PLAN_STALE"        // утверждаемый план уже заменён новым
+)
+
+// codedError — ошибка с присвоенным кодом.
+type codedError struct {
+	code ErrorCode
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode присваивает ошибке err код code; nil остаётся nil.
+func withCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// errorCode возвращает код, присвоенный ошибке withCode, или fallback.
+func errorCode(err error, fallback ErrorCode) ErrorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return fallback
+}
+
+// folderErrorCode возвращает код ошибки обработки папки.
+func folderErrorCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return errorCode(err, CodeFolderMissing)
+	case errors.Is(err, fs.ErrPermission):
+		return errorCode(err, CodeFolderDenied)
+	}
+	return errorCode(err, CodeFolderRead)
+}
+
+// fileErrorCode уточняет код ошибки операции code над файлом по самой
+// ошибке: файл исчез или в доступе отказано.
+func fileErrorCode(code ErrorCode, err error) ErrorCode {
+	code = errorCode(err, code)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return CodeFileMissing
+	case errors.Is(err, fs.ErrPermission) && code == CodeDeleteFailed:
+		return CodeDeleteDenied
+	case errors.Is(err, fs.ErrPermission):
+		return CodeAccessDenied
+	}
+	return code
+}
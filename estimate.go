@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// folderEstimate — приблизительные итоги папки без удаления файлов.
+type folderEstimate struct {
+	Files      int
+	Candidates int
+	Size       int64 // объём кандидатов на удаление
+}
+
+// estimateFolder оценивает количество и объём файлов-кандидатов, используя
+// только данные ReadDir: тип записи и сведения о файле из записи каталога
+// (в Windows они не требуют отдельного запроса к файловой системе).
+// Время создания не учитывается, поэтому оценка может быть завышена
+// для недавно скопированных файлов со старым временем модификации.
+func estimateFolder(folder string, rule folderRule, nested []string, lowMemory bool) (folderEstimate, error) {
+	var est folderEstimate
+	var files []policyFile
+	var err error
+	if rule.Ignore, err = loadIgnore(folder); err != nil {
+		return est, err
+	}
+	anchors := newRetentionAnchors(rule)
+	ranked := newestFiles{n: rule.Policy.maxBeyondNewest()}
+	gfs := newGFSFiles(rule.GFS)
+	thinned := newThinning(rule.KeepOnePer, anchors)
+	err = readFolderFiles(folder, rule, nested, lowMemory, nil, func(entry os.DirEntry) {
+		if !entry.Type().IsRegular() {
+			return
+		}
+		est.Files++
+		if !rule.included(entry.Name()) || rule.excluded(entry.Name()) || rule.filtered(entry.Name(), false) != "" {
+			return
+		}
+		info, err := entry.Info()
+		if err != nil || rule.sizeSkip(info.Size()) != "" || rule.ownerSkip(fileOwner(info)) != "" {
+			return
+		}
+		files = append(files, policyFile{name: entry.Name(), newest: info.ModTime(), size: info.Size()})
+		ranked.add(entry.Name(), info.ModTime())
+		anchors.add(entry.Name(), info.ModTime())
+		gfs.add(entry.Name(), info.ModTime())
+		thinned.add(entry.Name(), info.ModTime())
+	})
+	if err != nil {
+		return est, err
+	}
+	ranks := ranked.ranks()
+	gfsKeep := gfs.names()
+	periodKeep := thinned.names()
+	for _, f := range files {
+		f.rank = ranks.of(f.name)
+		if gfsKeep[f.name] == "" && periodKeep[f.name] == "" && rule.expired(f, anchors.of(f.name)) {
+			est.Candidates++
+			est.Size += f.size
+		}
+	}
+	return est, nil
+}
+
+// runEstimate реализует подкоманду estimate: быстрая приблизительная оценка
+// числа и объёма файлов, которые будут удалены, без удаления.
+func runEstimate(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("estimate", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup estimate [flags] [days|config.yml] [folder1 folder2 ...]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if cfg.Days < 0 || len(cfg.Folders) == 0 {
+		log.Print(errMissingParams)
+		return 1
+	}
+	var total folderEstimate
+	for _, spec := range sortedFolderSpecs(cfg.Folders) {
+		est, err := estimateFolder(spec.Path, cfg.folderRule(spec), nestedFolders(spec.Path, cfg.Folders), cfg.LowMemory)
+		if err != nil {
+			log.Printf("Ошибка чтения папки '%s': %v\n", spec.Path, err)
+			continue
+		}
+		fmt.Printf("%s: файлов %d, к удалению около %d (%s)\n", spec.Path, est.Files, est.Candidates, formatBytes(est.Size))
+		total.Files += est.Files
+		total.Candidates += est.Candidates
+		total.Size += est.Size
+	}
+	fmt.Printf("Итого: файлов %d, к удалению около %d (%s)\n", total.Files, total.Candidates, formatBytes(total.Size))
+	return 0
+}
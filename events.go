@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventCategory — категория события запуска.
+type EventCategory string
+
+const (
+	// EventDecision — решение по папке: найденная свежая дата, день отсечки.
+	EventDecision EventCategory = "decision"
+	// EventAction — выполненное действие: удаление файла, отправка итогов.
+	EventAction EventCategory = "action"
+	// EventSkip — файл оставлен, с причиной.
+	EventSkip EventCategory = "skip"
+	// EventWarning — ситуация, требующая внимания, но не мешающая запуску.
+	EventWarning EventCategory = "warning"
+	// EventError — ошибка.
+	EventError EventCategory = "error"
+)
+
+// eventCategories перечисляет все категории в порядке вывода справки.
+var eventCategories = []EventCategory{EventDecision, EventAction, EventSkip, EventWarning, EventError}
+
+// Event — событие запуска в машиночитаемом виде.
+type Event struct {
+	Time     time.Time     `json:"time"`
+	Category EventCategory `json:"category"`
+	Folder   string        `json:"folder,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	// Code — код ошибки для событий error и предупреждений о сбоях.
+	Code    ErrorCode `json:"code,omitempty"`
+	Message string    `json:"message"`
+}
+
+// eventSink выводит в журнал события отобранных категорий и записывает
+// все события в файл событий JSON Lines, если он задан. Выводимые в журнал
+// события могут также накапливаться для отправки в CloudWatch Logs.
+type eventSink struct {
+	mu   sync.Mutex
+	show map[EventCategory]bool
+	file *os.File
+	// capturing включает накопление событий в captured, не больше
+	// captureLimit; не поместившиеся только подсчитываются в dropped.
+	capturing    bool
+	captureLimit int
+	captured     []Event
+	dropped      int
+}
+
+// events — получатель событий текущего запуска; по умолчанию в журнал
+// выводятся все категории, кроме skip.
+var events = &eventSink{show: defaultShow()}
+
+// defaultShow возвращает категории, выводимые в журнал по умолчанию.
+func defaultShow() map[EventCategory]bool {
+	return map[EventCategory]bool{EventDecision: true, EventAction: true, EventWarning: true, EventError: true}
+}
+
+// parseShow разбирает список категорий через запятую; "all" включает все.
+func parseShow(s string) (map[EventCategory]bool, error) {
+	show := make(map[EventCategory]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == "all":
+			for _, c := range eventCategories {
+				show[c] = true
+			}
+		case slices.Contains(eventCategories, EventCategory(name)):
+			show[EventCategory(name)] = true
+		default:
+			return nil, fmt.Errorf("неизвестная категория событий %q (допустимы %s, all)", name, eventCategoryList())
+		}
+	}
+	return show, nil
+}
+
+// logLevels — категории событий, выводимые в журнал на каждом уровне
+// log_level; пустой уровень — info.
+var logLevels = map[string][]EventCategory{
+	"debug": eventCategories,
+	"info":  {EventDecision, EventAction, EventWarning, EventError},
+	"warn":  {EventWarning, EventError},
+	"error": {EventError},
+}
+
+// parseLogLevel возвращает категории событий уровня журнала level.
+func parseLogLevel(level string) (map[EventCategory]bool, error) {
+	if level == "" {
+		return defaultShow(), nil
+	}
+	list, ok := logLevels[strings.ToLower(level)]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный уровень журнала %q (допустимы debug, info, warn, error)", level)
+	}
+	show := make(map[EventCategory]bool)
+	for _, c := range list {
+		show[c] = true
+	}
+	return show, nil
+}
+
+// eventCategoryList возвращает список категорий через запятую.
+func eventCategoryList() string {
+	names := make([]string, len(eventCategories))
+	for i, c := range eventCategories {
+		names[i] = string(c)
+	}
+	return strings.Join(names, ", ")
+}
+
+// configureEvents настраивает вывод событий запуска: show — категории для
+// журнала (пусто — по уровню level, verbose добавляет skip), eventsFile —
+// файл для полного потока событий. Возвращает функцию закрытия файла.
+func configureEvents(show, level string, verbose bool, eventsFile string) (func(), error) {
+	categories, err := parseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	if show != "" {
+		if categories, err = parseShow(show); err != nil {
+			return nil, err
+		}
+	} else if verbose {
+		categories[EventSkip] = true
+	}
+	sink := &eventSink{show: categories}
+	if eventsFile != "" {
+		f, err := openLogFile(eventsFile)
+		if err != nil {
+			return nil, withCode(CodeReportWrite, fmt.Errorf("ошибка открытия файла событий: %v", err))
+		}
+		sink.file = f
+	}
+	events = sink
+	return func() {
+		if sink.file != nil {
+			sink.file.Close()
+		}
+	}, nil
+}
+
+// emit регистрирует событие: папка и путь к файлу необязательны.
+func (s *eventSink) emit(category EventCategory, folder, path, format string, args ...any) {
+	s.emitCode(category, "", folder, path, format, args...)
+}
+
+// emitCode регистрирует событие с кодом ошибки code; в журнале код
+// выводится перед сообщением.
+func (s *eventSink) emitCode(category EventCategory, code ErrorCode, folder, path, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if s.show[category] {
+		if code != "" {
+			log.Printf("[%s] %s\n", code, msg)
+		} else {
+			log.Println(msg)
+		}
+	}
+	if s.file == nil && !s.capturing {
+		return
+	}
+	ev := Event{Time: time.Now(), Category: category, Folder: folder, Path: path, Code: code, Message: msg}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.capturing && s.show[category] {
+		if len(s.captured) < s.captureLimit {
+			s.captured = append(s.captured, ev)
+		} else {
+			s.dropped++
+		}
+	}
+	if s.file == nil {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	writeLocked(s.file, append(data, '\n'))
+}
+
+// capture включает накопление выводимых в журнал событий запуска, не больше limit.
+func (s *eventSink) capture(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capturing, s.captureLimit = true, limit
+}
+
+// takeCaptured возвращает накопленные события по времени и число событий,
+// не поместившихся в предел, и начинает накопление заново.
+func (s *eventSink) takeCaptured() ([]Event, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, dropped := s.captured, s.dropped
+	s.captured, s.dropped = nil, 0
+	slices.SortStableFunc(list, func(a, b Event) int { return a.Time.Compare(b.Time) })
+	return list, dropped
+}
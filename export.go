@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Форматы выгрузки истории запусков.
+const (
+	exportCSV     = "csv"
+	exportParquet = "parquet"
+)
+
+// columnKind — тип значения столбца выгрузки.
+type columnKind int
+
+const (
+	columnString columnKind = iota
+	columnInt
+	columnFloat
+	columnBool
+	columnTime
+)
+
+// historyRow — строка выгрузки: итоги обработки одной папки в одном запуске.
+type historyRow struct {
+	rec    *RunRecord
+	folder FolderRecord
+}
+
+// historyColumn — столбец выгрузки истории.
+type historyColumn struct {
+	name  string
+	kind  columnKind
+	value func(historyRow) any
+}
+
+// historyColumns — столбцы выгрузки в порядке вывода. Значения имеют тип
+// string, int64, float64, bool или time.Time в соответствии с kind.
+var historyColumns = []historyColumn{
+	{"start", columnTime, func(r historyRow) any { return r.rec.Start }},
+	{"host", columnString, func(r historyRow) any { return r.rec.Host }},
+	{"instance", columnString, func(r historyRow) any { return r.rec.Instance }},
+	{"run_id", columnString, func(r historyRow) any { return r.rec.RunID }},
+	{"dry_run", columnBool, func(r historyRow) any { return r.rec.DryRun }},
+	{"run_duration_seconds", columnFloat, func(r historyRow) any { return r.rec.DurationSeconds }},
+	{"folder", columnString, func(r historyRow) any { return r.folder.Folder }},
+	{"total", columnInt, func(r historyRow) any { return int64(r.folder.Total) }},
+	{"deleted", columnInt, func(r historyRow) any { return int64(r.folder.Deleted) }},
+	{"freed_bytes", columnInt, func(r historyRow) any { return r.folder.Freed }},
+	{"quarantined", columnInt, func(r historyRow) any { return int64(r.folder.Quarantined) }},
+	{"archived", columnInt, func(r historyRow) any { return int64(r.folder.Archived) }},
+	{"moved", columnInt, func(r historyRow) any { return int64(r.folder.Moved) }},
+	{"tiered", columnInt, func(r historyRow) any { return int64(r.folder.Tiered) }},
+	{"tiered_bytes", columnInt, func(r historyRow) any { return r.folder.TieredBytes }},
+	{"compressed", columnInt, func(r historyRow) any { return int64(r.folder.Compressed) }},
+	{"compressed_saved", columnInt, func(r historyRow) any { return r.folder.CompressedSaved }},
+	{"fs_total_bytes", columnInt, func(r historyRow) any { return int64(r.folder.FSTotal) }},
+	{"fs_free_bytes", columnInt, func(r historyRow) any { return int64(r.folder.FSFree) }},
+	{"error", columnString, func(r historyRow) any { return r.folder.Error }},
+}
+
+// historyRows разворачивает записи истории, начиная с since, в строки по папкам.
+func historyRows(records []RunRecord, since time.Time) []historyRow {
+	var rows []historyRow
+	for i := range records {
+		rec := &records[i]
+		if rec.Start.Before(since) {
+			continue
+		}
+		for _, f := range rec.Folders {
+			rows = append(rows, historyRow{rec: rec, folder: f})
+		}
+	}
+	return rows
+}
+
+// writeHistoryCSV записывает строки выгрузки в CSV с заголовком.
+// Время записывается в RFC 3339.
+func writeHistoryCSV(w io.Writer, rows []historyRow) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(historyColumns))
+	for i, col := range historyColumns {
+		header[i] = col.name
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	line := make([]string, len(historyColumns))
+	for _, row := range rows {
+		for i, col := range historyColumns {
+			switch v := col.value(row).(type) {
+			case time.Time:
+				line[i] = v.Format(time.RFC3339)
+			case int64:
+				line[i] = strconv.FormatInt(v, 10)
+			case float64:
+				line[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				line[i] = strconv.FormatBool(v)
+			case string:
+				line[i] = v
+			}
+		}
+		if err := cw.Write(line); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runHistory реализует подкоманду history.
+func runHistory(args []string) int {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintln(os.Stderr, "Usage: cleanup history export [--format csv|parquet] [--since 2024-01-01] [-o file] [flags]")
+		return 1
+	}
+	return runHistoryExport(args[1:])
+}
+
+// runHistoryExport выгружает историю запусков в CSV или Parquet для
+// систем BI: одна строка на папку в каждом запуске.
+func runHistoryExport(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("history export", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup history export [--format csv|parquet] [--since 2024-01-01] [-o file] [--history-file history.jsonl] [flags]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if opts.exportFormat != exportCSV && opts.exportFormat != exportParquet {
+		log.Printf("Неизвестный формат выгрузки %q: допустимы csv и parquet", opts.exportFormat)
+		return 1
+	}
+	var since time.Time
+	if opts.exportSince != "" {
+		if since, err = time.ParseInLocation("2006-01-02", opts.exportSince, time.Local); err != nil {
+			log.Printf("Неверная дата --since %q: ожидается ГГГГ-ММ-ДД", opts.exportSince)
+			return 1
+		}
+	}
+	historyFile, err := cfg.historyPath()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	records, err := readHistory(historyFile)
+	if err != nil {
+		log.Printf("Ошибка чтения истории %s: %v\n", historyFile, err)
+		return 1
+	}
+	rows := historyRows(records, since)
+
+	out := os.Stdout
+	if opts.exportOutput != "" && opts.exportOutput != "-" {
+		f, err := os.Create(opts.exportOutput)
+		if err != nil {
+			log.Printf("Ошибка создания файла выгрузки: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	if opts.exportFormat == exportParquet {
+		err = writeHistoryParquet(w, rows)
+	} else {
+		err = writeHistoryCSV(w, rows)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && out != os.Stdout {
+		err = out.Close()
+	}
+	if err != nil {
+		log.Printf("Ошибка записи выгрузки: %v\n", err)
+		return 1
+	}
+	if out != os.Stdout {
+		log.Printf("Выгружено строк: %d в %s\n", len(rows), opts.exportOutput)
+	}
+	return 0
+}
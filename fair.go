@@ -0,0 +1,69 @@
+package main
+
+import "time"
+
+// fairFolder — папка, не обработанная целиком за свою долю времени
+// (--fair-share); index — её место в итогах запуска.
+type fairFolder struct {
+	index int
+	rule  folderRule
+	opts  processOptions
+}
+
+// fairDeadline возвращает окончание доли времени папки: оставшееся до
+// deadline время делится поровну между папками круга, которые ещё не
+// обрабатывались. Время, не использованное папкой, достаётся следующим.
+func fairDeadline(deadline time.Time, folders int) time.Time {
+	return time.Now().Add(time.Until(deadline) / time.Duration(max(folders, 1)))
+}
+
+// fairRounds обрабатывает по кругу папки, не успевшие за свою долю времени,
+// пока они не будут обработаны целиком или не истечёт время запуска.
+// Возвращает, на каком файле остановлен запуск (stoppedAt, если все папки
+// обработаны).
+func fairRounds(results []FolderResult, unfinished []fairFolder, opts processOptions, stoppedAt string) string {
+	for len(unfinished) > 0 {
+		var next []fairFolder
+		for i, f := range unfinished {
+			res := &results[f.index]
+			if opts.expired() {
+				if stoppedAt == "" {
+					stoppedAt = res.StoppedAt
+				}
+				continue
+			}
+			f.opts.Deadline = fairDeadline(opts.Deadline, len(unfinished)-i)
+			again, err := processFolder(res.Folder, f.rule, f.opts)
+			again.Err = err
+			res.resume(again)
+			if err != nil {
+				if f.rule.BestEffort {
+					events.emitCode(EventWarning, folderErrorCode(err), res.Folder, "", "Ошибка обработки папки '%s' (best_effort): %v", res.Folder, err)
+				} else {
+					events.emitCode(EventError, folderErrorCode(err), res.Folder, "", "Ошибка обработки папки '%s': %v", res.Folder, err)
+				}
+				continue
+			}
+			if res.StoppedAt != "" {
+				next = append(next, f)
+			}
+		}
+		unfinished = next
+	}
+	return stoppedAt
+}
+
+// resume добавляет к итогам папки итоги её повторной обработки next: действия
+// суммируются, а оставленные файлы и их причины берутся из последней
+// обработки. Число файлов папки остаётся от первого чтения.
+func (res *FolderResult) resume(next FolderResult) {
+	total, quota := res.Total, res.QuotaDeleted
+	res.Skipped, res.SkipReasons, res.Kept, res.Future = 0, nil, nil, 0
+	res.merge(next)
+	res.Total = total
+	res.QuotaDeleted = quota + next.QuotaDeleted
+	res.Truncated = next.Truncated
+	res.StoppedAt = next.StoppedAt
+	res.Duration += next.Duration
+	res.Err = next.Err
+}
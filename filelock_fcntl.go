@@ -0,0 +1,41 @@
+//go:build aix || solaris
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// На AIX, Solaris и illumos нет flock, поэтому блокировки ставятся через
+// fcntl. Такие блокировки принадлежат процессу, а не дескриптору, и
+// разделяют процессы так же, как flock.
+
+// lockFile захватывает исключительную рекомендательную блокировку файла,
+// ожидая её освобождения другими процессами.
+func lockFile(f *os.File) error {
+	return fcntlLock(f, unix.F_SETLKW, unix.F_WRLCK)
+}
+
+// unlockFile снимает блокировку, захваченную lockFile.
+func unlockFile(f *os.File) error {
+	return fcntlLock(f, unix.F_SETLK, unix.F_UNLCK)
+}
+
+// tryLockFile захватывает блокировку файла без ожидания и сообщает,
+// удалось ли это: false — файл заблокирован другим процессом.
+func tryLockFile(f *os.File) (bool, error) {
+	err := fcntlLock(f, unix.F_SETLK, unix.F_WRLCK)
+	if err == unix.EAGAIN || err == unix.EACCES {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// fcntlLock ставит или снимает блокировку всего файла.
+func fcntlLock(f *os.File, cmd int, kind int16) error {
+	lock := unix.Flock_t{Type: kind, Whence: io.SeekStart}
+	return unix.FcntlFlock(f.Fd(), cmd, &lock)
+}
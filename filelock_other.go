@@ -0,0 +1,28 @@
+//go:build !(unix || windows)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// На платформах без блокировок файлов (Plan 9, WebAssembly) одновременные
+// запуски cleanup не разделяются: lockFile и unlockFile ничего не делают.
+
+// lockFile захватывает исключительную блокировку файла; здесь — ничего
+// не делает.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile снимает блокировку, захваченную lockFile.
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+// tryLockFile сообщает, что блокировку захватить нельзя: без неё не
+// проверить, что файл не используется другим запуском.
+func tryLockFile(f *os.File) (bool, error) {
+	return false, errors.ErrUnsupported
+}
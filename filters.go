@@ -0,0 +1,35 @@
+package main
+
+import "strings"
+
+// compileFilters разбирает правила filters: шаблоны .gitignore, к которым
+// добавлены префиксы rsync — «- шаблон» исключает из очистки, как строка
+// без префикса, «+ шаблон» возвращает в неё, как «!шаблон».
+func compileFilters(source string, filters []string) (ignoreRules, error) {
+	lines := make([]string, len(filters))
+	for i, f := range filters {
+		f = strings.TrimSpace(f)
+		switch {
+		case strings.HasPrefix(f, "- "):
+			f = strings.TrimSpace(f[2:])
+		case strings.HasPrefix(f, "+ "):
+			f = "!" + strings.TrimSpace(f[2:])
+		}
+		lines[i] = f
+	}
+	return compileIgnore(source, lines)
+}
+
+// filtered возвращает правило filters или строку .cleanupignore, которые
+// исключают из очистки путь rel относительно папки, или пустую строку.
+// Правила проверяются отдельно: .cleanupignore не может вернуть в очистку
+// то, что исключено filters конфигурации. Сам .cleanupignore исключён всегда.
+func (r folderRule) filtered(rel string, dir bool) string {
+	if strings.EqualFold(rel, ignoreFileName) {
+		return ignoreFileName
+	}
+	if hit := r.Filters.match(rel, dir); hit != "" {
+		return hit
+	}
+	return r.Ignore.match(rel, dir)
+}
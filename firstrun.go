@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// folderState — сведения о папке, которую cleanup уже очищал.
+type folderState struct {
+	FirstRun time.Time `json:"first_run"`
+	LastRun  time.Time `json:"last_run"`
+	// BackfillStep — число пройденных шагов постепенной очистки (backfill).
+	BackfillStep int `json:"backfill_step,omitempty"`
+}
+
+// folderStatePath возвращает путь к файлу состояния папок.
+func folderStatePath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "folders.json"), nil
+}
+
+// folderKey возвращает ключ папки в файле состояния — абсолютный путь.
+func folderKey(folder string) string {
+	if abs, err := filepath.Abs(folder); err == nil {
+		return abs
+	}
+	return filepath.Clean(folder)
+}
+
+// loadFolderState читает состояние папок; отсутствие файла — пустое состояние.
+func loadFolderState(path string) (map[string]folderState, error) {
+	state := make(map[string]folderState)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return make(map[string]folderState), fmt.Errorf("%s: %v", path, err)
+	}
+	return state, nil
+}
+
+// updateFolderState записывает в файл состояния сведения о папках changes,
+// обработанных запуском. Файл перечитывается под блокировкой (path.lock) и
+// заменяется через временный файл: одновременные запуски с разными
+// конфигурациями не теряют записи друг друга, а сбой во время записи не
+// оставляет файл обрезанным. Повреждённый файл заменяется новым.
+func updateFolderState(path string, changes map[string]folderState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+	state, _ := loadFolderState(path)
+	for key, change := range changes {
+		state[key] = mergeFolderState(state[key], change)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// mergeFolderState объединяет запись файла состояния с записью запуска:
+// самый ранний первый запуск, самый поздний последний и наибольший шаг
+// постепенной очистки.
+func mergeFolderState(old, change folderState) folderState {
+	if old.FirstRun.IsZero() || (!change.FirstRun.IsZero() && change.FirstRun.Before(old.FirstRun)) {
+		old.FirstRun = change.FirstRun
+	}
+	if change.LastRun.After(old.LastRun) {
+		old.LastRun = change.LastRun
+	}
+	old.BackfillStep = max(old.BackfillStep, change.BackfillStep)
+	return old
+}
+
+// writeFileAtomic записывает файл через временный файл в том же каталоге,
+// сброшенный на диск и переименованный поверх path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err2 := tmp.Sync(); err == nil {
+		err = err2
+	}
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// knownFolders возвращает папки, которые уже очищались: из файла состояния
+// и из истории запусков, чтобы папки, очищавшиеся до появления файла
+// состояния, не считались новыми.
+func (cfg Config) knownFolders(state map[string]folderState) map[string]bool {
+	known := make(map[string]bool, len(state))
+	for key := range state {
+		known[key] = true
+	}
+	if cfg.HistoryFile == "-" {
+		return known
+	}
+	path, err := cfg.historyPath()
+	if err != nil {
+		return known
+	}
+	records, err := readHistory(path)
+	if err != nil {
+		events.emit(EventWarning, "", "", "Ошибка чтения истории запусков %s: %v", path, err)
+	}
+	for _, rec := range records {
+		if rec.DryRun {
+			continue
+		}
+		for _, f := range rec.Folders {
+			if f.Error == "" && !f.FirstRun {
+				known[folderKey(f.Folder)] = true
+			}
+		}
+	}
+	return known
+}
+
+// loggedRuns сообщает, записаны ли в журнале logFile запуски не в пробном
+// режиме. Журнал версий без файла состояния и истории не содержит путей
+// папок, но показывает, что cleanup уже удалял файлы по этой конфигурации.
+// Журнал с шаблоном в пути появился вместе с файлом состояния и не читается.
+func loggedRuns(logFile string) bool {
+	if strings.Contains(logFile, "{{") {
+		return false
+	}
+	paths := []string{logFile}
+	if dir, err := stateDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, filepath.Base(logFile)))
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.Contains(line, "файлов обнаружено:") && !strings.HasSuffix(line, ", пробный запуск") {
+				f.Close()
+				return true
+			}
+		}
+		f.Close()
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMergeFolderState(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name        string
+		old, change folderState
+		want        folderState
+	}{
+		{
+			name:   "новая папка",
+			change: folderState{FirstRun: day(10), LastRun: day(10)},
+			want:   folderState{FirstRun: day(10), LastRun: day(10)},
+		},
+		{
+			name:   "следующий запуск",
+			old:    folderState{FirstRun: day(1), LastRun: day(9)},
+			change: folderState{FirstRun: day(10), LastRun: day(10)},
+			want:   folderState{FirstRun: day(1), LastRun: day(10)},
+		},
+		{
+			name:   "запуск, завершившийся раньше записанного",
+			old:    folderState{FirstRun: day(5), LastRun: day(12)},
+			change: folderState{FirstRun: day(3), LastRun: day(11)},
+			want:   folderState{FirstRun: day(3), LastRun: day(12)},
+		},
+		{
+			name:   "запуск без первого запуска",
+			old:    folderState{FirstRun: day(5), LastRun: day(5)},
+			change: folderState{LastRun: day(6)},
+			want:   folderState{FirstRun: day(5), LastRun: day(6)},
+		},
+		{
+			name:   "шаг backfill не уменьшается",
+			old:    folderState{FirstRun: day(1), LastRun: day(2), BackfillStep: 3},
+			change: folderState{FirstRun: day(1), LastRun: day(3), BackfillStep: 2},
+			want:   folderState{FirstRun: day(1), LastRun: day(3), BackfillStep: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeFolderState(tt.old, tt.change); got != tt.want {
+				t.Errorf("mergeFolderState() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateFolderState(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		initial string // "-" — файла нет
+		want    map[string]folderState
+	}{
+		{
+			name:    "файла нет",
+			initial: "-",
+			want:    map[string]folderState{"/a": {FirstRun: start, LastRun: start}},
+		},
+		{
+			name:    "записи других конфигураций сохраняются",
+			initial: `{"/b": {"first_run": "2024-04-01T00:00:00Z", "last_run": "2024-04-02T00:00:00Z"}}`,
+			want: map[string]folderState{
+				"/a": {FirstRun: start, LastRun: start},
+				"/b": {FirstRun: start.AddDate(0, -1, 0), LastRun: start.AddDate(0, -1, 1)},
+			},
+		},
+		{
+			name:    "повреждённый файл заменяется",
+			initial: `{"/b": `,
+			want:    map[string]folderState{"/a": {FirstRun: start, LastRun: start}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state", "folders.json")
+			if tt.initial != "-" {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.initial), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := updateFolderState(path, map[string]folderState{"/a": {FirstRun: start, LastRun: start}}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadFolderState(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("состояние %+v, want %+v", got, tt.want)
+			}
+			for key, want := range tt.want {
+				if st := got[key]; !st.FirstRun.Equal(want.FirstRun) || !st.LastRun.Equal(want.LastRun) {
+					t.Errorf("%s: %+v, want %+v", key, st, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggedRuns(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     string // "-" — журнала нет
+		inState bool   // журнал в каталоге состояния
+		tmpl    bool   // путь журнала — шаблон
+		want    bool
+	}{
+		{name: "журнала нет", log: "-"},
+		{name: "запуск с удалением", log: "2024-05-01T02:00:00Z - файлов обнаружено: 10, удалено: 3, хост: web-1, экземпляр: default\n", want: true},
+		{name: "только пробные запуски", log: "2024-05-01T02:00:00Z - файлов обнаружено: 10, удалено: 0, хост: web-1, экземпляр: default, пробный запуск\n"},
+		{name: "журнал без итогов", log: "Error: папка не найдена\n"},
+		{name: "журнал в каталоге состояния", log: "2024-05-01T02:00:00Z - файлов обнаружено: 1, удалено: 1, хост: web-1, экземпляр: default\n", inState: true, want: true},
+		{name: "шаблон в пути", log: "2024-05-01T02:00:00Z - файлов обнаружено: 1, удалено: 1, хост: web-1, экземпляр: default\n", tmpl: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "xdg"))
+			t.Setenv("ProgramData", filepath.Join(dir, "xdg"))
+			state, err := stateDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			logFile := filepath.Join(dir, "cleanup.log")
+			if tt.tmpl {
+				logFile = filepath.Join(dir, "cleanup{{.Date}}.log")
+			}
+			if tt.log != "-" {
+				path := logFile
+				if tt.inState {
+					path = filepath.Join(state, filepath.Base(logFile))
+				}
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(tt.log), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := loggedRuns(logFile); got != tt.want {
+				t.Errorf("loggedRuns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1162 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FolderSettings — настройки, которые можно задать как для отдельной папки,
+// так и в секции defaults для всех папок. Незаданные (nil) поля наследуются.
+type FolderSettings struct {
+	Days *int `yaml:"days"`
+	// RetentionByExtension задаёт срок хранения в днях для файлов
+	// с определённым расширением, например {".log": 7, ".zip": 90}.
+	RetentionByExtension map[string]int `yaml:"retention_by_extension"`
+	// Required — ошибка или отсутствие папки проваливает весь запуск.
+	Required *bool `yaml:"required"`
+	// BestEffort — ошибки папки выводятся как предупреждения и не считаются
+	// ошибками запуска.
+	BestEffort *bool `yaml:"best_effort"`
+	// Concurrency — сколько файлов папки удаляется одновременно.
+	Concurrency *int `yaml:"concurrency"`
+	// RateLimit — не больше стольких удалений в секунду (0 — без ограничения).
+	RateLimit *float64 `yaml:"rate_limit"`
+	// IOPriority — класс ввода-вывода потоков удаления: idle, low или normal (Linux).
+	IOPriority *string `yaml:"io_priority"`
+	// Nice — значение nice потоков удаления (Linux).
+	Nice *int `yaml:"nice"`
+	// TierTo — куда перемещать файлы старше TierDays дней: каталог
+	// (например, архивный диск) или s3://bucket/prefix. Файлы старше
+	// срока хранения удаляются как обычно.
+	TierTo   *string `yaml:"tier_to"`
+	TierDays *int    `yaml:"tier_days"`
+	// SoftDelete включает мягкое удаление: файлы переименовываются
+	// в <имя>.deleted-<время> и окончательно удаляются через заданный срок.
+	SoftDelete *time.Duration `yaml:"soft_delete"`
+	// Include — шаблоны имён файлов (например, *.log), которые очищаются;
+	// остальные файлы папки не затрагиваются. Пусто — все файлы.
+	Include []string `yaml:"include"`
+	// Exclude — шаблоны имён файлов папки, которые никогда не удаляются;
+	// дополняют общий список exclude.
+	Exclude []string `yaml:"exclude"`
+	// IncludeRegex и ExcludeRegex — регулярные выражения для имён, которые
+	// шаблонами не выразить: очищаются только файлы, подходящие под одно
+	// из include_regex (вместо общего include_regex), а файлы, подходящие
+	// под exclude_regex (в дополнение к общему), не удаляются никогда.
+	IncludeRegex []string `yaml:"include_regex"`
+	ExcludeRegex []string `yaml:"exclude_regex"`
+	// Filters — правила в стиле .gitignore и rsync, исключающие файлы и
+	// каталоги папки из очистки; действуют после общих filters.
+	Filters []string `yaml:"filters"`
+	// SubdirQuotaSize и SubdirQuotaFiles — квота каждого подкаталога папки
+	// по объёму и числу файлов; сверх квоты удаляются самые старые файлы.
+	SubdirQuotaSize  *ByteSize `yaml:"subdir_quota_size"`
+	SubdirQuotaFiles *int      `yaml:"subdir_quota_files"`
+	// Keep — сколько самых свежих файлов папки сохраняется независимо от
+	// возраста, например если задание резервного копирования перестало работать.
+	Keep *int `yaml:"keep"`
+	// MaxDelete — сколько файлов папки можно удалить за запуск (0 — без
+	// ограничения); MaxDeleteMode — abort или truncate при превышении.
+	MaxDelete     *int    `yaml:"max_delete"`
+	MaxDeleteMode *string `yaml:"max_delete_mode"`
+	// Recursive — очищать файлы и во всех подкаталогах папки, а не только
+	// в ней самой; MaxDepth — до скольких уровней подкаталогов (0 — без
+	// ограничения; заданный max_depth сам включает обход подкаталогов).
+	Recursive *bool `yaml:"recursive"`
+	MaxDepth  *int  `yaml:"max_depth"`
+	// MinFree — сколько места должно оставаться свободным на файловой
+	// системе папки: пока его меньше, удаляются самые старые файлы, даже
+	// если их срок не истёк. С MinFreeOnly файлы удаляются только ради
+	// свободного места, а не по сроку.
+	MinFree     *ByteSize `yaml:"min_free"`
+	MinFreeOnly *bool     `yaml:"min_free_only"`
+	// MaxDeletePercent — папка не очищается, если к удалению больше
+	// такой доли её файлов, % (0 — без ограничения).
+	MaxDeletePercent *float64 `yaml:"max_delete_percent"`
+	// Action — что делать с файлами, срок хранения которых истёк: delete или
+	// quarantine — переместить в QuarantineDir (с сохранением пути папки)
+	// и окончательно удалить через QuarantineTTL при следующих запусках;
+	// archive — дописать в архив tar.gz за день в ArchiveDir и удалить;
+	// move — переместить в MoveTo.
+	Action        *string        `yaml:"action"`
+	QuarantineDir *string        `yaml:"quarantine_dir"`
+	QuarantineTTL *time.Duration `yaml:"quarantine_ttl"`
+	ArchiveDir    *string        `yaml:"archive_dir"`
+	MoveTo        *string        `yaml:"move_to"`
+	// FollowReparsePoints разрешает обходить символические ссылки и
+	// соединения (junction) на каталоги в подкаталогах квот.
+	FollowReparsePoints *bool `yaml:"follow_reparse_points"`
+	// Policy — составное условие удаления (all, any, not над older_than,
+	// larger_than, smaller_than, name, beyond_newest) вместо срока хранения.
+	Policy *Policy `yaml:"policy"`
+	// CompressDays — файлы старше стольких дней сжимаются на месте
+	// в <имя>.gz, как в logrotate; дальше срок хранения отсчитывается как обычно.
+	CompressDays *int `yaml:"compress_days"`
+	// Retention — сроки хранения по шаблонам имён в порядке проверки,
+	// например [{"*.log": 7d}, {"*.zip": 30d}, {"*": 90d}]: файл хранится
+	// по первому подошедшему правилу, а возраст отсчитывается от самого
+	// свежего файла этого же правила.
+	Retention []RetentionRule `yaml:"retention"`
+	// GFS — схема хранения «дед — отец — сын» (daily, weekly, monthly)
+	// вместо срока хранения.
+	GFS *GFS `yaml:"gfs"`
+	// HonorRetain — учитывать даты хранения отдельных файлов (атрибут
+	// user.cleanup.expires или файл-спутник <имя>.retain), например для
+	// данных под юридическим удержанием.
+	HonorRetain *bool `yaml:"honor_retain"`
+	// KeepOnePer — из файлов старше срока хранения сохраняется самый свежий
+	// за каждый календарный период: day, week, month или year.
+	KeepOnePer *string `yaml:"keep_one_per"`
+	// Backfill — убывающие сроки хранения первых запусков новой папки,
+	// например [365, 180]: каждый успешный запуск переходит к следующему
+	// сроку, а после последнего действует обычный. Так давно не очищавшийся
+	// том освобождается за несколько запусков, а не за один многочасовой.
+	Backfill []int `yaml:"backfill"`
+	// Anchor — от чего отсчитывается срок хранения: newest — от самого
+	// свежего файла, now — от текущего времени; по умолчанию как у запуска.
+	Anchor *string `yaml:"anchor"`
+	// TimeFields — отметки времени, по которым определяется возраст файла:
+	// mtime, ctime, atime, birth; по умолчанию [mtime, birth]. Время
+	// создания на многих файловых системах Linux ненадёжно.
+	TimeFields []string `yaml:"time_fields"`
+	// TimeMatch — файл старше отсечки по всем отметкам (all, по умолчанию)
+	// или хотя бы по одной (any).
+	TimeMatch *string `yaml:"time_match"`
+	// ProtectMapped — не удалять файлы, запущенные процессами или
+	// отображённые в их память (Linux, по /proc/*/exe и /proc/*/maps).
+	ProtectMapped *bool `yaml:"protect_mapped"`
+	// KeepReadWithin — не удалять файлы, которые читали (atime) за
+	// последние столько дней, даже если их срок хранения истёк.
+	KeepReadWithin *int `yaml:"keep_read_within"`
+	// Verify — внешняя проверка перед удалением файлов по шаблону:
+	// файл удаляется, только если команда или HTTP-адрес подтвердили это.
+	Verify *Verify `yaml:"verify"`
+	// Unit — что очищается как целое: file — файлы папки (по умолчанию),
+	// dir — подкаталоги первого уровня (например, каталоги резервных копий
+	// 2024-01-15/), которые удаляются вместе с содержимым.
+	Unit *string `yaml:"unit"`
+	// Symlinks — что делать с символическими ссылками на файлы: skip —
+	// пропускать (по умолчанию), delete — удалять старые ссылки по их
+	// собственному времени, follow — по времени файла внутри папки, на
+	// который ведёт ссылка. Удаляется только сама ссылка.
+	Symlinks *string `yaml:"symlinks"`
+	// MinSize — файлы меньше этого объёма (например, маркеры и файлы
+	// состояния) не удаляются и не влияют на самый свежий файл.
+	MinSize *ByteSize `yaml:"min_size"`
+	// MaxSize — файлы больше этого объёма не удаляются.
+	MaxSize *ByteSize `yaml:"max_size"`
+	// OnlyLargerThan — удаляются только файлы строго больше этого объёма
+	// (например, дампы памяти больше 500M), остальные остаются.
+	OnlyLargerThan *ByteSize `yaml:"only_larger_than"`
+	// Owner и Group — удаляются только файлы этих пользователей и групп
+	// (имена или uid/gid), например в общем каталоге временных файлов.
+	Owner []string `yaml:"owner"`
+	Group []string `yaml:"group"`
+}
+
+// inherit возвращает настройки, в которых незаданные поля взяты из defaults.
+func (s FolderSettings) inherit(defaults FolderSettings) FolderSettings {
+	if s.Days == nil {
+		s.Days = defaults.Days
+	}
+	if s.Required == nil {
+		s.Required = defaults.Required
+	}
+	if s.BestEffort == nil {
+		s.BestEffort = defaults.BestEffort
+	}
+	if s.Concurrency == nil {
+		s.Concurrency = defaults.Concurrency
+	}
+	if s.RateLimit == nil {
+		s.RateLimit = defaults.RateLimit
+	}
+	if s.IOPriority == nil {
+		s.IOPriority = defaults.IOPriority
+	}
+	if s.Nice == nil {
+		s.Nice = defaults.Nice
+	}
+	if s.TierTo == nil {
+		s.TierTo = defaults.TierTo
+	}
+	if s.TierDays == nil {
+		s.TierDays = defaults.TierDays
+	}
+	if s.SoftDelete == nil {
+		s.SoftDelete = defaults.SoftDelete
+	}
+	if s.Include == nil {
+		s.Include = defaults.Include
+	}
+	if s.Exclude == nil {
+		s.Exclude = defaults.Exclude
+	}
+	if s.IncludeRegex == nil {
+		s.IncludeRegex = defaults.IncludeRegex
+	}
+	if s.ExcludeRegex == nil {
+		s.ExcludeRegex = defaults.ExcludeRegex
+	}
+	if s.Filters == nil {
+		s.Filters = defaults.Filters
+	}
+	if s.SubdirQuotaSize == nil {
+		s.SubdirQuotaSize = defaults.SubdirQuotaSize
+	}
+	if s.SubdirQuotaFiles == nil {
+		s.SubdirQuotaFiles = defaults.SubdirQuotaFiles
+	}
+	if s.Keep == nil {
+		s.Keep = defaults.Keep
+	}
+	if s.MaxDelete == nil {
+		s.MaxDelete = defaults.MaxDelete
+	}
+	if s.MaxDeleteMode == nil {
+		s.MaxDeleteMode = defaults.MaxDeleteMode
+	}
+	if s.Recursive == nil {
+		s.Recursive = defaults.Recursive
+	}
+	if s.MaxDepth == nil {
+		s.MaxDepth = defaults.MaxDepth
+	}
+	if s.MinFree == nil {
+		s.MinFree = defaults.MinFree
+	}
+	if s.MinFreeOnly == nil {
+		s.MinFreeOnly = defaults.MinFreeOnly
+	}
+	if s.MaxDeletePercent == nil {
+		s.MaxDeletePercent = defaults.MaxDeletePercent
+	}
+	if s.FollowReparsePoints == nil {
+		s.FollowReparsePoints = defaults.FollowReparsePoints
+	}
+	if s.Policy == nil {
+		s.Policy = defaults.Policy
+	}
+	if s.CompressDays == nil {
+		s.CompressDays = defaults.CompressDays
+	}
+	if s.Action == nil {
+		s.Action = defaults.Action
+	}
+	if s.QuarantineDir == nil {
+		s.QuarantineDir = defaults.QuarantineDir
+	}
+	if s.QuarantineTTL == nil {
+		s.QuarantineTTL = defaults.QuarantineTTL
+	}
+	if s.ArchiveDir == nil {
+		s.ArchiveDir = defaults.ArchiveDir
+	}
+	if s.MoveTo == nil {
+		s.MoveTo = defaults.MoveTo
+	}
+	if s.Retention == nil {
+		s.Retention = defaults.Retention
+	}
+	if s.GFS == nil {
+		s.GFS = defaults.GFS
+	}
+	if s.HonorRetain == nil {
+		s.HonorRetain = defaults.HonorRetain
+	}
+	if s.KeepOnePer == nil {
+		s.KeepOnePer = defaults.KeepOnePer
+	}
+	if s.Backfill == nil {
+		s.Backfill = defaults.Backfill
+	}
+	if s.Anchor == nil {
+		s.Anchor = defaults.Anchor
+	}
+	if s.TimeFields == nil {
+		s.TimeFields = defaults.TimeFields
+	}
+	if s.TimeMatch == nil {
+		s.TimeMatch = defaults.TimeMatch
+	}
+	if s.ProtectMapped == nil {
+		s.ProtectMapped = defaults.ProtectMapped
+	}
+	if s.KeepReadWithin == nil {
+		s.KeepReadWithin = defaults.KeepReadWithin
+	}
+	if s.Verify == nil {
+		s.Verify = defaults.Verify
+	}
+	if s.Unit == nil {
+		s.Unit = defaults.Unit
+	}
+	if s.Symlinks == nil {
+		s.Symlinks = defaults.Symlinks
+	}
+	if s.MinSize == nil {
+		s.MinSize = defaults.MinSize
+	}
+	if s.MaxSize == nil {
+		s.MaxSize = defaults.MaxSize
+	}
+	if s.OnlyLargerThan == nil {
+		s.OnlyLargerThan = defaults.OnlyLargerThan
+	}
+	if s.Owner == nil {
+		s.Owner = defaults.Owner
+	}
+	if s.Group == nil {
+		s.Group = defaults.Group
+	}
+	// Сроки по расширениям объединяются: значения папки перекрывают defaults.
+	if len(defaults.RetentionByExtension) > 0 {
+		merged := maps.Clone(defaults.RetentionByExtension)
+		maps.Copy(merged, s.RetentionByExtension)
+		s.RetentionByExtension = merged
+	}
+	return s
+}
+
+// FolderSpec описывает папку для очистки и её собственные настройки,
+// перекрывающие общие.
+type FolderSpec struct {
+	Path           string       `yaml:"path"`
+	Canary         *CanaryCheck `yaml:"canary"` // папка-канарейка, обрабатывается первой
+	FolderSettings `yaml:",inline"`
+}
+
+// parseFolderSpec разбирает строку папки с необязательными параметрами
+// после «?», например "/var/backups/db?days=30". Так простые настройки
+// папки можно задать в FOLDERS и в командной строке без перехода на YAML.
+func parseFolderSpec(s string) (FolderSpec, error) {
+	s = strings.TrimSpace(s)
+	spec := FolderSpec{Path: s}
+	// Ищем последний «?», за которым идут параметры вида ключ=значение:
+	// так пути вида \\?\C:\data не принимаются за параметры.
+	idx := strings.LastIndex(s, "?")
+	if idx < 0 || !strings.Contains(s[idx+1:], "=") {
+		return spec, nil
+	}
+	spec.Path = strings.TrimSpace(s[:idx])
+	query, err := url.ParseQuery(s[idx+1:])
+	if err != nil {
+		return spec, fmt.Errorf("неверные параметры папки %q: %v", s, err)
+	}
+	// Ключи перебираются по порядку, чтобы сообщение об ошибке не зависело от запуска.
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		value := query[key][len(query[key])-1]
+		switch key {
+		case "days":
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 0 {
+				return spec, fmt.Errorf("папка %s: days должно быть целым неотрицательным числом", spec.Path)
+			}
+			spec.Days = &days
+		case "required", "best_effort", "follow_reparse_points", "honor_retain", "protect_mapped", "recursive", "min_free_only":
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: %s должно быть true или false", spec.Path, key)
+			}
+			switch key {
+			case "required":
+				spec.Required = &flag
+			case "best_effort":
+				spec.BestEffort = &flag
+			case "honor_retain":
+				spec.HonorRetain = &flag
+			case "protect_mapped":
+				spec.ProtectMapped = &flag
+			case "recursive":
+				spec.Recursive = &flag
+			case "min_free_only":
+				spec.MinFreeOnly = &flag
+			default:
+				spec.FollowReparsePoints = &flag
+			}
+		case "keep", "max_delete":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return spec, fmt.Errorf("папка %s: %s должно быть целым неотрицательным числом", spec.Path, key)
+			}
+			if key == "keep" {
+				spec.Keep = &n
+			} else {
+				spec.MaxDelete = &n
+			}
+		case "max_delete_mode":
+			spec.MaxDeleteMode = &value
+		case "max_delete_percent":
+			percent, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: max_delete_percent должно быть числом", spec.Path)
+			}
+			spec.MaxDeletePercent = &percent
+		case "tier_days", "compress_days", "keep_read_within":
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 0 {
+				return spec, fmt.Errorf("папка %s: %s должно быть целым неотрицательным числом", spec.Path, key)
+			}
+			switch key {
+			case "tier_days":
+				spec.TierDays = &days
+			case "compress_days":
+				spec.CompressDays = &days
+			default:
+				spec.KeepReadWithin = &days
+			}
+		case "max_depth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 0 {
+				return spec, fmt.Errorf("папка %s: max_depth должно быть целым неотрицательным числом", spec.Path)
+			}
+			spec.MaxDepth = &depth
+		case "tier_to":
+			spec.TierTo = &value
+		case "soft_delete", "quarantine_ttl":
+			grace, err := time.ParseDuration(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: %s должно быть длительностью, например 72h", spec.Path, key)
+			}
+			if key == "soft_delete" {
+				spec.SoftDelete = &grace
+			} else {
+				spec.QuarantineTTL = &grace
+			}
+		case "action":
+			spec.Action = &value
+		case "quarantine_dir":
+			spec.QuarantineDir = &value
+		case "archive_dir":
+			spec.ArchiveDir = &value
+		case "move_to":
+			spec.MoveTo = &value
+		case "concurrency", "nice":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: %s должно быть целым числом", spec.Path, key)
+			}
+			if key == "concurrency" {
+				spec.Concurrency = &n
+			} else {
+				spec.Nice = &n
+			}
+		case "rate_limit":
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: rate_limit должно быть числом", spec.Path)
+			}
+			spec.RateLimit = &rate
+		case "io_priority":
+			spec.IOPriority = &value
+		case "keep_one_per":
+			spec.KeepOnePer = &value
+		case "anchor":
+			spec.Anchor = &value
+		case "unit":
+			spec.Unit = &value
+		case "symlinks":
+			spec.Symlinks = &value
+		case "min_size", "max_size", "only_larger_than":
+			n, err := parseByteSize(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: %s: %v", spec.Path, key, err)
+			}
+			size := ByteSize(n)
+			switch key {
+			case "min_size":
+				spec.MinSize = &size
+			case "max_size":
+				spec.MaxSize = &size
+			default:
+				spec.OnlyLargerThan = &size
+			}
+		case "time_fields":
+			spec.TimeFields = strings.Split(value, ",")
+		case "time_match":
+			spec.TimeMatch = &value
+		case "backfill":
+			steps, err := parseBackfill(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: backfill: %v", spec.Path, err)
+			}
+			spec.Backfill = steps
+		case "include":
+			spec.Include = strings.Split(value, ",")
+		case "owner":
+			spec.Owner = strings.Split(value, ",")
+		case "group":
+			spec.Group = strings.Split(value, ",")
+		case "exclude":
+			spec.Exclude = strings.Split(value, ",")
+		case "include_regex":
+			// Выражение может содержать запятые: несколько выражений задаются
+			// повторением ключа.
+			spec.IncludeRegex = query[key]
+		case "exclude_regex":
+			spec.ExcludeRegex = query[key]
+		case "retention":
+			rules, err := parseRetentionRules(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: retention: %v", spec.Path, err)
+			}
+			spec.Retention = rules
+		case "subdir_quota_size", "min_free":
+			n, err := parseByteSize(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: %s: %v", spec.Path, key, err)
+			}
+			size := ByteSize(n)
+			if key == "min_free" {
+				spec.MinFree = &size
+			} else {
+				spec.SubdirQuotaSize = &size
+			}
+		case "subdir_quota_files":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return spec, fmt.Errorf("папка %s: subdir_quota_files должно быть целым неотрицательным числом", spec.Path)
+			}
+			spec.SubdirQuotaFiles = &n
+		case "retention_by_extension":
+			// Таблица записывается через запятую: .zip:90,.tar.gz:30.
+			table := make(map[string]int)
+			for _, item := range strings.Split(value, ",") {
+				ext, d, ok := strings.Cut(item, ":")
+				days, err := strconv.Atoi(strings.TrimSpace(d))
+				if !ok || err != nil {
+					return spec, fmt.Errorf("папка %s: retention_by_extension задаётся как .zip:90,.tar.gz:30", spec.Path)
+				}
+				table[ext] = days
+			}
+			spec.RetentionByExtension = table
+		case "canary":
+			on, err := strconv.ParseBool(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: canary должно быть true или false", spec.Path)
+			}
+			spec.canaryCheck().enabled = on
+		case "canary_min_deleted", "canary_max_deleted":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return spec, fmt.Errorf("папка %s: %s должно быть целым неотрицательным числом", spec.Path, key)
+			}
+			if key == "canary_min_deleted" {
+				spec.canaryCheck().MinDeleted = &n
+			} else {
+				spec.canaryCheck().MaxDeleted = &n
+			}
+		case "canary_max_freed":
+			n, err := parseByteSize(value)
+			if err != nil {
+				return spec, fmt.Errorf("папка %s: canary_max_freed: %v", spec.Path, err)
+			}
+			size := ByteSize(n)
+			spec.canaryCheck().MaxFreed = &size
+		default:
+			return spec, fmt.Errorf("папка %s: неизвестный параметр %q", spec.Path, key)
+		}
+	}
+	if c := spec.Canary; c != nil && c.MinDeleted != nil && c.MaxDeleted != nil && *c.MinDeleted > *c.MaxDeleted {
+		return spec, fmt.Errorf("папка %s: canary_min_deleted больше canary_max_deleted", spec.Path)
+	}
+	if err := spec.normalize(); err != nil {
+		return spec, fmt.Errorf("папка %s: %v", spec.Path, err)
+	}
+	return spec, nil
+}
+
+// parseFolderSpecs разбирает список строк папок, пропуская пустые.
+func parseFolderSpecs(folders []string) ([]FolderSpec, error) {
+	var specs []FolderSpec
+	for _, folder := range trimFolders(folders) {
+		spec, err := parseFolderSpec(folder)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// UnmarshalYAML позволяет задавать папку в YAML строкой с параметрами
+// или объектом с ключом path и настройками папки.
+func (f *FolderSpec) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		spec, err := parseFolderSpec(s)
+		if err != nil {
+			return err
+		}
+		*f = spec
+		return nil
+	}
+	type plain FolderSpec
+	var spec plain
+	if err := unmarshal(&spec); err != nil {
+		return err
+	}
+	spec.Path = strings.TrimSpace(spec.Path)
+	if spec.Path == "" {
+		return fmt.Errorf("у папки не задан path")
+	}
+	if spec.Days != nil && *spec.Days < 0 {
+		return fmt.Errorf("папка %s: days должно быть целым неотрицательным числом", spec.Path)
+	}
+	if err := spec.FolderSettings.normalize(); err != nil {
+		return fmt.Errorf("папка %s: %v", spec.Path, err)
+	}
+	*f = FolderSpec(spec)
+	return nil
+}
+
+// folderSettings возвращает настройки папки с учётом секции defaults.
+func (cfg Config) folderSettings(spec FolderSpec) FolderSettings {
+	return spec.FolderSettings.inherit(cfg.Defaults)
+}
+
+// folderDays возвращает количество дней для папки с учётом её собственной настройки.
+func (cfg Config) folderDays(spec FolderSpec) int {
+	if days := cfg.folderSettings(spec).Days; days != nil {
+		return *days
+	}
+	return cfg.Days
+}
+
+// normalize приводит расширения в RetentionByExtension к виду «.ext»
+// в нижнем регистре и проверяет сроки и параметры параллельности.
+func (s *FolderSettings) normalize() error {
+	concurrency, rate, prio := 1, 0.0, ""
+	if s.Concurrency != nil {
+		concurrency = *s.Concurrency
+	}
+	if s.RateLimit != nil {
+		rate = *s.RateLimit
+	}
+	if s.IOPriority != nil {
+		prio = *s.IOPriority
+	}
+	if err := validateThrottle(concurrency, rate, prio); err != nil {
+		return err
+	}
+	if s.TierDays != nil && *s.TierDays < 0 {
+		return fmt.Errorf("tier_days должно быть целым неотрицательным числом")
+	}
+	if s.CompressDays != nil && *s.CompressDays < 0 {
+		return fmt.Errorf("compress_days должно быть целым неотрицательным числом")
+	}
+	if s.KeepReadWithin != nil && *s.KeepReadWithin < 0 {
+		return fmt.Errorf("keep_read_within должно быть целым неотрицательным числом")
+	}
+	if s.SoftDelete != nil && *s.SoftDelete < 0 {
+		return fmt.Errorf("soft_delete не может быть отрицательным")
+	}
+	if s.QuarantineTTL != nil && *s.QuarantineTTL < 0 {
+		return fmt.Errorf("quarantine_ttl не может быть отрицательным")
+	}
+	if s.Action != nil {
+		if err := validateActionName(*s.Action); err != nil {
+			return err
+		}
+	}
+	if s.MaxDelete != nil || s.MaxDeleteMode != nil {
+		limit, mode := 0, maxDeleteAbort
+		if s.MaxDelete != nil {
+			limit = *s.MaxDelete
+		}
+		if s.MaxDeleteMode != nil {
+			mode = *s.MaxDeleteMode
+		}
+		if err := validateMaxDelete(limit, mode); err != nil {
+			return err
+		}
+	}
+	if s.MaxDeletePercent != nil {
+		if err := validateMaxDeletePercent(*s.MaxDeletePercent); err != nil {
+			return err
+		}
+	}
+	if s.Keep != nil && *s.Keep < 0 {
+		return fmt.Errorf("keep должно быть целым неотрицательным числом")
+	}
+	if s.SubdirQuotaFiles != nil && *s.SubdirQuotaFiles < 0 {
+		return fmt.Errorf("subdir_quota_files должно быть целым неотрицательным числом")
+	}
+	if err := validatePatterns("include", s.Include); err != nil {
+		return err
+	}
+	for i := range s.Include {
+		s.Include[i] = foldName(strings.TrimSpace(s.Include[i]))
+	}
+	if err := validatePatterns("exclude", s.Exclude); err != nil {
+		return err
+	}
+	if _, err := compileFilters("filters папки", s.Filters); err != nil {
+		return err
+	}
+	if _, err := resolveOwners("owner", s.Owner, lookupUserID); err != nil {
+		return err
+	}
+	if _, err := resolveOwners("group", s.Group, lookupGroupID); err != nil {
+		return err
+	}
+	if s.Policy != nil {
+		if err := s.Policy.validate(); err != nil {
+			return err
+		}
+	}
+	if s.GFS != nil {
+		if err := s.GFS.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Verify != nil {
+		if err := s.Verify.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Unit != nil {
+		if err := validateUnit(*s.Unit); err != nil {
+			return err
+		}
+	}
+	if s.Symlinks != nil {
+		if err := validateSymlinks(*s.Symlinks); err != nil {
+			return err
+		}
+	}
+	if s.KeepOnePer != nil {
+		if err := validateKeepOnePer(*s.KeepOnePer); err != nil {
+			return err
+		}
+	}
+	if err := validateBackfill(s.Backfill); err != nil {
+		return err
+	}
+	if s.Anchor != nil {
+		if err := validateAnchor(*s.Anchor); err != nil {
+			return err
+		}
+	}
+	for i := range s.TimeFields {
+		s.TimeFields[i] = strings.ToLower(strings.TrimSpace(s.TimeFields[i]))
+	}
+	var match string
+	if s.TimeMatch != nil {
+		match = *s.TimeMatch
+	}
+	if err := validateTimeFields(s.TimeFields, match); err != nil {
+		return err
+	}
+	for i := range s.Exclude {
+		s.Exclude[i] = foldName(strings.TrimSpace(s.Exclude[i]))
+	}
+	if _, err := compileRegexps("include_regex", s.IncludeRegex); err != nil {
+		return err
+	}
+	if _, err := compileRegexps("exclude_regex", s.ExcludeRegex); err != nil {
+		return err
+	}
+	if s.MaxDepth != nil && *s.MaxDepth < 0 {
+		return fmt.Errorf("max_depth должно быть целым неотрицательным числом")
+	}
+	for i := range s.Retention {
+		if err := validatePatterns("retention", []string{s.Retention[i].Pattern}); err != nil {
+			return err
+		}
+		s.Retention[i].Pattern = foldName(strings.TrimSpace(s.Retention[i].Pattern))
+	}
+	if s.RetentionByExtension == nil {
+		return nil
+	}
+	byExt := make(map[string]int, len(s.RetentionByExtension))
+	for ext, days := range s.RetentionByExtension {
+		if days < 0 {
+			return fmt.Errorf("retention_by_extension: срок для %s должен быть неотрицательным", ext)
+		}
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" || ext == "." {
+			return fmt.Errorf("retention_by_extension: пустое расширение")
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		byExt[ext] = days
+	}
+	s.RetentionByExtension = byExt
+	return nil
+}
+
+// folderRule — итоговые правила очистки одной папки.
+type folderRule struct {
+	Days        int
+	ByExtension map[string]int
+	Required    bool
+	BestEffort  bool
+	Concurrency int
+	RateLimit   float64 // удалений в секунду, 0 — без ограничения
+	IOPriority  string
+	Nice        int
+	TierTo      string // пусто — файлы не перемещаются
+	TierDays    int
+	SoftDelete  time.Duration // 0 — удалять сразу
+	Include     []string      // пусто — очищаются все файлы
+	Exclude     []string      // файлы, которые никогда не удаляются
+	// IncludeRegex и ExcludeRegex действуют вместе с Include и Exclude.
+	IncludeRegex []*regexp.Regexp
+	ExcludeRegex []*regexp.Regexp
+	// Квоты каждого подкаталога; 0 — без ограничения.
+	SubdirQuotaSize  int64
+	SubdirQuotaFiles int
+	Keep             int // сколько самых свежих файлов сохранять
+	MaxDelete        int // 0 — без ограничения
+	MaxDeleteMode    string
+	// Recursive — очищать и подкаталоги; MaxDepth — уровней подкаталогов,
+	// 0 — без ограничения.
+	Recursive bool
+	MaxDepth  int
+	// MinFree — свободное место на файловой системе папки, 0 — не следить.
+	MinFree          int64
+	MinFreeOnly      bool
+	MaxDeletePercent float64 // 0 — без ограничения
+	Action           string  // delete, quarantine, archive или move
+	QuarantineDir    string
+	QuarantineTTL    time.Duration
+	ArchiveDir       string
+	MoveTo           string
+	// FollowReparsePoints — обходить ссылки на каталоги.
+	FollowReparsePoints bool
+	// Policy — условие удаления вместо срока хранения; nil — по сроку.
+	Policy *Policy
+	// CompressDays — через сколько дней сжимать файлы; 0 — не сжимать.
+	CompressDays int
+	// Retention — сроки по шаблонам имён, проверяются по порядку.
+	Retention []RetentionRule
+	// GFS — схема daily/weekly/monthly вместо срока; nil — по сроку.
+	GFS *GFS
+	// HonorRetain — не удалять файлы с неистёкшей датой хранения.
+	HonorRetain bool
+	// KeepOnePer — период прореживания; пусто — без прореживания.
+	KeepOnePer string
+	// Backfill — сроки постепенной очистки новой папки по шагам.
+	Backfill []int
+	// BackfillDays — срок текущего шага постепенной очистки: файлы не
+	// удаляются раньше, чем через столько дней; 0 — шаг не действует.
+	BackfillDays int
+	// Anchor — отсчёт срока хранения: newest или now.
+	Anchor string
+	// AsOf — дата отсчёта срока хранения вместо anchor; нулевая — не задана.
+	AsOf time.Time
+	// TimeFields и TimeMatch — отметки времени файла и условие all или
+	// any; пусто — mtime и birth по всем.
+	TimeFields []string
+	TimeMatch  string
+	// ProtectMapped — не удалять файлы, используемые процессами.
+	ProtectMapped bool
+	// KeepReadWithin — сохранять файлы, прочитанные за столько дней; 0 — нет.
+	KeepReadWithin int
+	// Verify — проверка перед удалением; nil — без проверки.
+	Verify *Verify
+	// Unit — file или dir; пусто — file.
+	Unit string
+	// Symlinks — skip, delete или follow; пусто — skip.
+	Symlinks string
+	// MinSize — наименьший размер удаляемого файла; 0 — без ограничения.
+	MinSize int64
+	// MaxSize — наибольший размер удаляемого файла; 0 — без ограничения.
+	MaxSize int64
+	// OnlyLargerThan — удаляются только файлы больше этого размера; 0 — все.
+	OnlyLargerThan int64
+	// Owner и Group — списки owner и group как заданы, OwnerIDs и
+	// GroupIDs — их uid и gid.
+	Owner, Group       []string
+	OwnerIDs, GroupIDs []string
+	// Filters — общие правила filters и правила папки.
+	Filters ignoreRules
+	// Ignore — шаблоны файла .cleanupignore папки; читаются при обработке.
+	Ignore ignoreRules
+}
+
+// folderRule возвращает правила очистки папки с учётом секции defaults;
+// незаданные параллельность и приоритет берутся из общих настроек запуска.
+func (cfg Config) folderRule(spec FolderSpec) folderRule {
+	s := cfg.folderSettings(spec)
+	rule := folderRule{
+		Days:        cfg.folderDays(spec),
+		ByExtension: s.RetentionByExtension,
+		Required:    s.Required != nil && *s.Required,
+		BestEffort:  s.BestEffort != nil && *s.BestEffort,
+		Concurrency: cfg.Concurrency,
+		RateLimit:   cfg.RateLimit,
+		IOPriority:  cfg.IOPriority,
+		Nice:        cfg.Nice,
+		Include:     s.Include,
+		MaxDelete:   cfg.MaxDelete,
+	}
+	rule.MaxDeleteMode = cfg.MaxDeleteMode
+	rule.MaxDeletePercent = cfg.MaxDeletePercent
+	if s.MaxDeletePercent != nil {
+		rule.MaxDeletePercent = *s.MaxDeletePercent
+	}
+	if s.Action != nil {
+		rule.Action = *s.Action
+	}
+	if s.QuarantineDir != nil {
+		rule.QuarantineDir = *s.QuarantineDir
+	}
+	if s.QuarantineTTL != nil {
+		rule.QuarantineTTL = *s.QuarantineTTL
+	}
+	if s.ArchiveDir != nil {
+		rule.ArchiveDir = *s.ArchiveDir
+	}
+	if s.MoveTo != nil {
+		rule.MoveTo = *s.MoveTo
+	}
+	rule.FollowReparsePoints = s.FollowReparsePoints != nil && *s.FollowReparsePoints
+	rule.Policy = s.Policy
+	rule.Retention = s.Retention
+	rule.GFS = s.GFS
+	rule.HonorRetain = s.HonorRetain != nil && *s.HonorRetain
+	if s.KeepOnePer != nil {
+		rule.KeepOnePer = *s.KeepOnePer
+	}
+	rule.Backfill = s.Backfill
+	rule.Anchor = cfg.Anchor
+	rule.AsOf, _ = parseAsOf(cfg.AsOf) // проверяется при запуске и в lint
+	rule.TimeFields = s.TimeFields
+	rule.ProtectMapped = s.ProtectMapped != nil && *s.ProtectMapped
+	rule.Verify = s.Verify
+	if s.Unit != nil {
+		rule.Unit = *s.Unit
+	}
+	if s.Symlinks != nil {
+		rule.Symlinks = *s.Symlinks
+	}
+	if s.MinSize != nil {
+		rule.MinSize = int64(*s.MinSize)
+	}
+	if s.MaxSize != nil {
+		rule.MaxSize = int64(*s.MaxSize)
+	}
+	if s.OnlyLargerThan != nil {
+		rule.OnlyLargerThan = int64(*s.OnlyLargerThan)
+	}
+	rule.Owner, rule.Group = s.Owner, s.Group
+	rule.OwnerIDs, _ = resolveOwners("owner", s.Owner, lookupUserID)
+	rule.GroupIDs, _ = resolveOwners("group", s.Group, lookupGroupID)
+	if s.KeepReadWithin != nil {
+		rule.KeepReadWithin = *s.KeepReadWithin
+	}
+	if s.TimeMatch != nil {
+		rule.TimeMatch = *s.TimeMatch
+	}
+	if s.Anchor != nil {
+		rule.Anchor = *s.Anchor
+	}
+	if s.CompressDays != nil {
+		rule.CompressDays = *s.CompressDays
+	}
+	if s.MaxDelete != nil {
+		rule.MaxDelete = *s.MaxDelete
+	}
+	if s.MaxDeleteMode != nil {
+		rule.MaxDeleteMode = *s.MaxDeleteMode
+	}
+	if s.Keep != nil {
+		rule.Keep = *s.Keep
+	}
+	if s.SubdirQuotaSize != nil {
+		rule.SubdirQuotaSize = int64(*s.SubdirQuotaSize)
+	}
+	if s.SubdirQuotaFiles != nil {
+		rule.SubdirQuotaFiles = *s.SubdirQuotaFiles
+	}
+	for _, pattern := range cfg.Exclude {
+		rule.Exclude = append(rule.Exclude, foldName(strings.TrimSpace(pattern)))
+	}
+	rule.Exclude = append(rule.Exclude, s.Exclude...)
+	// Ошибки выражений и шаблонов проверяются при запуске и в lint.
+	includeRegex := s.IncludeRegex
+	if includeRegex == nil {
+		includeRegex = cfg.IncludeRegex
+	}
+	rule.IncludeRegex, _ = compileRegexps("include_regex", includeRegex)
+	rule.ExcludeRegex, _ = compileRegexps("exclude_regex", append(slices.Clone(cfg.ExcludeRegex), s.ExcludeRegex...))
+	global, _ := compileFilters("filters", cfg.Filters)
+	local, _ := compileFilters("filters папки", s.Filters)
+	rule.Filters = append(global, local...)
+	if s.Concurrency != nil {
+		rule.Concurrency = *s.Concurrency
+	}
+	if s.RateLimit != nil {
+		rule.RateLimit = *s.RateLimit
+	}
+	if s.IOPriority != nil {
+		rule.IOPriority = *s.IOPriority
+	}
+	if s.Nice != nil {
+		rule.Nice = *s.Nice
+	}
+	if s.TierTo != nil {
+		rule.TierTo = *s.TierTo
+	}
+	if s.TierDays != nil {
+		rule.TierDays = *s.TierDays
+	}
+	if s.SoftDelete != nil {
+		rule.SoftDelete = *s.SoftDelete
+	}
+	if s.MaxDepth != nil {
+		rule.MaxDepth = *s.MaxDepth
+	}
+	rule.Recursive = s.Recursive != nil && *s.Recursive || rule.MaxDepth > 0
+	if s.MinFree != nil {
+		rule.MinFree = int64(*s.MinFree)
+	}
+	rule.MinFreeOnly = s.MinFreeOnly != nil && *s.MinFreeOnly
+	return rule
+}
+
+// daysFor возвращает срок хранения файла: по первому подошедшему правилу
+// retention, иначе по самому длинному совпавшему расширению (так «.tar.gz»
+// точнее «.gz»), иначе общий срок папки. На шаге постепенной очистки
+// срок не короче срока шага.
+func (r folderRule) daysFor(name string) int {
+	if i := r.retentionIndex(name); i >= 0 {
+		return max(r.Retention[i].Days, r.BackfillDays)
+	}
+	name = strings.ToLower(name)
+	days, best := r.Days, 0
+	for ext, d := range r.ByExtension {
+		if len(ext) > best && strings.HasSuffix(name, ext) {
+			days, best = d, len(ext)
+		}
+	}
+	return max(days, r.BackfillDays)
+}
+
+// included сообщает, очищается ли файл name по шаблонам include и
+// выражениям include_regex.
+func (r folderRule) included(name string) bool {
+	return (len(r.Include) == 0 || matchAny(r.Include, name)) &&
+		(len(r.IncludeRegex) == 0 || matchRegexp(r.IncludeRegex, name))
+}
+
+// excluded сообщает, защищён ли файл name от удаления шаблонами exclude
+// или выражениями exclude_regex.
+func (r folderRule) excluded(name string) bool {
+	return matchAny(r.Exclude, name) || matchRegexp(r.ExcludeRegex, name)
+}
+
+// candidateSkip проверяет отбор файла rel (путь относительно папки) для
+// очистки: include и include_regex, exclude и exclude_regex, filters и
+// .cleanupignore, файлы дат хранения (honor_retain), размер и владельца
+// (info nil — без них). Один и тот же отбор действует на файлы папки, квоты
+// подкаталогов и ссылки. Возвращает причину и пояснение для файла, который
+// не очищается, или пустую причину.
+func (r folderRule) candidateSkip(rel string, info fs.FileInfo) (SkipReason, string) {
+	name := filepath.Base(rel)
+	if !r.included(name) {
+		return SkipNotIncluded, ""
+	}
+	if r.excluded(name) {
+		return SkipExcluded, ""
+	}
+	if hit := r.filtered(rel, false); hit != "" {
+		return SkipIgnored, hit
+	}
+	if r.HonorRetain && isRetainSidecar(name) {
+		return SkipRetained, "файл с датой хранения"
+	}
+	if info != nil {
+		if detail := r.sizeSkip(info.Size()); detail != "" {
+			return SkipSize, detail
+		}
+		if detail := r.ownerSkip(fileOwner(info)); detail != "" {
+			return SkipOwner, detail
+		}
+	}
+	return "", ""
+}
+
+// entryInfo возвращает сведения о записи каталога или nil, если их не
+// удалось получить.
+func entryInfo(entry fs.DirEntry) fs.FileInfo {
+	info, err := entry.Info()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// foldedNames сообщает, что шаблоны имён сравниваются без учёта регистра:
+// так же, как файловые системы Windows и macOS (по умолчанию) сравнивают
+// имена. В остальных системах README и readme — разные файлы, и шаблон
+// README* защищает только первый.
+var foldedNames = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// foldName приводит имя файла или шаблон к виду, в котором они сравниваются:
+// в нижний регистр, если имена сравниваются без учёта регистра.
+func foldName(s string) string {
+	if foldedNames {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// matchAny сообщает, подходит ли имя файла хотя бы под один из шаблонов,
+// приведённых foldName. У файлов подкаталогов (recursive) сравнивается
+// только имя, без пути.
+func matchAny(patterns []string, name string) bool {
+	name = foldName(filepath.Base(name))
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePatterns проверяет синтаксис шаблонов имён файлов параметра key.
+// Шаблон с разделителем пути отклоняется: он сравнивается только с именем
+// файла и не подошёл бы ни к одному файлу.
+func validatePatterns(key string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("%s: неверный шаблон %q", key, pattern)
+		}
+		if strings.ContainsRune(pattern, '/') || strings.ContainsRune(pattern, filepath.Separator) {
+			return fmt.Errorf("%s: шаблон %q содержит путь, а сравнивается только с именем файла (для путей — filters или .cleanupignore)", key, pattern)
+		}
+	}
+	return nil
+}
+
+// sortedFolderSpecs возвращает копию списка папок, упорядоченную по очищенному
+// пути; папки с одинаковым путём сохраняют исходный порядок.
+func sortedFolderSpecs(specs []FolderSpec) []FolderSpec {
+	sorted := slices.Clone(specs)
+	slices.SortStableFunc(sorted, func(a, b FolderSpec) int {
+		return strings.Compare(filepath.Clean(a.Path), filepath.Clean(b.Path))
+	})
+	return sorted
+}
+
+// folderPaths возвращает пути папок из конфигурации.
+func folderPaths(specs []FolderSpec) []string {
+	paths := make([]string, len(specs))
+	for i, spec := range specs {
+		paths[i] = spec.Path
+	}
+	return paths
+}
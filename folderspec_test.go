@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestMatchAnyCase(t *testing.T) {
+	saved := foldedNames
+	defer func() { foldedNames = saved }()
+	for _, folded := range []bool{false, true} {
+		foldedNames = folded
+		patterns := []string{foldName("README*"), foldName("*.log")}
+		tests := []struct {
+			name string
+			want bool
+		}{
+			{"README.md", true},
+			{"readme.md", folded},
+			{"APP.LOG", folded},
+			{"sub/app.log", true},
+			{"app.txt", false},
+		}
+		for _, tt := range tests {
+			if got := matchAny(patterns, tt.name); got != tt.want {
+				t.Errorf("foldedNames=%v: matchAny(%q) = %v, want %v", folded, tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestIgnoreCase(t *testing.T) {
+	saved := foldedNames
+	defer func() { foldedNames = saved }()
+	for _, folded := range []bool{false, true} {
+		foldedNames = folded
+		rules, err := compileIgnore(ignoreFileName, []string{"*.LOG", "Keep/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			rel  string
+			want bool
+		}{
+			{"app.LOG", true},
+			{"app.log", folded},
+			{"Keep/a.txt", true},
+			{"keep/a.txt", folded},
+		}
+		for _, tt := range tests {
+			if got := rules.match(tt.rel, false) != ""; got != tt.want {
+				t.Errorf("foldedNames=%v: match(%q) = %v, want %v", folded, tt.rel, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestValidatePatternsPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     bool
+	}{
+		{"*.log", false},
+		{"logs/*.log", true},
+		{"[", true},
+		{" ", true},
+	}
+	for _, tt := range tests {
+		if err := validatePatterns("include", []string{tt.pattern}); (err != nil) != tt.err {
+			t.Errorf("validatePatterns(%q) = %v, want ошибку: %v", tt.pattern, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+)
+
+// usagePoint — занятый объём файловой системы в момент времени.
+type usagePoint struct {
+	At   time.Time
+	Used float64
+}
+
+// usageGrowth возвращает скорость роста занятого объёма в байтах в сутки
+// по методу наименьших квадратов. ok = false, если точек недостаточно.
+func usageGrowth(points []usagePoint) (perDay float64, ok bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+	t0 := points[0].At
+	var sx, sy, sxx, sxy float64
+	for _, p := range points {
+		x := p.At.Sub(t0).Hours() / 24
+		sx += x
+		sy += p.Used
+		sxx += x * x
+		sxy += x * p.Used
+	}
+	n := float64(len(points))
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / den, true
+}
+
+// folderUsageHistory собирает из истории запусков точки занятого объёма
+// файловой системы папки.
+func folderUsageHistory(records []RunRecord, folder string) []usagePoint {
+	var points []usagePoint
+	for _, rec := range records {
+		for _, f := range rec.Folders {
+			if f.Folder == folder && f.FSTotal > 0 {
+				points = append(points, usagePoint{At: rec.Start, Used: float64(f.FSTotal - f.FSFree)})
+			}
+		}
+	}
+	return points
+}
+
+// runForecast реализует подкоманду forecast: по распределению возраста файлов
+// и росту занятого места в истории запусков оценивает, когда файловая система
+// каждой папки заполнится до порога при текущих сроках хранения.
+func runForecast(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("forecast", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup forecast [--threshold 90] [flags] [days|config.yml] [folder1 folder2 ...]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if cfg.Days < 0 || len(cfg.Folders) == 0 {
+		log.Print(errMissingParams)
+		return 1
+	}
+	threshold := opts.threshold
+	if threshold <= 0 || threshold > 100 {
+		log.Print("Порог заполнения должен быть от 0 до 100 процентов")
+		return 1
+	}
+	historyFile, err := cfg.historyPath()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	records, err := readHistory(historyFile)
+	if err != nil {
+		log.Printf("Ошибка чтения истории %s: %v\n", historyFile, err)
+		return 1
+	}
+
+	now := time.Now()
+	for _, spec := range sortedFolderSpecs(cfg.Folders) {
+		folder := spec.Path
+		total, free, err := diskUsage(folder)
+		if err != nil {
+			fmt.Printf("%s: объём файловой системы неизвестен: %v\n", folder, err)
+			continue
+		}
+		est, err := estimateFolder(folder, cfg.folderRule(spec), nestedFolders(folder, cfg.Folders), cfg.LowMemory)
+		if err != nil {
+			fmt.Printf("%s: ошибка чтения папки: %v\n", folder, err)
+			continue
+		}
+		used := float64(total - free)
+		after := used - float64(est.Size) // занято после удаления файлов старше срока хранения
+		limit := float64(total) * threshold / 100
+		fmt.Printf("%s: занято %s из %s (%.0f%%), при следующем запуске освободится около %s\n",
+			folder, formatBytes(int64(used)), formatBytes(int64(total)), used/float64(total)*100, formatBytes(est.Size))
+
+		points := append(folderUsageHistory(records, folder), usagePoint{At: now, Used: used})
+		growth, ok := usageGrowth(points)
+		switch {
+		case after >= limit:
+			fmt.Printf("  порог %.0f%% уже достигнут\n", threshold)
+		case !ok:
+			fmt.Printf("  недостаточно истории запусков для прогноза (%s)\n", historyFile)
+		case growth <= 0:
+			fmt.Printf("  рост занятого места не наблюдается, порог %.0f%% не будет достигнут\n", threshold)
+		default:
+			days := (limit - after) / growth
+			at := now.Add(time.Duration(math.Min(days, 100*365) * 24 * float64(time.Hour)))
+			fmt.Printf("  рост %s в сутки: порог %.0f%% будет достигнут около %s (через %.0f дн.)\n",
+				formatBytes(int64(growth)), threshold, at.Format("2006-01-02"), math.Ceil(days))
+		}
+	}
+	return 0
+}
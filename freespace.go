@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// validateFreeSpace проверяет min_free папки: свободное место освобождается
+// удалением файлов начиная с самых старых, поэтому режим не сочетается
+// с очисткой каталогов целиком и с режимом экономии памяти, где файлы
+// обрабатываются в порядке каталога.
+func validateFreeSpace(rule folderRule, lowMemory bool) error {
+	switch {
+	case rule.MinFree == 0 && rule.MinFreeOnly:
+		return fmt.Errorf("min_free_only задан без min_free")
+	case rule.MinFree == 0:
+		return nil
+	case rule.Unit == unitDir:
+		return fmt.Errorf("min_free нельзя сочетать с unit: dir")
+	case lowMemory:
+		return fmt.Errorf("min_free нельзя сочетать с --low-memory: в этом режиме файлы обрабатываются не начиная с самых старых")
+	}
+	return nil
+}
+
+// freeTarget следит за свободным местом на файловой системе папки
+// (min_free). Потоки удаления резервируют размер файла до удаления, чтобы не
+// удалить лишнего, пока удаления других потоков ещё не завершились. Свободное
+// место перечитывается перед каждым решением (statfs): удаление жёсткой
+// ссылки, открытого файла или перенос в карантин на той же файловой системе
+// места не освобождают. В пробном запуске свободное место не меняется,
+// поэтому к нему прибавляются размеры файлов, которые были бы удалены.
+type freeTarget struct {
+	folder string
+	target uint64
+	dryRun bool
+
+	mu      sync.Mutex
+	free    uint64 // свободно по последней проверке
+	pending uint64 // зарезервировано потоками, удаление ещё не завершено
+	planned uint64 // в пробном запуске — размер файлов, которые были бы удалены
+}
+
+// newFreeTarget возвращает слежение за свободным местом папки или nil, если
+// min_free не задан. Если свободное место не удалось определить, ради него
+// файлы не удаляются.
+func newFreeTarget(res *FolderResult, folder string, rule folderRule, dryRun bool) *freeTarget {
+	if rule.MinFree <= 0 {
+		return nil
+	}
+	_, free, err := diskUsage(folder)
+	if err != nil {
+		res.fileError(folder, CodeDiskUsage, "Ошибка определения свободного места для min_free в "+folder, err)
+		return nil
+	}
+	t := &freeTarget{folder: folder, target: uint64(rule.MinFree), dryRun: dryRun, free: free}
+	if free < t.target {
+		events.emit(EventDecision, folder, "", "Папка %s: свободно %s, меньше min_free %s: удаляются самые старые файлы",
+			folder, formatBytes(int64(free)), formatBytes(rule.MinFree))
+	} else {
+		events.emit(EventDecision, folder, "", "Папка %s: свободно %s, не меньше min_free %s",
+			folder, formatBytes(int64(free)), formatBytes(rule.MinFree))
+	}
+	return t
+}
+
+// reserve сообщает, нужно ли удалить ещё файл размером size ради свободного
+// места, и резервирует его размер; после попытки удаления вызывается release.
+func (t *freeTarget) reserve(size int64) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dryRun {
+		if _, free, err := diskUsage(t.folder); err == nil {
+			t.free = free
+		}
+	}
+	if t.free+t.planned+t.pending >= t.target {
+		return false
+	}
+	t.pending += uint64(size)
+	return true
+}
+
+// release снимает резерв reserve.
+func (t *freeTarget) release(size int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending -= uint64(size)
+}
+
+// plan учитывает файл, который был бы удалён в пробном запуске.
+func (t *freeTarget) plan(size int64) {
+	if t == nil || !t.dryRun {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.planned += uint64(size)
+}
+
+// report предупреждает, если после обработки папки свободного места всё
+// ещё меньше min_free: файлов, которые можно удалить, не осталось.
+func (t *freeTarget) report() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dryRun {
+		if _, free, err := diskUsage(t.folder); err == nil {
+			t.free = free
+		}
+	}
+	if free := t.free + t.planned; free < t.target {
+		events.emit(EventWarning, t.folder, "", "Папка %s: свободно %s, меньше min_free %s, но файлов, которые можно удалить, не осталось",
+			t.folder, formatBytes(int64(free)), formatBytes(int64(t.target)))
+	}
+}
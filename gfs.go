@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GFS — схема хранения «дед — отец — сын» для папок резервных копий:
+// сохраняется самый свежий файл каждого из Daily последних дней, Weekly
+// последних недель и Monthly последних месяцев, в которые есть файлы;
+// остальные файлы удаляются независимо от возраста.
+//
+//	gfs: {daily: 7, weekly: 4, monthly: 12}
+type GFS struct {
+	Daily   int `yaml:"daily"`
+	Weekly  int `yaml:"weekly"`
+	Monthly int `yaml:"monthly"`
+}
+
+func (g *GFS) validate() error {
+	if g.Daily < 0 || g.Weekly < 0 || g.Monthly < 0 {
+		return fmt.Errorf("gfs: daily, weekly и monthly должны быть неотрицательными")
+	}
+	if g.Daily+g.Weekly+g.Monthly == 0 {
+		return fmt.Errorf("gfs: задайте daily, weekly или monthly, иначе будут удалены все файлы")
+	}
+	return nil
+}
+
+func (g *GFS) String() string {
+	return fmt.Sprintf("daily=%d, weekly=%d, monthly=%d", g.Daily, g.Weekly, g.Monthly)
+}
+
+// calendarPeriods — ключи календарных интервалов по местному времени. Ключи
+// одного периода упорядочены так же, как интервалы во времени.
+var calendarPeriods = map[string]func(time.Time) string{
+	"day": func(t time.Time) string { return t.Format("2006-01-02") },
+	"week": func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	},
+	"month": func(t time.Time) string { return t.Format("2006-01") },
+	"year":  func(t time.Time) string { return t.Format("2006") },
+}
+
+// gfsPeriods — периоды схемы GFS.
+var gfsPeriods = []struct {
+	name string
+	key  func(time.Time) string
+	n    func(*GFS) int
+}{
+	{"daily", calendarPeriods["day"], func(g *GFS) int { return g.Daily }},
+	{"weekly", calendarPeriods["week"], func(g *GFS) int { return g.Weekly }},
+	{"monthly", calendarPeriods["month"], func(g *GFS) int { return g.Monthly }},
+}
+
+// gfsFiles отбирает за один проход самый свежий файл каждого дня, недели
+// и месяца по времени изменения, храня по одному файлу на интервал.
+type gfsFiles struct {
+	g       *GFS
+	buckets []map[string]newestFile // по периодам gfsPeriods
+}
+
+func newGFSFiles(g *GFS) *gfsFiles {
+	k := &gfsFiles{g: g}
+	if g != nil {
+		for range gfsPeriods {
+			k.buckets = append(k.buckets, make(map[string]newestFile))
+		}
+	}
+	return k
+}
+
+// add учитывает файл name со временем изменения t.
+func (k *gfsFiles) add(name string, t time.Time) {
+	if k.g == nil {
+		return
+	}
+	t = t.Local()
+	for i, p := range gfsPeriods {
+		key := p.key(t)
+		if f, ok := k.buckets[i][key]; !ok || t.After(f.time) {
+			k.buckets[i][key] = newestFile{name, t}
+		}
+	}
+}
+
+// names возвращает сохраняемые файлы с интервалами, за которые они
+// сохранены, например "daily 2024-05-01, monthly 2024-05".
+func (k *gfsFiles) names() map[string]string {
+	kept := make(map[string]string)
+	if k.g == nil {
+		return kept
+	}
+	for i, p := range gfsPeriods {
+		keys := slices.Sorted(maps.Keys(k.buckets[i]))
+		slices.Reverse(keys)
+		for _, key := range keys[:min(p.n(k.g), len(keys))] {
+			name := k.buckets[i][key].name
+			kept[name] = strings.TrimPrefix(kept[name]+", "+p.name+" "+key, ", ")
+		}
+	}
+	return kept
+}
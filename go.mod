@@ -4,7 +4,6 @@ go 1.24.0
 
 require (
 	github.com/djherbis/times v1.6.0
+	golang.org/x/sys v0.0.0-20220615213510-4f61da869c0c
 	gopkg.in/yaml.v2 v2.4.0
 )
-
-require golang.org/x/sys v0.0.0-20220615213510-4f61da869c0c // indirect
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// grafanaTimeout ограничивает время ожидания Grafana API.
+const grafanaTimeout = 10 * time.Second
+
+// GrafanaOptions описывает параметры публикации аннотаций в Grafana.
+type GrafanaOptions struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	Tags  string `yaml:"tags"` // дополнительные теги через запятую
+}
+
+// grafanaBaseTags возвращает теги, общие для аннотаций начала и конца запуска.
+func grafanaBaseTags(opts GrafanaOptions, folders []string) []string {
+	host, _ := os.Hostname()
+	tags := []string{"cleanup", "host:" + host}
+	for _, f := range folders {
+		tags = append(tags, "folder:"+f)
+	}
+	for _, t := range strings.Split(opts.Tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// postGrafanaAnnotation создаёт аннотацию через POST /api/annotations.
+func postGrafanaAnnotation(opts GrafanaOptions, at time.Time, tags []string, text string) error {
+	body, err := json.Marshal(map[string]any{
+		"time": at.UnixMilli(),
+		"tags": tags,
+		"text": text,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(opts.URL, "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	client := &http.Client{Timeout: grafanaTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Grafana ответила %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// annotateRunStart публикует аннотацию о начале запуска.
+func annotateRunStart(opts GrafanaOptions, start time.Time, folders []string) error {
+	tags := append(grafanaBaseTags(opts, folders), "event:start")
+	return postGrafanaAnnotation(opts, start, tags, "cleanup: запуск очистки "+strings.Join(folders, ", "))
+}
+
+// annotateRunFinish публикует аннотацию о завершении запуска с итогами.
+func annotateRunFinish(opts GrafanaOptions, summary RunSummary, folders []string) error {
+	tags := append(grafanaBaseTags(opts, folders), "event:finish", "freed:"+formatBytes(summary.Freed))
+	if summary.FailedFolders() > 0 {
+		tags = append(tags, "status:error")
+	} else {
+		tags = append(tags, "status:ok")
+	}
+	text := fmt.Sprintf("cleanup: файлов обнаружено %d, удалено %d, освобождено %s за %s",
+		summary.Total, summary.Deleted, formatBytes(summary.Freed), summary.Duration.Round(time.Millisecond))
+	return postGrafanaAnnotation(opts, summary.Start.Add(summary.Duration), tags, text)
+}
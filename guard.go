@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Что делать с папкой, в которой файлов к удалению больше max_delete.
+const (
+	maxDeleteAbort    = "abort"    // не очищать папку
+	maxDeleteTruncate = "truncate" // удалить не больше max_delete самых старых файлов
+)
+
+// validateMaxDelete проверяет ограничение числа удалений.
+func validateMaxDelete(limit int, mode string) error {
+	if limit < 0 {
+		return fmt.Errorf("max_delete должно быть целым неотрицательным числом")
+	}
+	switch mode {
+	case "", maxDeleteAbort, maxDeleteTruncate:
+		return nil
+	}
+	return fmt.Errorf("неизвестный режим max_delete_mode %q (допустимы abort, truncate)", mode)
+}
+
+// validateMaxDeleteTotal проверяет ограничение числа удалений за запуск.
+func validateMaxDeleteTotal(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("max_delete_total должно быть целым неотрицательным числом")
+	}
+	return nil
+}
+
+// validateMaxDeletePercent проверяет ограничение доли удаляемых файлов.
+func validateMaxDeletePercent(percent float64) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("max_delete_percent должно быть от 0 до 100")
+	}
+	return nil
+}
+
+// deleteBudget — запас удалений папки по max_delete, общий для файлов самой
+// папки, квот подкаталогов и ссылок; limit 0 — без ограничения. run — запас
+// запуска по max_delete_total, общий для всех папок (nil — без ограничения):
+// ошибка в days не удалит по max_delete файлов в каждой из многих папок.
+type deleteBudget struct {
+	limit int
+	used  atomic.Int64
+	run   *deleteBudget
+	// spent — сообщение об исчерпанном запасе запуска уже выведено.
+	spent atomic.Bool
+}
+
+// newRunBudget возвращает запас удалений запуска по max_delete_total
+// (nil — без ограничения).
+func newRunBudget(limit int) *deleteBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &deleteBudget{limit: limit}
+}
+
+// take расходует одно удаление из запаса папки и запуска. Если запаса нет,
+// возвращается исчерпанное ограничение для причины max_delete, иначе пустая
+// строка.
+func (b *deleteBudget) take() string {
+	if b.limit > 0 && b.used.Add(1) > int64(b.limit) {
+		return fmt.Sprintf("max_delete=%d", b.limit)
+	}
+	if r := b.run; r != nil && r.used.Add(1) > int64(r.limit) {
+		if !r.spent.Swap(true) {
+			events.emitCode(EventError, CodeDeleteLimit, "", "", "Достигнут max_delete_total=%d: остальные файлы запуска не удаляются, проверьте срок хранения", r.limit)
+		}
+		return fmt.Sprintf("max_delete_total=%d", r.limit)
+	}
+	return ""
+}
+
+// give возвращает в запас папки и запуска удаление, взятое take, если файл
+// так и не был удалён: неудачное удаление не должно расходовать max_delete.
+func (b *deleteBudget) give() {
+	if b.limit > 0 {
+		b.used.Add(-1)
+	}
+	if r := b.run; r != nil {
+		r.used.Add(-1)
+	}
+}
+
+// guardDeletes до начала удаления проверяет max_delete_percent и max_delete:
+// n — файлов к удалению из total отобранных (файлы папки, квот подкаталогов
+// и ссылки вместе). При превышении папка не очищается, а с max_delete_mode
+// truncate удаляются только max_delete самых старых.
+func guardDeletes(res *FolderResult, folder string, rule folderRule, n, total int) error {
+	if percent := 100 * float64(n) / float64(total); rule.MaxDeletePercent > 0 && total > 0 && percent > rule.MaxDeletePercent {
+		return withCode(CodeDeleteLimit, fmt.Errorf("к удалению %d из %d файлов (%.0f%%), больше max_delete_percent=%g%%: папка не очищалась, проверьте срок хранения",
+			n, total, percent, rule.MaxDeletePercent))
+	}
+	if rule.MaxDelete > 0 && n > rule.MaxDelete {
+		if rule.MaxDeleteMode != maxDeleteTruncate {
+			return withCode(CodeDeleteLimit, fmt.Errorf("к удалению %d файлов, больше max_delete=%d: папка не очищалась, проверьте срок хранения", n, rule.MaxDelete))
+		}
+		events.emitCode(EventError, CodeDeleteLimit, folder, "", "Папка %s: к удалению %d файлов, больше max_delete=%d: будут удалены только %d самых старых",
+			folder, n, rule.MaxDelete, rule.MaxDelete)
+		res.Truncated = n - rule.MaxDelete
+	}
+	return nil
+}
+
+// validateLowMemory проверяет, что режим экономии памяти не сочетается с
+// ограничением времени: в этом режиме файлы обрабатываются в порядке
+// каталога, а --max-duration обещает удалять начиная с самых старых.
+func validateLowMemory(lowMemory bool, maxDuration time.Duration) error {
+	if lowMemory && maxDuration > 0 {
+		return fmt.Errorf("--low-memory нельзя сочетать с --max-duration: в режиме экономии памяти файлы обрабатываются в порядке каталога, а не начиная с самых старых")
+	}
+	return nil
+}
+
+// countCandidates возвращает, сколько файлов подлежит удалению при самых
+// свежих файлах anchors, не считая файлов, сохраняемых keep.
+func countCandidates(files []policyFile, anchors retentionAnchors, keep map[string]bool, ranks fileRanks, rule folderRule) int {
+	n := 0
+	for _, f := range files {
+		f.rank = ranks.of(f.name)
+		if !keep[f.name] && rule.expired(f, anchors.of(f.name)) {
+			n++
+		}
+	}
+	return n
+}
+
+// oldestCandidates возвращает limit самых старых файлов к удалению (при
+// равном времени — по имени), чтобы в режиме экономии памяти, где файлы
+// обрабатываются в порядке каталога, max_delete_mode truncate оставлял те же
+// самые свежие файлы, что и в обычном режиме.
+func oldestCandidates(files []policyFile, anchors retentionAnchors, keep map[string]bool, ranks fileRanks, rule folderRule, limit int) map[string]bool {
+	var expired []policyFile
+	for _, f := range files {
+		f.rank = ranks.of(f.name)
+		if !keep[f.name] && rule.expired(f, anchors.of(f.name)) {
+			expired = append(expired, f)
+		}
+	}
+	slices.SortFunc(expired, func(a, b policyFile) int {
+		if c := a.newest.Compare(b.newest); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	names := make(map[string]bool, min(limit, len(expired)))
+	for _, f := range expired[:min(limit, len(expired))] {
+		names[f.name] = true
+	}
+	return names
+}
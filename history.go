@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// historyPath возвращает путь к файлу истории запусков: заданный в
+// конфигурации или history.jsonl в каталоге состояния. Значение «-»
+// отключает историю.
+func (cfg Config) historyPath() (string, error) {
+	if cfg.HistoryFile != "" {
+		return cfg.HistoryFile, nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// appendHistory дописывает запись о запуске в файл истории (JSON Lines).
+func appendHistory(path string, rec RunRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeLocked(f, append(data, '\n'))
+}
+
+// readHistory читает записи истории; повреждённые строки пропускаются.
+func readHistory(path string) ([]RunRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []RunRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var rec RunRecord
+		if json.Unmarshal(sc.Bytes(), &rec) == nil {
+			records = append(records, rec)
+		}
+	}
+	return records, sc.Err()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileName — файл исключений в самой очищаемой папке.
+const ignoreFileName = ".cleanupignore"
+
+// ignorePattern — строка файла .cleanupignore или правило filters.
+type ignorePattern struct {
+	source  string // .cleanupignore или filters
+	line    int
+	text    string
+	negate  bool // !шаблон возвращает ранее исключённое
+	dirOnly bool // шаблон/ подходит только для каталогов
+	re      *regexp.Regexp
+}
+
+// ignoreRules — шаблоны в порядке источника; nil — шаблонов нет.
+type ignoreRules []ignorePattern
+
+// loadIgnore читает .cleanupignore папки folder; nil — файла нет.
+func loadIgnore(folder string) (ignoreRules, error) {
+	f, err := os.Open(filepath.Join(folder, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return compileIgnore(ignoreFileName, lines)
+}
+
+// compileIgnore разбирает шаблоны в синтаксисе .gitignore; source — их
+// источник для пояснений. Пустые строки и строки с # пропускаются,
+// ! отменяет исключение, / в конце ограничивает шаблон каталогами, шаблон
+// с / в начале или середине отсчитывается от папки, без / — подходит под
+// имя на любом уровне, ** — любое число каталогов. Регистр имён учитывается
+// так же, как в include и exclude (см. foldName).
+func compileIgnore(source string, lines []string) (ignoreRules, error) {
+	rules := ignoreRules{}
+	for i, line := range lines {
+		text := strings.TrimRight(line, " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p := ignorePattern{source: source, line: i + 1, text: text}
+		pattern := strings.TrimPrefix(text, `\`) // \# и \! — буквальные символы
+		if pattern == text && strings.HasPrefix(pattern, "!") {
+			p.negate, pattern = true, pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			p.dirOnly, pattern = true, strings.TrimRight(pattern, "/")
+		}
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		expr := ignoreRegexp(foldName(pattern))
+		if !anchored {
+			expr = "(?:.*/)?" + expr
+		}
+		var err error
+		if p.re, err = regexp.Compile("^" + expr + "$"); err != nil {
+			return nil, fmt.Errorf("%s, строка %d: неверный шаблон %q", source, i+1, text)
+		}
+		rules = append(rules, p)
+	}
+	return rules, nil
+}
+
+// ignoreRegexp переводит шаблон .gitignore в регулярное выражение.
+func ignoreRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match возвращает шаблон, исключивший путь rel
+// (относительно папки, через /), или пустую строку. Решает последний
+// подходящий шаблон; файл в исключённом каталоге не вернуть шаблоном с !,
+// как и в .gitignore.
+func (r ignoreRules) match(rel string, dir bool) string {
+	rel = foldName(filepath.ToSlash(rel))
+	if len(r) == 0 {
+		return ""
+	}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if hit := r.last(strings.Join(parts[:i], "/"), true); hit != "" {
+			return hit
+		}
+	}
+	return r.last(rel, dir)
+}
+
+// last применяет шаблоны к одному пути без учёта родительских каталогов.
+func (r ignoreRules) last(rel string, dir bool) string {
+	hit := ""
+	for _, p := range r {
+		if p.dirOnly && !dir || !p.re.MatchString(rel) {
+			continue
+		}
+		hit = ""
+		if !p.negate {
+			hit = fmt.Sprintf("%s:%d: %s", p.source, p.line, p.text)
+		}
+	}
+	return hit
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wizard задаёт вопросы пользователю и читает ответы построчно.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask задаёт вопрос и возвращает ответ; пустой ответ заменяется значением по умолчанию.
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// askYesNo задаёт вопрос с ответом да/нет.
+func (w *wizard) askYesNo(question string, def bool) (bool, error) {
+	d := "н"
+	if def {
+		d = "д"
+	}
+	for {
+		answer, err := w.ask(question+" (д/н)", d)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "д", "да", "y", "yes":
+			return true, nil
+		case "н", "нет", "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(w.out, "Ответьте «д» или «н»")
+	}
+}
+
+// initAnswers — ответы, собранные мастером.
+type initAnswers struct {
+	Folders     []string
+	Days        int
+	PushGateway string
+	GrafanaURL  string
+}
+
+// askInit проводит диалог и собирает параметры конфигурации.
+func askInit(w *wizard) (initAnswers, error) {
+	var a initAnswers
+	for {
+		line, err := w.ask("Папки для очистки через запятую", "")
+		if err != nil {
+			return a, err
+		}
+		a.Folders = trimFolders(strings.Split(line, ","))
+		if len(a.Folders) > 0 {
+			break
+		}
+		fmt.Fprintln(w.out, "Нужно указать хотя бы одну папку")
+	}
+	for _, folder := range a.Folders {
+		if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+			fmt.Fprintf(w.out, "Внимание: папка %s сейчас недоступна\n", folder)
+		}
+	}
+	for {
+		line, err := w.ask("Сколько дней хранить файлы (отсчёт от самого свежего файла в папке)", "30")
+		if err != nil {
+			return a, err
+		}
+		days, err := strconv.Atoi(line)
+		if err != nil || days < 0 {
+			fmt.Fprintln(w.out, "Нужно целое неотрицательное число")
+			continue
+		}
+		if days == 0 {
+			ok, err := w.askYesNo("days=0 удаляет все файлы, кроме самых свежих. Продолжить", false)
+			if err != nil {
+				return a, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		a.Days = days
+		break
+	}
+	notify, err := w.askYesNo("Настроить отправку результатов в мониторинг", false)
+	if err != nil {
+		return a, err
+	}
+	if notify {
+		if a.PushGateway, err = w.ask("Адрес Prometheus Pushgateway (пусто — не использовать)", ""); err != nil {
+			return a, err
+		}
+		if a.GrafanaURL, err = w.ask("Адрес Grafana для аннотаций (пусто — не использовать)", ""); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// renderInitConfig формирует YAML конфигурацию с комментариями.
+func renderInitConfig(a initAnswers, path string) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "# Конфигурация cleanup, созданная командой `cleanup init`.")
+	fmt.Fprintln(&b, "#")
+	fmt.Fprintln(&b, "# Для каждой папки находится самый свежий файл, от его даты")
+	fmt.Fprintln(&b, "# отсчитывается days дней назад, и удаляются файлы, у которых и время")
+	fmt.Fprintln(&b, "# создания, и время модификации старше этого дня отсечки.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "# Версия схемы конфигурации.")
+	fmt.Fprintf(&b, "version: %d\n", configVersion)
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "# Сколько дней хранить файлы; 0 — удалять всё, кроме самых свежих файлов.")
+	fmt.Fprintf(&b, "days: %d\n", a.Days)
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "# Папки для очистки (обрабатываются только файлы верхнего уровня).")
+	fmt.Fprintln(&b, "folders:")
+	for _, folder := range a.Folders {
+		fmt.Fprintf(&b, "  - %s\n", strconv.Quote(folder))
+	}
+	if a.PushGateway != "" {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "# Отправка метрик запуска в Prometheus Pushgateway.")
+		fmt.Fprintln(&b, "push_gateway:")
+		fmt.Fprintf(&b, "  url: %s\n", strconv.Quote(a.PushGateway))
+	}
+	if a.GrafanaURL != "" {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "# Аннотации о запусках в Grafana; токен можно задать переменной GRAFANA_TOKEN.")
+		fmt.Fprintln(&b, "grafana:")
+		fmt.Fprintf(&b, "  url: %s\n", strconv.Quote(a.GrafanaURL))
+	}
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "# Перед первым запуском проверьте конфигурацию:")
+	fmt.Fprintf(&b, "#   cleanup lint --config %s\n", path)
+	fmt.Fprintln(&b, "# Запуск:")
+	fmt.Fprintf(&b, "#   cleanup run --config %s\n", path)
+	return b.String()
+}
+
+// runInit реализует подкоманду init: интерактивно создаёт файл конфигурации.
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	output := fs.String("o", "config.yml", "Путь к создаваемому файлу конфигурации")
+	force := fs.Bool("force", false, "Перезаписать существующий файл")
+	var help bool
+	if _, err := parseFlags(fs, args, &help); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if help {
+		fmt.Println("Usage: cleanup init [-o config.yml] [--force]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "Файл %s уже существует, используйте --force для перезаписи\n", *output)
+		return 1
+	}
+
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	answers, err := askInit(w)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nОшибка ввода: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(*output, []byte(renderInitConfig(answers, *output)), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка записи %s: %v\n", *output, err)
+		return 1
+	}
+	fmt.Printf("Конфигурация записана в %s\n", *output)
+	return 0
+}
@@ -0,0 +1,42 @@
+package main
+
+import "path/filepath"
+
+// mappedFiles — файлы папки, открытые процессами как исполняемые файлы или
+// отображённые в память (разделяемые библиотеки, плагины): удаление такого
+// файла ломает работающий процесс при следующей подгрузке.
+type mappedFiles struct {
+	folder string            // путь папки, как он задан в конфигурации
+	real   string            // путь папки без символических ссылок
+	files  map[string]string // по реальному пути файла: какие процессы его используют
+}
+
+// loadMappedFiles собирает файлы папки folder, используемые процессами.
+// unreadable — сколько процессов не удалось проверить (нет прав).
+func loadMappedFiles(folder string) (m *mappedFiles, unreadable int, err error) {
+	real, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		return nil, 0, err
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return nil, 0, err
+	}
+	files, unreadable, err := processMappedFiles(real)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &mappedFiles{folder: folder, real: real, files: files}, unreadable, nil
+}
+
+// of возвращает, какими процессами используется файл path внутри папки;
+// пусто — файл не используется.
+func (m *mappedFiles) of(path string) string {
+	if m == nil {
+		return ""
+	}
+	rel, err := filepath.Rel(m.folder, path)
+	if err != nil {
+		return ""
+	}
+	return m.files[filepath.Join(m.real, rel)]
+}
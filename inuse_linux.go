@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// processMappedFiles просматривает /proc/*/exe и /proc/*/maps и возвращает
+// файлы внутри root, используемые процессами, с их номерами и именами.
+func processMappedFiles(root string) (map[string]string, int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make(map[string][]string)
+	add := func(path, proc string) {
+		if isSubpath(root, path) && !slices.Contains(users[path], proc) {
+			users[path] = append(users[path], proc)
+		}
+	}
+	unreadable := 0
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		comm, _ := os.ReadFile(filepath.Join(dir, "comm"))
+		proc := fmt.Sprintf("%s[%d]", strings.TrimSpace(string(comm)), pid)
+		if exe, err := os.Readlink(filepath.Join(dir, "exe")); err == nil {
+			add(exe, proc)
+		}
+		f, err := os.Open(filepath.Join(dir, "maps"))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				unreadable++
+			}
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// адрес права смещение устройство inode путь
+			fields := strings.SplitN(scanner.Text(), " ", 6)
+			if len(fields) < 6 {
+				continue
+			}
+			if path := strings.TrimSpace(fields[5]); strings.HasPrefix(path, "/") && !strings.HasSuffix(path, " (deleted)") {
+				add(path, proc)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			unreadable++
+		}
+		f.Close()
+	}
+	files := make(map[string]string, len(users))
+	for path, procs := range users {
+		files[path] = strings.Join(procs, ", ")
+	}
+	return files, unreadable, nil
+}
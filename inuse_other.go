@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// processMappedFiles не поддерживается: отображённые файлы процессов
+// перечисляются через /proc только в Linux.
+func processMappedFiles(string) (map[string]string, int, error) {
+	return nil, 0, errors.New("проверка файлов, используемых процессами, поддерживается только в Linux")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// newestFiles запоминает имена n самых свежих файлов папки за один проход,
+// не храня остальные: так keep работает и в режиме экономии памяти.
+type newestFiles struct {
+	n     int
+	files []newestFile // по убыванию времени
+}
+
+type newestFile struct {
+	name string
+	time time.Time
+}
+
+// add учитывает файл name с временем t.
+func (k *newestFiles) add(name string, t time.Time) {
+	if k.n <= 0 {
+		return
+	}
+	i, _ := slices.BinarySearchFunc(k.files, t, func(f newestFile, t time.Time) int {
+		return t.Compare(f.time)
+	})
+	if i >= k.n {
+		return
+	}
+	k.files = slices.Insert(k.files, i, newestFile{name, t})
+	if len(k.files) > k.n {
+		k.files = k.files[:k.n]
+	}
+}
+
+// names возвращает множество имён сохраняемых файлов.
+func (k *newestFiles) names() map[string]bool {
+	names := make(map[string]bool, len(k.files))
+	for _, f := range k.files {
+		names[f.name] = true
+	}
+	return names
+}
+
+// fileRanks — места самых свежих файлов папки, считая с 0.
+type fileRanks struct {
+	places map[string]int
+	n      int
+}
+
+// ranks возвращает места запомненных файлов (для условия beyond_newest).
+func (k *newestFiles) ranks() fileRanks {
+	places := make(map[string]int, len(k.files))
+	for i, f := range k.files {
+		places[f.name] = i
+	}
+	return fileRanks{places: places, n: k.n}
+}
+
+// of возвращает место файла name; файлы, не вошедшие в запомненные, получают n.
+func (r fileRanks) of(name string) int {
+	if i, ok := r.places[name]; ok {
+		return i
+	}
+	return r.n
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// runLegacy поддерживает старую форму запуска без подкоманды
+// (`cleanup 30 /path1 /path2`, `cleanup config.yml` или только переменные окружения).
+// Аргументы разбираются так же, как у подкоманды run; если заданы позиционные
+// аргументы, выводится предупреждение об устаревшей форме. Предупреждение
+// отключается переменной окружения CLEANUP_NO_DEPRECATION_WARNING.
+func runLegacy(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("run", args)
+	if opts.help {
+		printRunHelp(fs)
+		return 0
+	}
+	if err != nil {
+		log.Printf("[%s] %v\n", errorCode(err, CodeConfig), err)
+		return 1
+	}
+	if len(opts.args) > 0 && os.Getenv("CLEANUP_NO_DEPRECATION_WARNING") == "" {
+		log.Printf("Внимание: запуск без подкоманды устарел и будет удалён, используйте `cleanup run %s`\n", strings.Join(args, " "))
+	}
+	return executeRun(cfg)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LifecycleOptions описывает применение политики жизненного цикла в формате
+// S3 (PutBucketLifecycleConfiguration) к локальным папкам: префикс правила
+// отсчитывается от Root, а классы хранения переходов сопоставляются
+// с каталогами или адресами s3:// через StorageClasses.
+type LifecycleOptions struct {
+	Policy         string            `yaml:"policy"`          // файл политики JSON
+	Root           string            `yaml:"root"`            // каталог, соответствующий корню bucket
+	StorageClasses map[string]string `yaml:"storage_classes"` // класс хранения -> tier_to
+}
+
+// lifecyclePolicy — поддерживаемая часть документа политики S3.
+type lifecyclePolicy struct {
+	Rules []struct {
+		ID     string `json:"ID"`
+		Status string `json:"Status"`
+		Prefix *string
+		Filter *struct {
+			Prefix *string
+			Tag    any
+			And    any
+		}
+		Expiration *struct {
+			Days *int
+			Date *string
+		}
+		Transitions []struct {
+			Days         *int
+			Date         *string
+			StorageClass string
+		}
+	}
+}
+
+// lifecycleFolders строит папки для очистки по включённым правилам политики:
+// Expiration.Days становится сроком хранения, переход — tier_days и tier_to.
+// В отличие от S3 возраст файла отсчитывается, как и везде в cleanup,
+// от самого свежего файла папки.
+func lifecycleFolders(opts LifecycleOptions) ([]FolderSpec, error) {
+	data, err := os.ReadFile(opts.Policy)
+	if err != nil {
+		return nil, err
+	}
+	var policy lifecyclePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("%s: %v", opts.Policy, err)
+	}
+	if opts.Root == "" {
+		return nil, fmt.Errorf("не задан каталог для политики %s (--lifecycle-root)", opts.Policy)
+	}
+	var specs []FolderSpec
+	for i, rule := range policy.Rules {
+		name := rule.ID
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.Status != "Enabled" {
+			continue
+		}
+		prefix := ""
+		switch {
+		case rule.Filter != nil && (rule.Filter.Tag != nil || rule.Filter.And != nil):
+			return nil, fmt.Errorf("правило %s: фильтры по тегам не поддерживаются", name)
+		case rule.Filter != nil && rule.Filter.Prefix != nil:
+			prefix = *rule.Filter.Prefix
+		case rule.Prefix != nil:
+			prefix = *rule.Prefix
+		}
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			return nil, fmt.Errorf("правило %s: префикс %q должен обозначать каталог и заканчиваться на «/»", name, prefix)
+		}
+		if rule.Expiration == nil || rule.Expiration.Days == nil {
+			return nil, fmt.Errorf("правило %s: поддерживаются только правила с Expiration.Days", name)
+		}
+		spec := FolderSpec{Path: filepath.Join(opts.Root, filepath.FromSlash(prefix))}
+		spec.Days = rule.Expiration.Days
+		switch len(rule.Transitions) {
+		case 0:
+		case 1:
+			t := rule.Transitions[0]
+			if t.Days == nil {
+				return nil, fmt.Errorf("правило %s: поддерживаются только переходы с Days", name)
+			}
+			dest, ok := opts.StorageClasses[t.StorageClass]
+			if !ok {
+				return nil, fmt.Errorf("правило %s: для класса хранения %s не задан каталог (lifecycle.storage_classes)", name, t.StorageClass)
+			}
+			spec.TierDays, spec.TierTo = t.Days, &dest
+		default:
+			return nil, fmt.Errorf("правило %s: поддерживается не больше одного перехода", name)
+		}
+		if err := spec.normalize(); err != nil {
+			return nil, fmt.Errorf("правило %s: %v", name, err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
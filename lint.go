@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// lintLevel — серьёзность замечания линтера.
+type lintLevel string
+
+const (
+	lintWarning lintLevel = "ПРЕДУПРЕЖДЕНИЕ"
+	lintError   lintLevel = "ОШИБКА"
+)
+
+// lintIssue — одно замечание к конфигурации.
+type lintIssue struct {
+	Level   lintLevel
+	Message string
+}
+
+// lintConfig проверяет конфигурацию на подозрительные настройки.
+func lintConfig(cfg Config) []lintIssue {
+	var issues []lintIssue
+	add := func(level lintLevel, format string, args ...any) {
+		issues = append(issues, lintIssue{Level: level, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, warning := range cfg.discoverWarnings {
+		add(lintWarning, "%s", warning)
+	}
+	if cfg.Days < 0 {
+		add(lintError, "days=%d: количество дней не может быть отрицательным", cfg.Days)
+	}
+	if cfg.Days == 0 {
+		add(lintWarning, "days=0 при удалении: будут удалены все файлы, кроме самых свежих в каждой папке")
+	}
+	for _, spec := range cfg.Folders {
+		if spec.Days != nil && *spec.Days == 0 {
+			add(lintWarning, "папка %s: days=0 при удалении: будут удалены все файлы, кроме самых свежих", spec.Path)
+		}
+		if err := validateRecursive(cfg.folderRule(spec)); err != nil {
+			add(lintError, "папка %s: %v", spec.Path, err)
+		}
+		if err := validateFreeSpace(cfg.folderRule(spec), cfg.LowMemory); err != nil {
+			add(lintError, "папка %s: %v", spec.Path, err)
+		}
+		if err := validateDirUnit(cfg.folderRule(spec)); err != nil {
+			add(lintError, "папка %s: %v", spec.Path, err)
+		}
+		if rule := cfg.folderRule(spec); rule.Required && rule.BestEffort {
+			add(lintError, "папка %s: required и best_effort взаимоисключают друг друга", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); rule.TierTo != "" && rule.TierDays >= rule.Days {
+			add(lintError, "папка %s: tier_days=%d должно быть меньше срока хранения %d: иначе файлы удаляются, не дожидаясь перемещения", spec.Path, rule.TierDays, rule.Days)
+		}
+		if rule := cfg.folderRule(spec); rule.MinFree > 0 && (rule.Action == actionQuarantine || rule.Action == actionMove) {
+			add(lintWarning, "папка %s: min_free с action=%s: перемещённые файлы освобождают место, только если каталог на другой файловой системе", spec.Path, rule.Action)
+		}
+		if rule := cfg.folderRule(spec); rule.CompressDays > 0 && rule.Policy == nil && rule.GFS == nil && rule.CompressDays >= rule.Days {
+			add(lintError, "папка %s: compress_days=%d должно быть меньше срока хранения %d: иначе файлы удаляются, не дожидаясь сжатия", spec.Path, rule.CompressDays, rule.Days)
+		}
+		if rule := cfg.folderRule(spec); rule.Action != "" || rule.QuarantineDir != "" || rule.ArchiveDir != "" || rule.MoveTo != "" {
+			if err := validateAction(rule); err != nil {
+				add(lintError, "папка %s: %v", spec.Path, err)
+			} else if rule.QuarantineDir != "" && rule.Action != actionQuarantine {
+				add(lintWarning, "папка %s: quarantine_dir задан, но action не quarantine: файлы не перемещаются в карантин", spec.Path)
+			} else if rule.ArchiveDir != "" && rule.Action != actionArchive {
+				add(lintWarning, "папка %s: archive_dir задан, но action не archive: файлы не архивируются", spec.Path)
+			} else if rule.MoveTo != "" && rule.Action != actionMove {
+				add(lintWarning, "папка %s: move_to задан, но action не move: файлы не перемещаются", spec.Path)
+			}
+		}
+		byExt := cfg.folderSettings(spec).RetentionByExtension
+		for _, ext := range slices.Sorted(maps.Keys(byExt)) {
+			if byExt[ext] == 0 {
+				add(lintWarning, "папка %s: срок 0 дней для %s: будут удалены все такие файлы, кроме самых свежих", spec.Path, ext)
+			}
+		}
+		if rule := cfg.folderRule(spec); rule.GFS != nil && (rule.Policy != nil || len(rule.Retention) > 0) {
+			add(lintWarning, "папка %s: задана схема gfs, policy и retention не применяются", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); rule.ProtectMapped && runtime.GOOS != "linux" {
+			add(lintError, "папка %s: protect_mapped поддерживается только в Linux, папка не будет очищаться", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); (len(rule.Owner) > 0 || len(rule.Group) > 0) && !ownersSupported {
+			add(lintError, "папка %s: owner и group поддерживаются только в Unix, файлы папки не будут удаляться", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); slices.Contains(rule.TimeFields, timeAtime) {
+			add(lintWarning, "папка %s: time_fields с atime: при монтировании с noatime или relatime время чтения обновляется редко или не обновляется", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); rule.KeepReadWithin > 0 {
+			add(lintWarning, "папка %s: keep_read_within: при монтировании с noatime время чтения не обновляется, и защита не действует", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); rule.Unit == unitDir {
+			if rule.Policy != nil || rule.GFS != nil || rule.KeepOnePer != "" || rule.CompressDays > 0 || rule.KeepReadWithin > 0 ||
+				rule.SubdirQuotaSize > 0 || rule.SubdirQuotaFiles > 0 || rule.Symlinks != "" && rule.Symlinks != symlinksSkip || rule.Recursive {
+				add(lintWarning, "папка %s: при unit=dir каталоги удаляются целиком по сроку и keep; policy, gfs, keep_one_per, compress_days, keep_read_within, symlinks, recursive и квоты подкаталогов не применяются", spec.Path)
+			}
+		}
+		if rule := cfg.folderRule(spec); rule.sizeRangeEmpty() {
+			add(lintWarning, "папка %s: max_size не больше min_size или only_larger_than, ни один файл не будет удалён", spec.Path)
+		}
+		if rule := cfg.folderRule(spec); len(rule.Backfill) > 0 {
+			if rule.GFS != nil || rule.Policy != nil {
+				add(lintWarning, "папка %s: сроки backfill не применяются к схеме gfs и условию policy", spec.Path)
+			} else if last := rule.Backfill[len(rule.Backfill)-1]; last <= rule.Days {
+				add(lintWarning, "папка %s: срок backfill %d не длиннее срока хранения %d и ничего не меняет", spec.Path, last, rule.Days)
+			}
+		}
+		if rule := cfg.folderRule(spec); len(rule.Retention) > 0 {
+			if rule.Policy != nil {
+				add(lintWarning, "папка %s: задано policy, сроки retention не применяются", spec.Path)
+			}
+			for i, rr := range rule.Retention[:len(rule.Retention)-1] {
+				if rr.Pattern == "*" {
+					add(lintWarning, "папка %s: правило retention \"*\" подходит под все файлы, правила после него (%d) не применяются", spec.Path, len(rule.Retention)-i-1)
+					break
+				}
+			}
+		}
+	}
+
+	switch cfg.FuturePolicy {
+	case futureKeep, futureReset, futureDelete:
+	default:
+		add(lintError, "future_policy=%q: допустимы keep, reset, delete", cfg.FuturePolicy)
+	}
+	if err := validateAnchor(cfg.Anchor); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validatePlanUpload(cfg); err != nil {
+		add(lintError, "%v", err)
+	} else if cfg.PlanUpload != "" && cfg.LowMemory {
+		add(lintWarning, "plan_upload при low_memory: список файлов не собирается, план содержит только счётчики")
+	}
+	if asOf, err := parseAsOf(cfg.AsOf); err != nil {
+		add(lintError, "%v", err)
+	} else if asOf.After(time.Now()) {
+		add(lintWarning, "as_of=%s в будущем: срок хранения отсчитывается от ещё не наступившей даты", cfg.AsOf)
+	}
+	for _, spec := range cfg.Folders {
+		if rule := cfg.folderRule(spec); rule.Anchor == anchorNow && rule.Days == 0 && rule.Policy == nil && rule.GFS == nil {
+			add(lintWarning, "папка %s: anchor=now при days=0: будут удалены все файлы, включая самые свежие", spec.Path)
+		}
+	}
+	if cfg.FuturePolicy == futureDelete {
+		add(lintWarning, "future_policy=delete: файлы со временем в будущем будут удалены независимо от срока хранения")
+	}
+
+	if err := validateThrottle(cfg.Concurrency, cfg.RateLimit, cfg.IOPriority); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validatePatterns("exclude", cfg.Exclude); err != nil {
+		add(lintError, "%v", err)
+	}
+	if _, err := compileFilters("filters", cfg.Filters); err != nil {
+		add(lintError, "%v", err)
+	}
+	if _, err := compileRegexps("include_regex", cfg.IncludeRegex); err != nil {
+		add(lintError, "%v", err)
+	}
+	if _, err := compileRegexps("exclude_regex", cfg.ExcludeRegex); err != nil {
+		add(lintError, "%v", err)
+	}
+	if _, err := loadProtection(cfg.Protect); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateLocked(cfg.LockedFiles); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateRetry(cfg.Retry); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateOutput(cfg.Output); err != nil {
+		add(lintError, "%v", err)
+	}
+	if _, err := parseLogLevel(cfg.LogLevel); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateMaxDelete(cfg.MaxDelete, cfg.MaxDeleteMode); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateMaxDeleteTotal(cfg.MaxDeleteTotal); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateMaxDeletePercent(cfg.MaxDeletePercent); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateLowMemory(cfg.LowMemory, cfg.MaxDuration); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateQueue(cfg.Queue); err != nil {
+		add(lintError, "%v", err)
+	}
+	if err := validateMaintenance(cfg.Maintenance); err != nil {
+		add(lintError, "%v", err)
+	}
+	if len(cfg.Maintenance.Inhibitors) > 0 && runtime.GOOS != "linux" {
+		add(lintWarning, "maintenance.inhibitors проверяются только в Linux: на этой системе удаление будет всегда откладываться")
+	}
+
+	vars := newReportVars(time.Now(), cfg.instanceID())
+	for _, tmpl := range []string{cfg.LogFile, cfg.EventsFile} {
+		if _, err := expandReportPath(tmpl, vars); err != nil {
+			add(lintError, "%v", err)
+		}
+	}
+	if cfg.ReportRetention < 0 {
+		add(lintError, "report_retention=%d: количество дней не может быть отрицательным", cfg.ReportRetention)
+	}
+
+	folders := folderPaths(cfg.Folders)
+	if len(folders) == 0 {
+		add(lintError, "не задан список папок для очистки")
+	}
+
+	seen := make(map[string]FolderSpec)
+	var unique, abs []string
+	var uniqueSpecs []FolderSpec
+	// Общие шаблоны exclude, подошедшие хотя бы под один файл какой-либо папки.
+	excludeMatched := make(map[string]bool)
+	read := false
+	for _, spec := range cfg.Folders {
+		folder := spec.Path
+		p := folderKey(folder)
+		if prev, ok := seen[p]; ok {
+			if !cfg.sameFolderRules(prev, spec) {
+				add(lintError, "папка %s указана несколько раз с разными настройками (совпадает с %s)", folder, prev.Path)
+			} else {
+				add(lintWarning, "папка %s указана повторно (совпадает с %s)", folder, prev.Path)
+			}
+			continue
+		}
+		seen[p] = spec
+		unique = append(unique, folder)
+		uniqueSpecs = append(uniqueSpecs, spec)
+		abs = append(abs, p)
+
+		info, err := os.Stat(folder)
+		switch {
+		case err != nil:
+			add(lintError, "папка %s недоступна: %v", folder, err)
+		case !info.IsDir():
+			add(lintError, "%s не является директорией", folder)
+		default:
+			names := lintFileNames(folder, cfg.folderRule(spec))
+			if len(names) == 0 {
+				break
+			}
+			read = true
+			s := cfg.folderSettings(spec)
+			var retention []string
+			for _, rr := range s.Retention {
+				retention = append(retention, rr.Pattern)
+			}
+			for _, group := range []struct {
+				key      string
+				patterns []string
+			}{{"include", s.Include}, {"exclude", s.Exclude}, {"retention", retention}} {
+				for _, pattern := range group.patterns {
+					if !matchesAnyName(names, pattern) {
+						add(lintWarning, "папка %s: шаблон %s %q не подходит ни под один файл папки", folder, group.key, pattern)
+					}
+				}
+			}
+			for _, pattern := range cfg.Exclude {
+				if matchesAnyName(names, pattern) {
+					excludeMatched[pattern] = true
+				}
+			}
+		}
+	}
+	if read {
+		for _, pattern := range cfg.Exclude {
+			if !excludeMatched[pattern] {
+				add(lintWarning, "шаблон exclude %q не подходит ни под один файл очищаемых папок", pattern)
+			}
+		}
+	}
+
+	for i := range abs {
+		for j := range abs {
+			if i == j || !isSubpath(abs[j], abs[i]) {
+				continue
+			}
+			if rule := cfg.folderRule(uniqueSpecs[j]); rule.SubdirQuotaSize > 0 || rule.SubdirQuotaFiles > 0 {
+				add(lintWarning, "папка %s вложена в папку %s: квоты подкаталогов %s к ней не применяются, действуют её собственные правила", unique[i], unique[j], unique[j])
+			} else {
+				add(lintWarning, "папка %s вложена в папку %s", unique[i], unique[j])
+			}
+		}
+	}
+	// Каталог, куда перемещаются файлы, внутри очищаемой папки: перемещённые
+	// файлы снова попадают под очистку (квоты, срок хранения другой папки).
+	for i, spec := range uniqueSpecs {
+		rule := cfg.folderRule(spec)
+		for _, dest := range []struct{ key, dir string }{
+			{"quarantine_dir", rule.QuarantineDir}, {"archive_dir", rule.ArchiveDir}, {"move_to", rule.MoveTo}, {"tier_to", rule.TierTo},
+		} {
+			if dest.dir == "" || strings.Contains(dest.dir, "://") {
+				continue
+			}
+			dir := folderKey(dest.dir)
+			for j, p := range abs {
+				if dir == p || isSubpath(p, dir) {
+					add(lintWarning, "папка %s: %s %s находится внутри очищаемой папки %s: перемещённые туда файлы снова попадут под очистку", unique[i], dest.key, dest.dir, unique[j])
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// lintFileNames возвращает имена обычных файлов папки (с recursive — и её
+// подкаталогов) для проверки шаблонов; папку, которую не удалось прочитать,
+// lint не проверяет.
+func lintFileNames(folder string, rule folderRule) []string {
+	var names []string
+	err := readFolderFiles(folder, rule, nil, false, nil, func(entry os.DirEntry) {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	})
+	if err != nil {
+		return nil
+	}
+	return names
+}
+
+// matchesAnyName сообщает, подходит ли шаблон pattern хотя бы под одно имя.
+func matchesAnyName(names []string, pattern string) bool {
+	pattern = foldName(strings.TrimSpace(pattern))
+	for _, name := range names {
+		if matchAny([]string{pattern}, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSubpath сообщает, находится ли path внутри parent.
+func isSubpath(parent, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// runLint реализует подкоманду lint: проверяет конфигурацию, заданную теми же
+// флагами, аргументами и переменными окружения, что и для подкоманды run,
+// и возвращает код завершения (1 при наличии замечаний).
+func runLint(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("lint", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup lint [flags] [days|config.yml] [folder1 folder2 ...]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	issues := lintConfig(cfg)
+	for _, issue := range issues {
+		fmt.Printf("%s: %s\n", issue.Level, issue.Message)
+	}
+	if len(issues) > 0 {
+		return 1
+	}
+	fmt.Println("Замечаний нет")
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// LockedOptions — повторы удаления файлов, занятых другими процессами
+// (в Windows — ERROR_SHARING_VIOLATION и ERROR_LOCK_VIOLATION).
+type LockedOptions struct {
+	Retries int           `yaml:"retries"` // повторов после первой попытки
+	Backoff time.Duration `yaml:"backoff"` // пауза перед первым повтором, дальше удваивается
+}
+
+// lockedRetry — повторы удаления занятых файлов текущего запуска.
+var lockedRetry LockedOptions
+
+// lockedError — файл не удалён, потому что занят другим процессом.
+type lockedError struct {
+	path     string
+	attempts int
+	err      error
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("%s занят другим процессом (попыток: %d): %v", e.path, e.attempts, e.err)
+}
+
+func (e *lockedError) Unwrap() error { return e.err }
+
+// validateLocked проверяет параметры повторов locked_files.
+func validateLocked(opts LockedOptions) error {
+	if opts.Retries < 0 {
+		return fmt.Errorf("locked_files.retries должно быть целым неотрицательным числом")
+	}
+	if opts.Backoff < 0 {
+		return fmt.Errorf("locked_files.backoff не может быть отрицательным")
+	}
+	return nil
+}
+
+// lockedPause возвращает паузу перед повтором номер n (с 1): backoff,
+// удваиваемый с каждым повтором, но, как у retry, не больше retryMaxPause.
+func lockedPause(opts LockedOptions, n int) time.Duration {
+	wait := min(opts.Backoff, retryMaxPause)
+	for i := 1; i < n && wait < retryMaxPause; i++ {
+		wait = min(wait*2, retryMaxPause)
+	}
+	return wait
+}
+
+// retryLocked выполняет удаление remove пути path и повторяет его, пока
+// файл занят другим процессом, не больше lockedRetry.Retries раз с
+// удваивающейся паузой. Если файл так и не освободился, возвращает
+// *lockedError.
+func retryLocked(path string, remove func() error) error {
+	err := remove()
+	attempts := 1
+	for ; attempts <= lockedRetry.Retries && isSharingViolation(err); attempts++ {
+		time.Sleep(lockedPause(lockedRetry, attempts))
+		err = remove()
+	}
+	if isSharingViolation(err) {
+		return &lockedError{path: path, attempts: attempts, err: err}
+	}
+	return err
+}
+
+// removeLocked удаляет файл path с повторами, пока он занят.
+func removeLocked(path string) error {
+	return retryLocked(path, func() error {
+		return withRetry(func() error { return os.Remove(path) })
+	})
+}
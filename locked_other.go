@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// isSharingViolation всегда false: в Unix открытый файл можно удалить.
+func isSharingViolation(err error) bool {
+	return false
+}
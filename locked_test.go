@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockedPause(t *testing.T) {
+	tests := []struct {
+		name string
+		opts LockedOptions
+		n    int
+		want time.Duration
+	}{
+		{"первый повтор", LockedOptions{Backoff: 100 * time.Millisecond}, 1, 100 * time.Millisecond},
+		{"второй повтор", LockedOptions{Backoff: 100 * time.Millisecond}, 2, 200 * time.Millisecond},
+		{"четвёртый повтор", LockedOptions{Backoff: 100 * time.Millisecond}, 4, 800 * time.Millisecond},
+		{"без паузы", LockedOptions{}, 3, 0},
+		{"предел паузы", LockedOptions{Backoff: 100 * time.Millisecond}, 20, retryMaxPause},
+		{"удвоений больше разрядности", LockedOptions{Backoff: 100 * time.Millisecond}, 1000, retryMaxPause},
+		{"backoff больше предела", LockedOptions{Backoff: time.Hour}, 1, retryMaxPause},
+		{"backoff у переполнения", LockedOptions{Backoff: 1<<62 + 1}, 2, retryMaxPause},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockedPause(tt.opts, tt.n); got != tt.want {
+				t.Errorf("lockedPause() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// stateDir возвращает каталог состояния программы: %ProgramData%\cleanup
+// в Windows, иначе $XDG_STATE_HOME/cleanup или ~/.local/state/cleanup.
+func stateDir() (string, error) {
+	if runtime.GOOS == "windows" {
+		if dir := os.Getenv("ProgramData"); dir != "" {
+			return filepath.Join(dir, "cleanup"), nil
+		}
+		return "", fmt.Errorf("не задана переменная ProgramData")
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "cleanup"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "cleanup"), nil
+}
+
+// openLogFile открывает файл журнала для дописывания, создавая родительские каталоги.
+func openLogFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// writeLocked записывает данные в открытый на дописывание файл одной операцией
+// под блокировкой, чтобы записи нескольких одновременно работающих экземпляров
+// cleanup не перемешивались.
+func writeLocked(f *os.File, data []byte) error {
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("блокировка %s: %v", f.Name(), err)
+	}
+	defer unlockFile(f)
+	_, err := f.Write(data)
+	return err
+}
+
+// appendLog дописывает данные в журнал под блокировкой, используя резервный
+// путь при необходимости (см. openLogWithFallback). Возвращает фактический путь.
+func appendLog(logFile string, data []byte) (string, error) {
+	f, path, err := openLogWithFallback(logFile)
+	if err != nil {
+		return path, err
+	}
+	defer f.Close()
+	return path, writeLocked(f, data)
+}
+
+// openLogWithFallback открывает журнал по пути из конфигурации. Если это
+// невозможно (например, относительный путь при рабочем каталоге / под systemd),
+// журнал с тем же именем открывается в каталоге состояния.
+// Возвращает открытый файл и путь, по которому он фактически открыт.
+func openLogWithFallback(logFile string) (*os.File, string, error) {
+	path, err := filepath.Abs(logFile)
+	if err != nil {
+		path = logFile
+	}
+	f, err := openLogFile(path)
+	if err == nil {
+		return f, path, nil
+	}
+	dir, derr := stateDir()
+	if derr != nil {
+		return nil, path, err
+	}
+	fallback := filepath.Join(dir, filepath.Base(logFile))
+	f, ferr := openLogFile(fallback)
+	if ferr != nil {
+		return nil, path, fmt.Errorf("%v; резервный путь %s: %v", err, fallback, ferr)
+	}
+	log.Printf("Не удалось открыть журнал %s: %v, используется %s\n", path, err, fallback)
+	return f, fallback, nil
+}
@@ -1,161 +1,772 @@
 package main
 
 import (
-	"errors"
-	"flag"
 	"fmt"
-	"log"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/djherbis/times"
-	"gopkg.in/yaml.v2"
 )
 
-// Config описывает параметры запуска программы.
-type Config struct {
-	Days    int      `yaml:"days"`
-	Folders []string `yaml:"folders"`
+// FolderResult содержит итоги обработки одной папки.
+type FolderResult struct {
+	Folder   string
+	Total    int
+	Deleted  int
+	Skipped  int   // файлов оставлено, так как они не старше дня отсечки
+	Errors   int   // ошибок при обработке отдельных файлов
+	Freed    int64 // освобождено байт
+	Duration time.Duration
+	// SkipReasons и Kept объясняют, почему оставлены файлы, не попавшие под удаление.
+	SkipReasons map[SkipReason]int
+	Kept        []KeptFile
+	// ErrorCodes — сколько ошибок отдельных файлов с каждым кодом.
+	ErrorCodes map[ErrorCode]int
+	Err        error
+	// StoppedAt — файл, на котором обработка остановлена по истечении времени запуска.
+	StoppedAt string
+	// BestEffort — ошибка папки не считается ошибкой запуска.
+	BestEffort bool
+	// Future — файлов со временем изменения или создания в будущем.
+	Future int
+	// PermissionDenied — файлов, которые не удалось обработать из-за отказа в доступе;
+	// PermissionHint подсказывает, какие права нужны.
+	PermissionDenied int
+	PermissionHint   string
+	// DryRun — файлы не удалялись; Planned и PlannedFreed — сколько файлов
+	// и байт было бы удалено. FirstRun — папка очищается впервые и удаление
+	// ожидает подтверждения (--first-run-confirm).
+	DryRun       bool
+	FirstRun     bool
+	Planned      int
+	PlannedFreed int64
+	// Tiered и TieredBytes — файлов и байт, перемещённых в tier_to.
+	Tiered      int
+	TieredBytes int64
+	// SoftDeleted — файлов, переименованных в надгробия (soft_delete).
+	SoftDeleted int
+	// QuotaDeleted — файлов, убранных из подкаталогов по квотам (входят в Deleted
+	// или в счётчик действия папки: Quarantined, Archived, Moved, SoftDeleted).
+	QuotaDeleted int
+	// Truncated — файлов к удалению, оставленных сверх max_delete.
+	Truncated int
+	// Quarantined — файлов, перемещённых в карантин (action: quarantine).
+	Quarantined int
+	// Archived — файлов, записанных в архив и удалённых (action: archive).
+	Archived int
+	// Moved — файлов, перемещённых в move_to (action: move).
+	Moved int
+	// Compressed и CompressedSaved — файлов, сжатых на месте (compress_days),
+	// и сэкономленных при этом байт.
+	Compressed      int
+	CompressedSaved int64
+
+	discardKept bool // не собирать Kept (режим экономии памяти)
 }
 
-// readYAMLConfig читает конфигурацию из YAML файла.
-func readYAMLConfig(path string) (Config, error) {
-	data, err := os.ReadFile(path) // использование os.ReadFile вместо ioutil.ReadFile
-	if err != nil {
-		return Config{}, err
+// RunSummary содержит итоги всего запуска.
+type RunSummary struct {
+	Start    time.Time
+	Duration time.Duration
+	Instance string // идентификатор экземпляра (конфигурации)
+	DryRun   bool   // пробный запуск: файлы не удалялись
+	RunID    string // уникальный идентификатор запуска
+	// StoppedAt — файл или папка, на которых запуск остановлен по --max-duration.
+	StoppedAt string
+	Folders   []FolderResult
+	Missing   []string // папки, пропущенные из-за отсутствия
+	Total     int
+	Deleted   int
+	Skipped   int
+	Errors    int
+	Freed     int64
+
+	// CanaryFailed — папка-канарейка, проверка которой не пройдена;
+	// остальные папки после неё не обрабатывались.
+	CanaryFailed string
+	// Deferred — признак обслуживания системы, из-за которого удаление
+	// отложено: папки после него обработаны пробно.
+	Deferred string
+	// Resources — ресурсы, потреблённые запуском; nil — не измерялись.
+	Resources *resourceUsage
+}
+
+// FailedFolders возвращает количество папок, обработка которых завершилась ошибкой.
+// Папки best_effort не учитываются.
+func (s RunSummary) FailedFolders() int {
+	n := 0
+	for _, f := range s.Folders {
+		if f.Err != nil && !f.BestEffort {
+			n++
+		}
 	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return Config{}, err
+	return n
+}
+
+// addFolderTotals суммирует итоги папок в итоги запуска. Папки с ошибкой
+// тоже учитываются: до ошибки в них могли быть удалены файлы.
+func (s *RunSummary) addFolderTotals() {
+	for _, f := range s.Folders {
+		s.Total += f.Total
+		s.Deleted += f.Deleted
+		s.Skipped += f.Skipped
+		s.Errors += f.Errors
+		s.Freed += f.Freed
 	}
-	return cfg, nil
 }
 
-// parseEnvConfig пытается прочесть параметры из переменных окружения.
-func parseEnvConfig() (Config, error) {
-	var cfg Config
-	daysStr := os.Getenv("DAYS")
-	if daysStr != "" {
-		days, err := strconv.Atoi(daysStr)
+// PermissionDenied возвращает количество файлов, не обработанных из-за отказа в доступе.
+func (s RunSummary) PermissionDenied() int {
+	n := 0
+	for _, f := range s.Folders {
+		n += f.PermissionDenied
+	}
+	return n
+}
+
+// lowMemoryBatch — сколько записей каталога читается за раз в режиме экономии памяти.
+const lowMemoryBatch = 256
+
+// processOptions — параметры обработки, общие для всех папок запуска.
+type processOptions struct {
+	// LowMemory включает режим экономии памяти: каталог читается порциями
+	// и дважды вместо хранения списка файлов, список оставленных файлов не собирается.
+	LowMemory bool
+	// FuturePolicy — что делать с файлами, время которых в будущем: keep, reset или delete.
+	FuturePolicy string
+	// Deadline — момент, после которого удаление прекращается (нулевой — без ограничения).
+	// При заданном сроке файлы удаляются начиная с самых старых.
+	Deadline time.Time
+	// DryRun — только определить файлы к удалению, ничего не меняя.
+	DryRun bool
+	// S3 — подключение к S3 для перемещения файлов (tier_to: s3://...).
+	S3 S3Options
+	// Approved — утверждённый план (serve с scan_only): путь файла и
+	// действие над ним; nil — действия не сверяются с планом.
+	Approved map[string]string
+	// Work — каталог промежуточных файлов запуска (nil — рядом с результатом).
+	Work *workDir
+	// Slice — Deadline ограничивает долю времени папки (--fair-share), после
+	// которой обработка папки продолжится в следующем круге.
+	Slice bool
+	// Nested — вложенные в папку другие папки конфигурации (относительные
+	// пути); квоты подкаталогов их не затрагивают.
+	Nested []string
+	// Mapped — файлы папки, используемые процессами (protect_mapped).
+	Mapped *mappedFiles
+	// RunBudget — запас удалений запуска по max_delete_total, общий для
+	// всех папок (nil — без ограничения).
+	RunBudget *deleteBudget
+}
+
+// futureTolerance — допустимое расхождение часов: файлы со временем позже
+// текущего больше чем на эту величину считаются файлами «из будущего».
+const futureTolerance = time.Hour
+
+// Политики обработки файлов со временем в будущем.
+const (
+	futureKeep   = "keep"   // оставить и сообщить
+	futureReset  = "reset"  // установить время изменения в текущее, чтобы файл старел обычным образом
+	futureDelete = "delete" // удалить
+)
+
+// expired сообщает, исчерпано ли время запуска.
+func (o processOptions) expired() bool {
+	return !o.Deadline.IsZero() && time.Now().After(o.Deadline)
+}
+
+// readEntries вызывает fn для каждой записи каталога. В режиме экономии памяти
+// записи читаются порциями по lowMemoryBatch без сортировки.
+func readEntries(folder string, lowMemory bool, fn func(os.DirEntry)) error {
+	if !lowMemory {
+		entries, err := readDir(folder)
 		if err != nil {
-			return cfg, errors.New("переменная окружения DAYS должна быть числом")
+			return err
 		}
-		cfg.Days = days
-	}
-	foldersStr := os.Getenv("FOLDERS")
-	if foldersStr != "" {
-		// предполагается, что папки перечислены через запятую
-		cfg.Folders = strings.Split(foldersStr, ",")
-		for i := range cfg.Folders {
-			cfg.Folders[i] = strings.TrimSpace(cfg.Folders[i])
+		for _, entry := range entries {
+			fn(entry)
 		}
+		return nil
 	}
-	return cfg, nil
-}
-
-// mergeConfigs объединяет конфигурацию из аргументов и окружения.
-// Приоритет у аргументов, если они заданы.
-func mergeConfigs(argCfg, envCfg Config) Config {
-	if argCfg.Days == 0 {
-		argCfg.Days = envCfg.Days
+	var f *os.File
+	err := withRetry(func() (err error) {
+		f, err = os.Open(folder)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	if len(argCfg.Folders) == 0 {
-		argCfg.Folders = envCfg.Folders
+	defer f.Close()
+	for {
+		batch, err := f.ReadDir(lowMemoryBatch)
+		for _, entry := range batch {
+			fn(entry)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return argCfg
 }
 
 // processFolder очищает одну папку по заданной логике.
-// Возвращает количество найденных файлов и количество удалённых.
-func processFolder(folder string, days int) (int, int, error) {
-	entries, err := os.ReadDir(folder) // использование os.ReadDir вместо ioutil.ReadDir
-	if err != nil {
-		return 0, 0, err
+// Возвращает количество найденных и удалённых файлов и объём освобождённого места.
+func processFolder(folder string, rule folderRule, opts processOptions) (res FolderResult, err error) {
+	res.Folder = folder
+	res.discardKept = opts.LowMemory
+	res.DryRun = opts.DryRun
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+	progress.beginFolder(folder)
+	if rule.Ignore, err = loadIgnore(folder); err != nil {
+		return res, withCode(CodeIgnoreRead, fmt.Errorf("не удалось прочитать исключения папки: %v", err))
+	}
+	if rule.ProtectMapped {
+		mapped, unreadable, err := loadMappedFiles(folder)
+		if err != nil {
+			return res, withCode(CodeMappedCheck, fmt.Errorf("не удалось проверить файлы, используемые процессами (protect_mapped): %v", err))
+		}
+		if unreadable > 0 {
+			events.emit(EventWarning, folder, "", "Папка %s: не удалось проверить процессов: %d (нет прав), их файлы могут быть удалены", folder, unreadable)
+		}
+		opts.Mapped = mapped
+	}
+	if rule.Unit == unitDir {
+		return res, processDirUnits(&res, folder, rule, opts)
+	}
+	// Удаления по квотам подкаталогов и ссылок расходуют тот же запас
+	// max_delete, что и файлы самой папки.
+	budget := &deleteBudget{limit: rule.MaxDelete, run: opts.RunBudget}
+	// truncated — файлы, которые удаляются при усечении по max_delete в режиме
+	// экономии памяти (nil — без ограничения по именам).
+	var truncated map[string]bool
+	// Файлы папки и квот подкаталогов убираются одним шагом удаления; он
+	// завершается (например, архив записывается) после применения квот.
+	disp := newDisposal(folder, rule, opts.Work)
+	defer disp.finish(&res)
+	// Квоты подкаталогов подсчитываются до проверки max_delete, а применяются
+	// после очистки файлов самой папки.
+	var quotas quotaPlan
+	if rule.SubdirQuotaSize > 0 || rule.SubdirQuotaFiles > 0 {
+		quotas = planSubdirQuotas(&res, folder, rule, opts)
+		defer func() {
+			if err == nil {
+				progress.setPhase(phaseQuota)
+				quotas.apply(&res, folder, rule, opts, budget, disp)
+			}
+		}()
 	}
-
-	totalFiles := 0
-	deletedFiles := 0
 
 	// Находим самый свежий файл (по модификации или созданию)
 	var newestTime time.Time
 	var fileEntries []os.DirEntry
+	fileTimes := make(map[string]time.Time) // нужны только для порядка «сначала старые»
+	// Файлы со временем в будущем не участвуют в выборе самого свежего файла,
+	// иначе день отсечки сдвигается и остальные файлы не удаляются.
+	future := time.Now().Add(futureTolerance)
+	futureCount := 0
+	keepNewest := newestFiles{n: rule.Keep}
+	ranked := newestFiles{n: rule.Policy.maxBeyondNewest()}
+	anchors := newRetentionAnchors(rule)
+	gfs := newGFSFiles(rule.GFS)
+	thinned := newThinning(rule.KeepOnePer, anchors)
+	// Для ограничений max_delete и max_delete_percent файлы к удалению
+	// подсчитываются заранее, а при усечении удаляются начиная с самых старых.
+	guarded := rule.MaxDelete > 0 || rule.MaxDeletePercent > 0
+	var candidates []policyFile
+	oldestFirst := !opts.Deadline.IsZero() || (rule.MaxDelete > 0 && rule.MaxDeleteMode == maxDeleteTruncate) || rule.MinFree > 0
 
 	// Отбираем обычные файлы
-	for _, entry := range entries {
+	var tombstones, links []string
+	err = readFolderFiles(folder, rule, opts.Nested, opts.LowMemory, &res, func(entry os.DirEntry) {
+		if isSymlink(entry) {
+			if rule.Symlinks == symlinksDelete || rule.Symlinks == symlinksFollow {
+				links = append(links, entry.Name())
+			}
+			return
+		}
+		if rule.SoftDelete > 0 && entry.Type().IsRegular() {
+			if _, ok := tombstoneTime(entry.Name()); ok {
+				tombstones = append(tombstones, entry.Name())
+				return
+			}
+		}
 		if entry.Type().IsRegular() {
-			totalFiles++
-			fileEntries = append(fileEntries, entry)
+			res.Total++
+			progress.scanned.Add(1)
 			fullPath := filepath.Join(folder, entry.Name())
-			t, err := times.Stat(fullPath)
+			// Файлы вне отбора (include, exclude, размер...) не удаляются
+			// и не влияют на самый свежий файл.
+			if reason, detail := rule.candidateSkip(entry.Name(), entryInfo(entry)); reason != "" {
+				res.Skipped++
+				res.keep(fullPath, reason, detail)
+				return
+			}
+			if !opts.LowMemory {
+				fileEntries = append(fileEntries, entry)
+			}
+			t, err := statTimes(fullPath)
 			if err != nil {
-				log.Printf("Ошибка получения времени для %s: %v\n", fullPath, err)
-				continue
+				events.emitCode(EventError, fileErrorCode(CodeStatFailed, err), folder, fullPath, "Ошибка получения времени для %s: %v", fullPath, err)
+				return
 			}
-			// Определяем максимальную дату между модификацией и созданием
-			fileNewest := t.ModTime()
-			birth := t.BirthTime()
-			if birth.After(fileNewest) {
-				fileNewest = birth
+			// Время файла по отметкам time_fields (по умолчанию — более
+			// поздняя из дат модификации и создания).
+			stamps := stampsOf(t)
+			fileNewest := rule.fileTime(stamps, entry.Name())
+			if rule.latestTime(stamps, entry.Name()).After(future) {
+				futureCount++
+				return
 			}
 			if fileNewest.After(newestTime) {
 				newestTime = fileNewest
 			}
+			keepNewest.add(entry.Name(), fileNewest)
+			ranked.add(entry.Name(), fileNewest)
+			anchors.add(entry.Name(), fileNewest)
+			gfs.add(entry.Name(), t.ModTime())
+			thinned.add(entry.Name(), fileNewest)
+			if guarded {
+				f := policyFile{name: entry.Name(), newest: fileNewest}
+				if info, err := entry.Info(); err == nil && rule.Policy != nil {
+					f.size = info.Size()
+				}
+				candidates = append(candidates, f)
+			}
+			if oldestFirst && !opts.LowMemory {
+				fileTimes[entry.Name()] = fileNewest
+			}
 		}
+	})
+	if err != nil {
+		return res, err
+	}
+	// Надгробия удаляются после обработки остальных файлов.
+	if len(tombstones) > 0 {
+		defer purgeTombstones(&res, folder, tombstones, rule.SoftDelete, opts)
+	}
+	// Ссылки обрабатываются после файлов: их срок считается от тех же
+	// самых свежих файлов, но сами ссылки на него не влияют.
+	var symlinks symlinkPlan
+	if len(links) > 0 {
+		symlinks = scanSymlinks(&res, folder, links, rule, anchors)
+		defer func() {
+			if err == nil {
+				symlinks.apply(&res, folder, rule, anchors, opts, budget)
+			}
+		}()
 	}
 
 	// Если файлов не найдено, пропускаем папку.
-	if newestTime.IsZero() {
-		log.Printf("Папка %s не содержит файлов для анализа\n", folder)
-		return totalFiles, deletedFiles, nil
+	if newestTime.IsZero() && futureCount == 0 {
+		events.emit(EventDecision, folder, "", "Папка %s не содержит файлов для анализа", folder)
+		if guarded {
+			return res, guardDeletes(&res, folder, rule, quotas.over+symlinks.over, quotas.files+len(symlinks.links))
+		}
+		return res, nil
+	}
+	if futureCount > 0 {
+		events.emit(EventWarning, folder, "", "Папка %s: файлов со временем в будущем: %d, они не учитываются при выборе самого свежего файла (политика %s)",
+			folder, futureCount, opts.FuturePolicy)
 	}
 
 	// Вычисляем день отсечки.
 	// Если days == 0, cutoff равен времени самого свежего файла.
-	cutoff := newestTime.AddDate(0, 0, -days)
-	if days == 0 {
-		log.Printf("Папка: %s, самая свежая дата: %v, режим удаления: удаление файлов старше самой свежей даты\n", folder, newestTime)
+	cutoff := newestTime.AddDate(0, 0, -max(rule.Days, rule.BackfillDays))
+	if !rule.AsOf.IsZero() {
+		events.emit(EventDecision, folder, "", "Папка: %s, самая свежая дата: %v, день отсечки от даты as_of %v: %v", folder, newestTime,
+			rule.AsOf, anchors.now.AddDate(0, 0, -max(rule.Days, rule.BackfillDays)))
+	} else if rule.Anchor == anchorNow {
+		events.emit(EventDecision, folder, "", "Папка: %s, самая свежая дата: %v, день отсечки от текущего времени: %v", folder, newestTime,
+			anchors.now.AddDate(0, 0, -max(rule.Days, rule.BackfillDays)))
+	} else if max(rule.Days, rule.BackfillDays) == 0 {
+		events.emit(EventDecision, folder, "", "Папка: %s, самая свежая дата: %v, режим удаления: удаление файлов старше самой свежей даты", folder, newestTime)
 	} else {
-		log.Printf("Папка: %s, самая свежая дата: %v, день отсечки: %v\n", folder, newestTime, cutoff)
+		events.emit(EventDecision, folder, "", "Папка: %s, самая свежая дата: %v, день отсечки: %v", folder, newestTime, cutoff)
+	}
+	if len(rule.ByExtension) > 0 {
+		var parts []string
+		for _, ext := range slices.Sorted(maps.Keys(rule.ByExtension)) {
+			parts = append(parts, fmt.Sprintf("%s=%d", ext, rule.ByExtension[ext]))
+		}
+		events.emit(EventDecision, folder, "", "Папка: %s, сроки хранения по расширениям (дней): %s", folder, strings.Join(parts, ", "))
+	}
+	if len(rule.Retention) > 0 {
+		events.emit(EventDecision, folder, "", "Папка: %s, сроки хранения по шаблонам (дней): %s", folder, anchors.describe())
 	}
 
+	if rule.Policy != nil {
+		events.emit(EventDecision, folder, "", "Папка %s: условие удаления policy: %s", folder, rule.Policy)
+	}
+	if rule.Verify != nil {
+		events.emit(EventDecision, folder, "", "Папка %s: проверка перед удалением verify: %s", folder, rule.Verify)
+	}
+
+	keepNames := keepNewest.names()
+	ranks := ranked.ranks()
+	gfsKeep := gfs.names()
+	if rule.GFS != nil {
+		events.emit(EventDecision, folder, "", "Папка %s: схема gfs: %s, сохраняется файлов: %d", folder, rule.GFS, len(gfsKeep))
+	}
+	periodKeep := thinned.names()
+	if rule.KeepOnePer != "" {
+		events.emit(EventDecision, folder, "", "Папка %s: прореживание keep_one_per=%s, периодов с файлами: %d", folder, rule.KeepOnePer, len(periodKeep))
+	}
+	if guarded {
+		protected := keepNames
+		if len(gfsKeep) > 0 || len(periodKeep) > 0 {
+			protected = maps.Clone(keepNames)
+			for name := range gfsKeep {
+				protected[name] = true
+			}
+			for name := range periodKeep {
+				protected[name] = true
+			}
+		}
+		n := countCandidates(candidates, anchors, protected, ranks, rule)
+		if opts.LowMemory && rule.MaxDelete > 0 && rule.MaxDeleteMode == maxDeleteTruncate && n > rule.MaxDelete {
+			truncated = oldestCandidates(candidates, anchors, protected, ranks, rule, rule.MaxDelete)
+		}
+		if err := guardDeletes(&res, folder, rule, n+quotas.over+symlinks.over, len(candidates)+quotas.files+len(symlinks.links)); err != nil {
+			return res, err
+		}
+	}
+
+	// Без quarantine_ttl файлы остаются в карантине, пока их не удалят вручную.
+	if rule.Action == actionQuarantine && rule.QuarantineTTL > 0 {
+		defer purgeQuarantine(&res, mirrorPath(rule.QuarantineDir, folder), rule.QuarantineTTL, opts)
+	}
+	limiter := newRateLimiter(rule.RateLimit)
+	defer limiter.stop()
+	space := newFreeTarget(&res, folder, rule, opts.DryRun)
+	defer space.report()
+
 	// Удаляем файлы, если и время модификации, и время создания старше cutoff.
-	for _, entry := range fileEntries {
+	// Итоги записываются в res, переданный потоком обработки.
+	process := func(res *FolderResult, entry os.DirEntry) {
 		fullPath := filepath.Join(folder, entry.Name())
-		t, err := times.Stat(fullPath)
+		if keepNames[entry.Name()] {
+			res.Skipped++
+			res.keep(fullPath, SkipKeepNewest, fmt.Sprintf("keep=%d", rule.Keep))
+			return
+		}
+		if rule.HonorRetain {
+			held, detail, err := fileHold(fullPath, time.Now())
+			if err != nil {
+				res.fileError(fullPath, CodeRetentionRead, "Ошибка чтения даты хранения "+fullPath, err)
+				return
+			}
+			if held {
+				res.Skipped++
+				res.keep(fullPath, SkipRetained, detail)
+				return
+			}
+		}
+		if users := opts.Mapped.of(fullPath); users != "" {
+			res.Skipped++
+			res.keep(fullPath, SkipMapped, users)
+			return
+		}
+		t, err := statTimes(fullPath)
 		if err != nil {
-			log.Printf("Ошибка получения времени для %s: %v\n", fullPath, err)
-			continue
+			res.fileError(fullPath, CodeStatFailed, "Ошибка получения времени для "+fullPath, err)
+			return
+		}
+		stamps := stampsOf(t)
+		fileTime := rule.fileTime(stamps, entry.Name())
+		anchor := anchors.of(entry.Name())
+		cutoff := anchor.AddDate(0, 0, -rule.daysFor(entry.Name()))
+
+		old := fileTime.Before(cutoff)
+		if rule.Policy != nil {
+			f := policyFile{name: entry.Name(), newest: fileTime, rank: ranks.of(entry.Name())}
+			if info, err := entry.Info(); err == nil {
+				f.size = info.Size()
+			}
+			old = rule.Policy.match(f, anchor)
+		}
+		if rule.GFS != nil {
+			old = gfsKeep[entry.Name()] == ""
+		}
+		// Самый свежий файл периода keep_one_per сохраняется, даже если его срок истёк.
+		thin := old && periodKeep[entry.Name()] != ""
+		if thin {
+			old = false
+		}
+		// Файл, который ещё читают, сохраняется, даже если его срок истёк.
+		if old && rule.recentlyRead(stamps, time.Now()) {
+			res.Skipped++
+			res.keep(fullPath, SkipRecentlyRead, "прочитан "+stamps.atime.Format(time.RFC3339))
+			return
+		}
+		if rule.latestTime(stamps, entry.Name()).After(future) {
+			res.Future++
+			detail := rule.describeTimes(stamps, entry.Name())
+			switch opts.FuturePolicy {
+			case futureDelete:
+				old = true
+			case futureReset:
+				if opts.DryRun {
+					res.Skipped++
+					res.keep(fullPath, SkipFuture, detail)
+					return
+				}
+				now := time.Now()
+				if err := os.Chtimes(fullPath, now, now); err != nil {
+					res.fileError(fullPath, CodeTouchFailed, "Ошибка сброса времени файла "+fullPath, err)
+					return
+				}
+				events.emit(EventAction, folder, fullPath, "Время изменения файла %s из будущего сброшено на текущее (%s)", fullPath, detail)
+				res.Skipped++
+				res.keep(fullPath, SkipFuture, detail)
+				return
+			default:
+				res.Skipped++
+				res.keep(fullPath, SkipFuture, detail)
+				return
+			}
 		}
-		modTime := t.ModTime()
-		birthTime := t.BirthTime()
 
-		if modTime.Before(cutoff) && birthTime.Before(cutoff) {
-			err := os.Remove(fullPath)
+		// min_free: пока на файловой системе папки мало места, удаляются
+		// начиная с самых старых и файлы, которые сохраняются только по сроку
+		// (не gfs, keep_one_per или policy); с min_free_only файлы удаляются
+		// только ради места.
+		freeing := false
+		if rule.MinFree > 0 && (old && rule.MinFreeOnly || !old && !thin && rule.GFS == nil && rule.Policy == nil && !rule.recentlyRead(stamps, time.Now())) {
+			var size int64
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			if freeing = space.reserve(size); freeing {
+				defer space.release(size)
+			}
+			old = freeing || old && !rule.MinFreeOnly
+		}
+
+		if old {
+			var size int64
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			if !opts.approved(fullPath, pendingDelete) {
+				res.Skipped++
+				res.keep(fullPath, SkipNotApproved, pendingDelete)
+				return
+			}
+			// Неподтверждённые файлы не занимают место в max_delete.
+			if rule.Verify.matches(entry.Name()) && !rule.Verify.allow(res, folder, fullPath, size, stamps.mtime) {
+				return
+			}
+			if truncated != nil && !truncated[entry.Name()] {
+				res.Skipped++
+				res.keep(fullPath, SkipMaxDelete, fmt.Sprintf("max_delete=%d", rule.MaxDelete))
+				return
+			}
+			if limit := budget.take(); limit != "" {
+				res.Skipped++
+				res.keep(fullPath, SkipMaxDelete, limit)
+				return
+			}
+			if opts.DryRun {
+				if err := protection.check(fullPath); err != nil {
+					budget.give()
+					res.fileError(fullPath, CodeDeleteFailed, "", err)
+					return
+				}
+				if freeing {
+					events.emit(EventDecision, folder, fullPath, "Будет удалён файл: %s ради свободного места min_free (возраст %s, размер %s)",
+						fullPath, formatAge(time.Since(fileTime)), formatBytes(size))
+				} else {
+					events.emit(EventDecision, folder, fullPath, "Будет удалён файл: %s (возраст %s, размер %s)",
+						fullPath, formatAge(time.Since(fileTime)), formatBytes(size))
+				}
+				space.plan(size)
+				res.Planned++
+				res.PlannedFreed += size
+				res.Skipped++
+				res.keep(fullPath, SkipDryRun, pendingDelete)
+				return
+			}
+			if freeing {
+				events.emit(EventDecision, folder, fullPath, "Файл %s удаляется ради свободного места: свободно меньше min_free %s", fullPath, formatBytes(rule.MinFree))
+			}
+			limiter.wait()
+			target, err := disp.dispose(fullPath)
+			if err != nil {
+				budget.give()
+				code, message := disp.failure()
+				res.fileError(fullPath, code, message+fullPath, err)
+				return
+			}
+			disp.record(res, fullPath, target, size)
+		} else if tierCutoff := anchor.AddDate(0, 0, -rule.TierDays); rule.TierTo != "" && fileTime.Before(tierCutoff) {
+			var size int64
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			action := pendingTier + rule.TierTo
+			if !opts.approved(fullPath, action) {
+				res.Skipped++
+				res.keep(fullPath, SkipNotApproved, action)
+				return
+			}
+			if opts.DryRun {
+				if err := protection.check(fullPath); err != nil {
+					res.fileError(fullPath, CodeDeleteFailed, "", err)
+					return
+				}
+				events.emit(EventDecision, folder, fullPath, "Будет перемещён файл: %s в %s", fullPath, rule.TierTo)
+				res.Skipped++
+				res.keep(fullPath, SkipDryRun, action)
+				return
+			}
+			limiter.wait()
+			target, err := tierFile(folder, rule.TierTo, opts.S3, fullPath)
 			if err != nil {
-				log.Printf("Ошибка удаления файла %s: %v\n", fullPath, err)
+				res.fileError(fullPath, CodeMoveFailed, "Ошибка перемещения файла "+fullPath, err)
+				return
+			}
+			events.emit(EventAction, folder, fullPath, "Перемещён файл: %s в %s", fullPath, target)
+			affected.add(folder, fullPath, "tiered", target, size)
+			res.Tiered++
+			res.TieredBytes += size
+		} else if compressCutoff := anchor.AddDate(0, 0, -rule.CompressDays); rule.CompressDays > 0 && !rule.compressed(entry.Name()) &&
+			fileTime.Before(compressCutoff) {
+			if !opts.approved(fullPath, pendingCompress) {
+				res.Skipped++
+				res.keep(fullPath, SkipNotApproved, pendingCompress)
+				return
+			}
+			if opts.DryRun {
+				if err := protection.check(fullPath); err != nil {
+					res.fileError(fullPath, CodeDeleteFailed, "", err)
+					return
+				}
+				events.emit(EventDecision, folder, fullPath, "Будет сжат файл: %s", fullPath)
+				res.Skipped++
+				res.keep(fullPath, SkipDryRun, pendingCompress)
+				return
+			}
+			limiter.wait()
+			var size int64
+			if info, err := entry.Info(); err == nil {
+				size = info.Size()
+			}
+			target, compressedSize, err := compressFile(fullPath, opts.Work)
+			if err != nil {
+				res.fileError(fullPath, CodeCompressFailed, "Ошибка сжатия файла "+fullPath, err)
+				return
+			}
+			events.emit(EventAction, folder, fullPath, "Сжат файл: %s в %s (%s → %s)", fullPath, filepath.Base(target),
+				formatBytes(size), formatBytes(compressedSize))
+			affected.add(folder, fullPath, "compressed", target, size)
+			res.Compressed++
+			res.CompressedSaved += size - compressedSize
+		} else if thin {
+			res.Skipped++
+			res.keep(fullPath, SkipKeepOnePer, periodKeep[entry.Name()])
+		} else if rule.GFS != nil {
+			res.Skipped++
+			res.keep(fullPath, SkipGFS, gfsKeep[entry.Name()])
+		} else if rule.Policy != nil {
+			res.Skipped++
+			res.keep(fullPath, SkipPolicy, rule.Policy.String())
+		} else if rule.MinFreeOnly {
+			res.Skipped++
+			res.keep(fullPath, SkipFreeSpace, "min_free "+formatBytes(rule.MinFree))
+		} else {
+			res.Skipped++
+			res.keep(fullPath, SkipNotOldEnough, fmt.Sprintf("%s, отсечка %s", rule.describeTimes(stamps, entry.Name()), cutoff.Format(time.RFC3339)))
+		}
+	}
+	// stop останавливает обработку по истечении времени: оставшиеся файлы
+	// считаются оставленными, а первый из них запоминается.
+	stop := func(entry os.DirEntry) {
+		fullPath := filepath.Join(folder, entry.Name())
+		if res.StoppedAt == "" {
+			res.StoppedAt = fullPath
+			if opts.Slice {
+				events.emit(EventDecision, folder, fullPath, "Доля времени папки исчерпана, обработка продолжится с файла %s в следующем круге", fullPath)
 			} else {
-				log.Printf("Удалён файл: %s\n", fullPath)
-				deletedFiles++
+				events.emit(EventWarning, folder, fullPath, "Время запуска исчерпано, обработка остановлена на файле %s", fullPath)
+			}
+		}
+		res.Skipped++
+		res.keep(fullPath, SkipBudget, "")
+	}
+	if !opts.LowMemory {
+		if oldestFirst {
+			slices.SortStableFunc(fileEntries, func(a, b os.DirEntry) int {
+				return fileTimes[a.Name()].Compare(fileTimes[b.Name()])
+			})
+		}
+		progress.setPhase(phaseProcess)
+		workers := startFolderWorkers(&res, rule, process)
+		for _, entry := range fileEntries {
+			if res.StoppedAt != "" || opts.expired() {
+				stop(entry)
+				continue
 			}
+			workers.submit(entry)
+		}
+		workers.wait()
+		return res, nil
+	}
+	// В режиме экономии памяти каталог читается повторно.
+	progress.setPhase(phaseProcess)
+	workers := startFolderWorkers(&res, rule, process)
+	err = readFolderFiles(folder, rule, opts.Nested, true, nil, func(entry os.DirEntry) {
+		if !entry.Type().IsRegular() {
+			return
 		}
+		if _, ok := tombstoneTime(entry.Name()); ok && rule.SoftDelete > 0 {
+			return
+		}
+		if reason, _ := rule.candidateSkip(entry.Name(), entryInfo(entry)); reason != "" {
+			return
+		}
+		if res.StoppedAt != "" || opts.expired() {
+			stop(entry)
+			return
+		}
+		workers.submit(entry)
+	})
+	workers.wait()
+	if err != nil {
+		return res, err
 	}
-	return totalFiles, deletedFiles, nil
+	return res, nil
 }
 
-// writeLog записывает результаты работы в лог-файл.
-func writeLog(timestamp time.Time, totalFiles, deletedFiles int) error {
-	logFile := "cleanup.log"
-	line := fmt.Sprintf("%s - файлов обнаружено: %d, удалено: %d\n", timestamp.Format(time.RFC3339), totalFiles, deletedFiles)
-	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return err
+// writeLog записывает результаты работы в лог-файл. Журнал может быть общим
+// для нескольких экземпляров, поэтому строка содержит имя хоста и экземпляра.
+// Возвращает путь, по которому запись фактически выполнена.
+func writeLog(logFile string, summary RunSummary) (string, error) {
+	host, _ := os.Hostname()
+	line := fmt.Sprintf("%s - файлов обнаружено: %d, удалено: %d, хост: %s, экземпляр: %s",
+		summary.Start.Format(time.RFC3339), summary.Total, summary.Deleted, host, summary.Instance)
+	if summary.DryRun {
+		line += ", пробный запуск"
 	}
-	defer f.Close()
-	_, err = f.WriteString(line)
-	return err
+	line += "\n"
+	return appendLog(logFile, []byte(line))
+}
+
+// trimFolders убирает пробелы вокруг путей и пропускает пустые элементы.
+func trimFolders(folders []string) []string {
+	var out []string
+	for _, folder := range folders {
+		if folder = strings.TrimSpace(folder); folder != "" {
+			out = append(out, folder)
+		}
+	}
+	return out
 }
 
 // isNumber проверяет, можно ли преобразовать строку в число.
@@ -165,74 +776,43 @@ func isNumber(s string) bool {
 }
 
 func main() {
-	// Флаг для вывода справки
-	help := flag.Bool("help", false, "Показать справку")
-	flag.Parse()
-	if *help {
-		fmt.Println("Usage: cleanup [days|config.yml] [folder1 folder2 ...]")
-		return
-	}
-
-	var cfg Config
-
-	args := flag.Args()
-	// Если аргументы командной строки заданы
+	args := os.Args[1:]
 	if len(args) > 0 {
-		if isNumber(args[0]) {
-			// Первый аргумент – количество дней (0 означает удалять все файлы, старше самого свежего)
-			days, err := strconv.Atoi(args[0])
-			if err != nil {
-				log.Fatalf("Неверное значение для количества дней: %v", err)
-			}
-			cfg.Days = days
-			if len(args) > 1 {
-				cfg.Folders = args[1:]
-			}
-		} else {
-			// Первый аргумент – путь к YAML файлу конфигурации
-			loadedCfg, err := readYAMLConfig(args[0])
-			if err != nil {
-				log.Fatalf("Ошибка чтения YAML файла: %v", err)
-			}
-			cfg = loadedCfg
+		switch args[0] {
+		case "run":
+			os.Exit(runCleanup(args[1:]))
+		case "lint":
+			os.Exit(runLint(args[1:]))
+		case "init":
+			os.Exit(runInit(args[1:]))
+		case "estimate":
+			os.Exit(runEstimate(args[1:]))
+		case "plan":
+			os.Exit(runPlan(args[1:]))
+		case "recoverable":
+			os.Exit(runRecoverable(args[1:]))
+		case "restore":
+			os.Exit(runRestore(args[1:]))
+		case "forecast":
+			os.Exit(runForecast(args[1:]))
+		case "digest":
+			os.Exit(runDigest(args[1:]))
+		case "collect":
+			os.Exit(runCollect(args[1:]))
+		case "serve":
+			os.Exit(runServe(args[1:]))
+		case "config":
+			os.Exit(runConfig(args[1:]))
+		case "approve":
+			os.Exit(runApprove(args[1:]))
+		case "history":
+			os.Exit(runHistory(args[1:]))
+		case "plans":
+			os.Exit(runPlans(args[1:]))
+		case "status":
+			os.Exit(runStatus(args[1:]))
 		}
 	}
-
-	// Если не все параметры заданы через аргументы, пытаемся прочесть из переменных окружения.
-	envCfg, _ := parseEnvConfig()
-	cfg = mergeConfigs(cfg, envCfg)
-
-	if cfg.Days < 0 || len(cfg.Folders) == 0 {
-		log.Fatal("Не заданы необходимые параметры. Требуется указать количество дней (целое число, 0 означает удаление файлов старше самого свежего файла) и список папок для очистки.")
-	}
-
-	overallTotal := 0
-	overallDeleted := 0
-
-	for _, folder := range cfg.Folders {
-		folder = strings.TrimSpace(folder)
-		if folder == "" {
-			continue
-		}
-		// Проверяем, существует ли папка
-		info, err := os.Stat(folder)
-		if err != nil || !info.IsDir() {
-			log.Printf("Папка '%s' не найдена или не является директорией, пропускаем\n", folder)
-			continue
-		}
-		total, deleted, err := processFolder(folder, cfg.Days)
-		if err != nil {
-			log.Printf("Ошибка обработки папки '%s': %v\n", folder, err)
-			continue
-		}
-		overallTotal += total
-		overallDeleted += deleted
-	}
-
-	now := time.Now()
-	if err := writeLog(now, overallTotal, overallDeleted); err != nil {
-		log.Printf("Ошибка записи лога: %v\n", err)
-	} else {
-		log.Printf("Результаты работы записаны в cleanup.log\n")
-	}
+	// Вызов без подкоманды — старая форма запуска.
+	os.Exit(runLegacy(args))
 }
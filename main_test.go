@@ -0,0 +1,461 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// folderTree создаёт в dir файлы с заданным возрастом в днях.
+func folderTree(t *testing.T, dir string, ages map[string]int) {
+	t.Helper()
+	for name, age := range ages {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		at := time.Now().AddDate(0, 0, -age)
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// datedTree создаёт в dir файлы, изменённые в полдень заданных дат
+// ГГГГ-ММ-ДД по местному времени.
+func datedTree(t *testing.T, dir string, dates map[string]string) {
+	t.Helper()
+	for name, date := range dates {
+		day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		at := day.Add(12 * time.Hour)
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testRule возвращает правила папки dir со сроком 30 дней и параметрами
+// строки папки params; возраст файлов считается по времени изменения.
+func testRule(t *testing.T, dir, params string) folderRule {
+	t.Helper()
+	spec, err := parseFolderSpec(dir + "?time_fields=mtime&" + params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Config{Days: 30}.folderRule(spec)
+}
+
+// remaining возвращает, какие из файлов names остались в dir.
+func remaining(dir string, names ...string) map[string]bool {
+	left := make(map[string]bool)
+	for _, name := range names {
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+			left[name] = true
+		}
+	}
+	return left
+}
+
+func TestProcessFolderDryRun(t *testing.T) {
+	dir := t.TempDir()
+	folderTree(t, dir, map[string]int{"old.log": 100, "older.log": 200, "new.log": 1})
+	res, err := processFolder(dir, testRule(t, dir, ""), processOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Deleted != 0 || res.Planned != 2 {
+		t.Errorf("Deleted = %d, Planned = %d, want 0 и 2", res.Deleted, res.Planned)
+	}
+	if left := remaining(dir, "old.log", "older.log", "new.log"); len(left) != 3 {
+		t.Errorf("при --dry-run удалены файлы, остались: %v", left)
+	}
+}
+
+func TestProcessFolderInclude(t *testing.T) {
+	dir := t.TempDir()
+	folderTree(t, dir, map[string]int{"a.log": 100, "b.bak": 100, "c.txt": 100, "new.log": 1})
+	if _, err := processFolder(dir, testRule(t, dir, "include=*.log,*.bak"), processOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	left := remaining(dir, "a.log", "b.bak", "c.txt", "new.log")
+	if left["a.log"] || left["b.bak"] || !left["c.txt"] || !left["new.log"] {
+		t.Errorf("include=*.log,*.bak: остались %v, want c.txt и new.log", left)
+	}
+}
+
+func TestProcessFolderExclude(t *testing.T) {
+	dir := t.TempDir()
+	folderTree(t, dir, map[string]int{"a.log": 100, "README": 100, ".keep": 100, "new.log": 1})
+	if _, err := processFolder(dir, testRule(t, dir, "exclude=README,.keep"), processOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	left := remaining(dir, "a.log", "README", ".keep", "new.log")
+	if left["a.log"] || !left["README"] || !left[".keep"] || !left["new.log"] {
+		t.Errorf("exclude=README,.keep: остались %v, want README, .keep и new.log", left)
+	}
+}
+
+func TestProcessFolderKeep(t *testing.T) {
+	dir := t.TempDir()
+	folderTree(t, dir, map[string]int{"a": 1, "b": 100, "c": 110, "d": 120})
+	res, err := processFolder(dir, testRule(t, dir, "keep=3"), processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := remaining(dir, "a", "b", "c", "d")
+	if !left["a"] || !left["b"] || !left["c"] || left["d"] {
+		t.Errorf("keep=3: остались %v, want a, b и c", left)
+	}
+	if n := res.SkipReasons[SkipKeepNewest]; n != 3 {
+		t.Errorf("оставлено по keep: %d, want 3", n)
+	}
+}
+
+func TestProcessFolderMaxDelete(t *testing.T) {
+	names := []string{"new", "a", "b", "c"}
+	ages := map[string]int{"new": 1, "a": 100, "b": 110, "c": 120}
+	t.Run("abort", func(t *testing.T) {
+		dir := t.TempDir()
+		folderTree(t, dir, ages)
+		_, err := processFolder(dir, testRule(t, dir, "max_delete=2"), processOptions{})
+		if errorCode(err, "") != CodeDeleteLimit {
+			t.Errorf("processFolder() = %v, want ошибку %s", err, CodeDeleteLimit)
+		}
+		if left := remaining(dir, names...); len(left) != len(names) {
+			t.Errorf("папка очищена при превышении max_delete, остались: %v", left)
+		}
+	})
+	for _, lowMemory := range []bool{false, true} {
+		t.Run(fmt.Sprintf("truncate low-memory=%v", lowMemory), func(t *testing.T) {
+			dir := t.TempDir()
+			folderTree(t, dir, ages)
+			res, err := processFolder(dir, testRule(t, dir, "max_delete=2&max_delete_mode=truncate"), processOptions{LowMemory: lowMemory})
+			if err != nil {
+				t.Fatal(err)
+			}
+			left := remaining(dir, names...)
+			if !left["new"] || !left["a"] || left["b"] || left["c"] {
+				t.Errorf("остались %v, want new и a: удаляются самые старые", left)
+			}
+			if res.Deleted != 2 || res.Truncated != 1 {
+				t.Errorf("Deleted = %d, Truncated = %d, want 2 и 1", res.Deleted, res.Truncated)
+			}
+		})
+	}
+	t.Run("max_delete_total", func(t *testing.T) {
+		opts := processOptions{RunBudget: newRunBudget(4)}
+		deleted := 0
+		for range 2 {
+			dir := t.TempDir()
+			folderTree(t, dir, ages)
+			res, err := processFolder(dir, testRule(t, dir, "max_delete=3"), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deleted += res.Deleted
+		}
+		if deleted != 4 {
+			t.Errorf("удалено в двух папках %d, want 4 по max_delete_total", deleted)
+		}
+	})
+	t.Run("неудачное удаление", func(t *testing.T) {
+		budget := &deleteBudget{limit: 1, run: newRunBudget(1)}
+		if limit := budget.take(); limit != "" {
+			t.Fatalf("take() = %q, want пустую строку", limit)
+		}
+		// Файл не удалён: запас папки и запуска возвращается.
+		budget.give()
+		if limit := budget.take(); limit != "" {
+			t.Errorf("take() после give() = %q, want удаление снова доступно", limit)
+		}
+		if limit := budget.take(); limit != "max_delete=1" {
+			t.Errorf("take() = %q, want max_delete=1", limit)
+		}
+	})
+}
+
+func TestProcessFolderMaxDeletePercent(t *testing.T) {
+	names := []string{"new", "a", "b", "c"}
+	tests := []struct {
+		percent string
+		blocked bool
+	}{
+		{"50", true},
+		{"80", false},
+	}
+	for _, tt := range tests {
+		t.Run("max_delete_percent="+tt.percent, func(t *testing.T) {
+			dir := t.TempDir()
+			folderTree(t, dir, map[string]int{"new": 1, "a": 100, "b": 110, "c": 120})
+			// К удалению 3 из 4 файлов — 75%.
+			_, err := processFolder(dir, testRule(t, dir, "max_delete_percent="+tt.percent), processOptions{})
+			left := remaining(dir, names...)
+			if tt.blocked {
+				if errorCode(err, "") != CodeDeleteLimit {
+					t.Errorf("processFolder() = %v, want ошибку %s", err, CodeDeleteLimit)
+				}
+				if len(left) != len(names) {
+					t.Errorf("папка очищена при превышении доли, остались: %v", left)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(left) != 1 || !left["new"] {
+				t.Errorf("остались %v, want только new", left)
+			}
+		})
+	}
+}
+
+func TestProcessFolderQuarantine(t *testing.T) {
+	dir, trash := t.TempDir(), t.TempDir()
+	folderTree(t, dir, map[string]int{"new.log": 1, "old.log": 100})
+	mirror := mirrorPath(trash, dir)
+	if err := os.MkdirAll(mirror, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Файл, попавший в карантин раньше срока quarantine_ttl, и свежий.
+	expired := filepath.Join(mirror, tombstoneName("stale.log", time.Now().Add(-72*time.Hour)))
+	fresh := filepath.Join(mirror, tombstoneName("recent.log", time.Now().Add(-time.Hour)))
+	for _, path := range []string{expired, fresh} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := processFolder(dir, testRule(t, dir, "action=quarantine&quarantine_dir="+trash+"&quarantine_ttl=48h"), processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := remaining(dir, "new.log", "old.log"); left["old.log"] || !left["new.log"] {
+		t.Errorf("в папке остались %v, want только new.log", left)
+	}
+	// Удалённым считается только файл карантина с истёкшим quarantine_ttl.
+	if res.Quarantined != 1 || res.Deleted != 1 {
+		t.Errorf("Quarantined = %d, Deleted = %d, want 1 и 1", res.Quarantined, res.Deleted)
+	}
+	moved, _ := filepath.Glob(filepath.Join(mirror, "old.log"+tombstoneMarker+"*"))
+	if len(moved) != 1 {
+		t.Errorf("old.log в карантине: %v, want один файл", moved)
+	}
+	if _, err := os.Lstat(expired); !os.IsNotExist(err) {
+		t.Errorf("файл карантина старше quarantine_ttl не удалён: %v", err)
+	}
+	if _, err := os.Lstat(fresh); err != nil {
+		t.Errorf("файл карантина моложе quarantine_ttl удалён: %v", err)
+	}
+}
+
+func TestProcessFolderQuotaQuarantine(t *testing.T) {
+	dir, trash := t.TempDir(), t.TempDir()
+	folderTree(t, dir, map[string]int{"new.log": 1, "u/a.log": 3, "u/b.log": 2})
+	res, err := processFolder(dir, testRule(t, dir, "subdir_quota_files=1&action=quarantine&quarantine_dir="+trash), processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := remaining(dir, "new.log", "u/a.log", "u/b.log"); left["u/a.log"] || !left["u/b.log"] || !left["new.log"] {
+		t.Errorf("в папке остались %v, want new.log и u/b.log", left)
+	}
+	if res.Quarantined != 1 || res.Deleted != 0 || res.QuotaDeleted != 1 {
+		t.Errorf("Quarantined = %d, Deleted = %d, QuotaDeleted = %d, want 1, 0 и 1", res.Quarantined, res.Deleted, res.QuotaDeleted)
+	}
+	moved, _ := filepath.Glob(filepath.Join(mirrorPath(trash, dir), "u", "a.log"+tombstoneMarker+"*"))
+	if len(moved) != 1 {
+		t.Errorf("u/a.log в карантине: %v, want один файл", moved)
+	}
+}
+
+func TestProcessFolderPolicy(t *testing.T) {
+	names := []string{"new.log", "a.log", "b.log", "c.bak"}
+	dir := t.TempDir()
+	folderTree(t, dir, map[string]int{"new.log": 1, "a.log": 40, "b.log": 100, "c.bak": 5})
+	rule := testRule(t, dir, "")
+	olderThan := 60
+	// Условие заменяет срок хранения: a.log старше days=30, но моложе older_than.
+	rule.Policy = &Policy{Any: []Policy{{OlderThan: &olderThan}, {Name: "*.bak"}}}
+	if err := rule.Policy.validate(); err != nil {
+		t.Fatal(err)
+	}
+	res, err := processFolder(dir, rule, processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := remaining(dir, names...)
+	if !left["new.log"] || !left["a.log"] || left["b.log"] || left["c.bak"] {
+		t.Errorf("остались %v, want new.log и a.log", left)
+	}
+	if n := res.SkipReasons[SkipPolicy]; n != 2 {
+		t.Errorf("оставлено по policy: %d, want 2", n)
+	}
+}
+
+func TestProcessFolderGFS(t *testing.T) {
+	dates := map[string]string{
+		"0531": "2024-05-31", "0530": "2024-05-30", "0520": "2024-05-20",
+		"0430": "2024-04-30", "0415": "2024-04-15", "0331": "2024-03-31",
+	}
+	names := slices.Sorted(maps.Keys(dates))
+	dir := t.TempDir()
+	datedTree(t, dir, dates)
+	rule := testRule(t, dir, "")
+	// Схема заменяет срок хранения: 0520 моложе days=30, но не входит в неё.
+	rule.GFS = &GFS{Daily: 2, Monthly: 2}
+	res, err := processFolder(dir, rule, processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := remaining(dir, names...)
+	want := map[string]bool{"0531": true, "0530": true, "0430": true}
+	if !maps.Equal(left, want) {
+		t.Errorf("остались %v, want %v: два последних дня и два последних месяца", left, want)
+	}
+	if n := res.SkipReasons[SkipGFS]; n != 3 {
+		t.Errorf("оставлено по gfs: %d, want 3", n)
+	}
+}
+
+func TestProcessFolderKeepOnePer(t *testing.T) {
+	dates := map[string]string{
+		"0531": "2024-05-31", "0520": "2024-05-20",
+		"0430": "2024-04-30", "0415": "2024-04-15", "0331": "2024-03-31", "0310": "2024-03-10",
+	}
+	names := slices.Sorted(maps.Keys(dates))
+	dir := t.TempDir()
+	datedTree(t, dir, dates)
+	res, err := processFolder(dir, testRule(t, dir, "keep_one_per=month"), processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Файлы моложе 30 дней от самого свежего остаются по сроку, из истёкших
+	// остаётся самый свежий файл каждого месяца.
+	left := remaining(dir, names...)
+	want := map[string]bool{"0531": true, "0520": true, "0430": true, "0331": true}
+	if !maps.Equal(left, want) {
+		t.Errorf("остались %v, want %v", left, want)
+	}
+	if n := res.SkipReasons[SkipKeepOnePer]; n != 2 {
+		t.Errorf("оставлено по keep_one_per: %d, want 2", n)
+	}
+}
+
+func TestProcessFolderRetentionAnchors(t *testing.T) {
+	names := []string{"app.log", "old.log", "data.bin", "prev.bin", "old.bin"}
+	dir := t.TempDir()
+	folderTree(t, dir, map[string]int{"app.log": 200, "old.log": 210, "data.bin": 1, "prev.bin": 20, "old.bin": 40})
+	// Срок каждого правила отсчитывается от самого свежего файла этого
+	// правила: app.log не удаляется, хотя на 199 дней старше data.bin.
+	_, err := processFolder(dir, testRule(t, dir, "retention=*.log:7d,*:30d"), processOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := remaining(dir, names...)
+	if !left["app.log"] || left["old.log"] || !left["data.bin"] || !left["prev.bin"] || left["old.bin"] {
+		t.Errorf("остались %v, want app.log, data.bin и prev.bin", left)
+	}
+}
+
+func TestProcessFolderAnchor(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	tests := []struct {
+		name   string
+		params string
+		asOf   int // дата as_of, дней назад; 0 — не задана
+		left   map[string]bool
+	}{
+		{"от самого свежего файла", "anchor=newest", 0, map[string]bool{"a": true, "b": true}},
+		{"от текущего времени", "anchor=now", 0, map[string]bool{}},
+		{"от даты as_of", "anchor=now", 80, map[string]bool{"a": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			folderTree(t, dir, map[string]int{"a": 100, "b": 120, "c": 140})
+			rule := testRule(t, dir, tt.params)
+			if tt.asOf > 0 {
+				rule.AsOf = time.Now().AddDate(0, 0, -tt.asOf)
+			}
+			if _, err := processFolder(dir, rule, processOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if left := remaining(dir, names...); !maps.Equal(left, tt.left) {
+				t.Errorf("остались %v, want %v", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestProcessFolderTimeFields(t *testing.T) {
+	tests := []struct {
+		params  string
+		deleted bool
+	}{
+		{"time_fields=mtime", false},
+		{"time_fields=atime", true},
+		{"time_fields=mtime,atime&time_match=all", false},
+		{"time_fields=mtime,atime&time_match=any", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			dir := t.TempDir()
+			folderTree(t, dir, map[string]int{"new": 0})
+			// Файл изменён вчера, а читали его 100 дней назад.
+			path := filepath.Join(dir, "read")
+			if err := os.WriteFile(path, []byte("read"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, time.Now().AddDate(0, 0, -100), time.Now().AddDate(0, 0, -1)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := processFolder(dir, testRule(t, dir, tt.params), processOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if left := remaining(dir, "read", "new"); left["read"] == tt.deleted || !left["new"] {
+				t.Errorf("остались %v, want read удалён: %v", left, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestProcessFolderProtect(t *testing.T) {
+	names := []string{"new.log", "app.log", "keep.log", "LICENSE.txt"}
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry-run=%v", dryRun), func(t *testing.T) {
+			dir := t.TempDir()
+			folderTree(t, dir, map[string]int{"new.log": 1, "app.log": 100, "keep.log": 100, "LICENSE.txt": 100})
+			saved := protection
+			defer func() { protection = saved }()
+			var err error
+			if protection, err = loadProtection([]string{filepath.Join(dir, "keep.log"), "**/LICENSE*"}); err != nil {
+				t.Fatal(err)
+			}
+			res, err := processFolder(dir, testRule(t, dir, ""), processOptions{DryRun: dryRun})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Защищённые файлы не удаляются и оставляются с причиной protected
+			// и в пробном запуске, чтобы расхождение с правилами было видно заранее.
+			left := remaining(dir, names...)
+			if !left["keep.log"] || !left["LICENSE.txt"] || left["app.log"] == !dryRun {
+				t.Errorf("остались %v, want keep.log и LICENSE.txt", left)
+			}
+			if n := res.SkipReasons[SkipProtected]; n != 2 || res.Errors != 0 {
+				t.Errorf("оставлено по protect: %d, ошибок %d; want 2 и 0", n, res.Errors)
+			}
+		})
+	}
+}
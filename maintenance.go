@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// defaultMaintenancePoll — как часто повторяется проверка обслуживания
+// во время ожидания, если poll не задан.
+const defaultMaintenancePoll = 30 * time.Second
+
+// maintenanceTimeout ограничивает время одной проверки команды или
+// блокировок systemd.
+const maintenanceTimeout = 30 * time.Second
+
+// MaintenanceOptions описывает признаки обслуживания системы (восстановление
+// из резервной копии, миграция): пока хотя бы один из них есть, удаление
+// откладывается, чтобы очистка не мешала таким заданиям.
+//
+//	maintenance:
+//	  files: [/run/restore.lock]
+//	  inhibitors: [pg-restore]
+//	  wait: 10m
+type MaintenanceOptions struct {
+	Files []string `yaml:"files"` // обслуживание идёт, пока существует любой из файлов
+	// Command — команда и аргументы; код выхода 0 означает, что обслуживание идёт.
+	Command []string `yaml:"command"`
+	// Inhibitors — имена (who) блокировок systemd-inhibit в режиме block,
+	// допускаются шаблоны; * — любая такая блокировка (Linux).
+	Inhibitors []string      `yaml:"inhibitors"`
+	Wait       time.Duration `yaml:"wait"` // сколько ждать окончания обслуживания, 0 — не ждать
+	Poll       time.Duration `yaml:"poll"` // интервал проверок при ожидании, по умолчанию 30s
+}
+
+func (m MaintenanceOptions) enabled() bool {
+	return len(m.Files) > 0 || len(m.Command) > 0 || len(m.Inhibitors) > 0
+}
+
+// validateMaintenance проверяет настройки признаков обслуживания.
+func validateMaintenance(m MaintenanceOptions) error {
+	if m.Wait < 0 || m.Poll < 0 {
+		return fmt.Errorf("maintenance: wait и poll не могут быть отрицательными")
+	}
+	for _, pattern := range m.Inhibitors {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("maintenance.inhibitors: неверный шаблон %q", pattern)
+		}
+	}
+	return nil
+}
+
+// active проверяет признаки обслуживания и возвращает, какой из них найден.
+// Если признак проверить не удалось, обслуживание считается идущим: очистке
+// безопаснее подождать, чем удалить файлы во время восстановления.
+func (m MaintenanceOptions) active() (string, bool) {
+	for _, file := range m.Files {
+		if _, err := os.Stat(file); err == nil {
+			return "найден файл " + file, true
+		}
+	}
+	if len(m.Command) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), maintenanceTimeout)
+		defer cancel()
+		err := exec.CommandContext(ctx, m.Command[0], m.Command[1:]...).Run()
+		var exit *exec.ExitError
+		switch {
+		case err == nil:
+			return "команда " + strings.Join(m.Command, " ") + " завершилась с кодом 0", true
+		case ctx.Err() != nil:
+			return "команда " + strings.Join(m.Command, " ") + " не завершилась за отведённое время", true
+		case !errors.As(err, &exit):
+			return fmt.Sprintf("команду %s не удалось запустить: %v", strings.Join(m.Command, " "), err), true
+		}
+	}
+	if len(m.Inhibitors) > 0 {
+		inhibitors, err := listInhibitors()
+		if err != nil {
+			return fmt.Sprintf("блокировки systemd не удалось проверить: %v", err), true
+		}
+		for _, inh := range inhibitors {
+			if inh.Mode != "block" {
+				continue
+			}
+			for _, pattern := range m.Inhibitors {
+				if ok, _ := path.Match(pattern, inh.Who); ok {
+					return fmt.Sprintf("блокировка systemd %s (%s): %s", inh.Who, inh.What, inh.Why), true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// await ждёт окончания обслуживания не дольше until и возвращает признак,
+// если обслуживание так и не закончилось.
+func (m MaintenanceOptions) await(folder string, until time.Time) (string, bool) {
+	poll := m.Poll
+	if poll == 0 {
+		poll = defaultMaintenancePoll
+	}
+	reason, busy := m.active()
+	for busy && time.Now().Before(until) {
+		events.emit(EventDecision, folder, "", "Идёт обслуживание системы (%s), ожидание до %s", reason, until.Format(time.TimeOnly))
+		time.Sleep(min(poll, time.Until(until)))
+		reason, busy = m.active()
+	}
+	return reason, busy
+}
+
+// inhibitor — блокировка systemd-logind (systemd-inhibit).
+type inhibitor struct {
+	What, Who, Why, Mode string
+}
+
+// listInhibitors возвращает блокировки systemd-logind через busctl.
+func listInhibitors() ([]inhibitor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), maintenanceTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "busctl", "--json=short", "call", "org.freedesktop.login1",
+		"/org/freedesktop/login1", "org.freedesktop.login1.Manager", "ListInhibitors").Output()
+	if err != nil {
+		return nil, err
+	}
+	// Ответ — массив a(ssssuu): what, who, why, mode, uid, pid.
+	var reply struct {
+		Data [][][]any `json:"data"`
+	}
+	if err := json.Unmarshal(out, &reply); err != nil {
+		return nil, fmt.Errorf("неожиданный ответ busctl: %v", err)
+	}
+	var list []inhibitor
+	for _, data := range reply.Data {
+		for _, fields := range data {
+			if len(fields) < 4 {
+				continue
+			}
+			var inh inhibitor
+			inh.What, _ = fields[0].(string)
+			inh.Who, _ = fields[1].(string)
+			inh.Why, _ = fields[2].(string)
+			inh.Mode, _ = fields[3].(string)
+			list = append(list, inh)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configVersion — текущая версия схемы файла конфигурации.
+//
+// Версия 1 — исходный формат без поля version (days и список папок-строк).
+// Версия 2 добавляет поле version, папки-объекты и секцию defaults.
+const configVersion = 2
+
+// configMigrations содержит преобразования схемы: элемент с ключом N
+// переводит документ версии N в версию N+1.
+var configMigrations = map[int]func(yaml.MapSlice) (yaml.MapSlice, error){
+	1: func(doc yaml.MapSlice) (yaml.MapSlice, error) {
+		// Формат версии 1 является подмножеством версии 2.
+		return doc, nil
+	},
+}
+
+// documentVersion возвращает версию схемы документа (1, если поле не задано).
+func documentVersion(doc yaml.MapSlice) (int, error) {
+	for _, item := range doc {
+		if item.Key != "version" {
+			continue
+		}
+		v, ok := item.Value.(int)
+		if !ok || v < 1 {
+			return 0, fmt.Errorf("неверное значение version: %v", item.Value)
+		}
+		return v, nil
+	}
+	return 1, nil
+}
+
+// setDocumentVersion записывает версию схемы первым ключом документа.
+func setDocumentVersion(doc yaml.MapSlice, version int) yaml.MapSlice {
+	out := yaml.MapSlice{{Key: "version", Value: version}}
+	for _, item := range doc {
+		if item.Key != "version" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// migrateConfigData приводит YAML документ к текущей версии схемы.
+// Возвращает новые данные и исходную версию документа.
+func migrateConfigData(data []byte) ([]byte, int, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > configVersion {
+		return nil, version, fmt.Errorf("версия конфигурации %d новее поддерживаемой (%d), обновите cleanup", version, configVersion)
+	}
+	if version == configVersion {
+		return data, version, nil
+	}
+	for v := version; v < configVersion; v++ {
+		migrate, ok := configMigrations[v]
+		if !ok {
+			return nil, version, fmt.Errorf("нет преобразования конфигурации из версии %d", v)
+		}
+		if doc, err = migrate(doc); err != nil {
+			return nil, version, fmt.Errorf("преобразование из версии %d: %w", v, err)
+		}
+	}
+	out, err := yaml.Marshal(setDocumentVersion(doc, configVersion))
+	if err != nil {
+		return nil, version, err
+	}
+	return out, version, nil
+}
+
+// runConfig реализует подкоманду config.
+func runConfig(args []string) int {
+	switch {
+	case len(args) > 0 && args[0] == "migrate":
+		return runConfigMigrate(args[1:])
+	case len(args) > 0 && args[0] == "embedded":
+		return runConfigEmbedded(args[1:])
+	}
+	fmt.Fprintln(os.Stderr, "Usage: cleanup config migrate config.yml")
+	fmt.Fprintln(os.Stderr, "       cleanup config embedded")
+	return 1
+}
+
+// runConfigMigrate переписывает файл конфигурации в текущей версии схемы,
+// сохраняя исходный файл с суффиксом .bak. Комментарии при этом не сохраняются.
+func runConfigMigrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: cleanup config migrate config.yml")
+		return 1
+	}
+	path := args[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка чтения %s: %v\n", path, err)
+		return 1
+	}
+	migrated, version, err := migrateConfigData(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка обновления %s: %v\n", path, err)
+		return 1
+	}
+	if version == configVersion {
+		fmt.Printf("%s уже в актуальной версии %d\n", path, configVersion)
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка чтения %s: %v\n", path, err)
+		return 1
+	}
+	if err := os.WriteFile(path+".bak", data, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка сохранения резервной копии: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка записи %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Printf("%s обновлён с версии %d до %d, исходный файл сохранён в %s.bak\n", path, version, configVersion, path)
+	return 0
+}
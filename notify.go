@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+
+	"cleanup/notify"
+)
+
+// notifyAll отправляет итоги запуска во встроенные каналы, настроенные
+// в конфигурации, и в каналы, зарегистрированные через пакет notify.
+// Ошибка одного канала не мешает остальным.
+func notifyAll(cfg Config, summary RunSummary) {
+	report := func(name string, err error) {
+		if err != nil {
+			events.emitCode(EventError, CodeNotifyFailed, "", "", "Ошибка отправки итогов запуска в %s: %v", name, err)
+		} else {
+			events.emit(EventAction, "", "", "Итоги запуска отправлены в %s", name)
+		}
+	}
+	for _, b := range builtinNotifiers {
+		if send := b.open(cfg); send != nil {
+			report(b.name, send(summary))
+		}
+	}
+	notify.Send(notifyRun(summary), report)
+}
+
+// notifyRun строит итоги запуска для каналов пакета notify.
+func notifyRun(summary RunSummary) notify.Run {
+	host, _ := os.Hostname()
+	run := notify.Run{Host: host, Instance: summary.Instance, RunID: summary.RunID, DryRun: summary.DryRun,
+		Start: summary.Start, Duration: summary.Duration, Total: summary.Total, Deleted: summary.Deleted,
+		Freed: summary.Freed, Errors: summary.Errors, Missing: summary.Missing,
+		StoppedAt: summary.StoppedAt, CanaryFailed: summary.CanaryFailed, Deferred: summary.Deferred}
+	for _, f := range summary.Folders {
+		folder := notify.Folder{Path: f.Folder, Total: f.Total, Deleted: f.Deleted, Freed: f.Freed, Errors: f.Errors,
+			BestEffort: f.BestEffort}
+		if f.Err != nil {
+			folder.Error, folder.ErrorCode = f.Err.Error(), string(folderErrorCode(f.Err))
+		}
+		if len(f.ErrorCodes) > 0 {
+			folder.ErrorCodes = make(map[string]int)
+			for code, n := range f.ErrorCodes {
+				folder.ErrorCodes[string(code)] = n
+			}
+		}
+		run.Folders = append(run.Folders, folder)
+	}
+	return run
+}
+
+// builtinNotifiers — встроенные каналы: по конфигурации запуска open
+// возвращает функцию отправки итогов или nil, если канал не настроен.
+var builtinNotifiers = []struct {
+	name string
+	open func(cfg Config) func(summary RunSummary) error
+}{
+	{"Pushgateway", func(cfg Config) func(RunSummary) error {
+		if cfg.PushGateway.URL == "" {
+			return nil
+		}
+		return func(s RunSummary) error { return pushMetrics(cfg.PushGateway, s) }
+	}},
+	{"CloudWatch", func(cfg Config) func(RunSummary) error {
+		if cfg.CloudWatch.Namespace == "" && cfg.CloudWatch.LogGroup == "" {
+			return nil
+		}
+		return func(s RunSummary) error { return publishCloudWatch(cfg.CloudWatch, s) }
+	}},
+	{"Datadog", func(cfg Config) func(RunSummary) error {
+		if !cfg.Datadog.API && cfg.Datadog.APIKey == "" && cfg.Datadog.StatsD == "" {
+			return nil
+		}
+		return func(s RunSummary) error { return publishDatadog(cfg.Datadog, s) }
+	}},
+	{"syslog", func(cfg Config) func(RunSummary) error {
+		if cfg.Syslog.Address == "" {
+			return nil
+		}
+		return func(s RunSummary) error { return shipSyslog(cfg.Syslog, s) }
+	}},
+	{"сервер сбора", func(cfg Config) func(RunSummary) error {
+		if cfg.Collect.URL == "" {
+			return nil
+		}
+		return func(s RunSummary) error { return sendReport(cfg.Collect, newRunRecord(s, false)) }
+	}},
+	{"план пробного запуска", func(cfg Config) func(RunSummary) error {
+		if cfg.PlanUpload == "" || !cfg.DryRun {
+			return nil
+		}
+		return func(s RunSummary) error { return uploadPlan(cfg, newPlanRecord(cfg, s)) }
+	}},
+}
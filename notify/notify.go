@@ -0,0 +1,117 @@
+// Package notify — точка расширения cleanup для собственных каналов
+// уведомлений об итогах запуска (например, внутренней системы оповещения
+// дежурных). Пакет канала регистрирует его в init, а в сборку cleanup
+// канал добавляется пустым импортом этого пакета:
+//
+//	package pager
+//
+//	import "cleanup/notify"
+//
+//	func init() {
+//		notify.Register("пейджер", notify.Func(func(run notify.Run) error {
+//			if run.Errors == 0 && len(run.Failed()) == 0 {
+//				return nil
+//			}
+//			return page(run)
+//		}))
+//	}
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// Run — итоги запуска cleanup, передаваемые каналам.
+type Run struct {
+	Host     string
+	Instance string // идентификатор экземпляра (конфигурации)
+	RunID    string
+	DryRun   bool // пробный запуск: файлы не удалялись
+	Start    time.Time
+	Duration time.Duration
+	Total    int   // просмотрено файлов
+	Deleted  int   // удалено файлов
+	Freed    int64 // освобождено байт
+	Errors   int   // ошибок при обработке отдельных файлов
+	Folders  []Folder
+	Missing  []string // ненайденные папки
+	// StoppedAt — файл или папка, на которых запуск остановлен по времени;
+	// CanaryFailed — папка-канарейка, проверка которой не пройдена;
+	// Deferred — признак обслуживания, из-за которого удаление отложено.
+	StoppedAt    string
+	CanaryFailed string
+	Deferred     string
+}
+
+// Folder — итоги обработки папки.
+type Folder struct {
+	Path    string
+	Total   int
+	Deleted int
+	Freed   int64
+	Errors  int // ошибок при обработке отдельных файлов
+	// Error и ErrorCode — ошибка, из-за которой папка не обработана, и её
+	// код (E_FOLDER_MISSING, E_DELETE_LIMIT...); ErrorCodes — сколько ошибок
+	// отдельных файлов с каждым кодом.
+	Error      string
+	ErrorCode  string
+	ErrorCodes map[string]int
+	// BestEffort — ошибка папки не считается ошибкой запуска.
+	BestEffort bool
+}
+
+// Failed возвращает папки, обработанные с ошибкой.
+func (r Run) Failed() []Folder {
+	var failed []Folder
+	for _, f := range r.Folders {
+		if f.Error != "" {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+// Notifier — канал, в который отправляются итоги запуска.
+type Notifier interface {
+	Notify(run Run) error
+}
+
+// Func позволяет использовать функцию как Notifier.
+type Func func(run Run) error
+
+// Notify вызывает f.
+func (f Func) Notify(run Run) error { return f(run) }
+
+// channel — канал, зарегистрированный под именем.
+type channel struct {
+	name     string
+	notifier Notifier
+}
+
+var (
+	mu       sync.Mutex
+	channels []channel
+)
+
+// Register регистрирует канал n с именем name. Каналы вызываются после
+// каждого запуска в порядке регистрации; свои настройки канал читает сам
+// (переменные окружения, собственный файл) и пропускает запуски, о которых
+// сообщать не нужно, возвращая nil.
+func Register(name string, n Notifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	channels = append(channels, channel{name: name, notifier: n})
+}
+
+// Send отправляет итоги запуска во все зарегистрированные каналы и сообщает
+// о результате каждой отправки в done. Ошибка одного канала не мешает
+// остальным.
+func Send(run Run, done func(name string, err error)) {
+	mu.Lock()
+	registered := append([]channel(nil), channels...)
+	mu.Unlock()
+	for _, c := range registered {
+		done(c.name, c.notifier.Notify(run))
+	}
+}
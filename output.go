@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Форматы итогов запуска на стандартном выводе (output).
+const (
+	outputText = "text" // итоговая таблица (по умолчанию)
+	outputJSON = "json" // машиночитаемая сводка, таблица — в stderr
+)
+
+// validateOutput проверяет формат итогов output.
+func validateOutput(format string) error {
+	if format != outputText && format != outputJSON {
+		return fmt.Errorf("output=%q: допустимы text, json", format)
+	}
+	return nil
+}
+
+// runOutput — сводка запуска для --output json: запись о запуске, код
+// завершения и ошибка, из-за которой очистка не выполнялась или была
+// остановлена, с её кодом.
+type runOutput struct {
+	RunRecord
+	Errors    int       `json:"errors"`
+	ExitCode  int       `json:"exit_code"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+// writeRunOutput выводит сводку запуска в формате JSON.
+func writeRunOutput(w io.Writer, summary RunSummary, runErr error, code int) error {
+	out := runOutput{RunRecord: newRunRecord(summary, false), Errors: summary.Errors, ExitCode: code}
+	if runErr != nil {
+		out.Error, out.ErrorCode = runErr.Error(), errorCode(runErr, CodeConfig)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+)
+
+// dedupeFolders убирает повторы папок (один и тот же абсолютный путь),
+// чтобы файлы не проверялись дважды. Повтор с теми же итоговыми правилами
+// пропускается с предупреждением; повтор с другими правилами — ошибка
+// конфигурации, потому что неясно, какие из правил должны действовать.
+func dedupeFolders(cfg Config, specs []FolderSpec) ([]FolderSpec, error) {
+	first := make(map[string]FolderSpec)
+	var out []FolderSpec
+	for _, spec := range specs {
+		key := folderKey(spec.Path)
+		prev, ok := first[key]
+		if !ok {
+			first[key] = spec
+			out = append(out, spec)
+			continue
+		}
+		if !cfg.sameFolderRules(prev, spec) {
+			return nil, fmt.Errorf("папка %s указана несколько раз с разными настройками (совпадает с %s): оставьте одно определение", spec.Path, prev.Path)
+		}
+		events.emit(EventWarning, spec.Path, "", "Папка %s указана повторно (совпадает с %s), обрабатывается один раз", spec.Path, prev.Path)
+	}
+	return out, nil
+}
+
+// sameFolderRules сообщает, очищаются ли папки a и b по одинаковым правилам.
+func (cfg Config) sameFolderRules(a, b FolderSpec) bool {
+	return reflect.DeepEqual(cfg.folderRule(a), cfg.folderRule(b)) && reflect.DeepEqual(a.Canary, b.Canary)
+}
+
+// nestedFolders возвращает пути других папок конфигурации, вложенных в folder,
+// относительно folder. Каждая папка очищается только по своим правилам, а
+// файлы её подкаталогов затрагивают лишь квоты подкаталогов, поэтому
+// вложенная папка исключается из квот внешней: действуют правила более
+// глубокой папки.
+func nestedFolders(folder string, specs []FolderSpec) []string {
+	parent := folderKey(folder)
+	var nested []string
+	for _, spec := range specs {
+		if path := folderKey(spec.Path); isSubpath(parent, path) {
+			if rel, err := filepath.Rel(parent, path); err == nil {
+				nested = append(nested, rel)
+			}
+		}
+	}
+	return nested
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// resolveOwners переводит имена пользователей или групп списка owner/group
+// в числовые идентификаторы; числа остаются как есть. name — название
+// параметра для сообщений, lookup — поиск идентификатора по имени.
+func resolveOwners(name string, list []string, lookup func(string) (string, error)) ([]string, error) {
+	var ids []string
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(entry, 10, 32); err == nil {
+			ids = append(ids, entry)
+			continue
+		}
+		id, err := lookup(entry)
+		if err != nil {
+			return ids, fmt.Errorf("%s: %q не найден", name, entry)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ownerSkip возвращает, почему файл владельца uid и группы gid не очищается
+// по спискам owner и group папки, или пустую строку. Пустые uid и gid —
+// владелец на этой системе не определяется, и файл оставляется.
+func (r folderRule) ownerSkip(uid, gid string) string {
+	if len(r.Owner) == 0 && len(r.Group) == 0 {
+		return ""
+	}
+	if uid == "" && gid == "" {
+		return "владелец файла на этой системе не определяется"
+	}
+	if len(r.Owner) > 0 && !slices.Contains(r.OwnerIDs, uid) {
+		return fmt.Sprintf("uid %s, нужен owner %s", uid, strings.Join(r.Owner, ", "))
+	}
+	if len(r.Group) > 0 && !slices.Contains(r.GroupIDs, gid) {
+		return fmt.Sprintf("gid %s, нужна group %s", gid, strings.Join(r.Group, ", "))
+	}
+	return ""
+}
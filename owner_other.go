@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import "io/fs"
+
+// ownersSupported — владельцы файлов здесь не сравниваются.
+const ownersSupported = false
+
+// fileOwner на этой системе владельца не определяет: файлы папок с owner
+// или group оставляются.
+func fileOwner(info fs.FileInfo) (uid, gid string) {
+	return "", ""
+}
+
+// lookupUserID принимает любое имя: владельцы файлов здесь не сравниваются.
+func lookupUserID(name string) (string, error) {
+	return name, nil
+}
+
+// lookupGroupID принимает любое имя: группы файлов здесь не сравниваются.
+func lookupGroupID(name string) (string, error) {
+	return name, nil
+}
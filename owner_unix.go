@@ -0,0 +1,39 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// ownersSupported — владельцы файлов сравниваются со списками owner и group.
+const ownersSupported = true
+
+// fileOwner возвращает uid и gid владельца файла.
+func fileOwner(info fs.FileInfo) (uid, gid string) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return strconv.FormatUint(uint64(st.Uid), 10), strconv.FormatUint(uint64(st.Gid), 10)
+	}
+	return "", ""
+}
+
+// lookupUserID возвращает uid пользователя по имени.
+func lookupUserID(name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// lookupGroupID возвращает gid группы по имени.
+func lookupGroupID(name string) (string, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
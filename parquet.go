@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// Минимальная запись файлов Parquet без внешних зависимостей: одна группа
+// строк, по одной странице данных на столбец, кодирование PLAIN без сжатия,
+// все столбцы обязательные. Метаданные кодируются компактным протоколом
+// Thrift, как того требует формат.
+
+const parquetMagic = "PAR1"
+
+// Физические типы и аннотации Parquet.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0 // ConvertedType UTF8
+	parquetTimestampMillis = 9 // ConvertedType TIMESTAMP_MILLIS
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+)
+
+// Типы полей компактного протокола Thrift.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter кодирует структуры компактным протоколом Thrift.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // номер последнего поля каждой открытой структуры
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// field пишет заголовок поля id типа typ.
+func (t *thriftWriter) field(id int16, typ byte) {
+	top := &t.last[len(t.last)-1]
+	if delta := id - *top; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	*top = id
+}
+
+func (t *thriftWriter) begin() { t.last = append(t.last, 0) }
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// list пишет заголовок списка из n элементов типа typ.
+func (t *thriftWriter) list(id int16, typ byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | typ)
+	} else {
+		t.buf.WriteByte(0xf0 | typ)
+		t.varint(uint64(n))
+	}
+}
+
+// structs пишет список структур, содержимое каждой записывает fn.
+func (t *thriftWriter) structs(id int16, n int, fn func(i int)) {
+	t.list(id, thriftStruct, n)
+	for i := 0; i < n; i++ {
+		t.begin()
+		fn(i)
+		t.end()
+	}
+}
+
+// parquetType возвращает физический тип и аннотацию (-1 — без аннотации)
+// столбца выгрузки.
+func parquetType(kind columnKind) (int32, int32) {
+	switch kind {
+	case columnInt:
+		return parquetInt64, -1
+	case columnFloat:
+		return parquetDouble, -1
+	case columnBool:
+		return parquetBoolean, -1
+	case columnTime:
+		return parquetInt64, parquetTimestampMillis
+	}
+	return parquetByteArray, parquetUTF8
+}
+
+// parquetValues кодирует значения столбца в PLAIN.
+func parquetValues(col historyColumn, rows []historyRow) []byte {
+	var buf bytes.Buffer
+	var b [8]byte
+	var bits byte
+	for i, row := range rows {
+		switch v := col.value(row).(type) {
+		case time.Time:
+			binary.LittleEndian.PutUint64(b[:], uint64(v.UnixMilli()))
+			buf.Write(b[:])
+		case int64:
+			binary.LittleEndian.PutUint64(b[:], uint64(v))
+			buf.Write(b[:])
+		case float64:
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+			buf.Write(b[:])
+		case bool:
+			// Логические значения упаковываются по биту, начиная с младшего.
+			if v {
+				bits |= 1 << (i % 8)
+			}
+			if i%8 == 7 || i == len(rows)-1 {
+				buf.WriteByte(bits)
+				bits = 0
+			}
+		case string:
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(v)))
+			buf.Write(b[:4])
+			buf.WriteString(v)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeHistoryParquet записывает строки выгрузки в формате Parquet.
+func writeHistoryParquet(w io.Writer, rows []historyRow) error {
+	type chunk struct {
+		offset, size int64
+	}
+	var body bytes.Buffer
+	body.WriteString(parquetMagic)
+	chunks := make([]chunk, len(historyColumns))
+	for i, col := range historyColumns {
+		data := parquetValues(col, rows)
+		var hdr thriftWriter
+		hdr.begin()
+		hdr.i32(1, 0) // DATA_PAGE
+		hdr.i32(2, int32(len(data)))
+		hdr.i32(3, int32(len(data)))
+		hdr.field(5, thriftStruct)
+		hdr.begin()
+		hdr.i32(1, int32(len(rows)))
+		hdr.i32(2, parquetEncodingPlain)
+		hdr.i32(3, parquetEncodingRLE)
+		hdr.i32(4, parquetEncodingRLE)
+		hdr.end()
+		hdr.end()
+		chunks[i] = chunk{offset: int64(body.Len()), size: int64(hdr.buf.Len() + len(data))}
+		body.Write(hdr.buf.Bytes())
+		body.Write(data)
+	}
+
+	var total int64
+	for _, c := range chunks {
+		total += c.size
+	}
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1)
+	meta.structs(2, len(historyColumns)+1, func(i int) {
+		if i == 0 {
+			meta.str(4, "schema")
+			meta.i32(5, int32(len(historyColumns)))
+			return
+		}
+		col := historyColumns[i-1]
+		typ, converted := parquetType(col.kind)
+		meta.i32(1, typ)
+		meta.i32(3, 0) // REQUIRED
+		meta.str(4, col.name)
+		if converted >= 0 {
+			meta.i32(6, converted)
+		}
+	})
+	meta.i64(3, int64(len(rows)))
+	meta.structs(4, 1, func(int) {
+		meta.structs(1, len(historyColumns), func(i int) {
+			col, c := historyColumns[i], chunks[i]
+			typ, _ := parquetType(col.kind)
+			meta.i64(2, c.offset)
+			meta.field(3, thriftStruct)
+			meta.begin()
+			meta.i32(1, typ)
+			meta.list(2, thriftI32, 2)
+			meta.zigzag(parquetEncodingPlain)
+			meta.zigzag(parquetEncodingRLE)
+			meta.list(3, thriftBinary, 1)
+			meta.varint(uint64(len(col.name)))
+			meta.buf.WriteString(col.name)
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, int64(len(rows)))
+			meta.i64(6, c.size)
+			meta.i64(7, c.size)
+			meta.i64(9, c.offset)
+			meta.end()
+		})
+		meta.i64(2, total)
+		meta.i64(3, int64(len(rows)))
+	})
+	meta.str(6, "cleanup")
+	meta.end()
+
+	body.Write(meta.buf.Bytes())
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(meta.buf.Len()))
+	body.Write(size[:])
+	body.WriteString(parquetMagic)
+	_, err := w.Write(body.Bytes())
+	return err
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// thriftReader разбирает структуры компактного протокола Thrift в словари
+// «номер поля — значение»: целые — int64, строки — []byte, списки — []any.
+// Поддерживаются только типы, которые пишет thriftWriter.
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		panic(fmt.Sprintf("неверный varint на смещении %d", r.pos))
+	}
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		r.pos += n
+		return r.data[r.pos-n : r.pos]
+	case thriftList:
+		head := r.data[r.pos]
+		r.pos++
+		n := int(head >> 4)
+		if n == 15 {
+			n = int(r.varint())
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i] = r.value(head & 0x0f)
+		}
+		return items
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("неподдерживаемый тип Thrift %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		head := r.data[r.pos]
+		r.pos++
+		if head == 0 {
+			return fields
+		}
+		if delta := int16(head >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(head & 0x0f)
+	}
+}
+
+// parquetFooter проверяет обрамление файла и разбирает FileMetaData.
+func parquetFooter(t *testing.T, data []byte) map[int16]any {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != parquetMagic || string(data[len(data)-4:]) != parquetMagic {
+		t.Fatalf("нет сигнатуры %s в начале и конце файла", parquetMagic)
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	start := len(data) - 8 - size
+	r := &thriftReader{data: data[:len(data)-8], pos: start}
+	meta := r.structure()
+	if r.pos != len(data)-8 {
+		t.Fatalf("метаданные заняли %d байт, в файле указано %d", r.pos-start, size)
+	}
+	return meta
+}
+
+// testHistoryRows строит n строк выгрузки; dry_run установлен у каждой
+// третьей строки.
+func testHistoryRows(n int) []historyRow {
+	records := make([]RunRecord, n)
+	rows := make([]historyRow, n)
+	for i := range records {
+		records[i] = RunRecord{
+			Host:   "web-1",
+			RunID:  fmt.Sprintf("run-%d", i),
+			DryRun: i%3 == 0,
+			Start:  time.Date(2024, 5, 1, 0, 0, i, 0, time.UTC),
+		}
+		rows[i] = historyRow{rec: &records[i], folder: FolderRecord{Folder: "/var/log/app", Deleted: i}}
+	}
+	return rows
+}
+
+func TestHistoryParquetFooter(t *testing.T) {
+	for _, n := range []int{0, 1, 10} {
+		t.Run(fmt.Sprintf("строк %d", n), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeHistoryParquet(&buf, testHistoryRows(n)); err != nil {
+				t.Fatal(err)
+			}
+			data := buf.Bytes()
+			meta := parquetFooter(t, data)
+			if got := meta[3]; got != int64(n) {
+				t.Errorf("num_rows = %v, want %d", got, n)
+			}
+
+			schema := meta[2].([]any)
+			if len(schema) != len(historyColumns)+1 {
+				t.Fatalf("элементов схемы %d, want %d", len(schema), len(historyColumns)+1)
+			}
+			if root := schema[0].(map[int16]any); root[5] != int64(len(historyColumns)) {
+				t.Errorf("num_children корня = %v, want %d", root[5], len(historyColumns))
+			}
+			for i, col := range historyColumns {
+				el := schema[i+1].(map[int16]any)
+				typ, converted := parquetType(col.kind)
+				if string(el[4].([]byte)) != col.name || el[1] != int64(typ) {
+					t.Errorf("столбец %d: %s типа %v, want %s типа %d", i, el[4], el[1], col.name, typ)
+				}
+				if converted >= 0 && el[6] != int64(converted) {
+					t.Errorf("столбец %s: converted_type = %v, want %d", col.name, el[6], converted)
+				}
+			}
+
+			groups := meta[4].([]any)
+			if len(groups) != 1 {
+				t.Fatalf("групп строк %d, want 1", len(groups))
+			}
+			group := groups[0].(map[int16]any)
+			if group[3] != int64(n) {
+				t.Errorf("num_rows группы = %v, want %d", group[3], n)
+			}
+			// Столбцы идут подряд сразу за сигнатурой, каждый начинается
+			// заголовком страницы, а их размеры в сумме дают total_byte_size.
+			offset, total := int64(len(parquetMagic)), int64(0)
+			for i, c := range group[1].([]any) {
+				col := historyColumns[i]
+				chunk := c.(map[int16]any)
+				cm := chunk[3].(map[int16]any)
+				size := cm[7].(int64)
+				if chunk[2] != offset || cm[9] != offset {
+					t.Fatalf("столбец %s: смещение %v (data_page_offset %v), want %d", col.name, chunk[2], cm[9], offset)
+				}
+				if cm[5] != int64(n) {
+					t.Errorf("столбец %s: num_values = %v, want %d", col.name, cm[5], n)
+				}
+				r := &thriftReader{data: data, pos: int(offset)}
+				page := r.structure()
+				header := page[5].(map[int16]any)
+				if page[1] != int64(0) || header[1] != int64(n) {
+					t.Errorf("столбец %s: страница типа %v на %v значений, want DATA_PAGE на %d", col.name, page[1], header[1], n)
+				}
+				if got := int64(r.pos) - offset + page[3].(int64); got != size {
+					t.Errorf("столбец %s: заголовок и данные занимают %d байт, want %d", col.name, got, size)
+				}
+				offset += size
+				total += size
+			}
+			if group[2] != total {
+				t.Errorf("total_byte_size = %v, want %d", group[2], total)
+			}
+			if footer := int64(len(data) - 8 - int(binary.LittleEndian.Uint32(data[len(data)-8:]))); offset != footer {
+				t.Errorf("столбцы заканчиваются на %d, метаданные начинаются с %d", offset, footer)
+			}
+		})
+	}
+}
+
+func TestHistoryParquetBool(t *testing.T) {
+	rows := testHistoryRows(19)
+	var col historyColumn
+	for _, c := range historyColumns {
+		if c.kind == columnBool {
+			col = c
+		}
+	}
+	data := parquetValues(col, rows)
+	if len(data) != 3 {
+		t.Fatalf("19 значений заняли %d байт, want 3", len(data))
+	}
+	for i, row := range rows {
+		if got := data[i/8]>>(i%8)&1 == 1; got != row.rec.DryRun {
+			t.Errorf("строка %d: %s = %v, want %v", i, col.name, got, row.rec.DryRun)
+		}
+	}
+}
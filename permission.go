@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os/user"
+)
+
+// fileError регистрирует ошибку обработки файла. Отказы в доступе обычно
+// повторяются для всех файлов папки, поэтому по каждому файлу выводится
+// только событие skip, а по папке — одна сводка с подсказкой. Отказ по
+// списку protect и занятый другим процессом файл — не ошибка: файл
+// оставляется с предупреждением. code — код ошибки операции; для
+// исчезнувшего файла и отказа в доступе он уточняется по самой ошибке.
+func (res *FolderResult) fileError(path string, code ErrorCode, message string, err error) {
+	var protected *protectedError
+	if errors.As(err, &protected) {
+		events.emit(EventWarning, res.Folder, path, "%s не удалён: защищён правилом protect %s", path, protected.rule)
+		res.Skipped++
+		res.keep(path, SkipProtected, protected.rule)
+		return
+	}
+	var locked *lockedError
+	if errors.As(err, &locked) {
+		events.emit(EventWarning, res.Folder, path, "%s не удалён: занят другим процессом, пропущен (попыток: %d)", path, locked.attempts)
+		res.Skipped++
+		res.keep(path, SkipLocked, locked.err.Error())
+		return
+	}
+	res.Errors++
+	code = fileErrorCode(code, err)
+	if res.ErrorCodes == nil {
+		res.ErrorCodes = make(map[ErrorCode]int)
+	}
+	res.ErrorCodes[code]++
+	if errors.Is(err, fs.ErrPermission) {
+		res.PermissionDenied++
+		res.keepCode(path, SkipPermission, err.Error(), code)
+		return
+	}
+	events.emitCode(EventError, code, res.Folder, path, "%s: %v", message, err)
+	res.keepCode(path, SkipError, err.Error(), code)
+}
+
+// currentUserName возвращает имя пользователя, от имени которого запущен cleanup.
+func currentUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "?"
+}
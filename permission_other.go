@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "fmt"
+
+// permissionHint описывает, какие права нужны для удаления файлов в папке.
+func permissionHint(folder string) string {
+	return fmt.Sprintf("cleanup запущен от имени %s; для удаления нужно право «Удаление» на файлы или «Удаление подпапок и файлов» на папку %s",
+		currentUserName(), folder)
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// permissionHint описывает владельца и права папки и то, какие права
+// нужны для удаления файлов в ней.
+func permissionHint(folder string) string {
+	need := "для удаления файлов нужны права на запись и выполнение для папки"
+	info, err := os.Stat(folder)
+	if err != nil {
+		return need
+	}
+	owner, group := "?", "?"
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		owner, group = strconv.FormatUint(uint64(st.Uid), 10), strconv.FormatUint(uint64(st.Gid), 10)
+		if u, err := user.LookupId(owner); err == nil {
+			owner = u.Username
+		}
+		if g, err := user.LookupGroupId(group); err == nil {
+			group = g.Name
+		}
+	}
+	if info.Mode()&os.ModeSticky != 0 {
+		need += ", а из-за sticky-бита — ещё и владение файлами"
+	}
+	return fmt.Sprintf("папка принадлежит %s:%s (%s), cleanup запущен от имени %s; %s",
+		owner, group, info.Mode().Perm(), currentUserName(), need)
+}
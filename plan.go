@@ -0,0 +1,254 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Действия политики над файлом при сравнении конфигураций.
+const (
+	planKeep     = "оставлен"
+	planDelete   = "удалён"
+	planTier     = "перемещён"
+	planCompress = "сжат"
+)
+
+// planFile — сведения о файле, полученные одним чтением папки.
+type planFile struct {
+	Name   string
+	Stamps fileStamps
+	Size   int64
+	UID    string
+	GID    string
+}
+
+// scanPlanFolder читает обычные файлы папки (с recursive — и подкаталогов
+// до max_depth правила rule) вместе с отметками времени. Обе политики
+// сравниваются на одном и том же результате.
+func scanPlanFolder(folder string, rule folderRule) ([]planFile, error) {
+	var files []planFile
+	err := readFolderFiles(folder, rule, nil, false, nil, func(entry os.DirEntry) {
+		if !entry.Type().IsRegular() {
+			return
+		}
+		fullPath := filepath.Join(folder, entry.Name())
+		t, err := statTimes(fullPath)
+		if err != nil {
+			log.Printf("Ошибка получения времени для %s: %v\n", fullPath, err)
+			return
+		}
+		f := planFile{Name: entry.Name(), Stamps: stampsOf(t)}
+		if info, err := entry.Info(); err == nil {
+			f.Size = info.Size()
+			f.UID, f.GID = fileOwner(info)
+		}
+		files = append(files, f)
+	})
+	return files, err
+}
+
+// treeFiles отбирает файлы, которые очищает папка по recursive и max_depth
+// правила rule, без файлов вложенных папок конфигурации nested.
+func treeFiles(files []planFile, rule folderRule, nested []string) []planFile {
+	var out []planFile
+	for _, f := range files {
+		if !rule.withinDepth(f.Name) || slices.ContainsFunc(nested, func(rel string) bool { return isSubpath(rel, f.Name) }) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// planActions определяет, что сделает с каждым файлом папки правило rule,
+// так же как processFolder: срок отсчитывается от самого свежего файла
+// (у каждого правила retention — своего), файлы из будущего обрабатываются
+// по futurePolicy.
+func planActions(files []planFile, rule folderRule, futurePolicy string) map[string]string {
+	future := time.Now().Add(futureTolerance)
+	anchors := newRetentionAnchors(rule)
+	keepNewest := newestFiles{n: rule.Keep}
+	gfs := newGFSFiles(rule.GFS)
+	thinned := newThinning(rule.KeepOnePer, anchors)
+	ranked := newestFiles{n: rule.Policy.maxBeyondNewest()}
+	for _, f := range files {
+		if _, ok := tombstoneTime(f.Name); ok && rule.SoftDelete > 0 || !rule.included(f.Name) || rule.excluded(f.Name) ||
+			rule.filtered(f.Name, false) != "" || rule.sizeSkip(f.Size) != "" ||
+			rule.ownerSkip(f.UID, f.GID) != "" {
+			continue
+		}
+		t := rule.fileTime(f.Stamps, f.Name)
+		if rule.latestTime(f.Stamps, f.Name).After(future) {
+			continue
+		}
+		anchors.add(f.Name, t)
+		keepNewest.add(f.Name, t)
+		gfs.add(f.Name, f.Stamps.mtime)
+		thinned.add(f.Name, t)
+		ranked.add(f.Name, t)
+	}
+	keepNames := keepNewest.names()
+	gfsKeep := gfs.names()
+	periodKeep := thinned.names()
+	ranks := ranked.ranks()
+	actions := make(map[string]string, len(files))
+	for _, f := range files {
+		if _, ok := tombstoneTime(f.Name); ok && rule.SoftDelete > 0 || !rule.included(f.Name) || rule.excluded(f.Name) ||
+			rule.filtered(f.Name, false) != "" || rule.sizeSkip(f.Size) != "" ||
+			rule.ownerSkip(f.UID, f.GID) != "" {
+			continue
+		}
+		action := planKeep
+		t := rule.fileTime(f.Stamps, f.Name)
+		pf := policyFile{name: f.Name, newest: t, size: f.Size, rank: ranks.of(f.Name)}
+		newest := anchors.of(f.Name)
+		tierCutoff := newest.AddDate(0, 0, -rule.TierDays)
+		compressCutoff := newest.AddDate(0, 0, -rule.CompressDays)
+		switch {
+		case keepNames[f.Name]:
+		case rule.latestTime(f.Stamps, f.Name).After(future):
+			if futurePolicy == futureDelete {
+				action = planDelete
+			}
+		case gfsKeep[f.Name] == "" && periodKeep[f.Name] == "" && rule.expired(pf, newest) && !rule.recentlyRead(f.Stamps, time.Now()):
+			action = planDelete
+		case rule.TierTo != "" && t.Before(tierCutoff):
+			action = planTier
+		case rule.CompressDays > 0 && !rule.compressed(f.Name) && t.Before(compressCutoff):
+			action = planCompress
+		}
+		actions[f.Name] = action
+	}
+	return actions
+}
+
+// loadPlanConfig загружает конфигурацию path с флагами и переменными окружения
+// командной строки подкоманды plan.
+func loadPlanConfig(path string, args []string) (Config, error) {
+	_, cfg, _, err := parseRunArgs("plan", append([]string{"--config", path}, args...))
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %v", path, err)
+	}
+	if cfg.Days < 0 || len(cfg.Folders) == 0 {
+		return cfg, fmt.Errorf("%s: %v", path, errMissingParams)
+	}
+	return cfg, nil
+}
+
+// runPlan реализует подкоманду plan --compare: обе конфигурации применяются
+// к одному чтению папок без удаления файлов и выводятся файлы, судьба которых
+// изменится после перехода со старой конфигурации на новую.
+func runPlan(args []string) int {
+	// Позиционные аргументы — файлы конфигурации, поэтому здесь они только
+	// разбираются, а загружаются в loadPlanConfig.
+	var opts runOptions
+	probeCfg := defaultConfig()
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	bindRunFlags(fs, &opts, &probeCfg)
+	files, err := parseFlags(fs, args, &opts.help)
+	if err != nil {
+		log.Print(err)
+		return exitFailed
+	}
+	if opts.help {
+		fmt.Println("Usage: cleanup plan --compare old.yml new.yml [flags]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if !opts.compare || len(files) != 2 {
+		log.Print("Укажите две конфигурации: cleanup plan --compare old.yml new.yml")
+		return 1
+	}
+	oldCfg, err := loadPlanConfig(files[0], args)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	newCfg, err := loadPlanConfig(files[1], args)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	// Папка, которой нет в одной из конфигураций, ею не очищается.
+	oldSpecs := make(map[string]FolderSpec)
+	newSpecs := make(map[string]FolderSpec)
+	var folders []string
+	for _, spec := range oldCfg.Folders {
+		oldSpecs[folderKey(spec.Path)] = spec
+		folders = append(folders, folderKey(spec.Path))
+	}
+	for _, spec := range newCfg.Folders {
+		newSpecs[folderKey(spec.Path)] = spec
+		folders = append(folders, folderKey(spec.Path))
+	}
+	slices.Sort(folders)
+	folders = slices.Compact(folders)
+
+	var added, kept, changed int
+	var addedSize, keptSize int64
+	for _, folder := range folders {
+		// Папка читается на глубину той конфигурации, которая обходит больше
+		// подкаталогов; лишние файлы другой отбрасываются в treeFiles.
+		var scan folderRule
+		if spec, ok := oldSpecs[folder]; ok {
+			scan = oldCfg.folderRule(spec)
+		}
+		if spec, ok := newSpecs[folder]; ok {
+			scan = deeperRule(scan, newCfg.folderRule(spec))
+		}
+		files, err := scanPlanFolder(folder, scan)
+		if err != nil {
+			log.Printf("Ошибка чтения папки '%s': %v\n", folder, err)
+			continue
+		}
+		ignore, err := loadIgnore(folder)
+		if err != nil {
+			log.Printf("Ошибка чтения исключений папки '%s': %v\n", folder, err)
+			continue
+		}
+		actions := func(cfg Config, specs map[string]FolderSpec) map[string]string {
+			spec, ok := specs[folder]
+			if !ok {
+				return nil
+			}
+			rule := cfg.folderRule(spec)
+			rule.Ignore = ignore
+			return planActions(treeFiles(files, rule, nestedFolders(folder, cfg.Folders)), rule, cfg.FuturePolicy)
+		}
+		before, after := actions(oldCfg, oldSpecs), actions(newCfg, newSpecs)
+		for _, f := range files {
+			was, now := before[f.Name], after[f.Name]
+			if was == "" {
+				was = planKeep
+			}
+			if now == "" {
+				now = planKeep
+			}
+			if was == now {
+				continue
+			}
+			fmt.Printf("%s: был бы %s, будет %s (изменён %s, размер %s)\n", filepath.Join(folder, f.Name), was, now,
+				f.Stamps.mtime.Local().Format(time.RFC3339), formatBytes(f.Size))
+			switch {
+			case now == planDelete:
+				added++
+				addedSize += f.Size
+			case was == planDelete:
+				kept++
+				keptSize += f.Size
+			default:
+				changed++
+			}
+		}
+	}
+	fmt.Printf("Итого: дополнительно будут удалены %d файлов (%s), больше не будут удаляться %d файлов (%s), изменится перемещение или сжатие %d файлов\n",
+		added, formatBytes(addedSize), kept, formatBytes(keptSize), changed)
+	return 0
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// planUploadCollect — значение plan_upload для отправки плана на сервер сбора.
+const planUploadCollect = "collect"
+
+// planExamples — сколько файлов отличающейся папки выводит plans diff.
+const planExamples = 5
+
+// PlanRecord — план пробного запуска: что сделал бы запуск на хосте. Планы
+// хостов сравниваются подкомандой plans diff, чтобы до включения удаления
+// на всём парке найти сервер, на котором политика ведёт себя неожиданно.
+type PlanRecord struct {
+	Host       string       `json:"host"`
+	Instance   string       `json:"instance"`
+	ConfigHash string       `json:"config_hash"` // хеш действующей конфигурации
+	RunID      string       `json:"run_id,omitempty"`
+	Start      time.Time    `json:"start"`
+	Folders    []PlanFolder `json:"folders"`
+}
+
+// PlanFolder — план одной папки.
+type PlanFolder struct {
+	Folder       string        `json:"folder"`
+	Total        int           `json:"total"`
+	Planned      int           `json:"planned"`
+	PlannedFreed int64         `json:"planned_freed_bytes"`
+	Error        string        `json:"error,omitempty"`
+	Files        []PlannedFile `json:"files,omitempty"`
+}
+
+// PlannedFile — файл, с которым запуск что-то сделал бы.
+type PlannedFile struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // удаление, перемещение, сжатие
+}
+
+// validatePlanUpload проверяет адрес выгрузки планов plan_upload.
+func validatePlanUpload(cfg Config) error {
+	switch {
+	case cfg.PlanUpload == "":
+	case cfg.PlanUpload == planUploadCollect:
+		if cfg.Collect.URL == "" {
+			return fmt.Errorf("plan_upload=collect: не задан адрес сервера сбора (--collect-url)")
+		}
+	case strings.HasPrefix(cfg.PlanUpload, "s3://"):
+		if bucket, _, _ := strings.Cut(strings.TrimPrefix(cfg.PlanUpload, "s3://"), "/"); bucket == "" {
+			return fmt.Errorf("plan_upload=%s: не указан bucket", cfg.PlanUpload)
+		}
+	default:
+		return fmt.Errorf("plan_upload=%q: допустимы collect или s3://bucket/prefix", cfg.PlanUpload)
+	}
+	return nil
+}
+
+// configHash возвращает короткий хеш действующей конфигурации: у хостов
+// с одинаковым хешем различия в планах объясняются только их файлами.
+func configHash(cfg Config) string {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	return sha256Hex(data)[:12]
+}
+
+// newPlanRecord строит план по итогам пробного запуска. Файлы берутся из
+// списка оставленных с причиной dry_run, поэтому в режиме экономии памяти
+// план содержит только счётчики.
+func newPlanRecord(cfg Config, summary RunSummary) PlanRecord {
+	host, _ := os.Hostname()
+	plan := PlanRecord{Host: host, Instance: summary.Instance, ConfigHash: configHash(cfg), RunID: summary.RunID, Start: summary.Start}
+	for _, f := range summary.Folders {
+		pf := PlanFolder{Folder: f.Folder, Total: f.Total, Planned: f.Planned, PlannedFreed: f.PlannedFreed}
+		if f.Err != nil {
+			pf.Error = f.Err.Error()
+		}
+		for _, k := range f.Kept {
+			if k.Reason == SkipDryRun {
+				pf.Files = append(pf.Files, PlannedFile{Path: k.Path, Action: k.Detail})
+			}
+		}
+		plan.Folders = append(plan.Folders, pf)
+	}
+	return plan
+}
+
+// planName возвращает относительный путь плана: <хост>/<экземпляр>-<хеш>.json.
+func planName(plan PlanRecord) string {
+	safe := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+				return r
+			}
+			return '_'
+		}, strings.TrimLeft(s, "."))
+	}
+	return safe(plan.Host) + "/" + safe(plan.Instance) + "-" + safe(plan.ConfigHash) + ".json"
+}
+
+// uploadPlan выгружает план пробного запуска на сервер сбора или в S3
+// (s3://bucket/prefix/<хост>/<экземпляр>-<хеш>.json).
+func uploadPlan(cfg Config, plan PlanRecord) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if rest, ok := strings.CutPrefix(cfg.PlanUpload, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		return putS3Data(cfg.S3, bucket, path.Join(prefix, planName(plan)), data)
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(cfg.Collect.URL, "/")+"/api/v1/plans", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Collect.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Collect.Token)
+	}
+	client := &http.Client{Timeout: collectTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("сервер сбора ответил %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// savePlan сохраняет план в каталоге dir под именем planName.
+func savePlan(dir string, plan PlanRecord) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(dir, filepath.FromSlash(planName(plan)))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// readPlans читает планы из файлов и каталогов (с подкаталогами), например
+// из каталога планов сервера сбора или копии префикса S3.
+func readPlans(paths []string) ([]PlanRecord, error) {
+	var plans []PlanRecord
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || file != root && filepath.Ext(file) != ".json" {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			var plan PlanRecord
+			if err := json.Unmarshal(data, &plan); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+			plans = append(plans, plan)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plans, nil
+}
+
+// fetchPlans запрашивает последние планы хостов у сервера сбора.
+func fetchPlans(opts CollectOptions) ([]PlanRecord, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(opts.URL, "/")+"/api/v1/plans", nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	client := &http.Client{Timeout: collectTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("сервер сбора ответил %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var plans []PlanRecord
+	if err := json.NewDecoder(resp.Body).Decode(&plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// latestPlans оставляет самый поздний план каждого хоста и экземпляра,
+// упорядочивая по экземпляру и хосту.
+func latestPlans(plans []PlanRecord) []PlanRecord {
+	latest := make(map[string]PlanRecord)
+	for _, p := range plans {
+		key := p.Instance + "\x00" + p.Host
+		if prev, ok := latest[key]; !ok || p.Start.After(prev.Start) {
+			latest[key] = p
+		}
+	}
+	out := make([]PlanRecord, 0, len(latest))
+	for _, p := range latest {
+		out = append(out, p)
+	}
+	slices.SortFunc(out, func(a, b PlanRecord) int {
+		if c := strings.Compare(a.Instance, b.Instance); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Host, b.Host)
+	})
+	return out
+}
+
+// diffPlans сравнивает планы хостов каждого экземпляра: сообщает о хостах
+// с другой конфигурацией, а по каждой папке — о хостах, где доля файлов
+// к удалению отличается от медианы по парку больше чем на threshold
+// процентных пунктов, где папка не найдена или обработана с ошибкой.
+// Возвращает количество замечаний.
+func diffPlans(w io.Writer, plans []PlanRecord, threshold float64) int {
+	issues := 0
+	plans = latestPlans(plans)
+	for len(plans) > 0 {
+		n := 1
+		for n < len(plans) && plans[n].Instance == plans[0].Instance {
+			n++
+		}
+		group := plans[:n]
+		plans = plans[n:]
+
+		hashes := make(map[string][]string)
+		for _, p := range group {
+			hashes[p.ConfigHash] = append(hashes[p.ConfigHash], p.Host)
+		}
+		fmt.Fprintf(w, "Экземпляр %s: хостов %d, конфигураций %d\n", group[0].Instance, len(group), len(hashes))
+		if len(hashes) > 1 {
+			common := slices.MaxFunc(slices.Sorted(maps.Keys(hashes)), func(a, b string) int { return len(hashes[a]) - len(hashes[b]) })
+			for _, hash := range slices.Sorted(maps.Keys(hashes)) {
+				if hash != common {
+					fmt.Fprintf(w, "  Конфигурация %s отличается от %s у большинства: %s\n", hash, common, strings.Join(hashes[hash], ", "))
+					issues++
+				}
+			}
+		}
+
+		var folders []string
+		for _, p := range group {
+			for _, f := range p.Folders {
+				folders = append(folders, f.Folder)
+			}
+		}
+		slices.Sort(folders)
+		for _, folder := range slices.Compact(folders) {
+			var shares []float64
+			found := make(map[string]PlanFolder)
+			for _, p := range group {
+				for _, f := range p.Folders {
+					if f.Folder == folder {
+						found[p.Host] = f
+						if f.Error == "" {
+							shares = append(shares, planShare(f))
+						}
+					}
+				}
+			}
+			slices.Sort(shares)
+			var median float64
+			if len(shares) > 0 {
+				median = shares[len(shares)/2]
+				if len(shares)%2 == 0 {
+					median = (shares[len(shares)/2-1] + median) / 2
+				}
+			}
+			var lines []string
+			for _, p := range group {
+				f, ok := found[p.Host]
+				switch {
+				case !ok:
+					issues++
+					lines = append(lines, fmt.Sprintf("    %s: папки нет в плане", p.Host))
+				case f.Error != "":
+					issues++
+					lines = append(lines, fmt.Sprintf("    %s: ошибка: %s", p.Host, f.Error))
+				case len(shares) > 1 && math.Abs(planShare(f)-median) > threshold:
+					issues++
+					lines = append(lines, fmt.Sprintf("    %s: к удалению %.0f%% (%d из %d, %s) — медиана %.0f%%",
+						p.Host, planShare(f), f.Planned, f.Total, formatBytes(f.PlannedFreed), median))
+					for _, file := range f.Files[:min(len(f.Files), planExamples)] {
+						lines = append(lines, fmt.Sprintf("      %s: %s", file.Path, file.Action))
+					}
+				}
+			}
+			if len(lines) > 0 {
+				fmt.Fprintf(w, "  %s: медиана к удалению %.0f%% файлов\n", folder, median)
+				for _, line := range lines {
+					fmt.Fprintln(w, line)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// planShare возвращает долю файлов папки к удалению, %.
+func planShare(f PlanFolder) float64 {
+	if f.Total == 0 {
+		return 0
+	}
+	return 100 * float64(f.Planned) / float64(f.Total)
+}
+
+// runPlans реализует подкоманду plans.
+func runPlans(args []string) int {
+	if len(args) == 0 || args[0] != "diff" {
+		fmt.Fprintln(os.Stderr, "Usage: cleanup plans diff [--threshold 20] [--from plans-dir,... | --collect-url URL] [flags]")
+		return 1
+	}
+	return runPlansDiff(args[1:])
+}
+
+// runPlansDiff сравнивает планы пробных запусков хостов, полученные от
+// сервера сбора или из файлов и каталогов с планами.
+func runPlansDiff(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("plans diff", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup plans diff [--threshold 20] [--from plans-dir,... | --collect-url URL] [flags]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	var plans []PlanRecord
+	if opts.plansFrom != "" {
+		plans, err = readPlans(strings.Split(opts.plansFrom, ","))
+	} else if cfg.Collect.URL != "" {
+		plans, err = fetchPlans(cfg.Collect)
+	} else {
+		log.Print("Укажите каталоги с планами (--from) или адрес сервера сбора (--collect-url)")
+		return 1
+	}
+	if err != nil {
+		log.Printf("Ошибка чтения планов: %v\n", err)
+		return 1
+	}
+	if len(plans) == 0 {
+		log.Print("Планов пробных запусков не найдено")
+		return 1
+	}
+	if issues := diffPlans(os.Stdout, plans, opts.threshold); issues > 0 {
+		fmt.Printf("Замечаний: %d\n", issues)
+		return 1
+	}
+	fmt.Println("Планы хостов не расходятся")
+	return 0
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Policy — составное условие удаления файла, которое заменяет у папки
+// обычный срок хранения, например «старше 30 дней и больше 1 ГБ или старше
+// 180 дней независимо от размера»:
+//
+//	policy:
+//	  any:
+//	    - all: [{older_than: 30}, {larger_than: 1GB}]
+//	    - older_than: 180
+//
+// Условия одного узла должны выполняться все, как в all.
+type Policy struct {
+	All []Policy `yaml:"all"` // все вложенные условия
+	Any []Policy `yaml:"any"` // хотя бы одно вложенное условие
+	Not *Policy  `yaml:"not"` // условие не выполняется
+
+	// OlderThan — файл старше стольких дней; как и срок хранения, возраст
+	// отсчитывается от самого свежего файла папки.
+	OlderThan   *int      `yaml:"older_than"`
+	LargerThan  *ByteSize `yaml:"larger_than"`
+	SmallerThan *ByteSize `yaml:"smaller_than"`
+	Name        string    `yaml:"name"` // шаблон имени файла, например *.bak
+	// BeyondNewest — файл не входит в столько самых свежих файлов папки.
+	BeyondNewest *int `yaml:"beyond_newest"`
+}
+
+// policyFile — сведения о файле, по которым проверяется условие.
+type policyFile struct {
+	name   string
+	newest time.Time // позднее из времени изменения и создания
+	size   int64
+	rank   int // место среди самых свежих файлов, считая с 0
+}
+
+// match сообщает, выполняется ли условие для файла f при самом свежем
+// файле папки newest.
+func (p *Policy) match(f policyFile, newest time.Time) bool {
+	if p.OlderThan != nil && !f.newest.Before(newest.AddDate(0, 0, -*p.OlderThan)) {
+		return false
+	}
+	if p.LargerThan != nil && f.size <= int64(*p.LargerThan) {
+		return false
+	}
+	if p.SmallerThan != nil && f.size >= int64(*p.SmallerThan) {
+		return false
+	}
+	if p.Name != "" && !matchAny([]string{p.Name}, f.name) {
+		return false
+	}
+	if p.BeyondNewest != nil && f.rank < *p.BeyondNewest {
+		return false
+	}
+	for i := range p.All {
+		if !p.All[i].match(f, newest) {
+			return false
+		}
+	}
+	if len(p.Any) > 0 {
+		matched := false
+		for i := range p.Any {
+			if p.Any[i].match(f, newest) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return p.Not == nil || !p.Not.match(f, newest)
+}
+
+// maxBeyondNewest возвращает наибольшее значение beyond_newest в условии:
+// столько самых свежих файлов нужно запомнить при чтении папки.
+func (p *Policy) maxBeyondNewest() int {
+	if p == nil {
+		return 0
+	}
+	n := 0
+	if p.BeyondNewest != nil {
+		n = *p.BeyondNewest
+	}
+	for _, children := range [][]Policy{p.All, p.Any} {
+		for i := range children {
+			n = max(n, children[i].maxBeyondNewest())
+		}
+	}
+	return max(n, p.Not.maxBeyondNewest())
+}
+
+// validate проверяет условие и приводит шаблоны имён к нижнему регистру.
+func (p *Policy) validate() error {
+	empty := p.OlderThan == nil && p.LargerThan == nil && p.SmallerThan == nil &&
+		p.Name == "" && p.BeyondNewest == nil && p.All == nil && p.Any == nil && p.Not == nil
+	if empty {
+		return fmt.Errorf("policy: пустое условие")
+	}
+	if p.OlderThan != nil && *p.OlderThan < 0 {
+		return fmt.Errorf("policy: older_than должно быть целым неотрицательным числом")
+	}
+	if p.BeyondNewest != nil && *p.BeyondNewest < 0 {
+		return fmt.Errorf("policy: beyond_newest должно быть целым неотрицательным числом")
+	}
+	if p.All != nil && len(p.All) == 0 || p.Any != nil && len(p.Any) == 0 {
+		return fmt.Errorf("policy: пустой список all или any")
+	}
+	if p.Name != "" {
+		if err := validatePatterns("policy: name", []string{p.Name}); err != nil {
+			return err
+		}
+		p.Name = foldName(strings.TrimSpace(p.Name))
+	}
+	for _, children := range [][]Policy{p.All, p.Any} {
+		for i := range children {
+			if err := children[i].validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if p.Not != nil {
+		return p.Not.validate()
+	}
+	return nil
+}
+
+// String описывает условие для журнала, например
+// any(all(older_than=30, larger_than=1.0 GiB), older_than=180).
+func (p *Policy) String() string {
+	var parts []string
+	if p.OlderThan != nil {
+		parts = append(parts, fmt.Sprintf("older_than=%d", *p.OlderThan))
+	}
+	if p.LargerThan != nil {
+		parts = append(parts, "larger_than="+formatBytes(int64(*p.LargerThan)))
+	}
+	if p.SmallerThan != nil {
+		parts = append(parts, "smaller_than="+formatBytes(int64(*p.SmallerThan)))
+	}
+	if p.Name != "" {
+		parts = append(parts, "name="+p.Name)
+	}
+	if p.BeyondNewest != nil {
+		parts = append(parts, fmt.Sprintf("beyond_newest=%d", *p.BeyondNewest))
+	}
+	for _, group := range []struct {
+		name     string
+		children []Policy
+	}{{"all", p.All}, {"any", p.Any}} {
+		if len(group.children) == 0 {
+			continue
+		}
+		var children []string
+		for i := range group.children {
+			children = append(children, group.children[i].String())
+		}
+		parts = append(parts, group.name+"("+strings.Join(children, ", ")+")")
+	}
+	if p.Not != nil {
+		parts = append(parts, "not("+p.Not.String()+")")
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "all(" + strings.Join(parts, ", ") + ")"
+}
+
+// expired сообщает, истёк ли срок файла f при самом свежем файле папки
+// newest: по условию policy, если оно задано, иначе по сроку хранения.
+// При схеме gfs истекают все файлы: сохраняемые ею файлы исключает
+// вызывающий, как и файлы keep.
+func (r folderRule) expired(f policyFile, newest time.Time) bool {
+	if r.GFS != nil {
+		return true
+	}
+	if r.Policy != nil {
+		return r.Policy.match(f, newest)
+	}
+	return f.newest.Before(newest.AddDate(0, 0, -r.daysFor(f.name)))
+}
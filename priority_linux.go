@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Параметры ioprio_set(2).
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+)
+
+// setThreadPriority задаёт текущему потоку класс ввода-вывода и nice.
+// В Linux оба параметра действуют на отдельный поток, поэтому вызывающая
+// горутина должна быть закреплена за ним.
+func setThreadPriority(ioPriority string, nice int) error {
+	tid := syscall.Gettid()
+	if ioPriority != "" {
+		var value uintptr
+		switch ioPriority {
+		case ioPriorityIdle:
+			value = ioprioClassIdle << ioprioClassShift
+		case ioPriorityLow:
+			value = ioprioClassBE<<ioprioClassShift | 7
+		case ioPriorityNormal:
+			value = ioprioClassBE<<ioprioClassShift | 4
+		default:
+			return fmt.Errorf("неизвестный приоритет ввода-вывода %q", ioPriority)
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), value); errno != 0 {
+			return fmt.Errorf("ioprio_set: %v", errno)
+		}
+	}
+	if nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+			return fmt.Errorf("setpriority: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// setThreadPriority вне Linux не поддерживается: приоритет потока
+// не меняется, параллельность и ограничение скорости действуют.
+func setThreadPriority(ioPriority string, nice int) error {
+	return fmt.Errorf("io_priority и nice поддерживаются только в Linux")
+}
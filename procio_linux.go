@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// procIO уточняет ввод-вывод процесса по /proc/self/io: байты, прочитанные
+// и записанные на диск, и число системных вызовов чтения и записи.
+func procIO(u *resourceUsage) {
+	f, err := os.Open("/proc/self/io")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	var syscalls int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ": ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "read_bytes":
+			u.ReadBytes = n
+		case "write_bytes":
+			u.WriteBytes = n
+		case "syscr", "syscw":
+			syscalls += n
+			u.Syscalls = syscalls
+		}
+	}
+}
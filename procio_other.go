@@ -0,0 +1,6 @@
+//go:build unix && !linux
+
+package main
+
+// procIO ничего не уточняет: /proc/self/io есть только в Linux.
+func procIO(*resourceUsage) {}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Этапы обработки папки для сведений о ходе запуска.
+const (
+	phaseScan    = "scan"    // чтение каталога и выбор самого свежего файла
+	phaseProcess = "process" // проверка и удаление файлов
+	phaseQuota   = "quota"   // квоты подкаталогов
+)
+
+// phaseText — описание этапов для вывода.
+var phaseText = map[string]string{
+	phaseScan:    "чтение каталога",
+	phaseProcess: "обработка файлов",
+	phaseQuota:   "квоты подкаталогов",
+}
+
+// runProgress — ход текущего запуска. Выводится по SIGQUIT и отдаётся API
+// (GET /api/v1/status), чтобы долгий запуск, похожий на зависший, можно было
+// проверить, не прерывая его.
+type runProgress struct {
+	mu           sync.Mutex
+	start        time.Time // начало запуска; нулевое — запуск не выполняется
+	foldersTotal int
+	foldersDone  int
+	folder       string
+	phase        string
+	phaseStart   time.Time
+
+	// Счётчики текущей папки; обновляются потоками обработки.
+	scanned   atomic.Int64
+	processed atomic.Int64
+	deleted   atomic.Int64
+	freed     atomic.Int64
+}
+
+// progress — ход запуска, выполняемого процессом.
+var progress = &runProgress{}
+
+// progressStatus — снимок хода запуска.
+type progressStatus struct {
+	Running      bool      `json:"running"`
+	Start        time.Time `json:"start,omitempty"`
+	ElapsedSec   float64   `json:"elapsed_seconds,omitempty"`
+	FoldersTotal int       `json:"folders_total,omitempty"`
+	FoldersDone  int       `json:"folders_done,omitempty"`
+	Folder       string    `json:"folder,omitempty"`
+	Phase        string    `json:"phase,omitempty"`
+	PhaseSec     float64   `json:"phase_seconds,omitempty"`
+	Scanned      int64     `json:"scanned"`
+	Processed    int64     `json:"processed"`
+	Deleted      int64     `json:"deleted"`
+	Freed        int64     `json:"freed_bytes"`
+	Rate         float64   `json:"rate_per_second,omitempty"` // файлов в секунду на этапе обработки
+	ETASec       float64   `json:"eta_seconds,omitempty"`     // до конца обработки папки
+	Goroutines   int       `json:"goroutines"`
+	Stacks       string    `json:"stacks,omitempty"`
+}
+
+func (p *runProgress) beginRun(folders int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start, p.foldersTotal, p.foldersDone, p.folder, p.phase = time.Now(), folders, 0, "", ""
+}
+
+func (p *runProgress) endRun() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = time.Time{}
+}
+
+// beginFolder отмечает начало обработки папки и сбрасывает счётчики.
+func (p *runProgress) beginFolder(folder string) {
+	p.mu.Lock()
+	p.folder = folder
+	p.mu.Unlock()
+	p.scanned.Store(0)
+	p.processed.Store(0)
+	p.deleted.Store(0)
+	p.freed.Store(0)
+	p.setPhase(phaseScan)
+}
+
+func (p *runProgress) folderDone() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.foldersDone++
+}
+
+func (p *runProgress) setPhase(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phase, p.phaseStart = phase, time.Now()
+}
+
+// track оборачивает обработку файла: учитывает обработанный файл и
+// удалённые при этом файлы и байты.
+func (p *runProgress) track(process func(*FolderResult, os.DirEntry)) func(*FolderResult, os.DirEntry) {
+	return func(res *FolderResult, entry os.DirEntry) {
+		deleted, freed := res.Deleted, res.Freed
+		process(res, entry)
+		p.processed.Add(1)
+		p.deleted.Add(int64(res.Deleted - deleted))
+		p.freed.Add(res.Freed - freed)
+	}
+}
+
+// snapshot возвращает ход запуска; stacks добавляет стеки всех горутин.
+func (p *runProgress) snapshot(stacks bool) progressStatus {
+	p.mu.Lock()
+	now := time.Now()
+	st := progressStatus{Running: !p.start.IsZero(), Goroutines: runtime.NumGoroutine()}
+	if st.Running {
+		st.Start, st.ElapsedSec = p.start, now.Sub(p.start).Seconds()
+		st.FoldersTotal, st.FoldersDone = p.foldersTotal, p.foldersDone
+		st.Folder, st.Phase, st.PhaseSec = p.folder, p.phase, now.Sub(p.phaseStart).Seconds()
+	}
+	p.mu.Unlock()
+	st.Scanned, st.Processed = p.scanned.Load(), p.processed.Load()
+	st.Deleted, st.Freed = p.deleted.Load(), p.freed.Load()
+	if st.Phase == phaseProcess && st.PhaseSec > 0 {
+		st.Rate = float64(st.Processed) / st.PhaseSec
+		if st.Rate > 0 && st.Scanned > st.Processed {
+			st.ETASec = float64(st.Scanned-st.Processed) / st.Rate
+		}
+	}
+	if stacks {
+		var b bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&b, 2)
+		st.Stacks = b.String()
+	}
+	return st
+}
+
+// writeProgress выводит ход запуска в текстовом виде.
+func writeProgress(w io.Writer, st progressStatus) {
+	seconds := func(s float64) time.Duration { return (time.Duration(s) * time.Second).Round(time.Second) }
+	if !st.Running {
+		fmt.Fprintln(w, "Запуск не выполняется")
+	} else {
+		fmt.Fprintf(w, "Запуск идёт %s (с %s), папок обработано %d из %d\n",
+			seconds(st.ElapsedSec), st.Start.Local().Format(time.RFC3339), st.FoldersDone, st.FoldersTotal)
+		fmt.Fprintf(w, "Папка %s: %s, %s\n", st.Folder, phaseText[st.Phase], seconds(st.PhaseSec))
+		fmt.Fprintf(w, "Файлов просмотрено %d, обработано %d, удалено %d (%s)\n", st.Scanned, st.Processed, st.Deleted, formatBytes(st.Freed))
+		if st.Rate > 0 {
+			fmt.Fprintf(w, "Скорость %.1f файлов/с, до конца папки около %s\n", st.Rate, seconds(st.ETASec))
+		}
+	}
+	fmt.Fprintf(w, "Горутин: %d\n", st.Goroutines)
+	if st.Stacks != "" {
+		fmt.Fprintf(w, "\n%s", st.Stacks)
+	}
+}
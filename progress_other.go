@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+// watchProgressSignal ничего не делает: SIGQUIT в Windows нет, ход запуска
+// доступен через cleanup status.
+func watchProgressSignal() {}
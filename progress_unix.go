@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var progressSignal sync.Once
+
+// watchProgressSignal по SIGQUIT выводит в stderr ход запуска и стеки
+// горутин; процесс при этом продолжает работу, а не завершается, как по
+// умолчанию в Go.
+func watchProgressSignal() {
+	progressSignal.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGQUIT)
+		go func() {
+			for range ch {
+				writeProgress(os.Stderr, progress.snapshot(true))
+			}
+		}()
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// protectedPaths — общий список protect: пути и шаблоны, которые cleanup не
+// удаляет и не перемещает ни при каких правилах папок. Проверяется последним,
+// непосредственно перед удалением.
+type protectedPaths struct {
+	paths    []protectPath
+	patterns []protectPattern
+}
+
+type protectPath struct {
+	key  string // абсолютный путь в нижнем регистре, через /
+	text string
+}
+
+type protectPattern struct {
+	text string
+	re   *regexp.Regexp
+}
+
+// protection — список protect текущего запуска.
+var protection protectedPaths
+
+// protectedError — отказ удалить путь из-за правила protect.
+type protectedError struct {
+	path string
+	rule string
+}
+
+func (e *protectedError) Error() string {
+	return fmt.Sprintf("%s защищён правилом protect %s", e.path, e.rule)
+}
+
+// loadProtection разбирает список protect: абсолютные пути (вместе со всем,
+// что внутри) и шаблоны с *, ?, [...] и ** в синтаксисе .gitignore —
+// абсолютные или начинающиеся с **/. Для пути, который сейчас является
+// символической ссылкой (например, /srv/app/current), защищается и каталог
+// или файл, на который она ведёт.
+func loadProtection(list []string) (protectedPaths, error) {
+	var p protectedPaths
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !filepath.IsAbs(entry) && !strings.HasPrefix(filepath.ToSlash(entry), "**/") {
+			return p, fmt.Errorf("protect: %q — нужен абсолютный путь или шаблон, начинающийся с **/", entry)
+		}
+		if !strings.ContainsAny(entry, "*?[") {
+			p.paths = append(p.paths, protectPath{key: protectKey(entry), text: entry})
+			if real, err := filepath.EvalSymlinks(entry); err == nil && protectKey(real) != protectKey(entry) {
+				p.paths = append(p.paths, protectPath{key: protectKey(real), text: real + " (цель " + entry + ")"})
+			}
+			continue
+		}
+		key := strings.ToLower(filepath.ToSlash(entry))
+		re, err := regexp.Compile("^" + ignoreRegexp(key) + "(?:/.*)?$")
+		if err != nil {
+			return p, fmt.Errorf("protect: неверный шаблон %q", entry)
+		}
+		p.patterns = append(p.patterns, protectPattern{text: entry, re: re})
+	}
+	return p, nil
+}
+
+// protectKey приводит путь к виду для сравнения с правилами protect.
+func protectKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.ToLower(filepath.ToSlash(filepath.Clean(path)))
+}
+
+// rule возвращает правило protect, под которое попадает путь path, по его
+// написанию или реальному пути каталога, или пустую строку.
+func (p protectedPaths) rule(path string) string {
+	if len(p.paths) == 0 && len(p.patterns) == 0 {
+		return ""
+	}
+	keys := []string{protectKey(path)}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		keys = append(keys, protectKey(filepath.Join(dir, filepath.Base(path))))
+	}
+	for _, key := range keys {
+		for _, protected := range p.paths {
+			if key == protected.key || strings.HasPrefix(key, strings.TrimSuffix(protected.key, "/")+"/") {
+				return protected.text
+			}
+		}
+		for _, pattern := range p.patterns {
+			if pattern.re.MatchString(key) {
+				return pattern.text
+			}
+		}
+	}
+	return ""
+}
+
+// check возвращает *protectedError, если путь path защищён.
+func (p protectedPaths) check(path string) error {
+	if rule := p.rule(path); rule != "" {
+		return &protectedError{path: path, rule: rule}
+	}
+	return nil
+}
+
+// checkTree проверяет каталог dir перед удалением целиком: каталог не
+// удаляется, если защищён он сам, путь внутри него или любой его файл.
+func (p protectedPaths) checkTree(dir string) error {
+	if len(p.paths) == 0 && len(p.patterns) == 0 {
+		return nil
+	}
+	if err := p.check(dir); err != nil {
+		return err
+	}
+	keys := []string{protectKey(dir)}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		keys = append(keys, protectKey(real))
+	}
+	for _, key := range keys {
+		for _, protected := range p.paths {
+			if strings.HasPrefix(protected.key, strings.TrimSuffix(key, "/")+"/") {
+				return &protectedError{path: dir, rule: protected.text}
+			}
+		}
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return p.check(path)
+	})
+}
+
+// removeFile удаляет файл, если он не защищён списком protect; занятый
+// другим процессом файл удаляется повторно (locked_files).
+func removeFile(path string) error {
+	if err := protection.check(path); err != nil {
+		return err
+	}
+	return removeLocked(path)
+}
+
+// removeTree удаляет каталог целиком, если ни он, ни его содержимое не
+// защищены списком protect.
+func removeTree(dir string) error {
+	if err := protection.checkTree(dir); err != nil {
+		return err
+	}
+	return retryLocked(dir, func() error {
+		return withRetry(func() error { return os.RemoveAll(dir) })
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// pushTimeout ограничивает время ожидания ответа Pushgateway,
+// чтобы недоступный сервер не подвешивал запуск из cron.
+const pushTimeout = 10 * time.Second
+
+// PushGatewayOptions описывает параметры отправки метрик в Pushgateway.
+type PushGatewayOptions struct {
+	URL      string `yaml:"url"`
+	Job      string `yaml:"job"`
+	Instance string `yaml:"instance"` // по умолчанию имя хоста
+}
+
+// formatMetrics формирует метрики запуска в текстовом формате Prometheus.
+// Итоги запуска и значения по папкам — разные метрики (cleanup_files_found
+// и cleanup_folder_files_found), чтобы sum() по метрике не удваивал итог.
+func formatMetrics(summary RunSummary) string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "# HELP cleanup_files_found Количество обнаруженных файлов.")
+	fmt.Fprintln(&b, "# TYPE cleanup_files_found gauge")
+	fmt.Fprintf(&b, "cleanup_files_found %d\n", summary.Total)
+	fmt.Fprintln(&b, "# HELP cleanup_folder_files_found Количество обнаруженных файлов в папке.")
+	fmt.Fprintln(&b, "# TYPE cleanup_folder_files_found gauge")
+	for _, f := range summary.Folders {
+		fmt.Fprintf(&b, "cleanup_folder_files_found{folder=%q} %d\n", f.Folder, f.Total)
+	}
+	fmt.Fprintln(&b, "# HELP cleanup_files_deleted Количество удалённых файлов.")
+	fmt.Fprintln(&b, "# TYPE cleanup_files_deleted gauge")
+	fmt.Fprintf(&b, "cleanup_files_deleted %d\n", summary.Deleted)
+	fmt.Fprintln(&b, "# HELP cleanup_folder_files_deleted Количество удалённых файлов в папке.")
+	fmt.Fprintln(&b, "# TYPE cleanup_folder_files_deleted gauge")
+	for _, f := range summary.Folders {
+		fmt.Fprintf(&b, "cleanup_folder_files_deleted{folder=%q} %d\n", f.Folder, f.Deleted)
+	}
+	fmt.Fprintln(&b, "# HELP cleanup_bytes_freed Объём освобождённого места в байтах.")
+	fmt.Fprintln(&b, "# TYPE cleanup_bytes_freed gauge")
+	fmt.Fprintf(&b, "cleanup_bytes_freed %d\n", summary.Freed)
+	fmt.Fprintln(&b, "# HELP cleanup_folder_bytes_freed Объём освобождённого места в папке в байтах.")
+	fmt.Fprintln(&b, "# TYPE cleanup_folder_bytes_freed gauge")
+	for _, f := range summary.Folders {
+		fmt.Fprintf(&b, "cleanup_folder_bytes_freed{folder=%q} %d\n", f.Folder, f.Freed)
+	}
+	failed := summary.FailedFolders()
+	fmt.Fprintln(&b, "# HELP cleanup_folders_failed Количество папок, обработка которых завершилась ошибкой.")
+	fmt.Fprintln(&b, "# TYPE cleanup_folders_failed gauge")
+	fmt.Fprintf(&b, "cleanup_folders_failed %d\n", failed)
+	fmt.Fprintln(&b, "# HELP cleanup_folders_missing Количество папок, пропущенных из-за отсутствия.")
+	fmt.Fprintln(&b, "# TYPE cleanup_folders_missing gauge")
+	fmt.Fprintf(&b, "cleanup_folders_missing %d\n", len(summary.Missing))
+	fmt.Fprintln(&b, "# HELP cleanup_permission_denied Количество файлов, не обработанных из-за отказа в доступе.")
+	fmt.Fprintln(&b, "# TYPE cleanup_permission_denied gauge")
+	fmt.Fprintf(&b, "cleanup_permission_denied %d\n", summary.PermissionDenied())
+	fmt.Fprintln(&b, "# HELP cleanup_folder_permission_denied Количество файлов папки, не обработанных из-за отказа в доступе.")
+	fmt.Fprintln(&b, "# TYPE cleanup_folder_permission_denied gauge")
+	for _, f := range summary.Folders {
+		fmt.Fprintf(&b, "cleanup_folder_permission_denied{folder=%q} %d\n", f.Folder, f.PermissionDenied)
+	}
+	fmt.Fprintln(&b, "# HELP cleanup_run_duration_seconds Длительность запуска.")
+	fmt.Fprintln(&b, "# TYPE cleanup_run_duration_seconds gauge")
+	fmt.Fprintf(&b, "cleanup_run_duration_seconds %g\n", summary.Duration.Seconds())
+	if rec := resourceRecord(summary); rec != nil {
+		fmt.Fprintln(&b, "# HELP cleanup_cpu_seconds Время CPU, затраченное запуском.")
+		fmt.Fprintln(&b, "# TYPE cleanup_cpu_seconds gauge")
+		fmt.Fprintf(&b, "cleanup_cpu_seconds{mode=\"user\"} %g\n", rec.UserCPUSeconds)
+		fmt.Fprintf(&b, "cleanup_cpu_seconds{mode=\"system\"} %g\n", rec.SystemCPUSeconds)
+		fmt.Fprintln(&b, "# HELP cleanup_max_rss_bytes Пиковый объём памяти процесса в байтах.")
+		fmt.Fprintln(&b, "# TYPE cleanup_max_rss_bytes gauge")
+		fmt.Fprintf(&b, "cleanup_max_rss_bytes %d\n", rec.MaxRSS)
+		fmt.Fprintln(&b, "# HELP cleanup_io_bytes Объём ввода-вывода запуска в байтах.")
+		fmt.Fprintln(&b, "# TYPE cleanup_io_bytes gauge")
+		fmt.Fprintf(&b, "cleanup_io_bytes{direction=\"read\"} %d\n", rec.ReadBytes)
+		fmt.Fprintf(&b, "cleanup_io_bytes{direction=\"write\"} %d\n", rec.WriteBytes)
+		fmt.Fprintln(&b, "# HELP cleanup_syscalls Количество системных вызовов чтения и записи за запуск.")
+		fmt.Fprintln(&b, "# TYPE cleanup_syscalls gauge")
+		fmt.Fprintf(&b, "cleanup_syscalls %d\n", rec.Syscalls)
+		fmt.Fprintln(&b, "# HELP cleanup_files_per_second Скорость просмотра файлов.")
+		fmt.Fprintln(&b, "# TYPE cleanup_files_per_second gauge")
+		fmt.Fprintf(&b, "cleanup_files_per_second %g\n", rec.FilesPerSecond)
+	}
+	fmt.Fprintln(&b, "# HELP cleanup_last_run_timestamp_seconds Время последнего запуска (unix).")
+	fmt.Fprintln(&b, "# TYPE cleanup_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(&b, "cleanup_last_run_timestamp_seconds %d\n", summary.Start.Unix())
+	return b.String()
+}
+
+// pushMetrics отправляет метрики запуска в Prometheus Pushgateway.
+// Метрики группируются по меткам job и instance; пустой instance
+// заменяется именем хоста.
+func pushMetrics(opts PushGatewayOptions, summary RunSummary) error {
+	job, instance := opts.Job, opts.Instance
+	if instance == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("не удалось определить имя хоста: %w", err)
+		}
+		instance = host
+	}
+	endpoint := strings.TrimRight(opts.URL, "/") + "/metrics/job/" + url.PathEscape(job) + "/instance/" + url.PathEscape(instance)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewBufferString(formatMetrics(summary)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Pushgateway ответил %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quotaFile — файл подкаталога, учитываемый в квоте.
+type quotaFile struct {
+	path   string
+	newest time.Time // время файла по time_fields
+	size   int64
+}
+
+// quotaDir — подкаталог с квотой и его файлы от самых старых к самым свежим.
+type quotaDir struct {
+	dir   string
+	files []quotaFile
+	used  int64
+	keep  map[string]bool // самые свежие файлы подкаталога (keep)
+}
+
+// quotaPlan — подкаталоги папки с квотами, подсчитанные до очистки папки,
+// чтобы удаления по квотам учитывались в max_delete и max_delete_percent.
+type quotaPlan struct {
+	dirs  []quotaDir
+	files int // файлов, учитываемых в квотах
+	over  int // файлов, которые придётся удалить, чтобы уложиться в квоты
+}
+
+// planSubdirQuotas обходит подкаталоги папки (например, каталог каждого
+// пользователя в /scratch) для квот: в квоте учитываются только файлы,
+// прошедшие тот же отбор, что и файлы самой папки (include, exclude, filters,
+// размер, владелец), и не исключённые .cleanupignore подкаталога.
+func planSubdirQuotas(res *FolderResult, folder string, rule folderRule, opts processOptions) quotaPlan {
+	var plan quotaPlan
+	entries, err := readDir(folder)
+	if err != nil {
+		events.emitCode(EventError, CodeFolderRead, folder, "", "Ошибка чтения папки %s для квот подкаталогов: %v", folder, err)
+		return plan
+	}
+	realFolder, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		events.emitCode(EventError, CodeFolderRead, folder, "", "Ошибка проверки пути папки %s для квот подкаталогов: %v", folder, err)
+		return plan
+	}
+	for _, entry := range entries {
+		dir := filepath.Join(folder, entry.Name())
+		if _, ok := linkedDir(dir, entry); ok {
+			if why := linkSkipReason(rule.FollowReparsePoints, realFolder, dir); why != "" {
+				skippedLink(folder, dir, why)
+				continue
+			}
+		} else if !entry.IsDir() {
+			continue
+		}
+		if slices.Contains(opts.Nested, entry.Name()) {
+			events.emit(EventDecision, folder, dir, "Подкаталог %s очищается как отдельная папка, квота папки %s к нему не применяется", dir, folder)
+			continue
+		}
+		q, ok := scanQuota(res, folder, dir, rule, opts)
+		if !ok {
+			continue
+		}
+		plan.files += len(q.files)
+		plan.over += q.overCount(rule)
+		plan.dirs = append(plan.dirs, q)
+	}
+	return plan
+}
+
+// scanQuota собирает файлы одного подкаталога; false — подкаталог к квоте
+// не приводится из-за ошибки.
+func scanQuota(res *FolderResult, folder, dir string, rule folderRule, opts processOptions) (quotaDir, bool) {
+	q := quotaDir{dir: dir}
+	// Владельцы каталогов в /scratch защищают свои файлы сами, не меняя
+	// общую конфигурацию.
+	ignore, err := loadIgnore(dir)
+	if err != nil {
+		res.fileError(dir, CodeIgnoreRead, "Ошибка чтения "+filepath.Join(dir, ignoreFileName)+", квота подкаталога не применяется", err)
+		return q, false
+	}
+	keepNewest := newestFiles{n: rule.Keep}
+	err = walkTree(dir, rule.FollowReparsePoints, func(path, why string) { skippedLink(folder, path, why) }, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			res.fileError(path, CodeFolderRead, "Ошибка чтения "+path, err)
+			return nil
+		}
+		if d.IsDir() && path != dir {
+			if rel, err := filepath.Rel(folder, path); err == nil && slices.Contains(opts.Nested, rel) {
+				events.emit(EventDecision, folder, path, "Каталог %s очищается как отдельная папка, квота подкаталога %s к нему не применяется", path, dir)
+				return fs.SkipDir
+			}
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return nil
+		}
+		if reason, _ := rule.candidateSkip(rel, entryInfo(d)); reason != "" {
+			return nil
+		}
+		if sub, err := filepath.Rel(dir, path); err == nil && (strings.EqualFold(sub, ignoreFileName) || ignore.match(sub, false) != "") {
+			return nil
+		}
+		res.Total++
+		t, err := statTimes(path)
+		if err != nil {
+			res.fileError(path, CodeStatFailed, "Ошибка получения времени для "+path, err)
+			return nil
+		}
+		f := quotaFile{path: path, newest: rule.fileTime(stampsOf(t), d.Name())}
+		if info, err := d.Info(); err == nil {
+			f.size = info.Size()
+		}
+		q.used += f.size
+		q.files = append(q.files, f)
+		keepNewest.add(path, f.newest)
+		return nil
+	})
+	if err != nil {
+		events.emitCode(EventError, CodeFolderRead, folder, dir, "Ошибка обхода подкаталога %s: %v", dir, err)
+		return q, false
+	}
+	slices.SortStableFunc(q.files, func(a, b quotaFile) int { return a.newest.Compare(b.newest) })
+	q.keep = keepNewest.names()
+	return q, true
+}
+
+// quotaOver сообщает, превышает ли подкаталог с count файлами объёмом used квоту.
+func quotaOver(rule folderRule, count int, used int64) bool {
+	return (rule.SubdirQuotaSize > 0 && used > rule.SubdirQuotaSize) ||
+		(rule.SubdirQuotaFiles > 0 && count > rule.SubdirQuotaFiles)
+}
+
+// overCount возвращает, сколько самых старых файлов подкаталога нужно
+// удалить, чтобы он уложился в квоту; файлы keep не удаляются.
+func (q quotaDir) overCount(rule folderRule) int {
+	n, count, used := 0, len(q.files), q.used
+	for _, f := range q.files {
+		if !quotaOver(rule, count, used) {
+			break
+		}
+		if q.keep[f.path] {
+			continue
+		}
+		n++
+		count--
+		used -= f.size
+	}
+	return n
+}
+
+// apply приводит подкаталоги к квотам, убирая файлы начиная с самых старых,
+// независимо от других подкаталогов и от срока хранения. Файлы убираются
+// шагом удаления папки disp (удаление, карантин, архив, move_to или мягкое
+// удаление), а удаления расходуют запас max_delete папки budget.
+func (p quotaPlan) apply(res *FolderResult, folder string, rule folderRule, opts processOptions, budget *deleteBudget, disp disposal) {
+	for _, q := range p.dirs {
+		q.apply(res, folder, rule, opts, budget, disp)
+	}
+}
+
+// apply приводит один подкаталог к квоте.
+func (q quotaDir) apply(res *FolderResult, folder string, rule folderRule, opts processOptions, budget *deleteBudget, disp disposal) {
+	count, used, dir := len(q.files), q.used, q.dir
+	if quotaOver(rule, count, used) {
+		events.emit(EventDecision, folder, dir, "Подкаталог %s превышает квоту: файлов %d (%s), квота %s",
+			dir, count, formatBytes(used), quotaText(rule))
+	}
+	for _, f := range q.files {
+		if !quotaOver(rule, count, used) {
+			res.Skipped++
+			res.keep(f.path, SkipWithinQuota, "квота подкаталога "+dir)
+			continue
+		}
+		if res.StoppedAt != "" || opts.expired() {
+			if res.StoppedAt == "" {
+				res.StoppedAt = f.path
+				events.emit(EventWarning, folder, f.path, "Время запуска исчерпано, обработка квоты остановлена на файле %s", f.path)
+			}
+			res.Skipped++
+			res.keep(f.path, SkipBudget, "")
+			continue
+		}
+		if q.keep[f.path] {
+			res.Skipped++
+			res.keep(f.path, SkipKeepNewest, fmt.Sprintf("keep=%d", rule.Keep))
+			continue
+		}
+		// Файлы с неистёкшей датой хранения занимают квоту, но не удаляются.
+		if rule.HonorRetain {
+			held, detail, err := fileHold(f.path, time.Now())
+			if err != nil {
+				res.fileError(f.path, CodeRetentionRead, "Ошибка чтения даты хранения "+f.path, err)
+				continue
+			}
+			if held {
+				res.Skipped++
+				res.keep(f.path, SkipRetained, detail)
+				continue
+			}
+		}
+		if users := opts.Mapped.of(f.path); users != "" {
+			res.Skipped++
+			res.keep(f.path, SkipMapped, users)
+			continue
+		}
+		if rule.Verify.matches(filepath.Base(f.path)) && !rule.Verify.allow(res, folder, f.path, f.size, f.newest) {
+			continue
+		}
+		if !opts.approved(f.path, pendingQuotaDelete) {
+			res.Skipped++
+			res.keep(f.path, SkipNotApproved, pendingQuotaDelete)
+			continue
+		}
+		if limit := budget.take(); limit != "" {
+			res.Skipped++
+			res.keep(f.path, SkipMaxDelete, limit)
+			continue
+		}
+		if err := protection.check(f.path); opts.DryRun && err != nil {
+			budget.give()
+			res.fileError(f.path, CodeDeleteFailed, "", err)
+			continue
+		} else if opts.DryRun {
+			events.emit(EventDecision, folder, f.path, "Будет удалён файл: %s по квоте подкаталога (возраст %s, размер %s)",
+				f.path, formatAge(time.Since(f.newest)), formatBytes(f.size))
+			res.Planned++
+			res.PlannedFreed += f.size
+			res.Skipped++
+			res.keep(f.path, SkipDryRun, pendingQuotaDelete)
+		} else {
+			events.emit(EventDecision, folder, f.path, "Файл %s убирается по квоте подкаталога %s", f.path, dir)
+			target, err := disp.dispose(f.path)
+			if err != nil {
+				budget.give()
+				code, message := disp.failure()
+				res.fileError(f.path, code, message+f.path, err)
+				continue
+			}
+			deleted, freed := res.Deleted, res.Freed
+			disp.record(res, f.path, target, f.size)
+			res.QuotaDeleted++
+			progress.deleted.Add(int64(res.Deleted - deleted))
+			progress.freed.Add(res.Freed - freed)
+		}
+		used -= f.size
+		count--
+	}
+}
+
+// quotaText описывает квоту подкаталога для сообщений.
+func quotaText(rule folderRule) string {
+	switch {
+	case rule.SubdirQuotaSize > 0 && rule.SubdirQuotaFiles > 0:
+		return formatBytes(rule.SubdirQuotaSize) + " и " + strconv.Itoa(rule.SubdirQuotaFiles) + " файлов"
+	case rule.SubdirQuotaSize > 0:
+		return formatBytes(rule.SubdirQuotaSize)
+	default:
+		return strconv.Itoa(rule.SubdirQuotaFiles) + " файлов"
+	}
+}
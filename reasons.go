@@ -0,0 +1,129 @@
+package main
+
+// SkipReason объясняет, почему файл-кандидат не был удалён.
+type SkipReason string
+
+const (
+	// SkipNotOldEnough — время модификации или создания не старше дня отсечки.
+	SkipNotOldEnough SkipReason = "not_old_enough"
+	// SkipError — файл не удалось проверить или удалить.
+	SkipError SkipReason = "error"
+	// SkipPermission — отказано в доступе при проверке или удалении файла.
+	SkipPermission SkipReason = "permission"
+	// SkipDryRun — файл подлежит удалению, но запуск пробный.
+	SkipDryRun SkipReason = "dry_run"
+	// SkipFuture — время изменения или создания файла в будущем.
+	SkipFuture SkipReason = "future"
+	// SkipNotIncluded — имя файла не подходит под шаблоны include папки.
+	SkipNotIncluded SkipReason = "not_included"
+	// SkipExcluded — файл защищён от удаления шаблоном exclude.
+	SkipExcluded SkipReason = "excluded"
+	// SkipWithinQuota — подкаталог файла укладывается в квоту.
+	SkipWithinQuota SkipReason = "within_quota"
+	// SkipKeepNewest — файл среди keep самых свежих файлов папки.
+	SkipKeepNewest SkipReason = "keep_newest"
+	// SkipMaxDelete — файлов к удалению больше max_delete (режим truncate).
+	SkipMaxDelete SkipReason = "max_delete"
+	// SkipPolicy — файл не подходит под условие удаления policy папки.
+	SkipPolicy SkipReason = "policy"
+	// SkipGFS — файл сохраняется схемой gfs папки.
+	SkipGFS SkipReason = "gfs"
+	// SkipRetained — у файла неистёкшая дата хранения (honor_retain).
+	SkipRetained SkipReason = "retained"
+	// SkipKeepOnePer — файл сохраняется за свой период прореживанием keep_one_per.
+	SkipKeepOnePer SkipReason = "keep_one_per"
+	// SkipMapped — файл используется процессом как исполняемый или
+	// отображён в память (protect_mapped).
+	SkipMapped SkipReason = "mapped"
+	// SkipRecentlyRead — файл читали за последние keep_read_within дней.
+	SkipRecentlyRead SkipReason = "recently_read"
+	// SkipUnverified — проверка verify не подтвердила удаление файла.
+	SkipUnverified SkipReason = "unverified"
+	// SkipSymlink — ссылка при symlinks: follow ведёт за пределы папки
+	// или не к файлу.
+	SkipSymlink SkipReason = "symlink"
+	// SkipIgnored — файл исключён правилом filters или .cleanupignore папки.
+	SkipIgnored SkipReason = "ignored"
+	// SkipProtected — путь защищён общим списком protect.
+	SkipProtected SkipReason = "protected"
+	// SkipSize — файл вне ограничений размера папки (min_size, max_size,
+	// only_larger_than).
+	SkipSize SkipReason = "size"
+	// SkipOwner — владелец или группа файла не из списков owner и group.
+	SkipOwner SkipReason = "owner"
+	// SkipLocked — файл занят другим процессом и после повторов (Windows).
+	SkipLocked SkipReason = "locked"
+	// SkipBudget — время запуска (--max-duration) исчерпано.
+	SkipBudget SkipReason = "budget"
+	// SkipFreeSpace — на файловой системе папки свободно не меньше min_free
+	// (min_free_only).
+	SkipFreeSpace SkipReason = "free_space"
+	// SkipNotApproved — действия над файлом нет в утверждённом плане
+	// (serve с scan_only).
+	SkipNotApproved SkipReason = "not_approved"
+)
+
+// skipReasonText содержит описания причин для вывода человеку.
+var skipReasonText = map[SkipReason]string{
+	SkipNotOldEnough: "не старше дня отсечки",
+	SkipError:        "ошибка",
+	SkipPermission:   "отказано в доступе",
+	SkipDryRun:       "пробный запуск",
+	SkipBudget:       "время запуска исчерпано",
+	SkipFuture:       "время файла в будущем",
+	SkipNotIncluded:  "не подходит под include",
+	SkipExcluded:     "защищён exclude",
+	SkipWithinQuota:  "в пределах квоты подкаталога",
+	SkipKeepNewest:   "среди самых свежих файлов",
+	SkipMaxDelete:    "превышен max_delete",
+	SkipPolicy:       "не подходит под policy",
+	SkipGFS:          "сохраняется схемой gfs",
+	SkipRetained:     "дата хранения не истекла",
+	SkipKeepOnePer:   "сохраняется за период keep_one_per",
+	SkipMapped:       "используется процессом",
+	SkipRecentlyRead: "недавно читали",
+	SkipUnverified:   "удаление не подтверждено",
+	SkipSymlink:      "ссылка не обрабатывается",
+	SkipIgnored:      "исключён фильтром",
+	SkipProtected:    "защищён protect",
+	SkipSize:         "не подходит по размеру",
+	SkipOwner:        "другой владелец",
+	SkipLocked:       "занят другим процессом",
+	SkipFreeSpace:    "свободного места достаточно",
+	SkipNotApproved:  "не входит в утверждённый план",
+}
+
+// String возвращает описание причины на русском языке.
+func (r SkipReason) String() string {
+	if text, ok := skipReasonText[r]; ok {
+		return text
+	}
+	return string(r)
+}
+
+// KeptFile описывает файл, оставленный при очистке, и причину решения.
+type KeptFile struct {
+	Path   string     `json:"path"`
+	Reason SkipReason `json:"reason"`
+	Detail string     `json:"detail,omitempty"`
+	// Code — код ошибки, из-за которой файл оставлен (причины error и permission).
+	Code ErrorCode `json:"code,omitempty"`
+}
+
+// keep регистрирует оставленный файл и причину в результатах папки.
+func (res *FolderResult) keep(path string, reason SkipReason, detail string) {
+	res.keepCode(path, reason, detail, "")
+}
+
+// keepCode регистрирует файл, оставленный из-за ошибки с кодом code.
+func (res *FolderResult) keepCode(path string, reason SkipReason, detail string, code ErrorCode) {
+	if res.SkipReasons == nil {
+		res.SkipReasons = make(map[SkipReason]int)
+	}
+	res.SkipReasons[reason]++
+	events.emit(EventSkip, res.Folder, path, "Оставлен файл %s: %s (%s)", path, reason, detail)
+	if res.discardKept {
+		return
+	}
+	res.Kept = append(res.Kept, KeptFile{Path: path, Reason: reason, Detail: detail, Code: code})
+}
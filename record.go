@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// FolderRecord — машиночитаемое представление итогов обработки папки.
+type FolderRecord struct {
+	Folder  string `json:"folder"`
+	Total   int    `json:"total"`
+	Deleted int    `json:"deleted"`
+	Freed   int64  `json:"freed_bytes"`
+	Error   string `json:"error,omitempty"`
+	Future  int    `json:"future,omitempty"` // файлов со временем в будущем
+	// ErrorCode — код ошибки папки; ErrorCodes — сколько ошибок отдельных
+	// файлов с каждым кодом.
+	ErrorCode  ErrorCode         `json:"error_code,omitempty"`
+	ErrorCodes map[ErrorCode]int `json:"error_codes,omitempty"`
+	// Errors — файлов, которые не удалось обработать; DurationSeconds —
+	// время обработки папки.
+	Errors          int     `json:"errors,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// PermissionDenied — файлов, не обработанных из-за отказа в доступе.
+	PermissionDenied int `json:"permission_denied,omitempty"`
+	// FirstRun — папка очищается впервые, файлы не удалялись до подтверждения;
+	// Planned и PlannedFreed — сколько файлов и байт было бы удалено.
+	FirstRun     bool  `json:"first_run,omitempty"`
+	Planned      int   `json:"planned,omitempty"`
+	PlannedFreed int64 `json:"planned_freed_bytes,omitempty"`
+	// Tiered и TieredBytes — файлов и байт, перемещённых в tier_to.
+	Tiered      int   `json:"tiered,omitempty"`
+	TieredBytes int64 `json:"tiered_bytes,omitempty"`
+	// SoftDeleted — файлов, переименованных в надгробия.
+	SoftDeleted int `json:"soft_deleted,omitempty"`
+	// QuotaDeleted — файлов, убранных по квотам подкаталогов.
+	QuotaDeleted int `json:"quota_deleted,omitempty"`
+	// Truncated — файлов к удалению, оставленных сверх max_delete.
+	Truncated int `json:"max_delete_truncated,omitempty"`
+	// Quarantined — файлов, перемещённых в карантин.
+	Quarantined int `json:"quarantined,omitempty"`
+	// Archived — файлов, записанных в архив tar.gz и удалённых.
+	Archived int `json:"archived,omitempty"`
+	// Moved — файлов, перемещённых в move_to.
+	Moved int `json:"moved,omitempty"`
+	// Compressed и CompressedSaved — файлов, сжатых на месте, и сэкономленных байт.
+	Compressed      int   `json:"compressed,omitempty"`
+	CompressedSaved int64 `json:"compressed_saved,omitempty"`
+	// SkipReasons — сколько файлов оставлено по каждой причине.
+	SkipReasons map[SkipReason]int `json:"skip_reasons,omitempty"`
+	// Kept — оставленные файлы с причинами; заполняется только в подробном режиме.
+	Kept []KeptFile `json:"kept,omitempty"`
+	// FSTotal и FSFree — общий и доступный объём файловой системы папки после очистки.
+	FSTotal uint64 `json:"fs_total_bytes,omitempty"`
+	FSFree  uint64 `json:"fs_free_bytes,omitempty"`
+}
+
+// RunRecord — машиночитаемое представление итогов запуска,
+// которое отправляется во внешние системы.
+type RunRecord struct {
+	Host            string         `json:"host"`
+	Instance        string         `json:"instance"`
+	RunID           string         `json:"run_id,omitempty"`
+	DryRun          bool           `json:"dry_run,omitempty"`
+	Start           time.Time      `json:"start"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	Total           int            `json:"total"`
+	Deleted         int            `json:"deleted"`
+	Freed           int64          `json:"freed_bytes"`
+	Folders         []FolderRecord `json:"folders"`
+	Missing         []string       `json:"missing,omitempty"`
+	StoppedAt       string         `json:"stopped_at,omitempty"`
+	CanaryFailed    string         `json:"canary_failed,omitempty"`
+	Deferred        string         `json:"deferred,omitempty"` // признак обслуживания, из-за которого удаление отложено
+	// Resources — ресурсы, потреблённые запуском.
+	Resources *ResourceRecord `json:"resources,omitempty"`
+}
+
+// newRunRecord строит RunRecord по итогам запуска.
+// Список оставленных файлов включается, если установлен withKept.
+func newRunRecord(summary RunSummary, withKept bool) RunRecord {
+	host, _ := os.Hostname()
+	rec := RunRecord{
+		Host:            host,
+		Instance:        summary.Instance,
+		RunID:           summary.RunID,
+		DryRun:          summary.DryRun,
+		Start:           summary.Start,
+		DurationSeconds: summary.Duration.Seconds(),
+		Total:           summary.Total,
+		Deleted:         summary.Deleted,
+		Freed:           summary.Freed,
+		Missing:         summary.Missing,
+		StoppedAt:       summary.StoppedAt,
+		CanaryFailed:    summary.CanaryFailed,
+		Deferred:        summary.Deferred,
+		Resources:       resourceRecord(summary),
+	}
+	for _, f := range summary.Folders {
+		fr := FolderRecord{Folder: f.Folder, Total: f.Total, Deleted: f.Deleted, Freed: f.Freed, Future: f.Future, SkipReasons: f.SkipReasons,
+			Errors: f.Errors, ErrorCodes: f.ErrorCodes, DurationSeconds: f.Duration.Seconds(),
+			PermissionDenied: f.PermissionDenied, FirstRun: f.FirstRun, Planned: f.Planned, PlannedFreed: f.PlannedFreed,
+			Tiered: f.Tiered, TieredBytes: f.TieredBytes, SoftDeleted: f.SoftDeleted, QuotaDeleted: f.QuotaDeleted, Truncated: f.Truncated, Quarantined: f.Quarantined,
+			Archived: f.Archived, Moved: f.Moved, Compressed: f.Compressed, CompressedSaved: f.CompressedSaved}
+		if withKept {
+			fr.Kept = f.Kept
+		}
+		if f.Err != nil {
+			fr.Error, fr.ErrorCode = f.Err.Error(), folderErrorCode(f.Err)
+		}
+		if total, free, err := diskUsage(f.Folder); err == nil {
+			fr.FSTotal, fr.FSFree = total, free
+		}
+		rec.Folders = append(rec.Folders, fr)
+	}
+	return rec
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Где находится файл, который ещё можно вернуть.
+const (
+	recoverSoftDeleted = "soft_deleted" // надгробие в самой папке (soft_delete)
+	recoverQuarantined = "quarantined"  // в карантине (action: quarantine)
+	recoverMoved       = "moved"        // в move_to (action: move)
+	recoverArchived    = "archived"     // в архиве (action: archive)
+)
+
+// recoverableFile — убранный из папки файл, который ещё можно вернуть.
+type recoverableFile struct {
+	Folder string `json:"folder"`
+	Path   string `json:"path"` // исходный путь
+	Kind   string `json:"kind"`
+	// Location — надгробие, файл в карантине или move_to либо архив.
+	Location  string    `json:"location"`
+	Member    string    `json:"member,omitempty"` // путь файла в архиве относительно папки
+	Size      int64     `json:"size"`
+	RemovedAt time.Time `json:"removed_at"`
+	// ExpiresAt — когда файл будет удалён окончательно; nil — хранится,
+	// пока его не удалят вручную.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// expiresIn записывает срок окончательного удаления файла, убранного в at,
+// если ttl задан.
+func (f *recoverableFile) expiresIn(at time.Time, ttl time.Duration) {
+	if ttl > 0 {
+		expires := at.Add(ttl)
+		f.ExpiresAt = &expires
+	}
+}
+
+// listRecoverable собирает файлы папки, которые ещё можно вернуть: надгробия
+// soft_delete в самой папке, файлы карантина, move_to и архивов папки.
+// Исходные пути и время берутся из манифестов каталогов, а для файлов,
+// перенесённых до появления манифестов, — из имён надгробий и архивов.
+func listRecoverable(folder string, rule folderRule, nested []string) ([]recoverableFile, error) {
+	var list []recoverableFile
+	err := readFolderFiles(folder, rule, nested, false, nil, func(entry os.DirEntry) {
+		at, ok := tombstoneTime(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			return
+		}
+		f := recoverableFile{Folder: folder, Kind: recoverSoftDeleted, Location: filepath.Join(folder, entry.Name()), RemovedAt: at,
+			Path: filepath.Join(folder, entry.Name()[:strings.LastIndex(entry.Name(), tombstoneMarker)])}
+		if info, err := entry.Info(); err == nil {
+			f.Size = info.Size()
+		}
+		f.expiresIn(at, rule.SoftDelete)
+		list = append(list, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rule.QuarantineDir != "" {
+		files, err := listQuarantine(folder, mirrorPath(rule.QuarantineDir, folder), rule.QuarantineTTL)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, files...)
+	}
+	if rule.MoveTo != "" {
+		files, err := listManifest(folder, rule.MoveTo, recoverMoved)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, files...)
+	}
+	if rule.ArchiveDir != "" {
+		files, err := listArchives(folder, mirrorPath(rule.ArchiveDir, folder))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, files...)
+	}
+	return list, nil
+}
+
+// listQuarantine собирает файлы карантина папки.
+func listQuarantine(folder, dir string, ttl time.Duration) ([]recoverableFile, error) {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Старые манифесты могли хранить относительные пути: цель считается от
+	// текущего каталога, а относительный исходный путь не используется —
+	// он выводится из места файла в карантине.
+	origin := make(map[string]string)
+	for _, m := range manifest {
+		if filepath.IsAbs(m.Path) {
+			origin[folderKey(m.Target)] = m.Path
+		}
+	}
+	var list []recoverableFile
+	err = walkTree(dir, false, nil, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		at, ok := tombstoneTime(d.Name())
+		if !ok || !d.Type().IsRegular() {
+			return nil
+		}
+		f := recoverableFile{Folder: folder, Kind: recoverQuarantined, Location: path, RemovedAt: at, Path: origin[folderKey(path)]}
+		if f.Path == "" {
+			// Путь папки повторяется внутри каталога карантина.
+			rel, _ := filepath.Rel(dir, path)
+			f.Path = filepath.Join(folderKey(folder), rel[:strings.LastIndex(rel, tombstoneMarker)])
+		}
+		if info, err := d.Info(); err == nil {
+			f.Size = info.Size()
+		}
+		f.expiresIn(at, ttl)
+		list = append(list, f)
+		return nil
+	})
+	return list, err
+}
+
+// listManifest собирает перенесённые из папки файлы по манифесту каталога
+// dir, которые ещё лежат там.
+func listManifest(folder, dir, kind string) ([]recoverableFile, error) {
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []recoverableFile
+	for _, m := range manifest {
+		if !pathWithin(folderKey(folder), folderKey(m.Path)) {
+			continue
+		}
+		if _, err := os.Lstat(m.Target); err != nil {
+			continue
+		}
+		list = append(list, recoverableFile{Folder: folder, Path: m.Path, Kind: kind, Location: m.Target, Member: m.Member,
+			Size: m.Size, RemovedAt: m.Time})
+	}
+	return list, nil
+}
+
+// listArchives собирает файлы архивов папки: по манифесту, а из архивов,
+// о которых в манифесте записей нет, — по заголовкам tar.
+func listArchives(folder, dir string) ([]recoverableFile, error) {
+	list, err := listManifest(folder, dir, recoverArchived)
+	if err != nil {
+		return nil, err
+	}
+	archives, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+	for _, archive := range archives {
+		if slices.ContainsFunc(list, func(f recoverableFile) bool { return f.Location == archive }) {
+			continue
+		}
+		files, err := archiveMembers(folder, archive)
+		if err != nil {
+			return nil, fmt.Errorf("архив %s: %v", archive, err)
+		}
+		list = append(list, files...)
+	}
+	return list, nil
+}
+
+// archiveMembers перечисляет файлы архива; временем переноса считается время
+// изменения архива.
+func archiveMembers(folder, archive string) ([]recoverableFile, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var list []recoverableFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, recoverableFile{Folder: folder, Path: filepath.Join(folder, filepath.FromSlash(hdr.Name)), Kind: recoverArchived,
+			Location: archive, Member: hdr.Name, Size: hdr.Size, RemovedAt: info.ModTime()})
+	}
+}
+
+// pathWithin сообщает, лежит ли path в папке folder или её подкаталогах.
+func pathWithin(folder, path string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// matchRecoverable сообщает, подходит ли файл под --file: шаблон имени
+// файла или исходный путь целиком; пусто — подходят все файлы.
+func matchRecoverable(pattern string, f recoverableFile) bool {
+	if pattern == "" || f.Path == pattern || f.Path == folderKey(pattern) {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(f.Path))
+	return ok
+}
+
+// recoverableKindText описывает, где лежит файл, для вывода человеку.
+var recoverableKindText = map[string]string{
+	recoverSoftDeleted: "мягко удалён",
+	recoverQuarantined: "в карантине",
+	recoverMoved:       "перемещён",
+	recoverArchived:    "в архиве",
+}
+
+// runRecoverable реализует подкоманду recoverable: список файлов, убранных
+// из папок, которые ещё можно вернуть, и сколько им осталось храниться.
+func runRecoverable(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("recoverable", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup recoverable [--file pattern] [flags] [days|config.yml] [folder1 folder2 ...]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if len(cfg.Folders) == 0 {
+		log.Print("Не задан список папок")
+		return 1
+	}
+	if err := validateOutput(cfg.Output); err != nil {
+		log.Print(err)
+		return 1
+	}
+	code := 0
+	list := []recoverableFile{}
+	for _, spec := range sortedFolderSpecs(cfg.Folders) {
+		files, err := listRecoverable(spec.Path, cfg.folderRule(spec), nestedFolders(spec.Path, cfg.Folders))
+		if err != nil {
+			log.Printf("Ошибка чтения папки '%s': %v\n", spec.Path, err)
+			code = 1
+			continue
+		}
+		for _, f := range files {
+			if matchRecoverable(opts.recoverFile, f) {
+				list = append(list, f)
+			}
+		}
+	}
+	slices.SortStableFunc(list, func(a, b recoverableFile) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return a.RemovedAt.Compare(b.RemovedAt)
+	})
+	if cfg.Output == outputJSON {
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return code
+	}
+	var size int64
+	now := time.Now()
+	for _, f := range list {
+		where := f.Location
+		if f.Member != "" {
+			where += " (" + f.Member + ")"
+		}
+		left := "хранится, пока не удалят вручную"
+		if f.ExpiresAt != nil {
+			left = "будет удалён через " + formatAge(max(f.ExpiresAt.Sub(now), 0))
+		}
+		fmt.Printf("%s: %s %s: %s, %s, %s\n", f.Path, recoverableKindText[f.Kind], f.RemovedAt.Local().Format(time.RFC3339),
+			where, formatBytes(f.Size), left)
+		size += f.Size
+	}
+	fmt.Printf("Можно вернуть файлов: %d (%s)\n", len(list), formatBytes(size))
+	return code
+}
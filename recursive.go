@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// validateRecursive проверяет обход подкаталогов папки: файлы подкаталогов
+// не могут одновременно очищаться по сроку и по квотам подкаталогов.
+func validateRecursive(rule folderRule) error {
+	if rule.Recursive && (rule.SubdirQuotaSize > 0 || rule.SubdirQuotaFiles > 0) {
+		return fmt.Errorf("recursive и max_depth нельзя сочетать с subdir_quota_size и subdir_quota_files")
+	}
+	return nil
+}
+
+// relDepth возвращает, в скольких подкаталогах папки лежит файл rel:
+// 0 — файл самой папки.
+func relDepth(rel string) int {
+	return strings.Count(filepath.ToSlash(rel), "/")
+}
+
+// withinDepth сообщает, очищается ли файл rel (путь относительно папки)
+// по recursive и max_depth.
+func (r folderRule) withinDepth(rel string) bool {
+	depth := relDepth(rel)
+	if !r.Recursive {
+		return depth == 0
+	}
+	return r.MaxDepth == 0 || depth <= r.MaxDepth
+}
+
+// deeperRule возвращает из двух правил то, которое обходит больше уровней
+// подкаталогов.
+func deeperRule(a, b folderRule) folderRule {
+	switch {
+	case !a.Recursive:
+		return b
+	case !b.Recursive:
+		return a
+	case a.MaxDepth == 0 || b.MaxDepth != 0 && a.MaxDepth >= b.MaxDepth:
+		return a
+	}
+	return b
+}
+
+// treeEntry — запись файла из подкаталога папки: Name возвращает путь
+// относительно папки, поэтому одноимённые файлы разных подкаталогов
+// различаются в keep, ранжировании и итогах.
+type treeEntry struct {
+	fs.DirEntry
+	rel string
+}
+
+func (e treeEntry) Name() string { return e.rel }
+
+// readFolderFiles вызывает fn для записей папки: без recursive — для записей
+// самой папки (в режиме экономии памяти — порциями), с recursive — для
+// файлов и ссылок всего дерева до max_depth. Подкаталоги, которые очищаются
+// как отдельные папки конфигурации (nested), не обходятся, а ссылки на
+// каталоги обходятся только с follow_reparse_points. О пропущенных каталогах,
+// ссылках и ошибках чтения подкаталогов сообщается в res (nil — не сообщать,
+// например при повторном чтении папки в режиме экономии памяти).
+func readFolderFiles(folder string, rule folderRule, nested []string, lowMemory bool, res *FolderResult, fn func(os.DirEntry)) error {
+	if !rule.Recursive {
+		return readEntries(folder, lowMemory, fn)
+	}
+	var skipped func(path, why string)
+	if res != nil {
+		skipped = func(path, why string) { skippedLink(folder, path, why) }
+	}
+	return walkTree(folder, rule.FollowReparsePoints, skipped, func(path string, d fs.DirEntry, err error) error {
+		if path == folder {
+			return err
+		}
+		if err != nil {
+			if res != nil {
+				res.fileError(path, CodeFolderRead, "Ошибка чтения каталога "+path, err)
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			switch {
+			case rule.MaxDepth > 0 && relDepth(rel) >= rule.MaxDepth:
+				return fs.SkipDir
+			case slices.Contains(nested, rel):
+				if res != nil {
+					events.emit(EventDecision, folder, path, "Каталог %s очищается как отдельная папка, при обходе папки %s пропускается", path, folder)
+				}
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if rel == d.Name() {
+			fn(d)
+		} else {
+			fn(treeEntry{DirEntry: d, rel: rel})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	regexpMu    sync.Mutex
+	regexpCache = make(map[string]*regexp.Regexp)
+)
+
+// compileRegexps компилирует регулярные выражения include_regex или
+// exclude_regex (key — для сообщения об ошибке). Каждое выражение
+// компилируется один раз: правила папок строятся многократно за запуск.
+func compileRegexps(key string, patterns []string) ([]*regexp.Regexp, error) {
+	regexpMu.Lock()
+	defer regexpMu.Unlock()
+	var list []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, ok := regexpCache[pattern]
+		if !ok {
+			var err error
+			if strings.TrimSpace(pattern) == "" {
+				return nil, fmt.Errorf("%s: пустое регулярное выражение", key)
+			}
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("%s: неверное регулярное выражение %q: %v", key, pattern, err)
+			}
+			regexpCache[pattern] = re
+		}
+		list = append(list, re)
+	}
+	return list, nil
+}
+
+// matchRegexp сообщает, подходит ли имя файла хотя бы под одно из
+// выражений. Выражения учитывают регистр во всех системах (для сравнения
+// без учёта регистра — (?i)). У файлов подкаталогов (recursive)
+// сравнивается только имя, без пути.
+func matchRegexp(list []*regexp.Regexp, name string) bool {
+	name = filepath.Base(name)
+	for _, re := range list {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexListFlag — флаг со списком регулярных выражений: выражение может
+// содержать запятые, поэтому каждое задаётся отдельным флагом.
+type regexListFlag struct {
+	list *[]string
+	set  bool
+}
+
+func (f *regexListFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, " ")
+}
+
+func (f *regexListFlag) Set(s string) error {
+	if !f.set {
+		*f.list = nil
+		f.set = true
+	}
+	*f.list = append(*f.list, s)
+	return nil
+}
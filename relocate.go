@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/djherbis/times"
+)
+
+// manifestName — манифест каталога карантина, архива или move_to: по строке
+// JSON на каждый перенесённый туда файл с его исходным путём и метаданными,
+// по которым файл восстанавливается.
+const manifestName = ".cleanup-manifest.jsonl"
+
+// fileMeta — исходные метаданные перенесённого файла.
+type fileMeta struct {
+	Time   time.Time `json:"time"`             // когда файл перенесён
+	Path   string    `json:"path"`             // исходный путь
+	Target string    `json:"target"`           // файл в карантине или move_to либо архив
+	Member string    `json:"member,omitempty"` // путь файла в архиве относительно папки
+	Size   int64     `json:"size"`
+	// Mode — права доступа вместе с setuid, setgid и sticky.
+	Mode   fs.FileMode       `json:"mode"`
+	UID    string            `json:"uid,omitempty"`
+	GID    string            `json:"gid,omitempty"`
+	MTime  time.Time         `json:"mtime"`
+	ATime  time.Time         `json:"atime"`
+	XAttrs map[string][]byte `json:"xattrs,omitempty"` // расширенные атрибуты (Linux)
+}
+
+// readMeta читает метаданные файла path.
+func readMeta(path string) (fileMeta, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fileMeta{}, err
+	}
+	m := fileMeta{Path: path, Size: info.Size(), Mode: info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky),
+		MTime: info.ModTime(), ATime: times.Get(info).AccessTime()}
+	m.UID, m.GID = fileOwner(info)
+	m.XAttrs = readXattrs(path)
+	return m, nil
+}
+
+// applyMeta переносит метаданные m на файл path, насколько позволяют
+// права: владелец меняется только от имени администратора, а атрибуты
+// пространств security и trusted — только с нужными привилегиями.
+// Ошибка возвращается, только если не удалось задать права или время.
+func applyMeta(path string, m fileMeta) error {
+	// Смена владельца сбрасывает setuid и setgid, поэтому права задаются после неё.
+	if uid, err := strconv.Atoi(m.UID); err == nil {
+		gid, err := strconv.Atoi(m.GID)
+		if err != nil {
+			gid = -1
+		}
+		if err := os.Lchown(path, uid, gid); errors.Is(err, fs.ErrPermission) {
+			// Без прав администратора пробуем сохранить хотя бы группу.
+			os.Lchown(path, -1, gid)
+		}
+	}
+	if err := os.Chmod(path, m.Mode); err != nil {
+		return err
+	}
+	writeXattrs(path, m.XAttrs)
+	return os.Chtimes(path, m.ATime, m.MTime)
+}
+
+var manifestMu sync.Mutex
+
+// appendManifest дописывает запись о перенесённом файле в манифест каталога dir.
+// Пути записываются абсолютными: restore и recoverable сравнивают их
+// с абсолютными путями папок, даже если папка или каталог переноса заданы
+// относительно текущего каталога.
+func appendManifest(dir string, m fileMeta) error {
+	m.Path, m.Target = folderKey(m.Path), folderKey(m.Target)
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(dir, manifestName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// relocate переносит файл в target с сохранением владельца, прав,
+// расширенных атрибутов и времени и записывает исходные метаданные
+// в манифест каталога dir — корня карантина, move_to или tier_to, даже если
+// target лежит в его подкаталоге (recursive): манифест читается только там.
+// Ошибка записи манифеста не отменяет перенос: о ней сообщается событием.
+func relocate(folder, file, target, dir string) error {
+	m, err := readMeta(file)
+	if err != nil {
+		return err
+	}
+	if err := moveFile(file, target); err != nil {
+		return err
+	}
+	m.Time, m.Target = time.Now(), target
+	if err := appendManifest(dir, m); err != nil {
+		events.emitCode(EventError, CodeManifestWrite, folder, file, "Ошибка записи манифеста %s: %v", filepath.Join(dir, manifestName), err)
+	}
+	return nil
+}
+
+// readManifest возвращает записи манифеста каталога dir; нет манифеста —
+// нет записей. Повреждённые строки пропускаются.
+func readManifest(dir string) ([]fileMeta, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []fileMeta
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var m fileMeta
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &m) != nil {
+			continue
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+// pruneManifest убирает из манифеста каталога dir записи о файлах, которых
+// там уже нет, например удалённых по quarantine_ttl.
+func pruneManifest(dir string) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	list, err := readManifest(dir)
+	if err != nil || list == nil {
+		return err
+	}
+	var b bytes.Buffer
+	for _, m := range list {
+		if _, err := os.Lstat(m.Target); err != nil {
+			continue
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		b.Write(append(data, '\n'))
+	}
+	path := filepath.Join(dir, manifestName)
+	if b.Len() == 0 {
+		return os.Remove(path)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// walkTree обходит каталог root, как filepath.WalkDir, но сам решает, что
+// делать со ссылками на каталоги: символическими ссылками, соединениями
+// (junction) NTFS и другими точками повторной обработки. По умолчанию они
+// не обходятся — иначе соединение на C:\Users внутри временного каталога
+// вычистило бы профили, — а для каждой вызывается skipped с пояснением, если
+// она задана. С follow обходятся и они, но только ведущие внутрь root и
+// каждый реальный каталог не больше одного раза, чтобы ссылка на
+// родительский каталог не зациклила обход.
+func walkTree(root string, follow bool, skipped func(path, why string), fn fs.WalkDirFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	w := treeWalker{follow: follow, skipped: skipped, fn: fn, visited: map[string]bool{}}
+	if follow {
+		if w.root, err = filepath.EvalSymlinks(root); err != nil {
+			return fn(root, nil, err)
+		}
+	}
+	err = w.walk(root, fs.FileInfoToDirEntry(info))
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+type treeWalker struct {
+	follow  bool
+	root    string // реальный путь корня обхода при follow
+	skipped func(path, why string)
+	fn      fs.WalkDirFunc
+	visited map[string]bool
+}
+
+func (w *treeWalker) walk(path string, d fs.DirEntry) error {
+	if err := w.fn(path, d, nil); err != nil || !d.IsDir() {
+		return err
+	}
+	if w.follow {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			if w.visited[real] {
+				return nil
+			}
+			w.visited[real] = true
+		}
+	}
+	entries, err := readDir(path)
+	if err != nil {
+		return w.fn(path, d, err)
+	}
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		if dir, ok := linkedDir(child, entry); ok {
+			why := linkSkipReason(w.follow, w.root, child)
+			if why != "" {
+				if w.skipped != nil {
+					w.skipped(child, why)
+				}
+				continue
+			}
+			entry = dir
+		}
+		if err := w.walk(child, entry); err != nil {
+			if err != filepath.SkipDir {
+				return err
+			}
+			if !entry.IsDir() {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// linkSkipReason возвращает, почему ссылка на каталог path не обходится,
+// или пустую строку, если она обходится: с follow — только ссылки, реальный
+// путь которых лежит внутри realRoot.
+func linkSkipReason(follow bool, realRoot, path string) string {
+	if !follow {
+		return "follow_reparse_points выключен"
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil || real != realRoot && !isSubpath(realRoot, real) {
+		return "ведёт за пределы папки"
+	}
+	return ""
+}
+
+// skippedLink сообщает о ссылке на каталог, которая не обходится.
+func skippedLink(folder, path, why string) {
+	events.emit(EventDecision, folder, path, "Каталог %s — ссылка или точка повторной обработки: не обходится (%s)", path, why)
+}
+
+// linkedDir сообщает, ведёт ли запись каталога path — ссылка или точка
+// повторной обработки — к каталогу, и возвращает запись этого каталога.
+// Точки повторной обработки, которые ведут себя как файлы (например,
+// файлы после дедупликации Windows Server), обрабатываются как обычные.
+func linkedDir(path string, entry fs.DirEntry) (fs.DirEntry, bool) {
+	if !isReparsePoint(entry) {
+		return nil, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return nil, false
+	}
+	return fs.FileInfoToDirEntry(info), true
+}
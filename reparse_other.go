@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+// isReparsePoint сообщает, является ли запись каталога символической ссылкой.
+func isReparsePoint(entry fs.DirEntry) bool {
+	return entry.Type()&fs.ModeSymlink != 0
+}
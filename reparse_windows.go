@@ -0,0 +1,21 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// isReparsePoint сообщает, является ли запись каталога символической
+// ссылкой, соединением (junction) или другой точкой повторной обработки
+// NTFS, например заполнителем облачного хранилища.
+func isReparsePoint(entry fs.DirEntry) bool {
+	if entry.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0 {
+		return true
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
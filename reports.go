@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportVars — значения, доступные в шаблонах путей журнала и файла событий.
+type reportVars struct {
+	Date     string // дата запуска, 2006-01-02
+	Time     string // время запуска, 150405
+	Host     string
+	Instance string
+	RunID    string // уникальный идентификатор запуска
+}
+
+// newReportVars формирует значения шаблонов для запуска, начатого в start.
+func newReportVars(start time.Time, instance string) reportVars {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 2)
+	rand.Read(suffix)
+	return reportVars{
+		Date:     start.Format("2006-01-02"),
+		Time:     start.Format("150405"),
+		Host:     host,
+		Instance: instance,
+		RunID:    start.Format("20060102T150405") + "-" + hex.EncodeToString(suffix),
+	}
+}
+
+// expandReportPath подставляет значения в шаблон пути, например
+// "reports/cleanup-{{.Date}}-{{.RunID}}.log". Путь без «{{» не меняется.
+func expandReportPath(tmpl string, vars reportVars) (string, error) {
+	if !strings.Contains(tmpl, "{{") {
+		return tmpl, nil
+	}
+	t, err := template.New("path").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("шаблон пути %q: %v", tmpl, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("шаблон пути %q: %v", tmpl, err)
+	}
+	return b.String(), nil
+}
+
+// templateAction находит подстановки в шаблоне пути.
+var templateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// reportFieldPatterns — регулярные выражения для подстановок шаблона пути
+// при поиске прошлых отчётов. Host и Instance подставляются значениями
+// текущего запуска: отчёты других экземпляров не удаляются.
+var reportFieldPatterns = map[string]func(reportVars) string{
+	"Date":     func(reportVars) string { return `\d{4}-\d{2}-\d{2}` },
+	"Time":     func(reportVars) string { return `\d{6}` },
+	"RunID":    func(reportVars) string { return `\d{8}T\d{6}-[0-9a-f]{4}` },
+	"Host":     func(v reportVars) string { return regexp.QuoteMeta(v.Host) },
+	"Instance": func(v reportVars) string { return regexp.QuoteMeta(v.Instance) },
+}
+
+// reportPattern строит по шаблону пути tmpl регулярное выражение, под которое
+// подходят только файлы, созданные по этому шаблону, например
+// ^reports/cleanup-\d{4}-\d{2}-\d{2}\.log$ для reports/cleanup-{{.Date}}.log.
+// Шаблон с другими подстановками (функциями, условиями) не поддерживается.
+func reportPattern(tmpl string, vars reportVars) (*regexp.Regexp, error) {
+	tmpl = filepath.Clean(tmpl)
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, loc := range templateAction.FindAllStringIndex(tmpl, -1) {
+		b.WriteString(regexp.QuoteMeta(tmpl[last:loc[0]]))
+		field := strings.TrimSpace(strings.Trim(tmpl[loc[0]:loc[1]], "{}"))
+		pattern, ok := reportFieldPatterns[strings.TrimPrefix(field, ".")]
+		if !ok || !strings.HasPrefix(field, ".") {
+			return nil, fmt.Errorf("подстановка %s не поддерживается при удалении старых отчётов (допустимы .Date, .Time, .Host, .Instance, .RunID)", tmpl[loc[0]:loc[1]])
+		}
+		b.WriteString(pattern(vars))
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// pruneReports удаляет файлы, созданные по шаблону tmpl в прошлых запусках,
+// если они старше days дней. Кандидаты ищутся по маске, а удаляются только
+// подходящие под reportPattern. Нешаблонные пути и текущий файл current
+// не затрагиваются. Возвращает удалённые файлы.
+func pruneReports(tmpl, current string, vars reportVars, days int, now time.Time) ([]string, error) {
+	if days <= 0 || !strings.Contains(tmpl, "{{") {
+		return nil, nil
+	}
+	re, err := reportPattern(tmpl, vars)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(templateAction.ReplaceAllString(filepath.Clean(tmpl), "*"))
+	if err != nil {
+		return nil, err
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	var removed []string
+	for _, path := range matches {
+		if filepath.Clean(path) == filepath.Clean(current) || !re.MatchString(filepath.Clean(path)) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := removeFile(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
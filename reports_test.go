@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReportPattern(t *testing.T) {
+	vars := reportVars{Host: "web-1.example", Instance: "daily"}
+	tests := []struct {
+		name  string
+		tmpl  string
+		match []string
+		other []string
+	}{
+		{
+			name:  "дата",
+			tmpl:  "reports/cleanup-{{.Date}}.log",
+			match: []string{"reports/cleanup-2024-05-01.log"},
+			other: []string{"reports/cleanup-2024-5-1.log", "reports/cleanup-2024-05-01.log.bak", "other/cleanup-2024-05-01.log", "reports/cleanup-latest.log"},
+		},
+		{
+			name:  "время и идентификатор запуска",
+			tmpl:  "cleanup-{{.Time}}-{{ .RunID }}.jsonl",
+			match: []string{"cleanup-010203-20240501T010203-0a1f.jsonl"},
+			other: []string{"cleanup-0102-20240501T010203-0a1f.jsonl", "cleanup-010203-20240501T010203-XYZW.jsonl"},
+		},
+		{
+			name:  "хост и экземпляр только текущие",
+			tmpl:  "{{.Host}}/{{.Instance}}-{{.Date}}.log",
+			match: []string{"web-1.example/daily-2024-05-01.log"},
+			other: []string{"web-1Xexample/daily-2024-05-01.log", "web-2.example/daily-2024-05-01.log", "web-1.example/weekly-2024-05-01.log"},
+		},
+		{
+			name:  "спецсимволы в пути",
+			tmpl:  "logs (old)/cleanup+{{.Date}}.log",
+			match: []string{"logs (old)/cleanup+2024-05-01.log"},
+			other: []string{"logs old/cleanupp2024-05-01.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := reportPattern(filepath.FromSlash(tt.tmpl), vars)
+			if err != nil {
+				t.Fatalf("reportPattern(%q): %v", tt.tmpl, err)
+			}
+			for _, path := range tt.match {
+				if !re.MatchString(filepath.FromSlash(path)) {
+					t.Errorf("%s не подходит под %s", path, re)
+				}
+			}
+			for _, path := range tt.other {
+				if re.MatchString(filepath.FromSlash(path)) {
+					t.Errorf("%s не должен подходить под %s", path, re)
+				}
+			}
+		})
+	}
+}
+
+func TestReportPatternUnsupported(t *testing.T) {
+	for _, tmpl := range []string{
+		"cleanup-{{.Unknown}}.log",
+		"cleanup-{{Date}}.log",
+		`cleanup-{{printf "%s" .Date}}.log`,
+		"cleanup-{{if .Host}}x{{end}}.log",
+	} {
+		if _, err := reportPattern(tmpl, reportVars{}); err == nil {
+			t.Errorf("reportPattern(%q): ожидалась ошибка", tmpl)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// resourceUsage — ресурсы, потреблённые процессом cleanup. Счётчики,
+// которые платформа не сообщает, равны -1.
+type resourceUsage struct {
+	UserCPU    time.Duration
+	SystemCPU  time.Duration
+	MaxRSS     int64 // пиковый объём резидентной памяти, байт
+	ReadBytes  int64 // прочитано с диска, байт
+	WriteBytes int64 // записано на диск, байт
+	Syscalls   int64 // системных вызовов чтения и записи
+}
+
+// sub возвращает потребление с момента start; пиковая память — за всё
+// время работы процесса.
+func (u resourceUsage) sub(start resourceUsage) resourceUsage {
+	diff := func(a, b int64) int64 {
+		if a < 0 || b < 0 {
+			return -1
+		}
+		return a - b
+	}
+	return resourceUsage{
+		UserCPU:    u.UserCPU - start.UserCPU,
+		SystemCPU:  u.SystemCPU - start.SystemCPU,
+		MaxRSS:     u.MaxRSS,
+		ReadBytes:  diff(u.ReadBytes, start.ReadBytes),
+		WriteBytes: diff(u.WriteBytes, start.WriteBytes),
+		Syscalls:   diff(u.Syscalls, start.Syscalls),
+	}
+}
+
+// ResourceRecord — машиночитаемое представление потреблённых запуском ресурсов.
+type ResourceRecord struct {
+	UserCPUSeconds    float64 `json:"cpu_user_seconds"`
+	SystemCPUSeconds  float64 `json:"cpu_system_seconds"`
+	MaxRSS            int64   `json:"max_rss_bytes,omitempty"`
+	ReadBytes         int64   `json:"read_bytes,omitempty"`
+	WriteBytes        int64   `json:"write_bytes,omitempty"`
+	Syscalls          int64   `json:"syscalls,omitempty"`
+	FilesPerSecond    float64 `json:"files_per_second"`
+	SyscallsPerSecond float64 `json:"syscalls_per_second,omitempty"`
+}
+
+// resourceRecord строит ResourceRecord по итогам запуска; nil — ресурсы
+// не измерялись.
+func resourceRecord(summary RunSummary) *ResourceRecord {
+	u := summary.Resources
+	if u == nil {
+		return nil
+	}
+	rec := &ResourceRecord{
+		UserCPUSeconds:   u.UserCPU.Seconds(),
+		SystemCPUSeconds: u.SystemCPU.Seconds(),
+		MaxRSS:           max(u.MaxRSS, 0),
+		ReadBytes:        max(u.ReadBytes, 0),
+		WriteBytes:       max(u.WriteBytes, 0),
+		Syscalls:         max(u.Syscalls, 0),
+	}
+	if sec := summary.Duration.Seconds(); sec > 0 {
+		rec.FilesPerSecond = float64(summary.Total) / sec
+		rec.SyscallsPerSecond = float64(rec.Syscalls) / sec
+	}
+	return rec
+}
+
+// String описывает потреблённые ресурсы для итоговой таблицы.
+func (r *ResourceRecord) String() string {
+	parts := []string{fmt.Sprintf("CPU %.2fs (польз. %.2fs, сист. %.2fs)", r.UserCPUSeconds+r.SystemCPUSeconds, r.UserCPUSeconds, r.SystemCPUSeconds)}
+	if r.MaxRSS > 0 {
+		parts = append(parts, "пиковая память "+formatBytes(r.MaxRSS))
+	}
+	parts = append(parts, fmt.Sprintf("чтение %s, запись %s", formatBytes(r.ReadBytes), formatBytes(r.WriteBytes)))
+	parts = append(parts, fmt.Sprintf("%.0f файлов/с", r.FilesPerSecond))
+	if r.Syscalls > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f вызовов ввода-вывода/с", r.SyscallsPerSecond))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,6 @@
+//go:build !unix && !windows
+
+package main
+
+// processUsage не поддерживается на этой платформе.
+func processUsage() (resourceUsage, bool) { return resourceUsage{}, false }
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage возвращает ресурсы, потреблённые процессом.
+func processUsage() (resourceUsage, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return resourceUsage{}, false
+	}
+	u := resourceUsage{
+		UserCPU:   time.Duration(ru.Utime.Nano()),
+		SystemCPU: time.Duration(ru.Stime.Nano()),
+		MaxRSS:    int64(ru.Maxrss) * 1024, // в КиБ, кроме macOS
+		// Блоки ввода-вывода rusage — по 512 байт.
+		ReadBytes:  int64(ru.Inblock) * 512,
+		WriteBytes: int64(ru.Oublock) * 512,
+		Syscalls:   -1,
+	}
+	if runtime.GOOS == "darwin" {
+		u.MaxRSS = int64(ru.Maxrss)
+	}
+	procIO(&u)
+	return u, true
+}
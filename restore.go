@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// restoreTargets отбирает из файлов карантина те, что нужно вернуть по
+// аргументам restore: исходный путь файла или папка, в которой он лежал.
+// Если файл попадал в карантин несколько раз, возвращается последняя версия.
+func restoreTargets(files []recoverableFile, targets []string) []recoverableFile {
+	latest := make(map[string]recoverableFile)
+	for _, f := range files {
+		if !slices.ContainsFunc(targets, func(t string) bool { return f.Path == t || pathWithin(t, f.Path) }) {
+			continue
+		}
+		if prev, ok := latest[f.Path]; !ok || f.RemovedAt.After(prev.RemovedAt) {
+			latest[f.Path] = f
+		}
+	}
+	list := make([]recoverableFile, 0, len(latest))
+	for _, f := range latest {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(a, b recoverableFile) int { return strings.Compare(a.Path, b.Path) })
+	return list
+}
+
+// restoreFile возвращает файл из карантина на исходное место. Каталоги
+// исходного пути, удалённые после переноса, создаются заново; существующий
+// файл не перезаписывается. Владелец, права и время берутся из манифеста.
+func restoreFile(f recoverableFile, meta map[string]fileMeta) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	if err := moveFile(f.Location, f.Path); err != nil {
+		return err
+	}
+	if m, ok := meta[folderKey(f.Location)]; ok {
+		if err := applyMeta(f.Path, m); err != nil {
+			log.Printf("Файл %s возвращён, но не восстановлены права или время: %v\n", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// runRestore реализует подкоманду restore: возвращает файлы из карантина
+// (action: quarantine) папок конфигурации на исходные места по манифесту
+// каталога карантина. Аргументы — исходные пути файлов или папки.
+func runRestore(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("restore", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup restore [--config config.yml] [--dry-run] [flags] <folder|file> ...")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if len(opts.args) == 0 {
+		log.Print("Не указаны папки или файлы, которые нужно вернуть из карантина")
+		return 1
+	}
+	targets := make([]string, len(opts.args))
+	for i, arg := range opts.args {
+		if targets[i], err = filepath.Abs(arg); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+	code := 0
+	restored, quarantines := 0, 0
+	matched := make([]bool, len(targets))
+	for _, spec := range sortedFolderSpecs(cfg.Folders) {
+		rule := cfg.folderRule(spec)
+		if rule.QuarantineDir == "" {
+			continue
+		}
+		folder, err := filepath.Abs(spec.Path)
+		if err != nil {
+			folder = spec.Path
+		}
+		// Папки, не связанные с аргументами, не читаются.
+		if !slices.ContainsFunc(targets, func(t string) bool { return pathWithin(folder, t) || pathWithin(t, folder) }) {
+			continue
+		}
+		quarantines++
+		dir := mirrorPath(rule.QuarantineDir, folder)
+		files, err := listQuarantine(folder, dir, rule.QuarantineTTL)
+		if err != nil {
+			log.Printf("Ошибка чтения карантина %s: %v\n", dir, err)
+			code = 1
+			continue
+		}
+		manifest, err := readManifest(dir)
+		if err != nil {
+			log.Printf("Ошибка чтения манифеста %s: %v\n", filepath.Join(dir, manifestName), err)
+			code = 1
+			continue
+		}
+		meta := make(map[string]fileMeta)
+		for _, m := range manifest {
+			meta[folderKey(m.Target)] = m
+		}
+		list := restoreTargets(files, targets)
+		for i, t := range targets {
+			if slices.ContainsFunc(list, func(f recoverableFile) bool { return f.Path == t || pathWithin(t, f.Path) }) {
+				matched[i] = true
+			}
+		}
+		for _, f := range list {
+			if cfg.DryRun {
+				fmt.Printf("Будет возвращён файл: %s из %s\n", f.Path, f.Location)
+				restored++
+				continue
+			}
+			if err := restoreFile(f, meta); err != nil {
+				log.Printf("Ошибка возврата файла %s из %s: %v\n", f.Path, f.Location, err)
+				code = 1
+				continue
+			}
+			fmt.Printf("Возвращён файл: %s из %s\n", f.Path, f.Location)
+			restored++
+		}
+		if len(list) > 0 && !cfg.DryRun {
+			if err := pruneManifest(dir); err != nil {
+				log.Printf("Ошибка обновления манифеста %s: %v\n", filepath.Join(dir, manifestName), err)
+			}
+		}
+	}
+	if quarantines == 0 {
+		log.Print("Указанные пути не относятся к папкам конфигурации с action: quarantine")
+		return 1
+	}
+	if cfg.DryRun {
+		fmt.Printf("Будет возвращено файлов: %d\n", restored)
+	} else {
+		fmt.Printf("Возвращено файлов: %d\n", restored)
+	}
+	// Аргумент, под который не подошёл ни один файл карантина, — скорее
+	// всего опечатка в пути: запуск не считается успешным.
+	for i, ok := range matched {
+		if !ok {
+			log.Printf("В карантине нет файлов для %s\n", opts.args[i])
+			code = 1
+		}
+	}
+	return code
+}
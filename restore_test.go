@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRestoreRelativePaths(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("data", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := filepath.Join("data", "sub", "old.log")
+	for _, name := range []string{old, filepath.Join("data", "new.log")} {
+		if err := os.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().AddDate(0, 0, -100)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(old, 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := "days: 30\ndefaults:\n  action: quarantine\n  quarantine_dir: trash\n  recursive: true\n  time_fields: [mtime]\nfolders:\n  - data\n"
+	if err := os.WriteFile("config.yml", []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runCleanup([]string{"--config", "config.yml", "--first-run-confirm"}); code != exitOK {
+		t.Fatalf("runCleanup() = %d, want %d", code, exitOK)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("файл не перенесён в карантин: %v", err)
+	}
+	// Файл подкаталога записан в манифест корня карантина, по которому
+	// restore возвращает ему права.
+	dir := mirrorPath("trash", "data")
+	manifest, err := readManifest(dir)
+	if err != nil || len(manifest) != 1 || manifest[0].Path != folderKey(old) {
+		t.Fatalf("манифест карантина: %v, %v; want запись о %s", manifest, err, old)
+	}
+	if err := os.Chmod(manifest[0].Target, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if nested, _ := filepath.Glob(filepath.Join(dir, "sub", manifestName)); len(nested) != 0 {
+		t.Errorf("манифест в подкаталоге карантина: %v", nested)
+	}
+	if code := runRestore([]string{"--config", "config.yml", "data/missing.log"}); code == 0 {
+		t.Error("runRestore() для пути без файлов в карантине = 0, want ненулевой")
+	}
+	if code := runRestore([]string{"--config", "config.yml", old}); code != 0 {
+		t.Fatalf("runRestore() = %d, want 0", code)
+	}
+	if info, err := os.Stat(old); err != nil {
+		t.Errorf("файл не возвращён из карантина: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("права возвращённого файла %v, want 0600 из манифеста", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); !os.IsNotExist(err) {
+		t.Errorf("запись о возвращённом файле осталась в манифесте: %v", err)
+	}
+}
+
+func TestRecoverableRecursiveMove(t *testing.T) {
+	dir, to := t.TempDir(), t.TempDir()
+	oldTree(t, dir)
+	runFolder(t, dir, "action=move&move_to="+to)
+	list, err := listRecoverable(dir, testRule(t, dir, "recursive=true&action=move&move_to="+to), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range list {
+		paths = append(paths, f.Path)
+	}
+	slices.Sort(paths)
+	if want := []string{filepath.Join(dir, "a", "x.log"), filepath.Join(dir, "b", "x.log")}; !slices.Equal(paths, want) {
+		t.Errorf("recoverable: %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// retainSuffix — расширение файла-спутника с датой хранения: report.pdf
+// хранится до даты, записанной в report.pdf.retain.
+const retainSuffix = ".retain"
+
+// retainMark — имя расширенного атрибута (user.cleanup.expires) или, в Windows,
+// альтернативного потока NTFS (файл:cleanup.expires) с датой хранения файла.
+const retainMark = "cleanup.expires"
+
+// isRetainSidecar сообщает, является ли файл name файлом-спутником с датой
+// хранения. Такие файлы не удаляются и не участвуют в выборе самого свежего.
+func isRetainSidecar(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), retainSuffix)
+}
+
+// fileHold проверяет отметки хранения файла path — расширенный атрибут и
+// файл-спутник — и возвращает, удерживается ли файл сейчас, с пояснением.
+// Отметка только продлевает хранение: файл с истёкшей датой очищается по
+// правилам папки. Пустая отметка удерживает файл бессрочно; при нескольких
+// отметках действует более поздняя.
+func fileHold(path string, now time.Time) (bool, string, error) {
+	var marks []string
+	if value, ok, err := readRetainMark(path); err != nil {
+		return false, "", fmt.Errorf("чтение %s: %v", retainMark, err)
+	} else if ok {
+		marks = append(marks, value)
+	}
+	data, err := os.ReadFile(path + retainSuffix)
+	if err == nil {
+		marks = append(marks, string(data))
+	} else if !os.IsNotExist(err) {
+		return false, "", err
+	}
+	var latest time.Time
+	for _, mark := range marks {
+		until, err := parseRetainDate(mark)
+		if err != nil {
+			return false, "", err
+		}
+		if until.IsZero() {
+			return true, "бессрочно", nil
+		}
+		if until.After(latest) {
+			latest = until
+		}
+	}
+	if !now.Before(latest) {
+		return false, "", nil
+	}
+	return true, "до " + latest.Format(time.RFC3339), nil
+}
+
+// parseRetainDate разбирает дату хранения: ГГГГ-ММ-ДД (начало дня по местному
+// времени) или RFC 3339; пустое значение — бессрочно.
+func parseRetainDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("неверная дата хранения %q: ожидается ГГГГ-ММ-ДД", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// readRetainMark читает расширенный атрибут user.cleanup.expires файла.
+func readRetainMark(path string) (string, bool, error) {
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(path, "user."+retainMark, buf)
+	if err == unix.ENOATTR || err == unix.ENOTSUP {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(buf[:n]), true, nil
+}
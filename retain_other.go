@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+// readRetainMark: расширенные атрибуты на этой платформе не поддерживаются,
+// действуют только файлы-спутники.
+func readRetainMark(string) (string, bool, error) {
+	return "", false, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// readRetainMark читает альтернативный поток NTFS файл:cleanup.expires.
+// Файловые системы без потоков (FAT, часть сетевых ресурсов) отметок не имеют.
+func readRetainMark(path string) (string, bool, error) {
+	data, err := os.ReadFile(path + ":" + retainMark)
+	if os.IsNotExist(err) || errors.Is(err, windows.ERROR_INVALID_NAME) ||
+		errors.Is(err, windows.ERROR_INVALID_PARAMETER) || errors.Is(err, windows.ERROR_NOT_SUPPORTED) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
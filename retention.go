@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Отсчёт срока хранения (anchor).
+const (
+	anchorNewest = "newest" // от самого свежего файла папки или правила retention
+	anchorNow    = "now"    // от текущего времени
+)
+
+// validateAnchor проверяет значение anchor.
+func validateAnchor(anchor string) error {
+	if anchor != anchorNewest && anchor != anchorNow {
+		return fmt.Errorf("anchor=%q: допустимы newest, now", anchor)
+	}
+	return nil
+}
+
+// parseAsOf разбирает дату отсчёта as_of: ГГГГ-ММ-ДД (начало дня по местному
+// времени) или RFC 3339; пустое значение — дата не задана.
+func parseAsOf(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("as_of=%q: ожидается дата ГГГГ-ММ-ДД или время RFC 3339", s)
+	}
+	return t, nil
+}
+
+// RetentionRule — срок хранения файлов, имя которых подходит под шаблон.
+// В YAML задаётся элементом списка вида "*.log": 7d.
+type RetentionRule struct {
+	Pattern string
+	Days    int
+}
+
+// UnmarshalYAML разбирает правило из отображения с одним ключом — шаблоном.
+func (r *RetentionRule) UnmarshalYAML(unmarshal func(any) error) error {
+	var item yaml.MapSlice
+	if err := unmarshal(&item); err != nil {
+		return err
+	}
+	if len(item) != 1 {
+		return fmt.Errorf("retention: правило должно иметь вид \"шаблон\": срок")
+	}
+	pattern, ok := item[0].Key.(string)
+	if !ok {
+		return fmt.Errorf("retention: шаблон %v должен быть строкой", item[0].Key)
+	}
+	days, err := parseRetentionDays(fmt.Sprint(item[0].Value))
+	if err != nil {
+		return fmt.Errorf("retention: %s: %v", pattern, err)
+	}
+	*r = RetentionRule{Pattern: pattern, Days: days}
+	return nil
+}
+
+// MarshalYAML записывает правило в том же виде, в каком оно читается.
+func (r RetentionRule) MarshalYAML() (any, error) {
+	return yaml.MapSlice{{Key: r.Pattern, Value: r.Days}}, nil
+}
+
+func (r RetentionRule) String() string {
+	return fmt.Sprintf("%s=%d", r.Pattern, r.Days)
+}
+
+// parseRetentionDays разбирает срок хранения: число дней с необязательным
+// суффиксом d, например 7 или 7d.
+func parseRetentionDays(s string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "d"))
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("срок %q должен быть целым неотрицательным числом дней", s)
+	}
+	return days, nil
+}
+
+// parseRetentionRules разбирает правила из строки параметров папки:
+// правила через запятую, шаблон и срок через двоеточие ("*.log:7d,*:90d").
+func parseRetentionRules(s string) ([]RetentionRule, error) {
+	var rules []RetentionRule
+	for _, part := range strings.Split(s, ",") {
+		i := strings.LastIndex(part, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("правило %q должно иметь вид шаблон:срок", part)
+		}
+		days, err := parseRetentionDays(part[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", part[:i], err)
+		}
+		rules = append(rules, RetentionRule{Pattern: part[:i], Days: days})
+	}
+	return rules, nil
+}
+
+// retentionIndex возвращает номер первого правила retention, под которое
+// подходит файл name, или -1, если не подходит ни одно.
+func (r folderRule) retentionIndex(name string) int {
+	for i, rr := range r.Retention {
+		if matchAny([]string{rr.Pattern}, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// retentionAnchors — самые свежие файлы, от которых отсчитывается срок
+// хранения: у каждого правила retention свой, чтобы редкие архивы не
+// отсчитывались от ежечасных журналов. Файлы, не подошедшие ни под одно
+// правило (и все файлы папки без retention), образуют отдельную группу.
+type retentionAnchors struct {
+	rule   folderRule
+	newest []time.Time // по номеру правила, последний — для остальных файлов
+	now    time.Time   // дата as_of или, при anchor: now, время начала обработки папки
+}
+
+func newRetentionAnchors(rule folderRule) retentionAnchors {
+	a := retentionAnchors{rule: rule, newest: make([]time.Time, len(rule.Retention)+1)}
+	switch {
+	case !rule.AsOf.IsZero():
+		a.now = rule.AsOf
+	case rule.Anchor == anchorNow:
+		a.now = time.Now()
+	}
+	return a
+}
+
+func (a retentionAnchors) group(name string) int {
+	if i := a.rule.retentionIndex(name); i >= 0 {
+		return i
+	}
+	return len(a.newest) - 1
+}
+
+// add учитывает файл name со временем t.
+func (a retentionAnchors) add(name string, t time.Time) {
+	if i := a.group(name); t.After(a.newest[i]) {
+		a.newest[i] = t
+	}
+}
+
+// of возвращает время, от которого отсчитывается срок хранения файла name:
+// самый свежий файл его группы, дата as_of или, при anchor: now, текущее время.
+func (a retentionAnchors) of(name string) time.Time {
+	if !a.now.IsZero() {
+		return a.now
+	}
+	return a.newest[a.group(name)]
+}
+
+// describe перечисляет правила retention со сроками и самыми свежими
+// файлами для журнала.
+func (a retentionAnchors) describe() string {
+	parts := make([]string, 0, len(a.rule.Retention))
+	for i, rr := range a.rule.Retention {
+		newest := "нет файлов"
+		if !a.newest[i].IsZero() {
+			newest = "самый свежий " + a.newest[i].Format(time.RFC3339)
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", rr, newest))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/djherbis/times"
+)
+
+// RetryOptions — повторы операций с файлами после временных ошибок
+// (сбои NFS, антивирус, открывший файл на проверку).
+type RetryOptions struct {
+	Attempts int           `yaml:"attempts"` // всего попыток, 1 — без повторов
+	Backoff  time.Duration `yaml:"backoff"`  // пауза перед первым повтором, дальше удваивается
+	Jitter   float64       `yaml:"jitter"`   // случайный разброс паузы, доля от 0 до 1
+}
+
+// ioRetry — повторы операций с файлами текущего запуска.
+var ioRetry = RetryOptions{Attempts: 1}
+
+// validateRetry проверяет параметры повторов retry.
+func validateRetry(opts RetryOptions) error {
+	if opts.Attempts < 1 {
+		return fmt.Errorf("retry.attempts должно быть не меньше 1")
+	}
+	if opts.Backoff < 0 {
+		return fmt.Errorf("retry.backoff не может быть отрицательным")
+	}
+	if opts.Jitter < 0 || opts.Jitter > 1 {
+		return fmt.Errorf("retry.jitter должно быть от 0 до 1")
+	}
+	return nil
+}
+
+// retryable сообщает, может ли ошибка err пройти при повторе. Отсутствие
+// файла, отказ в доступе, файловая система только для чтения, путь не того
+// типа и запреты cleanup (protect) не повторяются, а занятые файлы
+// повторяются отдельно (locked_files).
+func retryable(err error) bool {
+	var protected *protectedError
+	switch {
+	case err == nil, errors.As(err, &protected), isSharingViolation(err):
+		return false
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrPermission), errors.Is(err, fs.ErrExist),
+		errors.Is(err, fs.ErrInvalid):
+		return false
+	}
+	return !slices.ContainsFunc(permanentErrnos, func(target error) bool { return errors.Is(err, target) })
+}
+
+// withRetry выполняет op и повторяет её после временных ошибок по ioRetry.
+// Если все попытки неудачны, к ошибке добавляется их число.
+func withRetry(op func() error) error {
+	err := op()
+	attempt := 1
+	for ; attempt < ioRetry.Attempts && retryable(err); attempt++ {
+		time.Sleep(retryPause(ioRetry, attempt, rand.Float64()))
+		err = op()
+	}
+	if err != nil && attempt > 1 {
+		return fmt.Errorf("%w (попыток: %d)", err, attempt)
+	}
+	return err
+}
+
+// retryMaxPause ограничивает паузу между повторами: при большом
+// retry.attempts удвоение иначе переполнило бы time.Duration.
+const retryMaxPause = time.Minute
+
+// retryPause возвращает паузу перед повтором номер n (с 1): backoff,
+// удваиваемый с каждым повтором, со случайным разбросом jitter, но не больше
+// retryMaxPause; r — случайное число от 0 до 1.
+func retryPause(opts RetryOptions, n int, r float64) time.Duration {
+	wait := opts.Backoff
+	for i := 1; i < n && wait < retryMaxPause; i++ {
+		wait *= 2
+	}
+	wait = min(wait, retryMaxPause)
+	if opts.Jitter > 0 {
+		wait = time.Duration(float64(wait) * (1 + opts.Jitter*(2*r-1)))
+	}
+	return min(max(wait, 0), retryMaxPause)
+}
+
+// statTimes возвращает отметки времени файла с повторами.
+func statTimes(path string) (t times.Timespec, err error) {
+	err = withRetry(func() error {
+		t, err = times.Stat(path)
+		return err
+	})
+	return t, err
+}
+
+// lstatTimes возвращает отметки времени символической ссылки с повторами.
+func lstatTimes(path string) (t times.Timespec, err error) {
+	err = withRetry(func() error {
+		t, err = times.Lstat(path)
+		return err
+	})
+	return t, err
+}
+
+// readDir читает каталог с повторами.
+func readDir(path string) (entries []os.DirEntry, err error) {
+	err = withRetry(func() error {
+		entries, err = os.ReadDir(path)
+		return err
+	})
+	return entries, err
+}
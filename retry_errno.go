@@ -0,0 +1,9 @@
+//go:build !plan9
+
+package main
+
+import "syscall"
+
+// permanentErrnos — ошибки системы, которые повтор не исправит: файловая
+// система только для чтения и путь не того типа.
+var permanentErrnos = []error{syscall.EROFS, syscall.ENOTDIR, syscall.EISDIR, syscall.ENOTEMPTY}
@@ -0,0 +1,7 @@
+package main
+
+import "syscall"
+
+// permanentErrnos — ошибки системы, которые повтор не исправит; в Plan 9
+// нет EROFS и ENOTEMPTY.
+var permanentErrnos = []error{syscall.ENOTDIR, syscall.EISDIR}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPause(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RetryOptions
+		n    int
+		r    float64
+		want time.Duration
+	}{
+		{"первый повтор", RetryOptions{Backoff: 100 * time.Millisecond}, 1, 0.9, 100 * time.Millisecond},
+		{"второй повтор", RetryOptions{Backoff: 100 * time.Millisecond}, 2, 0.9, 200 * time.Millisecond},
+		{"четвёртый повтор", RetryOptions{Backoff: 100 * time.Millisecond}, 4, 0.9, 800 * time.Millisecond},
+		{"без паузы", RetryOptions{}, 3, 0.5, 0},
+		{"разброс вниз", RetryOptions{Backoff: 100 * time.Millisecond, Jitter: 0.5}, 1, 0, 50 * time.Millisecond},
+		{"разброс вверх", RetryOptions{Backoff: 100 * time.Millisecond, Jitter: 0.5}, 1, 1, 150 * time.Millisecond},
+		{"середина разброса", RetryOptions{Backoff: 100 * time.Millisecond, Jitter: 0.5}, 2, 0.5, 200 * time.Millisecond},
+		{"полный разброс", RetryOptions{Backoff: 100 * time.Millisecond, Jitter: 1}, 3, 0, 0},
+		{"предел паузы", RetryOptions{Backoff: 100 * time.Millisecond}, 20, 0.5, retryMaxPause},
+		{"сдвиг больше разрядности", RetryOptions{Backoff: 100 * time.Millisecond}, 100, 0.5, retryMaxPause},
+		{"разброс вверх у предела", RetryOptions{Backoff: 100 * time.Millisecond, Jitter: 0.5}, 1000, 1, retryMaxPause},
+		{"разброс вниз у предела", RetryOptions{Backoff: 100 * time.Millisecond, Jitter: 0.5}, 1000, 0, retryMaxPause / 2},
+		{"backoff больше предела", RetryOptions{Backoff: time.Hour}, 1, 0.5, retryMaxPause},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryPause(tt.opts, tt.n, tt.r); got != tt.want {
+				t.Errorf("retryPause() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	transient := errors.New("stale NFS file handle")
+	tests := []struct {
+		name     string
+		attempts int
+		errs     []error // ошибки попыток по порядку, дальше — nil
+		calls    int
+		err      error
+		suffix   string
+	}{
+		{name: "успех сразу", attempts: 3, calls: 1},
+		{name: "успех после повтора", attempts: 3, errs: []error{transient}, calls: 2},
+		{name: "все попытки неудачны", attempts: 3, errs: []error{transient, transient, transient}, calls: 3, err: transient, suffix: "(попыток: 3)"},
+		{name: "без повторов", attempts: 1, errs: []error{transient}, calls: 1, err: transient},
+		{name: "файла нет", attempts: 3, errs: []error{fs.ErrNotExist}, calls: 1, err: fs.ErrNotExist},
+		{name: "отказ в доступе", attempts: 3, errs: []error{fs.ErrPermission}, calls: 1, err: fs.ErrPermission},
+		{name: "временная, затем постоянная", attempts: 3, errs: []error{transient, fs.ErrNotExist}, calls: 2, err: fs.ErrNotExist, suffix: "(попыток: 2)"},
+	}
+	saved := ioRetry
+	defer func() { ioRetry = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ioRetry = RetryOptions{Attempts: tt.attempts}
+			calls := 0
+			err := withRetry(func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.calls {
+				t.Errorf("попыток %d, want %d", calls, tt.calls)
+			}
+			if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+				t.Errorf("ошибка %v, want %v", err, tt.err)
+			}
+			if err != nil && !strings.HasSuffix(err.Error(), tt.suffix) {
+				t.Errorf("ошибка %q без %q", err, tt.suffix)
+			}
+		})
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// printRunHelp выводит справку по формам запуска и флагам подкоманды run.
+func printRunHelp(fs *flag.FlagSet) {
+	fmt.Println("Usage: cleanup run [--days N] [--folders a,b] [--config config.yml] [flags]")
+	fmt.Println("       cleanup run [flags] [days|config.yml] [folder1 folder2 ...]")
+	fmt.Println("       cleanup lint [flags] [days|config.yml] [folder1 folder2 ...]")
+	fmt.Println("       cleanup estimate [flags] [days|config.yml] [folder1 folder2 ...]")
+	fmt.Println("       cleanup plan --compare old.yml new.yml [flags]")
+	fmt.Println("       cleanup recoverable [--file pattern] [flags] [days|config.yml] [folder1 folder2 ...]")
+	fmt.Println("       cleanup restore [--config config.yml] [--dry-run] [flags] <folder|file> ...")
+	fmt.Println("       cleanup forecast [--threshold 90] [flags] [days|config.yml] [folder1 folder2 ...]")
+	fmt.Println("       cleanup digest [--digest-period day|week] [--digest-webhook URL] [flags]")
+	fmt.Println("       cleanup history export [--format csv|parquet] [--since 2024-01-01] [-o file] [flags]")
+	fmt.Println("       cleanup plans diff [--threshold 20] [--from plans-dir,... | --collect-url URL] [flags]")
+	fmt.Println("       cleanup init [-o config.yml] [--force]")
+	fmt.Println("       cleanup serve --api-listen :8443 --api-tls-cert cert.pem --api-tls-key key.pem [flags]")
+	fmt.Println("       cleanup status --api-listen :8443 [--stacks] [flags]")
+	fmt.Println("       cleanup approve --api-listen :8443 [--plan-id ID] [flags]")
+	fmt.Println("       cleanup collect --api-listen :8443 --api-token TOKEN [--collect-store reports.jsonl] [flags]")
+	fmt.Println("       cleanup config migrate config.yml")
+	fmt.Println("       cleanup config embedded")
+	fs.SetOutput(os.Stdout)
+	fs.PrintDefaults()
+}
+
+// runCleanup реализует подкоманду run — основной режим очистки.
+// Возвращает код завершения программы.
+func runCleanup(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("run", args)
+	if opts.help {
+		printRunHelp(fs)
+		return 0
+	}
+	if err != nil {
+		log.Printf("[%s] %v\n", CodeConfig, err)
+		return exitFailed
+	}
+	return executeRun(cfg)
+}
+
+// missingFolders возвращает папки, которые не существуют или не являются директориями.
+func missingFolders(folders []string) []string {
+	var missing []string
+	for _, folder := range folders {
+		if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+			missing = append(missing, folder)
+		}
+	}
+	return missing
+}
+
+// errMissingParams сообщает, что не заданы количество дней или список папок.
+var errMissingParams = errors.New("Не заданы необходимые параметры. Требуется указать количество дней (целое число, 0 означает удаление файлов старше самого свежего файла) и список папок для очистки.")
+
+// Коды завершения запуска для cron, systemd и мониторинга. Если подходят
+// несколько, возвращается первый по порядку: 1, 3, 2, 4.
+const (
+	exitOK = 0
+	// exitFailed — ошибка конфигурации или очистка не выполнялась либо
+	// остановлена (обязательная папка, канарейка).
+	exitFailed = 1
+	// exitPartial — часть папок или файлов не обработана из-за ошибок,
+	// в том числе отказа в доступе.
+	exitPartial = 2
+	// exitNothingProcessed — ни одна папка не обработана: все не найдены
+	// или завершились ошибкой.
+	exitNothingProcessed = 3
+	// exitStopped — запуск остановлен по --max-duration или удаление
+	// отложено из-за обслуживания системы, не все файлы обработаны.
+	exitStopped = 4
+)
+
+// executeRun выполняет очистку по итоговой конфигурации
+// и возвращает код завершения программы.
+func executeRun(cfg Config) int {
+	summary, err := performRun(cfg)
+	code := exitFailed
+	if err != nil {
+		log.Printf("[%s] %v\n", errorCode(err, CodeConfig), err)
+	} else {
+		code = summary.exitCode()
+	}
+	if cfg.Output == outputJSON {
+		if err := writeRunOutput(os.Stdout, summary, err, code); err != nil {
+			log.Printf("Ошибка вывода итогов: %v\n", err)
+		}
+	}
+	return code
+}
+
+// exitCode возвращает код завершения выполненного запуска: если не
+// обработана ни одна папка — 3, даже если были и частичные сбои.
+func (s RunSummary) exitCode() int {
+	processed := 0
+	for _, f := range s.Folders {
+		if f.Err == nil {
+			processed++
+		}
+	}
+	switch {
+	case processed == 0 && (len(s.Folders) > 0 || len(s.Missing) > 0):
+		return exitNothingProcessed
+	case s.FailedFolders() > 0 || s.Errors > 0 || s.PermissionDenied() > 0:
+		return exitPartial
+	case s.StoppedAt != "" || s.Deferred != "":
+		return exitStopped
+	}
+	return exitOK
+}
+
+// performRun выполняет очистку, выводит итоги и отправляет их во внешние
+// системы. Ошибка возвращается, если очистка не выполнялась.
+func performRun(cfg Config) (RunSummary, error) {
+	gf := cfg.Grafana
+
+	if cfg.Days < 0 || len(cfg.Folders) == 0 {
+		return RunSummary{}, errMissingParams
+	}
+	switch cfg.FuturePolicy {
+	case futureKeep, futureReset, futureDelete:
+	default:
+		return RunSummary{}, fmt.Errorf("неизвестная политика для файлов из будущего %q (допустимы keep, reset, delete)", cfg.FuturePolicy)
+	}
+	if err := validateAnchor(cfg.Anchor); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateOutput(cfg.Output); err != nil {
+		return RunSummary{}, err
+	}
+	if _, err := parseAsOf(cfg.AsOf); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validatePlanUpload(cfg); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateThrottle(cfg.Concurrency, cfg.RateLimit, cfg.IOPriority); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validatePatterns("exclude", cfg.Exclude); err != nil {
+		return RunSummary{}, err
+	}
+	if _, err := compileFilters("filters", cfg.Filters); err != nil {
+		return RunSummary{}, err
+	}
+	if _, err := compileRegexps("include_regex", cfg.IncludeRegex); err != nil {
+		return RunSummary{}, err
+	}
+	if _, err := compileRegexps("exclude_regex", cfg.ExcludeRegex); err != nil {
+		return RunSummary{}, err
+	}
+	protect, err := loadProtection(cfg.Protect)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	protection = protect
+	if err := validateLocked(cfg.LockedFiles); err != nil {
+		return RunSummary{}, err
+	}
+	lockedRetry = cfg.LockedFiles
+	if err := validateRetry(cfg.Retry); err != nil {
+		return RunSummary{}, err
+	}
+	ioRetry = cfg.Retry
+	if err := validateMaxDelete(cfg.MaxDelete, cfg.MaxDeleteMode); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateMaxDeleteTotal(cfg.MaxDeleteTotal); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateMaxDeletePercent(cfg.MaxDeletePercent); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateLowMemory(cfg.LowMemory, cfg.MaxDuration); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateQueue(cfg.Queue); err != nil {
+		return RunSummary{}, err
+	}
+	if err := validateMaintenance(cfg.Maintenance); err != nil {
+		return RunSummary{}, err
+	}
+	vars := newReportVars(time.Now(), cfg.instanceID())
+	logFile, err := expandReportPath(cfg.LogFile, vars)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	eventsFile, err := expandReportPath(cfg.EventsFile, vars)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	closeEvents, err := configureEvents(cfg.Show, cfg.LogLevel, cfg.Verbose, eventsFile)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	defer closeEvents()
+	if cfg.CloudWatch.LogGroup != "" {
+		events.capture(cloudWatchMaxEvents)
+	}
+	for _, warning := range cfg.discoverWarnings {
+		events.emit(EventWarning, "", "", "%s", warning)
+	}
+
+	// Папки обрабатываются в порядке путей, а файлы в папке — в порядке имён,
+	// чтобы при одинаковых входных данных запуски были воспроизводимы.
+	specs, err := dedupeFolders(cfg, canariesFirst(sortedFolderSpecs(cfg.Folders)))
+	if err != nil {
+		return RunSummary{}, fmt.Errorf("Очистка не выполнялась: %v", err)
+	}
+	folders := folderPaths(specs)
+	watchProgressSignal()
+	startUsage, measured := processUsage()
+	progress.beginRun(len(specs))
+	defer progress.endRun()
+
+	// Проверяем папки до начала очистки: отсутствующая папка чаще всего
+	// означает опечатку в конфигурации или отключённый сетевой ресурс.
+	missing := missingFolders(folders)
+	if len(missing) > 0 && cfg.FailFastMissing {
+		return RunSummary{Missing: missing}, withCode(CodeFolderMissing, fmt.Errorf("Очистка не выполнялась: не найдены папки %s (--fail-fast-missing)", strings.Join(missing, ", ")))
+	}
+	for _, spec := range specs {
+		rule := cfg.folderRule(spec)
+		if err := validateRecursive(rule); err != nil {
+			return RunSummary{Missing: missing}, fmt.Errorf("папка %s: %v", spec.Path, err)
+		}
+		if err := validateFreeSpace(rule, cfg.LowMemory); err != nil {
+			return RunSummary{Missing: missing}, fmt.Errorf("папка %s: %v", spec.Path, err)
+		}
+		if err := validateAction(rule); err != nil {
+			return RunSummary{Missing: missing}, fmt.Errorf("папка %s: %v", spec.Path, err)
+		}
+		if err := validateDirUnit(rule); err != nil {
+			return RunSummary{Missing: missing}, fmt.Errorf("папка %s: %v", spec.Path, err)
+		}
+		if slices.Contains(missing, spec.Path) && rule.Required {
+			return RunSummary{Missing: missing}, withCode(CodeFolderMissing, fmt.Errorf("Очистка не выполнялась: не найдена обязательная папка %s", spec.Path))
+		}
+	}
+
+	// Теневая копия — страховка на случай ошибки в конфигурации:
+	// без неё удаление не начинается.
+	if cfg.VSS.Enabled && !cfg.DryRun {
+		if err := snapshotVolumes(cfg.VSS, folders); err != nil {
+			return RunSummary{Missing: missing}, withCode(CodeSnapshotFailed, fmt.Errorf("Очистка не выполнялась: %v", err))
+		}
+	}
+
+	summary := RunSummary{Start: time.Now(), Instance: cfg.instanceID(), DryRun: cfg.DryRun, RunID: vars.RunID, Missing: missing}
+	if err := openQueue(cfg.Queue, summary.RunID); err != nil {
+		return RunSummary{Missing: missing}, withCode(CodeQueueFailed, err)
+	}
+
+	if gf.URL != "" && !cfg.scan {
+		if err := annotateRunStart(gf, summary.Start, folders); err != nil {
+			events.emitCode(EventError, CodeNotifyFailed, "", "", "Ошибка публикации аннотации в Grafana: %v", err)
+		}
+	}
+
+	// Папки, которые cleanup раньше не очищал, без --first-run-confirm
+	// обрабатываются пробно: ошибка в сроках хранения при первом запуске
+	// обходится дороже всего.
+	statePath, err := folderStatePath()
+	state := make(map[string]folderState)
+	stateMissing := false
+	if err == nil {
+		_, statErr := os.Stat(statePath)
+		stateMissing = os.IsNotExist(statErr)
+		if state, err = loadFolderState(statePath); err != nil {
+			events.emit(EventWarning, "", "", "Ошибка чтения состояния папок: %v", err)
+		}
+	}
+	known := cfg.knownFolders(state)
+	// Обновление с версии без файла состояния: папки, которые она очищала,
+	// не должны молча перейти в пробный режим.
+	if stateMissing && len(known) == 0 && loggedRuns(cfg.LogFile) {
+		for _, spec := range specs {
+			known[folderKey(spec.Path)] = true
+		}
+		events.emit(EventWarning, "", "", "Файл состояния папок %s не найден, но в журнале %s есть прошлые запуски: папки конфигурации считаются уже очищавшимися", statePath, cfg.LogFile)
+	}
+	changed := make(map[string]folderState)
+
+	var failedRequired []string
+	opts := processOptions{LowMemory: cfg.LowMemory, DryRun: cfg.DryRun, FuturePolicy: cfg.FuturePolicy, S3: cfg.S3, Approved: cfg.approved,
+		RunBudget: newRunBudget(cfg.MaxDeleteTotal)}
+	if !cfg.DryRun {
+		work, err := openRunWorkDir(cfg.WorkDir, summary.RunID)
+		if err != nil {
+			events.emit(EventWarning, "", "", "Каталог промежуточных файлов недоступен, они создаются рядом с результатом: %v", err)
+		}
+		defer work.close()
+		opts.Work = work
+	}
+	if cfg.MaxDuration > 0 {
+		opts.Deadline = summary.Start.Add(cfg.MaxDuration)
+	}
+	// Во время обслуживания системы удаление откладывается: ожидание его
+	// окончания ограничено maintenance.wait на весь запуск.
+	var maintenanceUntil time.Time
+	if cfg.Maintenance.enabled() && !cfg.DryRun {
+		maintenanceUntil = time.Now().Add(cfg.Maintenance.Wait)
+		if !opts.Deadline.IsZero() && opts.Deadline.Before(maintenanceUntil) {
+			maintenanceUntil = opts.Deadline
+		}
+	}
+	// С --fair-share каждая папка получает долю оставшегося времени, а папки,
+	// не успевшие её за свою долю, обрабатываются следующими кругами.
+	fair := cfg.FairShare && !opts.Deadline.IsZero()
+	var unfinished []fairFolder
+	for i, spec := range specs {
+		folder := spec.Path
+		if summary.StoppedAt != "" || summary.CanaryFailed != "" {
+			break
+		}
+		if cfg.only != nil && !cfg.only[folder] {
+			continue
+		}
+		if opts.expired() {
+			summary.StoppedAt = folder
+			events.emit(EventWarning, folder, "", "Время запуска исчерпано, папка %s и следующие не обработаны", folder)
+			break
+		}
+		if slices.Contains(missing, folder) {
+			events.emitCode(EventWarning, CodeFolderMissing, folder, "", "Папка '%s' не найдена или не является директорией, пропускаем", folder)
+			if spec.isCanary() {
+				summary.CanaryFailed = folder
+				events.emitCode(EventError, CodeFolderMissing, folder, "", "Папка-канарейка %s не найдена, остальные папки не обрабатываются", folder)
+			}
+			continue
+		}
+		rule := cfg.folderRule(spec)
+		// Новая папка с backfill очищается по шагам: пока шаги не пройдены,
+		// файлы хранятся не меньше срока текущего шага.
+		step := backfillStep(rule, state[folderKey(folder)], known[folderKey(folder)])
+		if step >= 0 {
+			rule.BackfillDays = rule.Backfill[step]
+			events.emit(EventDecision, folder, "", "Папка %s: постепенная очистка, шаг %d из %d: срок хранения не меньше %d дней",
+				folder, step+1, len(rule.Backfill), rule.BackfillDays)
+		}
+		if !maintenanceUntil.IsZero() && summary.Deferred == "" {
+			if reason, busy := cfg.Maintenance.await(folder, maintenanceUntil); busy {
+				summary.Deferred = reason
+				events.emit(EventWarning, folder, "", "Идёт обслуживание системы (%s): удаление отложено, папка %s и следующие обрабатываются пробно", reason, folder)
+			}
+		}
+		folderOpts := opts
+		firstRun := !known[folderKey(folder)] && !cfg.FirstRunConfirm && !cfg.DryRun && summary.Deferred == ""
+		folderOpts.DryRun = opts.DryRun || firstRun || summary.Deferred != ""
+		folderOpts.Nested = nestedFolders(folder, specs)
+		if fair && !spec.isCanary() {
+			folderOpts.Deadline, folderOpts.Slice = fairDeadline(opts.Deadline, len(specs)-i), true
+		}
+		res, err := processFolder(folder, rule, folderOpts)
+		progress.folderDone()
+		res.FirstRun = firstRun
+		if firstRun && err == nil {
+			events.emit(EventWarning, folder, "", "Папка %s очищается впервые: файлы не удалены, к удалению %d файлов (%s). Проверьте настройки и запустите с --first-run-confirm",
+				folder, res.Planned, formatBytes(res.PlannedFreed))
+		}
+		if err == nil && !folderOpts.DryRun {
+			key := folderKey(folder)
+			st := state[key]
+			if st.FirstRun.IsZero() {
+				st.FirstRun = summary.Start
+			}
+			st.LastRun = summary.Start
+			// Шаг засчитывается, только если папка обработана целиком.
+			if step >= 0 && res.StoppedAt == "" {
+				st.BackfillStep = step + 1
+			}
+			state[key] = st
+			changed[key] = st
+		}
+		res.Err = err
+		res.BestEffort = rule.BestEffort
+		if res.PermissionDenied > 0 {
+			res.PermissionHint = permissionHint(folder)
+			events.emitCode(EventError, CodeAccessDenied, folder, "", "Папка %s: отказано в доступе к файлам: %d; %s", folder, res.PermissionDenied, res.PermissionHint)
+		}
+		summary.Folders = append(summary.Folders, res)
+		if folderOpts.Slice && res.StoppedAt != "" && !opts.expired() {
+			unfinished = append(unfinished, fairFolder{index: len(summary.Folders) - 1, rule: rule, opts: folderOpts})
+		} else {
+			summary.StoppedAt = res.StoppedAt
+		}
+		if spec.isCanary() {
+			if err := spec.Canary.verify(res); err != nil {
+				summary.CanaryFailed = folder
+				events.emitCode(EventError, CodeCanaryFailed, folder, "", "Проверка папки-канарейки %s не пройдена: %v; остальные папки не обрабатываются", folder, err)
+			} else {
+				events.emit(EventDecision, folder, "", "Проверка папки-канарейки %s пройдена", folder)
+			}
+		}
+		if err != nil {
+			if rule.BestEffort {
+				events.emitCode(EventWarning, folderErrorCode(err), folder, "", "Ошибка обработки папки '%s' (best_effort): %v", folder, err)
+			} else {
+				events.emitCode(EventError, folderErrorCode(err), folder, "", "Ошибка обработки папки '%s': %v", folder, err)
+			}
+			if rule.Required {
+				failedRequired = append(failedRequired, folder)
+			}
+		}
+	}
+	// Во время обслуживания следующие круги не начинаются.
+	if summary.CanaryFailed == "" && summary.Deferred == "" {
+		summary.StoppedAt = fairRounds(summary.Folders, unfinished, opts, summary.StoppedAt)
+	}
+	// Сообщения публикуются до итогов: сервисы-потребители узнают об
+	// убранных файлах как можно раньше.
+	affected.flush()
+	summary.addFolderTotals()
+	if len(changed) == 0 {
+		// Пробный запуск не создаёт файл состояния: иначе после обновления
+		// следующий запуск уже не распознал бы папки из журнала.
+	} else if statePath == "" {
+		events.emit(EventWarning, "", "", "Состояние папок не сохранено: не удалось определить каталог состояния")
+	} else if err := updateFolderState(statePath, changed); err != nil {
+		events.emitCode(EventError, CodeStateWrite, "", "", "Ошибка записи состояния папок %s: %v", statePath, err)
+	}
+	summary.Duration = time.Since(summary.Start)
+	if end, ok := processUsage(); ok && measured {
+		usage := end.sub(startUsage)
+		summary.Resources = &usage
+	}
+	// Сканирование для плана serve с scan_only итогов не выводит и никуда
+	// их не отправляет: его результат — сам план.
+	if cfg.scan {
+		return summary, nil
+	}
+
+	// С --output json стандартный вывод занят сводкой, таблица выводится в stderr.
+	table := os.Stdout
+	if cfg.Output == outputJSON {
+		table = os.Stderr
+	}
+	printSummaryTable(table, summary, useColor(cfg.Color, table))
+
+	notifyAll(cfg, summary)
+
+	if gf.URL != "" {
+		if err := annotateRunFinish(gf, summary, folders); err != nil {
+			events.emitCode(EventError, CodeNotifyFailed, "", "", "Ошибка публикации аннотации в Grafana: %v", err)
+		} else {
+			events.emit(EventAction, "", "", "Аннотации о запуске опубликованы в Grafana")
+		}
+	}
+
+	if cfg.HistoryFile != "-" {
+		if path, err := cfg.historyPath(); err != nil {
+			events.emitCode(EventError, CodeReportWrite, "", "", "Ошибка записи истории запусков: %v", err)
+		} else if err := appendHistory(path, newRunRecord(summary, false)); err != nil {
+			events.emitCode(EventError, CodeReportWrite, "", "", "Ошибка записи истории запусков %s: %v", path, err)
+		}
+	}
+
+	if path, err := writeLog(logFile, summary); err != nil {
+		events.emitCode(EventError, CodeReportWrite, "", "", "Ошибка записи лога: %v", err)
+	} else {
+		events.emit(EventAction, "", "", "Результаты работы записаны в %s", path)
+	}
+	if cfg.ReportRetention > 0 && !cfg.DryRun {
+		for _, p := range [][2]string{{cfg.LogFile, logFile}, {cfg.EventsFile, eventsFile}} {
+			removed, err := pruneReports(p[0], p[1], vars, cfg.ReportRetention, summary.Start)
+			for _, path := range removed {
+				events.emit(EventAction, "", path, "Удалён старый отчёт %s", path)
+			}
+			if err != nil {
+				events.emitCode(EventError, CodeReportWrite, "", "", "Ошибка удаления старых отчётов %s: %v", p[0], err)
+			}
+		}
+	}
+	if summary.CanaryFailed != "" {
+		return summary, withCode(CodeCanaryFailed, fmt.Errorf("Очистка остановлена: проверка папки-канарейки %s не пройдена", summary.CanaryFailed))
+	}
+	if len(failedRequired) > 0 {
+		return summary, withCode(CodeRequiredFailed, fmt.Errorf("Ошибка обработки обязательных папок: %s", strings.Join(failedRequired, ", ")))
+	}
+	return summary, nil
+}
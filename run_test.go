@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunSummaryExitCode(t *testing.T) {
+	failed := errors.New("ошибка чтения папки")
+	tests := []struct {
+		name    string
+		summary RunSummary
+		want    int
+	}{
+		{"пустой запуск", RunSummary{}, exitOK},
+		{"папки обработаны", RunSummary{Folders: []FolderResult{{Folder: "/a"}, {Folder: "/b"}}}, exitOK},
+		{"все папки не найдены", RunSummary{Missing: []string{"/a"}}, exitNothingProcessed},
+		{"все папки с ошибкой", RunSummary{Folders: []FolderResult{{Folder: "/a", Err: failed}}}, exitNothingProcessed},
+		{"ни одной папки и частичные сбои", RunSummary{Folders: []FolderResult{{Folder: "/a", Err: failed}}, Errors: 3}, exitNothingProcessed},
+		{"ни одной папки best_effort", RunSummary{Folders: []FolderResult{{Folder: "/a", Err: failed, BestEffort: true}}}, exitNothingProcessed},
+		{"часть папок с ошибкой", RunSummary{Folders: []FolderResult{{Folder: "/a"}, {Folder: "/b", Err: failed}}}, exitPartial},
+		{"ошибка папки best_effort", RunSummary{Folders: []FolderResult{{Folder: "/a"}, {Folder: "/b", Err: failed, BestEffort: true}}}, exitOK},
+		{"ошибки файлов", RunSummary{Folders: []FolderResult{{Folder: "/a"}}, Errors: 1}, exitPartial},
+		{"отказ в доступе", RunSummary{Folders: []FolderResult{{Folder: "/a", PermissionDenied: 2}}}, exitPartial},
+		{"часть папок не найдена", RunSummary{Folders: []FolderResult{{Folder: "/a"}}, Missing: []string{"/b"}}, exitOK},
+		{"остановлен по времени", RunSummary{Folders: []FolderResult{{Folder: "/a"}}, StoppedAt: "/a/f"}, exitStopped},
+		{"отложен обслуживанием", RunSummary{Folders: []FolderResult{{Folder: "/a"}}, Deferred: "/run/backup.lock"}, exitStopped},
+		{"сбой важнее остановки", RunSummary{Folders: []FolderResult{{Folder: "/a"}}, Errors: 1, StoppedAt: "/a/f"}, exitPartial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.summary.exitCode(); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFlagsAfterPositional(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.log")
+	for _, name := range []string{old, filepath.Join(dir, "new.log")} {
+		if err := os.WriteFile(name, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().AddDate(0, 0, -100)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+	// --first-run-confirm до позиционных аргументов снимает пробный первый
+	// запуск, поэтому без --dry-run старый файл был бы удалён.
+	args := []string{"--first-run-confirm", "30", dir + "?time_fields=mtime", "--dry-run"}
+	if code := runCleanup(args); code != exitOK {
+		t.Fatalf("runCleanup() = %d, want %d", code, exitOK)
+	}
+	if _, err := os.Stat(old); err != nil {
+		t.Errorf("файл удалён при --dry-run после позиционных аргументов: %v", err)
+	}
+}
+
+func TestParseFlagsPositional(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		dryRun     bool
+		err        bool
+	}{
+		{name: "флаг перед аргументами", args: []string{"--dry-run", "30", "/tmp"}, positional: []string{"30", "/tmp"}, dryRun: true},
+		{name: "флаг после аргументов", args: []string{"30", "/tmp", "--dry-run"}, positional: []string{"30", "/tmp"}, dryRun: true},
+		{name: "флаг между аргументами", args: []string{"30", "--dry-run", "/tmp"}, positional: []string{"30", "/tmp"}, dryRun: true},
+		{name: "после --", args: []string{"30", "--", "--dry-run"}, positional: []string{"30", "--dry-run"}},
+		{name: "одиночный минус", args: []string{"30", "-", "/tmp"}, err: true},
+		{name: "неизвестный флаг после аргументов", args: []string{"30", "/tmp", "--dry"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts runOptions
+			cfg := defaultConfig()
+			fs := flag.NewFlagSet("run", flag.ContinueOnError)
+			bindRunFlags(fs, &opts, &cfg)
+			positional, err := parseFlags(fs, tt.args, &opts.help)
+			if (err != nil) != tt.err {
+				t.Fatalf("ошибка %v, want %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			if !slices.Equal(positional, tt.positional) || cfg.DryRun != tt.dryRun {
+				t.Errorf("аргументы %q, dry-run %v; want %q, %v", positional, cfg.DryRun, tt.positional, tt.dryRun)
+			}
+		})
+	}
+}
+
+func TestRunSummaryFolderTotals(t *testing.T) {
+	summary := RunSummary{Folders: []FolderResult{
+		{Folder: "/a", Total: 10, Deleted: 4, Skipped: 6, Freed: 400},
+		// Папка прервана ошибкой после части удалений.
+		{Folder: "/b", Total: 5, Deleted: 2, Skipped: 1, Errors: 1, Freed: 200, Err: errors.New("ошибка чтения папки")},
+	}}
+	summary.addFolderTotals()
+	if summary.Total != 15 || summary.Deleted != 6 || summary.Skipped != 7 || summary.Errors != 1 || summary.Freed != 600 {
+		t.Errorf("итоги: найдено %d, удалено %d, оставлено %d, ошибок %d, освобождено %d; want 15, 6, 7, 1, 600",
+			summary.Total, summary.Deleted, summary.Skipped, summary.Errors, summary.Freed)
+	}
+}
+
+func TestPlainEnvDatadogOptIn(t *testing.T) {
+	t.Setenv("DD_API_KEY", "secret")
+	tests := []struct {
+		name string
+		api  bool
+		key  string
+	}{
+		{"только переменная окружения", false, ""},
+		{"явное включение API", true, "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Datadog.API = tt.api
+			if err := applyPlainEnv(&cfg, map[string]bool{}); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Datadog.APIKey != tt.key {
+				t.Errorf("APIKey = %q, want %q", cfg.Datadog.APIKey, tt.key)
+			}
+		})
+	}
+}
+
+func TestSummaryRowsBestEffort(t *testing.T) {
+	failed := errors.New("ошибка чтения папки")
+	summary := RunSummary{Folders: []FolderResult{
+		{Folder: "/a", Err: failed},
+		{Folder: "/b", Err: failed, BestEffort: true},
+	}}
+	rows := summaryRows(summary)
+	if got := rows[len(rows)-1].cells[5]; got != "1" {
+		t.Errorf("ошибок в итоге %s, want 1: папка best_effort не считается сбоем", got)
+	}
+	if row := rows[2]; row.cells[5] != "0" || row.color != ansiYellow {
+		t.Errorf("строка best_effort: ошибок %s, цвет %q; want 0, жёлтый", row.cells[5], row.color)
+	}
+}
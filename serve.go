@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIOptions описывает параметры HTTP API для запуска очистки по запросу.
+// Запрос на запуск фактически означает удалённое удаление файлов, поэтому
+// сервер не запускается без аутентификации (токен и/или клиентский сертификат).
+type APIOptions struct {
+	Listen      string        `yaml:"listen"`       // адрес, например :8443
+	TLSCert     string        `yaml:"tls_cert"`     // PEM файл сертификата сервера
+	TLSKey      string        `yaml:"tls_key"`      // PEM файл ключа сервера
+	ClientCA    string        `yaml:"client_ca"`    // PEM файл CA для проверки клиентских сертификатов
+	Token       string        `yaml:"token"`        // bearer-токен
+	MinInterval time.Duration `yaml:"min_interval"` // минимальный интервал между запросами одного клиента
+	QueueSize   int           `yaml:"queue_size"`   // сколько запросов может ожидать текущего запуска
+	AuditLog    string        `yaml:"audit_log"`    // журнал запусков по запросам API (JSON Lines)
+	// ScanOnly — только поддерживать план: удаление выполняется после его
+	// утверждения (POST /api/v1/plan/approve, cleanup approve). Изменившиеся
+	// папки пересканируются каждые ScanInterval, все — каждые FullScanInterval.
+	ScanOnly         bool          `yaml:"scan_only"`
+	ScanInterval     time.Duration `yaml:"scan_interval"`
+	FullScanInterval time.Duration `yaml:"full_scan_interval"`
+}
+
+// apiAuditRecord — запись журнала аудита о запросе на запуск.
+type apiAuditRecord struct {
+	Time    time.Time `json:"time"`
+	Caller  string    `json:"caller"`
+	Remote  string    `json:"remote"`
+	Status  int       `json:"status"`
+	Total   int       `json:"total"`
+	Deleted int       `json:"deleted"`
+	Freed   int64     `json:"freed_bytes"`
+	Error   string    `json:"error,omitempty"`
+	Code    ErrorCode `json:"code,omitempty"`
+	Plan    string    `json:"plan,omitempty"` // утверждённый план (scan_only)
+}
+
+// apiServer выполняет запуски по запросам API: ограничивает частоту запросов
+// каждого клиента и выполняет запуски по очереди, не допуская их наложения.
+type apiServer struct {
+	cfg   Config
+	queue chan struct{} // места в очереди, включая выполняемый запуск
+	run   sync.Mutex    // удерживается на время запуска
+
+	// Режим scan_only: итоги сканирования папок и их отпечатки (под run),
+	// запрос внепланового сканирования.
+	scanned map[string]FolderResult
+	prints  map[string]string
+	rescan  chan struct{}
+
+	mu   sync.Mutex
+	last map[string]time.Time // время последнего принятого запроса клиента
+	plan *pendingPlan         // план, ожидающий утверждения (scan_only)
+}
+
+// newAPIServer создаёт apiServer по конфигурации.
+func newAPIServer(cfg Config) *apiServer {
+	return &apiServer{
+		cfg:     cfg,
+		queue:   make(chan struct{}, max(cfg.API.QueueSize, 0)+1),
+		scanned: make(map[string]FolderResult),
+		prints:  make(map[string]string),
+		rescan:  make(chan struct{}, 1),
+		last:    make(map[string]time.Time),
+	}
+}
+
+// allow сообщает, можно ли принять запрос клиента, и сколько ждать в противном случае.
+func (s *apiServer) allow(caller string, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.last[caller]; ok {
+		if wait := s.cfg.API.MinInterval - now.Sub(last); wait > 0 {
+			return false, wait
+		}
+	}
+	s.last[caller] = now
+	return true, 0
+}
+
+// audit дописывает запись в журнал аудита.
+func (s *apiServer) audit(rec apiAuditRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Ошибка записи журнала аудита: %v\n", err)
+		return
+	}
+	if _, err := appendLog(s.cfg.API.AuditLog, append(data, '\n')); err != nil {
+		log.Printf("Ошибка записи журнала аудита: %v\n", err)
+	}
+}
+
+// validateAPIOptions проверяет, что API защищено: требуется токен или
+// клиентский сертификат, а вне loopback-интерфейса — TLS.
+func validateAPIOptions(opts APIOptions) error {
+	if opts.Listen == "" {
+		return errors.New("не задан адрес API (--api-listen)")
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return errors.New("сертификат и ключ сервера задаются вместе (--api-tls-cert, --api-tls-key)")
+	}
+	useTLS := opts.TLSCert != ""
+	if opts.Token == "" && opts.ClientCA == "" {
+		return errors.New("API без аутентификации не запускается: задайте --api-token или --api-client-ca")
+	}
+	if opts.ClientCA != "" && !useTLS {
+		return errors.New("проверка клиентских сертификатов требует TLS (--api-tls-cert, --api-tls-key)")
+	}
+	if !useTLS && !isLoopbackAddr(opts.Listen) {
+		return fmt.Errorf("API на %s без TLS не запускается: задайте --api-tls-cert и --api-tls-key", opts.Listen)
+	}
+	return nil
+}
+
+// isLoopbackAddr сообщает, слушает ли адрес только loopback-интерфейс.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiTLSConfig строит серверную конфигурацию TLS; при заданном ClientCA
+// клиентский сертификат обязателен и проверяется.
+func apiTLSConfig(opts APIOptions) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if opts.ClientCA != "" {
+		pem, err := os.ReadFile(opts.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в %s нет сертификатов PEM", opts.ClientCA)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// apiCaller проверяет аутентификацию запроса и возвращает имя вызывающего:
+// CN клиентского сертификата или «token», если использован только токен.
+func apiCaller(opts APIOptions, r *http.Request) (string, bool) {
+	if opts.Token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(opts.Token)) != 1 {
+			return "", false
+		}
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName, true
+	}
+	return "token", opts.Token != ""
+}
+
+// apiError — ответ API об ошибке: сообщение и его код.
+type apiError struct {
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code"`
+}
+
+// apiStatus возвращает код ответа HTTP для ошибки запуска по запросу API.
+func apiStatus(code ErrorCode) int {
+	switch code {
+	case CodeBadRequest:
+		return http.StatusBadRequest
+	case CodeNoPlan:
+		return http.StatusNotFound
+	case CodeApprovalRequired, CodePlanStale:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON отправляет ответ API в формате JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serveRun выполняет запуск по запросу API: проверяет аутентификацию,
+// частоту запросов и место в очереди, выполняет run, не допуская
+// наложения запусков, и записывает результат в журнал аудита.
+func (s *apiServer) serveRun(w http.ResponseWriter, r *http.Request, run func(rec *apiAuditRecord) (RunSummary, error)) {
+	caller, ok := apiCaller(s.cfg.API, r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "требуется аутентификация", Code: CodeUnauthorized})
+		return
+	}
+	rec := apiAuditRecord{Time: time.Now(), Caller: caller, Remote: r.RemoteAddr}
+	reject := func(status int, code ErrorCode, msg string) {
+		rec.Status, rec.Error, rec.Code = status, msg, code
+		s.audit(rec)
+		writeJSON(w, status, apiError{Error: msg, Code: code})
+	}
+	if ok, wait := s.allow(caller, rec.Time); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		reject(http.StatusTooManyRequests, CodeRateLimited, fmt.Sprintf("слишком частые запросы, повторите через %s", wait.Round(time.Second)))
+		return
+	}
+	select {
+	case s.queue <- struct{}{}:
+		defer func() { <-s.queue }()
+	default:
+		reject(http.StatusServiceUnavailable, CodeQueueFull, "очередь запусков заполнена")
+		return
+	}
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	summary, err := run(&rec)
+	if err != nil {
+		code := errorCode(err, CodeConfig)
+		reject(apiStatus(code), code, err.Error())
+		return
+	}
+	rec.Status, rec.Total, rec.Deleted, rec.Freed = http.StatusOK, summary.Total, summary.Deleted, summary.Freed
+	s.audit(rec)
+	writeJSON(w, http.StatusOK, newRunRecord(summary, false))
+}
+
+// apiHandler возвращает обработчик HTTP API:
+// GET /healthz — проверка доступности, POST /api/v1/runs — запуск очистки,
+// GET /api/v1/status — ход текущего запуска (?stacks=1 — со стеками горутин),
+// GET /api/v1/plan и POST /api/v1/plan/approve — план, ожидающий
+// утверждения, и его выполнение (scan_only).
+func apiHandler(s *apiServer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := apiCaller(s.cfg.API, r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "требуется аутентификация", Code: CodeUnauthorized})
+			return
+		}
+		writeJSON(w, http.StatusOK, progress.snapshot(r.URL.Query().Get("stacks") == "1"))
+	})
+	mux.HandleFunc("POST /api/v1/runs", func(w http.ResponseWriter, r *http.Request) {
+		s.serveRun(w, r, func(rec *apiAuditRecord) (RunSummary, error) {
+			if s.cfg.API.ScanOnly {
+				return RunSummary{}, withCode(CodeApprovalRequired, errors.New("сервер в режиме scan_only: удаление выполняется только по утверждённому плану (POST /api/v1/plan/approve)"))
+			}
+			log.Printf("Запуск очистки по запросу API от %s (%s)\n", rec.Caller, rec.Remote)
+			return performRun(s.cfg)
+		})
+	})
+	mux.HandleFunc("GET /api/v1/plan", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := apiCaller(s.cfg.API, r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{Error: "требуется аутентификация", Code: CodeUnauthorized})
+			return
+		}
+		switch plan := s.pendingPlan(); {
+		case !s.cfg.API.ScanOnly:
+			writeJSON(w, http.StatusNotFound, apiError{Error: "сервер не в режиме scan_only: планов, ожидающих утверждения, нет", Code: CodeNoPlan})
+		case plan == nil:
+			writeJSON(w, http.StatusNotFound, apiError{Error: "план ещё не построен: идёт первое сканирование", Code: CodeNoPlan})
+		default:
+			writeJSON(w, http.StatusOK, plan)
+		}
+	})
+	mux.HandleFunc("POST /api/v1/plan/approve", func(w http.ResponseWriter, r *http.Request) {
+		s.serveRun(w, r, func(rec *apiAuditRecord) (RunSummary, error) {
+			var req struct {
+				ID string `json:"id"`
+			}
+			if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil || req.ID == "" {
+				return RunSummary{}, withCode(CodeBadRequest, errors.New(`в теле запроса нужен идентификатор плана: {"id": "..."}`))
+			}
+			return s.approve(rec, req.ID)
+		})
+	})
+	return mux
+}
+
+// runServe реализует подкоманду serve: HTTP API, запускающее очистку
+// по конфигурации, заданной теми же флагами и файлом, что и для run.
+func runServe(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("serve", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup serve [flags] [config.yml]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if cfg.Days < 0 || len(cfg.Folders) == 0 {
+		log.Print(errMissingParams)
+		return 1
+	}
+	if err := validateAPIOptions(cfg.API); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := validateScanOnly(cfg); err != nil {
+		log.Print(err)
+		return 1
+	}
+	api := newAPIServer(cfg)
+	if cfg.API.ScanOnly {
+		log.Printf("Режим scan_only: удаление только по утверждённому плану (сканирование каждые %s, всех папок — каждые %s)\n",
+			cfg.API.ScanInterval, cfg.API.FullScanInterval)
+		go api.scanLoop()
+	}
+	srv := &http.Server{
+		Addr:              cfg.API.Listen,
+		Handler:           apiHandler(api),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.Default(),
+	}
+	if cfg.API.TLSCert != "" {
+		if srv.TLSConfig, err = apiTLSConfig(cfg.API); err != nil {
+			log.Printf("Ошибка настройки TLS: %v\n", err)
+			return 1
+		}
+		log.Printf("API ожидает запросы на https://%s\n", cfg.API.Listen)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("API ожидает запросы на http://%s\n", cfg.API.Listen)
+		err = srv.ListenAndServe()
+	}
+	log.Printf("Ошибка API: %v\n", err)
+	return 1
+}
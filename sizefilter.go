@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+// sizeSkip возвращает, почему файл размера size не участвует в очистке по
+// ограничениям размера папки, или пустую строку.
+func (r folderRule) sizeSkip(size int64) string {
+	switch {
+	case r.MinSize > 0 && size < r.MinSize:
+		return fmt.Sprintf("%s, меньше min_size=%s", formatBytes(size), formatBytes(r.MinSize))
+	case r.OnlyLargerThan > 0 && size <= r.OnlyLargerThan:
+		return fmt.Sprintf("%s, не больше only_larger_than=%s", formatBytes(size), formatBytes(r.OnlyLargerThan))
+	case r.MaxSize > 0 && size > r.MaxSize:
+		return fmt.Sprintf("%s, больше max_size=%s", formatBytes(size), formatBytes(r.MaxSize))
+	}
+	return ""
+}
+
+// sizeRangeEmpty сообщает, что под ограничения размера папки не подходит ни
+// один файл.
+func (r folderRule) sizeRangeEmpty() bool {
+	return r.MaxSize > 0 && (r.MaxSize < r.MinSize || r.MaxSize <= r.OnlyLargerThan)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// statusURL возвращает адрес хода запуска у сервера API.
+func statusURL(opts APIOptions, stacks bool) string {
+	url := apiBaseURL(opts) + "/api/v1/status"
+	if stacks {
+		url += "?stacks=1"
+	}
+	return url
+}
+
+// runStatus реализует подкоманду status: запрашивает у запущенного
+// cleanup serve ход текущего запуска и выводит его.
+func runStatus(args []string) int {
+	opts, cfg, fs, err := parseRunArgs("status", args)
+	if opts.help {
+		fmt.Println("Usage: cleanup status --api-listen :8443 [--api-token TOKEN] [--stacks] [flags] [config.yml]")
+		fs.SetOutput(os.Stdout)
+		fs.PrintDefaults()
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cfg.API.Listen == "" {
+		fmt.Fprintln(os.Stderr, "не задан адрес API (--api-listen)")
+		return 1
+	}
+	client, err := apiClient(cfg.API)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка чтения сертификата сервера: %v\n", err)
+		return 1
+	}
+	req, err := http.NewRequest(http.MethodGet, statusURL(cfg.API, opts.stacks), nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if cfg.API.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.API.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка запроса к API: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		fmt.Fprintf(os.Stderr, "API ответило %s: %s\n", resp.Status, strings.TrimSpace(string(data)))
+		return 1
+	}
+	var st progressStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка разбора ответа API: %v\n", err)
+		return 1
+	}
+	writeProgress(os.Stdout, st)
+	return 0
+}
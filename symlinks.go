@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Обработка символических ссылок на файлы в папке (symlinks).
+const (
+	symlinksSkip   = "skip"   // ссылки не обрабатываются (по умолчанию)
+	symlinksDelete = "delete" // возраст ссылки — её собственное время
+	symlinksFollow = "follow" // возраст ссылки — время файла, на который она ведёт
+)
+
+// validateSymlinks проверяет режим обработки ссылок symlinks.
+func validateSymlinks(mode string) error {
+	if mode != symlinksSkip && mode != symlinksDelete && mode != symlinksFollow {
+		return fmt.Errorf("symlinks=%q: допустимы skip, delete, follow", mode)
+	}
+	return nil
+}
+
+// isSymlink сообщает, является ли запись каталога символической ссылкой.
+func isSymlink(entry fs.DirEntry) bool {
+	return entry.Type()&fs.ModeSymlink != 0
+}
+
+// symlinkFile — ссылка папки, прошедшая отбор.
+type symlinkFile struct {
+	name, path string
+	desc       string // куда ведёт ссылка, для сообщений
+	target     string // файл, на который ведёт ссылка; пусто — никуда не ведёт
+	local      string // тот же файл по пути внутри папки; пусто — он вне папки
+	stamps     fileStamps
+	time       time.Time
+	size       int64
+}
+
+// symlinkPlan — ссылки папки с их возрастом. Ссылки подсчитываются вместе
+// с файлами папки до проверки max_delete и max_delete_percent, а
+// обрабатываются после файлов.
+type symlinkPlan struct {
+	links []symlinkFile // от самых старых к самым свежим
+	keep  map[string]bool
+	ranks fileRanks
+	over  int // ссылок к удалению
+}
+
+// scanSymlinks отбирает символические ссылки папки по режиму symlinks тем же
+// отбором, что и файлы (include, exclude, filters, размер, владелец).
+// Ссылка, которая никуда не ведёт, стареет по собственному времени в обоих
+// режимах. С follow возраст, размер и владелец берутся у файла, на который
+// ведёт ссылка, но только если он лежит внутри папки: ссылки за её пределы и
+// на каталоги не обрабатываются. keep и beyond_newest считаются среди ссылок
+// отдельно от файлов.
+func scanSymlinks(res *FolderResult, folder string, names []string, rule folderRule, anchors retentionAnchors) symlinkPlan {
+	var plan symlinkPlan
+	realFolder, err := filepath.EvalSymlinks(folder)
+	if err != nil {
+		events.emitCode(EventError, CodeFolderRead, folder, "", "Ошибка проверки пути папки %s: %v", folder, err)
+		return plan
+	}
+	keepNewest := newestFiles{n: rule.Keep}
+	ranked := newestFiles{n: rule.Policy.maxBeyondNewest()}
+	for _, name := range names {
+		path := filepath.Join(folder, name)
+		res.Total++
+		progress.scanned.Add(1)
+		l := symlinkFile{name: name, path: path}
+		stat, info := lstatTimes, fs.FileInfo(nil)
+		target, err := filepath.EvalSymlinks(path)
+		switch {
+		case os.IsNotExist(err):
+			l.desc = "никуда не ведёт"
+		case err != nil:
+			res.fileError(path, CodeStatFailed, "Ошибка чтения ссылки "+path, err)
+			continue
+		case rule.Symlinks == symlinksFollow:
+			l.target, l.desc = target, "ведёт на "+target
+			if !isSubpath(realFolder, target) {
+				res.Skipped++
+				res.keep(path, SkipSymlink, "ведёт за пределы папки: "+target)
+				continue
+			}
+			if info, err = os.Stat(target); err != nil || !info.Mode().IsRegular() {
+				res.Skipped++
+				res.keep(path, SkipSymlink, "ведёт не к файлу: "+target)
+				continue
+			}
+			stat = statTimes
+		default:
+			l.target, l.desc = target, "ведёт на "+target
+		}
+		if info == nil {
+			info, _ = os.Lstat(path)
+		}
+		if rel, err := filepath.Rel(realFolder, l.target); l.target != "" && err == nil && isSubpath(realFolder, l.target) {
+			l.local = filepath.Join(folder, rel)
+		}
+		if reason, detail := rule.candidateSkip(name, info); reason != "" {
+			res.Skipped++
+			res.keep(path, reason, detail)
+			continue
+		}
+		if info != nil {
+			l.size = info.Size()
+		}
+		t, err := stat(path)
+		if err != nil {
+			res.fileError(path, CodeStatFailed, "Ошибка получения времени для "+path, err)
+			continue
+		}
+		l.stamps = stampsOf(t)
+		l.time = rule.fileTime(l.stamps, name)
+		keepNewest.add(name, l.time)
+		ranked.add(name, l.time)
+		plan.links = append(plan.links, l)
+	}
+	slices.SortStableFunc(plan.links, func(a, b symlinkFile) int { return a.time.Compare(b.time) })
+	plan.keep, plan.ranks = keepNewest.names(), ranked.ranks()
+	for _, l := range plan.links {
+		if plan.expired(l, rule, anchors) {
+			plan.over++
+		}
+	}
+	return plan
+}
+
+// expired сообщает, подлежит ли ссылка удалению по сроку или условию policy.
+// При gfs и keep_one_per ссылки не удаляются: схемы хранения строятся по
+// файлам папки, и ссылка в них не входит.
+func (p symlinkPlan) expired(l symlinkFile, rule folderRule, anchors retentionAnchors) bool {
+	if p.keep[l.name] || rule.GFS != nil || rule.KeepOnePer != "" {
+		return false
+	}
+	return rule.expired(policyFile{name: l.name, newest: l.time, size: l.size, rank: p.ranks.of(l.name)}, anchors.of(l.name))
+}
+
+// apply удаляет ссылки с истёкшим сроком, начиная с самых старых. Удаляется
+// всегда сама ссылка, а не файл, на который она ведёт, поэтому action,
+// tier_to и compress_days к ссылкам не применяются. Удаления расходуют запас
+// max_delete папки budget.
+func (p symlinkPlan) apply(res *FolderResult, folder string, rule folderRule, anchors retentionAnchors, opts processOptions, budget *deleteBudget) {
+	for _, l := range p.links {
+		cutoff := anchors.of(l.name).AddDate(0, 0, -rule.daysFor(l.name))
+		switch {
+		case res.StoppedAt != "" || opts.expired():
+			if res.StoppedAt == "" {
+				res.StoppedAt = l.path
+				events.emit(EventWarning, folder, l.path, "Время запуска исчерпано, обработка остановлена на ссылке %s", l.path)
+			}
+			res.Skipped++
+			res.keep(l.path, SkipBudget, "")
+			continue
+		case p.keep[l.name]:
+			res.Skipped++
+			res.keep(l.path, SkipKeepNewest, fmt.Sprintf("keep=%d", rule.Keep))
+			continue
+		case rule.GFS != nil:
+			res.Skipped++
+			res.keep(l.path, SkipGFS, "ссылки при gfs не удаляются")
+			continue
+		case rule.KeepOnePer != "":
+			res.Skipped++
+			res.keep(l.path, SkipKeepOnePer, "ссылки при keep_one_per не удаляются")
+			continue
+		case !p.expired(l, rule, anchors) && rule.Policy != nil:
+			res.Skipped++
+			res.keep(l.path, SkipPolicy, rule.Policy.String())
+			continue
+		case !p.expired(l, rule, anchors):
+			res.Skipped++
+			res.keep(l.path, SkipNotOldEnough, fmt.Sprintf("%s, отсечка %s", rule.describeTimes(l.stamps, l.name), cutoff.Format(time.RFC3339)))
+			continue
+		}
+		if rule.HonorRetain && l.target != "" {
+			held, detail, err := fileHold(l.target, time.Now())
+			if err != nil {
+				res.fileError(l.path, CodeRetentionRead, "Ошибка чтения даты хранения "+l.target, err)
+				continue
+			}
+			if held {
+				res.Skipped++
+				res.keep(l.path, SkipRetained, detail)
+				continue
+			}
+		}
+		// Ссылку на загруженную библиотеку (например, current → v2.so)
+		// процесс откроет снова при перезапуске.
+		if users := opts.Mapped.of(l.local); l.local != "" && users != "" {
+			res.Skipped++
+			res.keep(l.path, SkipMapped, users)
+			continue
+		}
+		if !opts.approved(l.path, pendingDeleteLink) {
+			res.Skipped++
+			res.keep(l.path, SkipNotApproved, pendingDeleteLink)
+			continue
+		}
+		if limit := budget.take(); limit != "" {
+			res.Skipped++
+			res.keep(l.path, SkipMaxDelete, limit)
+			continue
+		}
+		if opts.DryRun {
+			if err := protection.check(l.path); err != nil {
+				budget.give()
+				res.fileError(l.path, CodeDeleteFailed, "", err)
+				continue
+			}
+			events.emit(EventDecision, folder, l.path, "Будет удалена ссылка: %s (%s, возраст %s)", l.path, l.desc, formatAge(time.Since(l.time)))
+			res.Planned++
+			res.Skipped++
+			res.keep(l.path, SkipDryRun, pendingDeleteLink)
+			continue
+		}
+		if err := removeFile(l.path); err != nil {
+			budget.give()
+			res.fileError(l.path, CodeDeleteFailed, "Ошибка удаления ссылки "+l.path, err)
+			continue
+		}
+		events.emit(EventAction, folder, l.path, "Удалена ссылка: %s (%s)", l.path, l.desc)
+		affected.add(folder, l.path, "deleted", "", 0)
+		res.Deleted++
+		progress.deleted.Add(1)
+	}
+}
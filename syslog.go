@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// syslogTimeout ограничивает время подключения и отправки записи в syslog.
+const syslogTimeout = 10 * time.Second
+
+// Приоритеты сообщений syslog: facility local0 и уровень info или warning.
+const (
+	syslogPriorityInfo    = 16*8 + 6
+	syslogPriorityWarning = 16*8 + 4
+)
+
+// SyslogOptions описывает параметры отправки записи о запуске на удалённый
+// syslog-сервер (rsyslog, syslog-ng, Vector) по TCP, при необходимости через TLS.
+type SyslogOptions struct {
+	Address string `yaml:"address"` // хост:порт
+	TLS     bool   `yaml:"tls"`
+	CA      string `yaml:"ca"`   // PEM файл корневых сертификатов сервера
+	Cert    string `yaml:"cert"` // PEM файл клиентского сертификата
+	Key     string `yaml:"key"`  // PEM файл ключа клиентского сертификата
+}
+
+// syslogTLSConfig строит клиентскую конфигурацию TLS: собственные корневые
+// сертификаты и клиентский сертификат задаются необязательно.
+func syslogTLSConfig(opts SyslogOptions, serverName string) (*tls.Config, error) {
+	conf := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if opts.CA != "" {
+		pem, err := os.ReadFile(opts.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в %s нет сертификатов PEM", opts.CA)
+		}
+		conf.RootCAs = pool
+	}
+	if opts.Cert != "" || opts.Key != "" {
+		if opts.Cert == "" || opts.Key == "" {
+			return nil, errors.New("клиентский сертификат и ключ задаются вместе")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.Cert, opts.Key)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// formatSyslogMessage формирует сообщение RFC 5424 с JSON записью о запуске
+// в качестве текста и с префиксом длины по RFC 6587 (octet counting).
+func formatSyslogMessage(summary RunSummary, host string) ([]byte, error) {
+	body, err := json.Marshal(newRunRecord(summary, false))
+	if err != nil {
+		return nil, err
+	}
+	pri := syslogPriorityInfo
+	if summary.FailedFolders() > 0 || len(summary.Missing) > 0 {
+		pri = syslogPriorityWarning
+	}
+	if host == "" {
+		host = "-"
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s cleanup %d run - %s",
+		pri, summary.Start.Add(summary.Duration).UTC().Format(time.RFC3339Nano), host, os.Getpid(), body)
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg)), nil
+}
+
+// shipSyslog отправляет запись о запуске на syslog-сервер.
+func shipSyslog(opts SyslogOptions, summary RunSummary) error {
+	host, _ := os.Hostname()
+	msg, err := formatSyslogMessage(summary, host)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	var conn net.Conn
+	if opts.TLS {
+		serverName, _, err := net.SplitHostPort(opts.Address)
+		if err != nil {
+			return err
+		}
+		conf, err := syslogTLSConfig(opts, serverName)
+		if err != nil {
+			return err
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", opts.Address, conf)
+		if err != nil {
+			return err
+		}
+	} else {
+		conn, err = dialer.Dial("tcp", opts.Address)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(syslogTimeout))
+	_, err = conn.Write(msg)
+	return err
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ANSI-последовательности для раскраски итоговой таблицы.
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+)
+
+// useColor решает, раскрашивать ли вывод: режим always/never задаётся явно,
+// в режиме auto цвет включается только для терминала и без NO_COLOR.
+func useColor(mode string, f *os.File) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// tableRow — строка итоговой таблицы и её цвет.
+type tableRow struct {
+	cells []string
+	color string
+}
+
+// summaryRows строит строки итоговой таблицы по результатам запуска.
+// Ошибка папки best_effort не считается сбоем, как и в коде завершения:
+// строка такой папки выделяется жёлтым, а в столбец ошибок она не входит.
+func summaryRows(summary RunSummary) []tableRow {
+	failed := summary.FailedFolders()
+	rows := []tableRow{{cells: []string{"Папка", "Просмотрено", "Удалено", "Оставлено", "Освобождено", "Ошибки", "Время"}, color: ansiBold}}
+	for _, f := range summary.Folders {
+		errs := f.Errors
+		color := ""
+		if f.Deleted > 0 {
+			color = ansiGreen
+		}
+		if f.Err != nil && f.BestEffort {
+			color = ansiYellow
+		} else if f.Err != nil {
+			errs++
+		}
+		if errs > 0 {
+			color = ansiRed
+		}
+		rows = append(rows, tableRow{cells: []string{
+			f.Folder,
+			strconv.Itoa(f.Total),
+			strconv.Itoa(f.Deleted),
+			strconv.Itoa(f.Skipped),
+			formatBytes(f.Freed),
+			strconv.Itoa(errs),
+			f.Duration.Round(time.Millisecond).String(),
+		}, color: color})
+	}
+	rows = append(rows, tableRow{cells: []string{
+		"Итого",
+		strconv.Itoa(summary.Total),
+		strconv.Itoa(summary.Deleted),
+		strconv.Itoa(summary.Skipped),
+		formatBytes(summary.Freed),
+		strconv.Itoa(summary.Errors + failed),
+		summary.Duration.Round(time.Millisecond).String(),
+	}, color: ansiBold})
+	return rows
+}
+
+// printSummaryTable выводит выровненную итоговую таблицу запуска.
+// Первый столбец выравнивается по левому краю, числовые — по правому.
+func printSummaryTable(w io.Writer, summary RunSummary, color bool) {
+	rows := summaryRows(summary)
+	widths := make([]int, len(rows[0].cells))
+	for _, row := range rows {
+		for i, cell := range row.cells {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	line := func(row tableRow) {
+		parts := make([]string, len(row.cells))
+		for i, cell := range row.cells {
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i == 0 {
+				parts[i] = cell + pad
+			} else {
+				parts[i] = pad + cell
+			}
+		}
+		text := strings.Join(parts, " | ")
+		if color && row.color != "" {
+			text = row.color + text + ansiReset
+		}
+		fmt.Fprintln(w, text)
+	}
+	separator := func() {
+		parts := make([]string, len(widths))
+		for i, width := range widths {
+			parts[i] = strings.Repeat("-", width)
+		}
+		fmt.Fprintln(w, strings.Join(parts, "-+-"))
+	}
+
+	line(rows[0])
+	separator()
+	for _, row := range rows[1 : len(rows)-1] {
+		line(row)
+	}
+	separator()
+	line(rows[len(rows)-1])
+
+	if summary.StoppedAt != "" {
+		msg := fmt.Sprintf("Время запуска исчерпано, запуск остановлен на %s", summary.StoppedAt)
+		if color {
+			msg = ansiYellow + msg + ansiReset
+		}
+		fmt.Fprintln(w, msg)
+	}
+	if summary.CanaryFailed != "" {
+		msg := fmt.Sprintf("Проверка папки-канарейки %s не пройдена, остальные папки не обрабатывались", summary.CanaryFailed)
+		if color {
+			msg = ansiRed + ansiBold + msg + ansiReset
+		}
+		fmt.Fprintln(w, msg)
+	}
+	if summary.Deferred != "" {
+		msg := fmt.Sprintf("Идёт обслуживание системы (%s): удаление отложено до следующего запуска", summary.Deferred)
+		if color {
+			msg = ansiYellow + msg + ansiReset
+		}
+		fmt.Fprintln(w, msg)
+	}
+	for _, f := range summary.Folders {
+		if f.Future > 0 {
+			msg := fmt.Sprintf("В папке %s файлов со временем в будущем: %d", f.Folder, f.Future)
+			if color {
+				msg = ansiYellow + msg + ansiReset
+			}
+			fmt.Fprintln(w, msg)
+		}
+	}
+	for _, f := range summary.Folders {
+		if f.SoftDeleted > 0 {
+			fmt.Fprintf(w, "В папке %s мягко удалено (переименовано) файлов: %d\n", f.Folder, f.SoftDeleted)
+		}
+		if f.Truncated > 0 {
+			msg := fmt.Sprintf("В папке %s достигнут max_delete: не удалено файлов сверх ограничения: %d", f.Folder, f.Truncated)
+			if color {
+				msg = ansiRed + msg + ansiReset
+			}
+			fmt.Fprintln(w, msg)
+		}
+		if f.Quarantined > 0 {
+			fmt.Fprintf(w, "Из папки %s перемещено в карантин файлов: %d\n", f.Folder, f.Quarantined)
+		}
+		if f.Compressed > 0 {
+			fmt.Fprintf(w, "В папке %s сжато файлов: %d (сэкономлено %s)\n", f.Folder, f.Compressed, formatBytes(f.CompressedSaved))
+		}
+		if f.Moved > 0 {
+			fmt.Fprintf(w, "Из папки %s перемещено для просмотра файлов: %d\n", f.Folder, f.Moved)
+		}
+		if f.Archived > 0 {
+			fmt.Fprintf(w, "Из папки %s перенесено в архив файлов: %d\n", f.Folder, f.Archived)
+		}
+		if f.QuotaDeleted > 0 {
+			fmt.Fprintf(w, "В папке %s по квотам подкаталогов убрано файлов: %d\n", f.Folder, f.QuotaDeleted)
+		}
+		if f.Tiered > 0 {
+			fmt.Fprintf(w, "Из папки %s перемещено файлов: %d (%s)\n", f.Folder, f.Tiered, formatBytes(f.TieredBytes))
+		}
+	}
+	for _, f := range summary.Folders {
+		if f.PermissionDenied > 0 {
+			msg := fmt.Sprintf("В папке %s отказано в доступе к файлам: %d; %s", f.Folder, f.PermissionDenied, f.PermissionHint)
+			if color {
+				msg = ansiRed + msg + ansiReset
+			}
+			fmt.Fprintln(w, msg)
+		}
+	}
+	if summary.DryRun {
+		var planned int
+		var plannedFreed int64
+		for _, f := range summary.Folders {
+			planned += f.Planned
+			plannedFreed += f.PlannedFreed
+		}
+		msg := fmt.Sprintf("Пробный запуск: файлы не удалены, к удалению %d файлов (%s)", planned, formatBytes(plannedFreed))
+		if color {
+			msg = ansiYellow + msg + ansiReset
+		}
+		fmt.Fprintln(w, msg)
+	}
+	for _, f := range summary.Folders {
+		if f.FirstRun && f.Err == nil {
+			msg := fmt.Sprintf("Папка %s очищается впервые: файлы не удалены, к удалению %d файлов (%s); для удаления запустите с --first-run-confirm",
+				f.Folder, f.Planned, formatBytes(f.PlannedFreed))
+			if color {
+				msg = ansiYellow + msg + ansiReset
+			}
+			fmt.Fprintln(w, msg)
+		}
+	}
+	for _, folder := range summary.Missing {
+		msg := fmt.Sprintf("Папка %s не найдена и пропущена", folder)
+		if color {
+			msg = ansiRed + ansiBold + msg + ansiReset
+		}
+		fmt.Fprintln(w, msg)
+	}
+	for _, f := range summary.Folders {
+		if f.Err != nil {
+			msg := fmt.Sprintf("[%s] Ошибка обработки папки %s: %v", folderErrorCode(f.Err), f.Folder, f.Err)
+			if color {
+				msg = ansiYellow + msg + ansiReset
+			}
+			fmt.Fprintln(w, msg)
+		}
+	}
+	if rec := resourceRecord(summary); rec != nil {
+		fmt.Fprintf(w, "Ресурсы запуска: %s\n", rec)
+	}
+}
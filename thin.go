@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// validateKeepOnePer проверяет период прореживания keep_one_per.
+func validateKeepOnePer(period string) error {
+	if _, ok := calendarPeriods[period]; !ok {
+		return fmt.Errorf("keep_one_per=%q: допустимы %s", period, strings.Join(slices.Sorted(maps.Keys(calendarPeriods)), ", "))
+	}
+	return nil
+}
+
+// thinning отбирает за один проход самый свежий файл каждого календарного
+// периода keep_one_per. Файлы разных правил retention прореживаются
+// отдельно, как и отсчитывается их срок хранения.
+type thinning struct {
+	period  string
+	key     func(time.Time) string
+	anchors retentionAnchors
+	files   map[string]newestFile // по группе retention и ключу периода
+}
+
+func newThinning(period string, anchors retentionAnchors) *thinning {
+	return &thinning{period: period, key: calendarPeriods[period], anchors: anchors, files: make(map[string]newestFile)}
+}
+
+// add учитывает файл name со временем t.
+func (k *thinning) add(name string, t time.Time) {
+	if k.key == nil {
+		return
+	}
+	key := fmt.Sprintf("%d/%s", k.anchors.group(name), k.key(t.Local()))
+	if f, ok := k.files[key]; !ok || t.After(f.time) {
+		k.files[key] = newestFile{name, t}
+	}
+}
+
+// names возвращает файлы, сохраняемые за свои периоды, с описанием
+// периода, например "month 2024-05".
+func (k *thinning) names() map[string]string {
+	kept := make(map[string]string, len(k.files))
+	for key, f := range k.files {
+		_, period, _ := strings.Cut(key, "/")
+		kept[f.name] = k.period + " " + period
+	}
+	return kept
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// s3UploadTimeout ограничивает время загрузки одного файла в S3.
+const s3UploadTimeout = 30 * time.Minute
+
+// s3MaxObject — наибольший размер объекта, загружаемого одним запросом PUT.
+const s3MaxObject = 5 << 30
+
+// S3Options описывает подключение к S3 для перемещения файлов (tier_to: s3://...).
+type S3Options struct {
+	Region   string `yaml:"region"`   // по умолчанию AWS_REGION
+	Endpoint string `yaml:"endpoint"` // S3-совместимое хранилище, например https://minio:9000
+}
+
+// tierFile перемещает файл папки folder в хранилище dest: каталог (например,
+// архивный диск) или s3://bucket/prefix. Файл сохраняет путь относительно
+// папки, а занятое имя не перезаписывается: файл переносится под именем
+// с номером, как в move_to. Исходный файл удаляется только после успешного
+// копирования.
+func tierFile(folder, dest string, s3 S3Options, file string) (string, error) {
+	if err := protection.check(file); err != nil {
+		return "", err
+	}
+	rel := folderRelative(folder, file)
+	if rest, ok := strings.CutPrefix(dest, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return "", fmt.Errorf("в %s не указан bucket", dest)
+		}
+		base := path.Join(prefix, filepath.ToSlash(rel))
+		for n := 1; ; n++ {
+			key := numberedName(base, n)
+			err := putS3Object(s3, bucket, key, file)
+			if errors.Is(err, fs.ErrExist) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			return "s3://" + bucket + "/" + key, removeFile(file)
+		}
+	}
+	base := filepath.Join(dest, rel)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return "", err
+	}
+	for n := 1; ; n++ {
+		target := numberedName(base, n)
+		if err := relocate(folder, file, target, dest); !errors.Is(err, fs.ErrExist) {
+			return target, err
+		}
+	}
+}
+
+// moveFile перемещает файл в target, в том числе на другую файловую систему.
+func moveFile(file, target string) error {
+	if err := protection.check(file); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return &os.PathError{Op: "move", Path: target, Err: fs.ErrExist}
+	}
+	if err := os.Rename(file, target); err == nil {
+		return nil
+	}
+	// Другая файловая система: копируем и удаляем исходный файл.
+	if err := copyFile(file, target); err != nil {
+		return err
+	}
+	return removeFile(file)
+}
+
+// numberedName возвращает n-й вариант имени target: сам target, а затем
+// имена с номером перед расширением (a-2.log, a-3.log и так далее), как
+// у архивов за один день.
+func numberedName(target string, n int) string {
+	if n <= 1 {
+		return target
+	}
+	ext := filepath.Ext(target)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(target, ext), n, ext)
+}
+
+// copyFile копирует файл с сохранением владельца, прав, расширенных
+// атрибутов и времени, насколько позволяют права (см. applyMeta). dst
+// создаётся только если его ещё нет; при ошибке удаляется только копия,
+// созданная этим вызовом, а не файл, появившийся под тем же именем.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	meta, err := readMeta(src)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, meta.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	// Исходный файл удаляется после копирования, поэтому копия сначала
+	// сбрасывается на диск.
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return applyMeta(dst, meta)
+}
+
+// putS3Object загружает файл в S3 одним запросом PUT. Существующий объект
+// не перезаписывается: тогда возвращается ошибка fs.ErrExist.
+func putS3Object(opts S3Options, bucket, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > s3MaxObject {
+		return fmt.Errorf("файл %s больше 5 ГБ, загрузка по частям не поддерживается", file)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return putS3Body(opts, bucket, key, f, info.Size(), hex.EncodeToString(h.Sum(nil)), true)
+}
+
+// putS3Data загружает в S3 небольшой объект из памяти.
+func putS3Data(opts S3Options, bucket, key string, data []byte) error {
+	return putS3Body(opts, bucket, key, bytes.NewReader(data), int64(len(data)), sha256Hex(data), false)
+}
+
+// putS3Body загружает объект размером size с SHA-256 payloadHash. При create
+// объект только создаётся (If-None-Match: *), а если он уже есть,
+// возвращается ошибка fs.ErrExist.
+func putS3Body(opts S3Options, bucket, key string, body io.Reader, size int64, payloadHash string, create bool) error {
+	region := opts.Region
+	if region == "" {
+		region = awsRegion()
+	}
+	if region == "" {
+		return errors.New("не задан регион S3 (--s3-region или AWS_REGION)")
+	}
+	escapedKey := awsEscapePath(key)
+	endpoint := "https://" + bucket + ".s3." + region + ".amazonaws.com/" + escapedKey
+	if opts.Endpoint != "" {
+		endpoint = strings.TrimRight(opts.Endpoint, "/") + "/" + bucket + "/" + escapedKey
+	}
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if create {
+		req.Header.Set("If-None-Match", "*")
+	}
+	signAWSRequestHash(req, payloadHash, creds, region, "s3", time.Now())
+	client := &http.Client{Timeout: s3UploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if create && resp.StatusCode == http.StatusPreconditionFailed {
+		return &os.PathError{Op: "put", Path: "s3://" + bucket + "/" + key, Err: fs.ErrExist}
+	}
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 ответил %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
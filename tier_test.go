@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestTierKeepsRelativePath(t *testing.T) {
+	dir, to := t.TempDir(), t.TempDir()
+	oldTree(t, dir)
+	// Файл, перенесённый раньше под тем же именем, не перезаписывается.
+	if err := os.MkdirAll(filepath.Join(to, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(to, "a", "x.log"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runFolder(t, dir, "days=365&tier_days=30&tier_to="+to)
+	for name, want := range map[string]string{"a/x.log": "old", "a/x-2.log": "a/x.log", "b/x.log": "b/x.log"} {
+		data, err := os.ReadFile(filepath.Join(to, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s в tier_to: %q, %v; want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestTierS3KeepsRelativePath(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{"/bucket/logs/a/x.log": "old"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := objects[r.URL.Path]; ok && r.Header.Get("If-None-Match") == "*" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		objects[r.URL.Path] = string(data)
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	dir := t.TempDir()
+	oldTree(t, dir)
+	opts := S3Options{Region: "us-east-1", Endpoint: srv.URL}
+	var targets []string
+	for _, name := range []string{"a/x.log", "b/x.log"} {
+		target, err := tierFile(dir, "s3://bucket/logs", opts, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("tierFile(%s): %v", name, err)
+		}
+		targets = append(targets, target)
+	}
+	if want := []string{"s3://bucket/logs/a/x-2.log", "s3://bucket/logs/b/x.log"}; !slices.Equal(targets, want) {
+		t.Errorf("перемещены в %v, want %v", targets, want)
+	}
+	for key, want := range map[string]string{"/bucket/logs/a/x.log": "old", "/bucket/logs/a/x-2.log": "a/x.log", "/bucket/logs/b/x.log": "b/x.log"} {
+		if objects[key] != want {
+			t.Errorf("объект %s: %q, want %q", key, objects[key], want)
+		}
+	}
+}
+
+func TestTierS3EscapesKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("в Windows в имени файла нет «:»")
+	}
+	var path, raw string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// S3 подписывает путь с закодированными «:» и «+» и читает «+» как пробел.
+		path, raw = r.URL.Path, r.URL.EscapedPath()
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a:b+c.log")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target, err := tierFile(dir, "s3://bucket/logs", S3Options{Region: "us-east-1", Endpoint: srv.URL}, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "s3://bucket/logs/a:b+c.log" {
+		t.Errorf("перемещён в %s, want s3://bucket/logs/a:b+c.log", target)
+	}
+	if path != "/bucket/logs/a:b+c.log" || raw != "/bucket/logs/a%3Ab%2Bc.log" {
+		t.Errorf("путь запроса %s (%s), want /bucket/logs/a%%3Ab%%2Bc.log", raw, path)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/djherbis/times"
+)
+
+// Отметки времени файла для time_fields.
+const (
+	timeMtime = "mtime" // изменение содержимого
+	timeCtime = "ctime" // изменение метаданных (inode)
+	timeAtime = "atime" // последнее чтение
+	timeBirth = "birth" // создание
+)
+
+// Условия time_match: файл старше отсечки по всем или по любой из отметок.
+const (
+	timeMatchAll = "all"
+	timeMatchAny = "any"
+)
+
+// defaultTimeFields — отметки, по которым возраст файла определялся всегда.
+var defaultTimeFields = []string{timeMtime, timeBirth}
+
+// fileStamps — отметки времени файла. Отметки, которые файловая система
+// не хранит, заменяются временем изменения.
+type fileStamps struct {
+	mtime, ctime, atime, birth time.Time
+}
+
+func stampsOf(t times.Timespec) fileStamps {
+	s := fileStamps{mtime: t.ModTime(), ctime: t.ModTime(), atime: t.AccessTime(), birth: t.ModTime()}
+	if t.HasChangeTime() {
+		s.ctime = t.ChangeTime()
+	}
+	if t.HasBirthTime() {
+		s.birth = t.BirthTime()
+	}
+	return s
+}
+
+func (s fileStamps) field(name string) time.Time {
+	switch name {
+	case timeCtime:
+		return s.ctime
+	case timeAtime:
+		return s.atime
+	case timeBirth:
+		return s.birth
+	default:
+		return s.mtime
+	}
+}
+
+// validateTimeFields проверяет отметки time_fields и условие time_match.
+func validateTimeFields(fields []string, match string) error {
+	known := []string{timeMtime, timeCtime, timeAtime, timeBirth}
+	for _, f := range fields {
+		if !slices.Contains(known, f) {
+			return fmt.Errorf("time_fields: неизвестная отметка %q (допустимы %s)", f, strings.Join(known, ", "))
+		}
+	}
+	if match != "" && match != timeMatchAll && match != timeMatchAny {
+		return fmt.Errorf("time_match=%q: допустимы all, any", match)
+	}
+	return nil
+}
+
+// fieldTimes возвращает отметки времени, по которым определяется возраст
+// файла name. У сжатого файла время создания — время сжатия, поэтому
+// вместо него берётся время изменения, сохранённое при сжатии.
+func (r folderRule) fieldTimes(s fileStamps, name string) []time.Time {
+	fields := r.TimeFields
+	if len(fields) == 0 {
+		fields = defaultTimeFields
+	}
+	ts := make([]time.Time, len(fields))
+	for i, f := range fields {
+		if f == timeBirth && r.compressed(name) {
+			f = timeMtime
+		}
+		ts[i] = s.field(f)
+	}
+	return ts
+}
+
+// fileTime возвращает время файла для сравнения с отсечкой и выбора самых
+// свежих файлов: при time_match: all файл старше отсечки, только если все
+// отметки старше, поэтому берётся самая поздняя; при any — самая ранняя.
+func (r folderRule) fileTime(s fileStamps, name string) time.Time {
+	ts := r.fieldTimes(s, name)
+	if r.TimeMatch == timeMatchAny {
+		return slices.MinFunc(ts, time.Time.Compare)
+	}
+	return slices.MaxFunc(ts, time.Time.Compare)
+}
+
+// latestTime возвращает самую позднюю из отметок файла — по ней файл
+// считается файлом из будущего.
+func (r folderRule) latestTime(s fileStamps, name string) time.Time {
+	return slices.MaxFunc(r.fieldTimes(s, name), time.Time.Compare)
+}
+
+// recentlyRead сообщает, читали ли файл за последние keep_read_within дней.
+func (r folderRule) recentlyRead(s fileStamps, now time.Time) bool {
+	return r.KeepReadWithin > 0 && s.atime.After(now.AddDate(0, 0, -r.KeepReadWithin))
+}
+
+// describeTimes перечисляет отметки файла для журнала, например
+// "mtime 2024-05-01T10:00:00Z, birth 2024-04-30T09:00:00Z".
+func (r folderRule) describeTimes(s fileStamps, name string) string {
+	fields := r.TimeFields
+	if len(fields) == 0 {
+		fields = defaultTimeFields
+	}
+	parts := make([]string, len(fields))
+	for i, t := range r.fieldTimes(s, name) {
+		parts[i] = fields[i] + " " + t.Format(time.RFC3339)
+	}
+	return strings.Join(parts, ", ")
+}
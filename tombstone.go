@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Имена «надгробий» — файлов, удалённых переименованием:
+// <имя>.deleted-<время UTC>.
+const (
+	tombstoneMarker = ".deleted-"
+	tombstoneLayout = "20060102T150405Z"
+)
+
+// tombstoneName возвращает имя, под которым файл name сохраняется при мягком удалении.
+func tombstoneName(name string, at time.Time) string {
+	return name + tombstoneMarker + at.UTC().Format(tombstoneLayout)
+}
+
+// tombstoneTime возвращает время мягкого удаления из имени надгробия.
+func tombstoneTime(name string) (time.Time, bool) {
+	idx := strings.LastIndex(name, tombstoneMarker)
+	if idx < 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(tombstoneLayout, name[idx+len(tombstoneMarker):])
+	return t, err == nil
+}
+
+// softDelete переименовывает файл в надгробие в той же папке, так что
+// приложения перестают его видеть, а восстановить его можно обратным
+// переименованием.
+func softDelete(path string, at time.Time) (string, error) {
+	if err := protection.check(path); err != nil {
+		return "", err
+	}
+	target := filepath.Join(filepath.Dir(path), tombstoneName(filepath.Base(path), at))
+	return target, os.Rename(path, target)
+}
+
+// purgeTombstones окончательно удаляет надгробия папки, мягко удалённые
+// раньше, чем grace назад.
+func purgeTombstones(res *FolderResult, folder string, names []string, grace time.Duration, opts processOptions) {
+	now := time.Now()
+	for _, name := range names {
+		at, _ := tombstoneTime(name)
+		if now.Sub(at) < grace {
+			continue
+		}
+		path := filepath.Join(folder, name)
+		var size int64
+		if info, err := os.Lstat(path); err == nil {
+			size = info.Size()
+		}
+		if !opts.approved(path, pendingPurge) {
+			res.Skipped++
+			res.keep(path, SkipNotApproved, pendingPurge)
+			continue
+		}
+		if opts.DryRun {
+			events.emit(EventDecision, folder, path, "Будет окончательно удалён файл: %s", path)
+			res.Planned++
+			res.PlannedFreed += size
+			res.keep(path, SkipDryRun, pendingPurge)
+			continue
+		}
+		if err := removeFile(path); err != nil {
+			res.fileError(path, CodeDeleteFailed, "Ошибка удаления файла "+path, err)
+			continue
+		}
+		events.emit(EventAction, folder, path, "Окончательно удалён файл: %s (мягко удалён %s)", path, at.Local().Format(time.RFC3339))
+		res.Deleted++
+		res.Freed += size
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatBytes выводит размер в удобочитаемом виде (КиБ, МиБ, ГиБ...).
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatAge выводит возраст файла в днях, а если он меньше суток — в часах.
+func formatAge(d time.Duration) string {
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%.1f ч", d.Hours())
+	}
+	return fmt.Sprintf("%.1f дн", d.Hours()/24)
+}
+
+// ByteSize — объём в байтах, который в YAML можно задать числом или строкой
+// с единицей: 512MB, 100GB (по 1000), 100GiB или 100G (по 1024).
+type ByteSize int64
+
+// UnmarshalYAML разбирает объём из числа или строки с единицей.
+func (b *ByteSize) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+// parseByteSize разбирает объём вида 100GB, 100GiB, 100G или число байт.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	unit := strings.ToUpper(strings.TrimSpace(s[i:]))
+	mult, ok := byteUnits[unit]
+	if err != nil || !ok || value < 0 {
+		return 0, fmt.Errorf("неверный объём %q (например, 512MB, 100GiB)", s)
+	}
+	return int64(value * float64(mult)), nil
+}
+
+// byteUnits — множители единиц объёма.
+var byteUnits = map[string]int64{
+	"": 1, "B": 1,
+	"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+	"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40,
+	"KIB": 1 << 10, "MIB": 1 << 20, "GIB": 1 << 30, "TIB": 1 << 40,
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultVerifyTimeout — ограничение времени одной проверки, если timeout
+// не задан.
+const defaultVerifyTimeout = 30 * time.Second
+
+// Verify — проверка перед удалением: для файлов, подходящих под Match,
+// вызывается внешняя команда или HTTP-адрес, и файл удаляется, только если
+// проверка подтвердила, что его можно удалить (например, дамп уже принят
+// в каталог резервных копий).
+//
+//	verify:
+//	  match: ["*.dump"]
+//	  url: https://catalog.example.com/api/ingested
+type Verify struct {
+	Match   []string      `yaml:"match"`   // шаблоны имён; пусто — все файлы
+	Command []string      `yaml:"command"` // команда и аргументы, путь к файлу добавляется последним
+	URL     string        `yaml:"url"`     // POST с JSON {"path", "folder", "size", "mtime"}
+	Token   string        `yaml:"token"`   // Bearer-токен для url
+	Timeout time.Duration `yaml:"timeout"` // по умолчанию 30s
+}
+
+func (v *Verify) validate() error {
+	if (len(v.Command) == 0) == (v.URL == "") {
+		return fmt.Errorf("verify: задайте command или url")
+	}
+	if v.Timeout < 0 {
+		return fmt.Errorf("verify: timeout не может быть отрицательным")
+	}
+	if err := validatePatterns("verify.match", v.Match); err != nil {
+		return err
+	}
+	for i := range v.Match {
+		v.Match[i] = foldName(strings.TrimSpace(v.Match[i]))
+	}
+	return nil
+}
+
+func (v *Verify) String() string {
+	target := v.URL
+	if target == "" {
+		target = strings.Join(v.Command, " ")
+	}
+	if len(v.Match) == 0 {
+		return target
+	}
+	return strings.Join(v.Match, ", ") + " → " + target
+}
+
+// matches сообщает, нужна ли проверка перед удалением файла name.
+func (v *Verify) matches(name string) bool {
+	return v != nil && (len(v.Match) == 0 || matchAny(v.Match, name))
+}
+
+// allow проверяет файл path перед удалением: файл, удаление которого не
+// подтверждено, оставляется с причиной unverified, а при ошибке проверки
+// учитывается как ошибка.
+func (v *Verify) allow(res *FolderResult, folder, path string, size int64, mtime time.Time) bool {
+	ok, detail, err := v.confirm(folder, path, size, mtime)
+	if err != nil {
+		res.fileError(path, CodeVerifyFailed, "Ошибка проверки перед удалением "+path, err)
+		return false
+	}
+	if !ok {
+		res.Skipped++
+		res.keep(path, SkipUnverified, detail)
+	}
+	return ok
+}
+
+// verifyRequest — тело запроса проверки к HTTP-адресу.
+type verifyRequest struct {
+	Path   string    `json:"path"`
+	Folder string    `json:"folder"`
+	Size   int64     `json:"size"`
+	MTime  time.Time `json:"mtime"`
+}
+
+// confirm спрашивает, можно ли удалить файл path. Команда подтверждает
+// удаление кодом выхода 0, HTTP-адрес — ответом 2xx; другой код выхода или
+// ответ 4xx — отказ, пояснение к которому возвращается во второй строке.
+// Ошибка — проверку выполнить не удалось (команда не запустилась, адрес
+// недоступен, ответ 5xx, истекло время), и файл тоже не удаляется.
+func (v *Verify) confirm(folder, path string, size int64, mtime time.Time) (bool, string, error) {
+	timeout := v.Timeout
+	if timeout == 0 {
+		timeout = defaultVerifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if v.URL == "" {
+		return v.runCommand(ctx, folder, path)
+	}
+	body, err := json.Marshal(verifyRequest{Path: path, Folder: folder, Size: size, MTime: mtime.UTC()})
+	if err != nil {
+		return false, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+v.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	text := strings.TrimSpace(string(data))
+	switch resp.StatusCode / 100 {
+	case 2:
+		return true, "", nil
+	case 4:
+		return false, verifyDetail(resp.Status, text), nil
+	default:
+		return false, "", fmt.Errorf("проверка ответила %s", verifyDetail(resp.Status, text))
+	}
+}
+
+// runCommand запускает команду проверки с путём к файлу последним
+// аргументом; путь и папка передаются и в CLEANUP_FILE, CLEANUP_FOLDER.
+func (v *Verify) runCommand(ctx context.Context, folder, path string) (bool, string, error) {
+	args := append(v.Command[1:len(v.Command):len(v.Command)], path)
+	cmd := exec.CommandContext(ctx, v.Command[0], args...)
+	cmd.Env = append(os.Environ(), "CLEANUP_FILE="+path, "CLEANUP_FOLDER="+folder)
+	out, err := cmd.CombinedOutput()
+	text := strings.TrimSpace(string(out))
+	if len(text) > 512 {
+		text = text[:512]
+	}
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return true, "", nil
+	case ctx.Err() != nil:
+		return false, "", fmt.Errorf("проверка не завершилась за отведённое время")
+	case errors.As(err, &exit):
+		return false, verifyDetail(fmt.Sprintf("код выхода %d", exit.ExitCode()), text), nil
+	default:
+		return false, "", err
+	}
+}
+
+// verifyDetail дополняет пояснение отказа выводом команды или телом ответа.
+func verifyDetail(status, text string) string {
+	if text == "" {
+		return status
+	}
+	return status + ": " + text
+}
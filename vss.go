@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// errVSSUnsupported возвращается при попытке создать теневую копию не в Windows.
+var errVSSUnsupported = errors.New("теневые копии VSS поддерживаются только в Windows")
+
+// VSSOptions описывает создание теневой копии тома (Volume Shadow Copy)
+// перед удалением файлов.
+type VSSOptions struct {
+	Enabled bool `yaml:"enabled"`
+	Keep    int  `yaml:"keep"` // сколько созданных cleanup копий хранить на каждом томе
+}
+
+// shadowRecord — теневая копия, созданная cleanup.
+type shadowRecord struct {
+	ID      string    `json:"id"`
+	Volume  string    `json:"volume"`
+	Created time.Time `json:"created"`
+}
+
+// shadowStatePath возвращает путь к файлу со списком созданных копий.
+// Копии, созданные другими программами, cleanup не удаляет.
+func shadowStatePath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "vss-shadows.json"), nil
+}
+
+// loadShadowState читает список созданных копий; отсутствие файла — пустой список.
+func loadShadowState(path string) ([]shadowRecord, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []shadowRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return records, nil
+}
+
+// saveShadowState записывает список созданных копий.
+func saveShadowState(path string, records []shadowRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// folderVolumes возвращает тома локальных папок (например, C:) без повторов.
+// Для сетевых папок теневая копия не создаётся.
+func folderVolumes(folders []string) []string {
+	var volumes []string
+	seen := make(map[string]bool)
+	for _, folder := range folders {
+		abs, err := filepath.Abs(folder)
+		if err != nil {
+			abs = folder
+		}
+		volume := strings.ToUpper(filepath.VolumeName(abs))
+		if len(volume) != 2 || volume[1] != ':' {
+			events.emit(EventWarning, folder, "", "Теневая копия для %s не создаётся: поддерживаются только локальные тома", folder)
+			continue
+		}
+		if !seen[volume] {
+			seen[volume] = true
+			volumes = append(volumes, volume)
+		}
+	}
+	return volumes
+}
+
+// snapshotVolumes создаёт теневые копии томов с папками и удаляет старые копии,
+// созданные cleanup, оставляя opts.Keep последних на каждом томе.
+func snapshotVolumes(opts VSSOptions, folders []string) error {
+	if runtime.GOOS != "windows" {
+		return errVSSUnsupported
+	}
+	statePath, err := shadowStatePath()
+	if err != nil {
+		return err
+	}
+	records, err := loadShadowState(statePath)
+	if err != nil {
+		return err
+	}
+	for _, volume := range folderVolumes(folders) {
+		id, err := createShadow(volume)
+		if err != nil {
+			return fmt.Errorf("создание теневой копии тома %s: %w", volume, err)
+		}
+		events.emit(EventAction, "", "", "Создана теневая копия тома %s: %s", volume, id)
+		records = append(records, shadowRecord{ID: id, Volume: volume, Created: time.Now()})
+	}
+	records = pruneShadows(records, max(opts.Keep, 1))
+	return saveShadowState(statePath, records)
+}
+
+// pruneShadows удаляет лишние копии, начиная с самых старых, и возвращает
+// оставшиеся. Копия, которую не удалось удалить, остаётся в списке.
+func pruneShadows(records []shadowRecord, keep int) []shadowRecord {
+	count := make(map[string]int)
+	for _, r := range records {
+		count[r.Volume]++
+	}
+	var left []shadowRecord
+	for _, r := range records { // записи добавляются по порядку создания
+		if count[r.Volume] <= keep {
+			left = append(left, r)
+			continue
+		}
+		if err := deleteShadow(r.ID); err != nil {
+			events.emitCode(EventError, CodeSnapshotFailed, "", "", "Ошибка удаления теневой копии %s: %v", r.ID, err)
+			left = append(left, r)
+			continue
+		}
+		events.emit(EventAction, "", "", "Удалена старая теневая копия тома %s: %s", r.Volume, r.ID)
+		count[r.Volume]--
+	}
+	return left
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+// createShadow не поддерживается вне Windows.
+func createShadow(volume string) (string, error) {
+	return "", errVSSUnsupported
+}
+
+// deleteShadow не поддерживается вне Windows.
+func deleteShadow(id string) error {
+	return errVSSUnsupported
+}
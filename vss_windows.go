@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// createShadow создаёт клиентскую теневую копию тома через WMI
+// и возвращает её идентификатор.
+func createShadow(volume string) (string, error) {
+	script := fmt.Sprintf(`$r = (Get-WmiObject -List Win32_ShadowCopy).Create('%s\', 'ClientAccessible'); `+
+		`if ($r.ReturnValue -ne 0) { Write-Error "ReturnValue $($r.ReturnValue)"; exit 1 }; $r.ShadowID`, volume)
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	id := strings.TrimSpace(string(out))
+	if id == "" {
+		return "", fmt.Errorf("не получен идентификатор теневой копии")
+	}
+	return id, nil
+}
+
+// deleteShadow удаляет теневую копию по идентификатору.
+func deleteShadow(id string) error {
+	out, err := exec.Command("vssadmin", "delete", "shadows", "/Shadow="+id, "/Quiet").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
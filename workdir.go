@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// workLockName — файл блокировки в каталоге промежуточных файлов запуска:
+// пока он заблокирован, запуск ещё работает.
+const workLockName = ".lock"
+
+// workStaleAge — каталог запуска без файла блокировки считается оставшимся
+// от аварийного запуска, только если он старше этого: так каталог, который
+// другой экземпляр только что создал, не удаляется до появления блокировки.
+const workStaleAge = time.Minute
+
+// workDir — каталог промежуточных файлов запуска (недописанные архивы,
+// сжатые файлы до переименования) внутри общего work_dir.
+type workDir struct {
+	path string
+	lock *os.File
+}
+
+// defaultWorkDir возвращает work_dir по умолчанию: <каталог состояния>/work.
+func defaultWorkDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "work"), nil
+}
+
+// openRunWorkDir открывает каталог промежуточных файлов запуска в work_dir
+// или, если он не задан, в каталоге по умолчанию.
+func openRunWorkDir(base, runID string) (*workDir, error) {
+	if base == "" {
+		dir, err := defaultWorkDir()
+		if err != nil {
+			return nil, err
+		}
+		base = dir
+	}
+	return openWorkDir(base, runID)
+}
+
+// openWorkDir удаляет промежуточные файлы аварийно завершившихся запусков
+// из base и создаёт в нём каталог запуска runID, заблокированный до close.
+func openWorkDir(base, runID string) (*workDir, error) {
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return nil, err
+	}
+	sweepWorkDir(base)
+	path := filepath.Join(base, runID)
+	if err := os.Mkdir(path, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(path, workLockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err == nil {
+		err = lockFile(lock)
+	}
+	if err != nil {
+		if lock != nil {
+			lock.Close()
+		}
+		os.RemoveAll(path)
+		return nil, err
+	}
+	return &workDir{path: path, lock: lock}, nil
+}
+
+// sweepWorkDir удаляет каталоги запусков, блокировка которых свободна:
+// их запуски завершились аварийно, а промежуточные файлы занимают место,
+// которое cleanup должен освобождать.
+func sweepWorkDir(base string) {
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		events.emit(EventWarning, "", base, "Ошибка чтения каталога промежуточных файлов %s: %v", base, err)
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(base, entry.Name())
+		lock, err := os.OpenFile(filepath.Join(dir, workLockName), os.O_RDWR, 0)
+		if os.IsNotExist(err) {
+			if info, err := entry.Info(); err != nil || time.Since(info.ModTime()) < workStaleAge {
+				continue
+			}
+		} else if err != nil {
+			continue
+		} else {
+			locked, err := tryLockFile(lock)
+			lock.Close()
+			if err != nil || !locked {
+				continue
+			}
+		}
+		size := dirSize(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			events.emit(EventWarning, "", dir, "Ошибка удаления промежуточных файлов прерванного запуска %s: %v", dir, err)
+			continue
+		}
+		events.emit(EventAction, "", dir, "Удалены промежуточные файлы прерванного запуска: %s (%s)", dir, formatBytes(size))
+	}
+}
+
+// dirSize возвращает объём файлов каталога.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// create создаёт промежуточный файл по шаблону os.CreateTemp. Без каталога
+// запуска (пробный запуск или work_dir недоступен) файл создаётся в fallback,
+// рядом с результатом.
+func (w *workDir) create(fallback, pattern string) (*os.File, error) {
+	if w == nil {
+		return os.CreateTemp(fallback, pattern)
+	}
+	return os.CreateTemp(w.path, pattern)
+}
+
+// close удаляет каталог запуска вместе с оставшимися в нём файлами.
+func (w *workDir) close() {
+	if w == nil {
+		return
+	}
+	unlockFile(w.lock)
+	w.lock.Close()
+	os.RemoveAll(w.path)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Классы приоритета ввода-вывода.
+const (
+	ioPriorityIdle   = "idle"   // только когда диск простаивает
+	ioPriorityLow    = "low"    // низший приоритет в обычном классе
+	ioPriorityNormal = "normal" // приоритет по умолчанию
+)
+
+// folderWorkers распределяет обработку файлов папки по нескольким потокам.
+// Без параллельности и без смены приоритета файлы обрабатываются
+// в вызывающей горутине.
+type folderWorkers struct {
+	res     *FolderResult
+	process func(*FolderResult, os.DirEntry)
+	jobs    chan os.DirEntry
+	parts   []FolderResult
+	wg      sync.WaitGroup
+}
+
+// startFolderWorkers запускает потоки обработки по правилам папки.
+// Каждый поток ведёт свой FolderResult, которые объединяются в wait.
+func startFolderWorkers(res *FolderResult, rule folderRule, process func(*FolderResult, os.DirEntry)) *folderWorkers {
+	w := &folderWorkers{res: res, process: progress.track(process)}
+	if rule.Concurrency <= 1 && rule.IOPriority == "" && rule.Nice == 0 {
+		return w
+	}
+	n := max(rule.Concurrency, 1)
+	w.jobs = make(chan os.DirEntry)
+	w.parts = make([]FolderResult, n)
+	var warnOnce sync.Once
+	for i := range w.parts {
+		w.parts[i] = FolderResult{Folder: res.Folder, DryRun: res.DryRun, discardKept: res.discardKept}
+		w.wg.Add(1)
+		go func(part *FolderResult) {
+			defer w.wg.Done()
+			if rule.IOPriority != "" || rule.Nice != 0 {
+				// Приоритет задаётся потоку ОС, поэтому горутина остаётся на нём
+				// до конца; поток не освобождается и завершается вместе с горутиной.
+				runtime.LockOSThread()
+				if err := setThreadPriority(rule.IOPriority, rule.Nice); err != nil {
+					warnOnce.Do(func() {
+						events.emit(EventWarning, res.Folder, "", "Папка %s: не удалось изменить приоритет: %v", res.Folder, err)
+					})
+				}
+			}
+			for entry := range w.jobs {
+				w.process(part, entry)
+			}
+		}(&w.parts[i])
+	}
+	return w
+}
+
+// submit передаёт файл на обработку.
+func (w *folderWorkers) submit(entry os.DirEntry) {
+	if w.jobs == nil {
+		w.process(w.res, entry)
+		return
+	}
+	w.jobs <- entry
+}
+
+// wait дожидается обработки переданных файлов и добавляет итоги потоков
+// к результату папки.
+func (w *folderWorkers) wait() {
+	if w.jobs == nil {
+		return
+	}
+	close(w.jobs)
+	w.wg.Wait()
+	for _, part := range w.parts {
+		w.res.merge(part)
+	}
+}
+
+// merge добавляет к результату папки счётчики и оставленные файлы из part.
+func (res *FolderResult) merge(part FolderResult) {
+	res.Deleted += part.Deleted
+	res.Skipped += part.Skipped
+	res.Errors += part.Errors
+	res.Freed += part.Freed
+	res.Future += part.Future
+	res.PermissionDenied += part.PermissionDenied
+	res.Planned += part.Planned
+	res.PlannedFreed += part.PlannedFreed
+	res.Tiered += part.Tiered
+	res.TieredBytes += part.TieredBytes
+	res.SoftDeleted += part.SoftDeleted
+	res.Quarantined += part.Quarantined
+	res.Archived += part.Archived
+	res.Moved += part.Moved
+	res.Compressed += part.Compressed
+	res.CompressedSaved += part.CompressedSaved
+	for reason, n := range part.SkipReasons {
+		if res.SkipReasons == nil {
+			res.SkipReasons = make(map[SkipReason]int)
+		}
+		res.SkipReasons[reason] += n
+	}
+	for code, n := range part.ErrorCodes {
+		if res.ErrorCodes == nil {
+			res.ErrorCodes = make(map[ErrorCode]int)
+		}
+		res.ErrorCodes[code] += n
+	}
+	res.Kept = append(res.Kept, part.Kept...)
+}
+
+// rateLimiter ограничивает число удалений в секунду; нулевой лимит — без ограничения.
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+// newRateLimiter создаёт ограничитель на perSecond удалений в секунду.
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{ticker: time.NewTicker(time.Duration(float64(time.Second) / perSecond))}
+}
+
+// wait ждёт, пока лимит позволит очередное удаление.
+func (l *rateLimiter) wait() {
+	if l.ticker != nil {
+		<-l.ticker.C
+	}
+}
+
+// stop освобождает таймер ограничителя.
+func (l *rateLimiter) stop() {
+	if l.ticker != nil {
+		l.ticker.Stop()
+	}
+}
+
+// validateThrottle проверяет параметры параллельности и приоритета.
+func validateThrottle(concurrency int, rateLimit float64, ioPriority string) error {
+	if concurrency < 1 {
+		return fmt.Errorf("concurrency должно быть не меньше 1")
+	}
+	if rateLimit < 0 {
+		return fmt.Errorf("rate_limit не может быть отрицательным")
+	}
+	switch ioPriority {
+	case "", ioPriorityIdle, ioPriorityLow, ioPriorityNormal:
+	default:
+		return fmt.Errorf("io_priority=%q: допустимы idle, low, normal", ioPriority)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs возвращает расширенные атрибуты файла; атрибуты, которые
+// прочитать не удалось, пропускаются.
+func readXattrs(path string) map[string][]byte {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size <= 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil
+	}
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := unix.Lgetxattr(path, string(name), nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = unix.Lgetxattr(path, string(name), value); err == nil {
+			attrs[string(name)] = value[:n]
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+// writeXattrs задаёт расширенные атрибуты файла, насколько позволяют права
+// и файловая система.
+func writeXattrs(path string, attrs map[string][]byte) {
+	for name, value := range attrs {
+		unix.Lsetxattr(path, name, value, 0)
+	}
+}
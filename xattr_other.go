@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+// readXattrs: расширенные атрибуты здесь не сохраняются.
+func readXattrs(path string) map[string][]byte {
+	return nil
+}
+
+// writeXattrs: расширенные атрибуты здесь не задаются.
+func writeXattrs(path string, attrs map[string][]byte) {}